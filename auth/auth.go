@@ -0,0 +1,352 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config lists the callers allowed to use the API. Each client authenticates
+// with its API key, or by signing requests with its signing secret (see
+// Authenticator.Middleware). With OIDC set, bearer tokens from that identity
+// provider are accepted too.
+type Config struct {
+	Clients []*Client   `json:"clients"`
+	OIDC    *OIDCConfig `json:"oidc"`
+	// MaxSkew bounds the age of a signed request, e.g. "5m".
+	MaxSkew string `json:"max_skew"`
+}
+
+type Client struct {
+	ID string `json:"id"`
+	// Tenant owns the client's async jobs.
+	Tenant string `json:"tenant"`
+	// Quota is the identity usage is metered against; defaults to ID.
+	Quota string `json:"quota"`
+	// Scopes limit the routes the client may call, e.g. "convert:write" or
+	// "jobs:*". A client configured without scopes may call everything but
+	// the admin API, which needs an explicit admin scope ("admin.*").
+	Scopes           []string `json:"scopes"`
+	APIKey           string   `json:"api_key"`
+	APIKeyEnv        string   `json:"api_key_env"`
+	SigningSecret    string   `json:"signing_secret"`
+	SigningSecretEnv string   `json:"signing_secret_env"`
+
+	// Claims are the token's claims for callers authenticated by an OIDC
+	// token, nil for configured clients.
+	Claims map[string]interface{} `json:"-"`
+}
+
+// Load reads the clients file at path, if any. oidc, when set, is the
+// identity provider to accept tokens from unless the file names one.
+func Load(path string, oidc *OIDCConfig) (*Authenticator, error) {
+	var cfg Config
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("invalid auth config %s: %v", path, err)
+		}
+	}
+	if cfg.OIDC == nil {
+		cfg.OIDC = oidc
+	}
+
+	var err error
+	a := &Authenticator{
+		clients: map[string]*Client{},
+		skew:    5 * time.Minute,
+		nonces:  map[string]time.Time{},
+	}
+	if cfg.MaxSkew != "" {
+		if a.skew, err = time.ParseDuration(cfg.MaxSkew); err != nil || a.skew <= 0 {
+			return nil, fmt.Errorf("auth config: invalid max_skew %q", cfg.MaxSkew)
+		}
+	}
+	for i, c := range cfg.Clients {
+		if c.APIKeyEnv != "" {
+			c.APIKey = os.Getenv(c.APIKeyEnv)
+		}
+		if c.SigningSecretEnv != "" {
+			c.SigningSecret = os.Getenv(c.SigningSecretEnv)
+		}
+		if c.ID == "" {
+			return nil, fmt.Errorf("auth config: client %d has no id", i+1)
+		}
+		if a.clients[c.ID] != nil {
+			return nil, fmt.Errorf("auth config: duplicate client id %q", c.ID)
+		}
+		if c.APIKey == "" && c.SigningSecret == "" {
+			return nil, fmt.Errorf("auth config: client %q has neither an api key nor a signing secret", c.ID)
+		}
+		if c.Quota == "" {
+			c.Quota = c.ID
+		}
+		a.clients[c.ID] = c
+	}
+	if cfg.OIDC != nil {
+		if a.oidc, err = newOIDCVerifier(*cfg.OIDC); err != nil {
+			return nil, fmt.Errorf("auth config: %v", err)
+		}
+	}
+	if len(a.clients) == 0 && a.oidc == nil {
+		return nil, fmt.Errorf("auth config %q: no clients and no oidc provider", path)
+	}
+	return a, nil
+}
+
+// Authenticator checks API keys, OIDC tokens and request signatures.
+type Authenticator struct {
+	clients map[string]*Client
+	skew    time.Duration
+	oidc    *oidcVerifier
+
+	mu        sync.Mutex
+	nonces    map[string]time.Time // client/nonce -> when it may be forgotten
+	lastSweep time.Time
+}
+
+// Allows reports whether one of the client's scopes, which may be globs,
+// grants scope. Clients without a scope list are unrestricted.
+func (c *Client) Allows(scope string) bool {
+	if c.Scopes == nil {
+		return true
+	}
+	for _, granted := range c.Scopes {
+		if ok, _ := path.Match(granted, scope); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// FromContext returns the authenticated client, or nil when authentication
+// is off.
+func FromContext(ctx context.Context) *Client {
+	c, _ := ctx.Value(contextKey{}).(*Client)
+	return c
+}
+
+// Tenant is the authenticated client's tenant, or "".
+func Tenant(ctx context.Context) string {
+	if c := FromContext(ctx); c != nil {
+		return c.Tenant
+	}
+	return ""
+}
+
+// Claim is a claim of the caller's token, looked up by a dotted path such as
+// "org.id", as a string; "" when absent or not a token caller. Handlers use
+// it for per-tenant behavior beyond the tenant claim.
+func Claim(ctx context.Context, path string) string {
+	if c := FromContext(ctx); c != nil && c.Claims != nil {
+		return claimString(c.Claims, path)
+	}
+	return ""
+}
+
+// Middleware admits requests carrying either
+//   - an API key, as "Authorization: Bearer <key>" or "X-API-Key: <key>",
+//   - an OIDC access token, as "Authorization: Bearer <JWT>", or
+//   - a signature: X-Client-ID, X-Timestamp (unix seconds), X-Nonce and
+//     X-Signature: sha256=<hex HMAC-SHA256 of the string to sign>, keyed with
+//     the client's signing secret. The string to sign is
+//     METHOD "\n" request URI "\n" timestamp "\n" nonce "\n" hex SHA-256 of the body.
+//
+// Signed requests older than the allowed skew, or reusing a nonce, are
+// refused so a captured request cannot be replayed. The body, at most
+// maxBody(client) bytes, is spooled to disk and hashed before the handler
+// runs. Signers may also send the body's hash as X-Content-SHA256, so a
+// bad signature is refused before the body is read.
+//
+// The caller must also hold scope (see Client.Allows); "" needs none.
+func (a *Authenticator) Middleware(scope string, maxBody func(*Client) int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var client *Client
+		var err error
+		if r.Header.Get("X-Signature") != "" {
+			var done func()
+			client, done, err = a.verifySignature(r, maxBody)
+			if done != nil {
+				defer done()
+			}
+		} else {
+			client, err = a.verifyKey(r)
+		}
+		if err != nil {
+			log.Printf("Auth: %s %s from %s refused: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			w.Header().Set("X-Error-Code", "unauthenticated")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if scope != "" && !client.Allows(scope) {
+			log.Printf("Auth: client %s lacks scope %s for %s %s", client.ID, scope, r.Method, r.URL.Path)
+			w.Header().Set("X-Error-Code", "insufficient_scope")
+			http.Error(w, fmt.Sprintf("Missing scope %q", scope), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, client)))
+	})
+}
+
+func (a *Authenticator) verifyKey(r *http.Request) (*Client, error) {
+	key := r.Header.Get("X-API-Key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		key = strings.TrimSpace(bearer)
+	}
+	if key == "" {
+		return nil, errors.New("missing API key or request signature")
+	}
+	if a.oidc != nil && looksLikeJWT(key) {
+		return a.oidc.verify(key)
+	}
+	for _, c := range a.clients {
+		if c.APIKey != "" && subtle.ConstantTimeCompare([]byte(c.APIKey), []byte(key)) == 1 {
+			return c, nil
+		}
+	}
+	return nil, errors.New("invalid API key")
+}
+
+// verifySignature checks a signed request. The timestamp and nonce are
+// checked before anything is read, and with X-Content-SHA256 the signature
+// too. The body, at most maxBody(client) bytes, is then spooled to a temp
+// file to hash it and replayed to the handler; done removes the file.
+func (a *Authenticator) verifySignature(r *http.Request, maxBody func(*Client) int64) (client *Client, done func(), err error) {
+	client = a.clients[r.Header.Get("X-Client-ID")]
+	if client == nil || client.SigningSecret == "" {
+		return nil, nil, errors.New("unknown client")
+	}
+	sig, ok := strings.CutPrefix(r.Header.Get("X-Signature"), "sha256=")
+	if !ok {
+		return nil, nil, errors.New("signature must be sha256=<hex>")
+	}
+	given, err := hex.DecodeString(sig)
+	if err != nil {
+		return nil, nil, errors.New("signature must be sha256=<hex>")
+	}
+	timestamp := r.Header.Get("X-Timestamp")
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, nil, errors.New("invalid X-Timestamp")
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > a.skew || age < -a.skew {
+		return nil, nil, errors.New("request timestamp outside the allowed window")
+	}
+	nonce := r.Header.Get("X-Nonce")
+	if nonce == "" || len(nonce) > 128 {
+		return nil, nil, errors.New("missing X-Nonce")
+	}
+	nonceKey := client.ID + "/" + nonce
+	if a.nonceUsed(nonceKey) {
+		return nil, nil, errors.New("nonce already used")
+	}
+
+	signed := func(bodyHash string) bool {
+		mac := hmac.New(sha256.New, []byte(client.SigningSecret))
+		fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", r.Method, r.URL.RequestURI(), timestamp, nonce, bodyHash)
+		return hmac.Equal(given, mac.Sum(nil))
+	}
+	declared := strings.ToLower(r.Header.Get("X-Content-SHA256"))
+	if declared != "" && !signed(declared) {
+		return nil, nil, errors.New("signature mismatch")
+	}
+	if done, err = spoolBody(r, maxBody(client)); err != nil {
+		return nil, done, err
+	}
+	bodyHash := hex.EncodeToString(r.Body.(*spooledBody).sum)
+	if declared != "" && declared != bodyHash {
+		return nil, done, errors.New("body does not match X-Content-SHA256")
+	}
+	if declared == "" && !signed(bodyHash) {
+		return nil, done, errors.New("signature mismatch")
+	}
+	// Only remember nonces of valid signatures, so forgeries can't burn them
+	if !a.useNonce(nonceKey, time.Unix(ts, 0)) {
+		return nil, done, errors.New("nonce already used")
+	}
+	return client, done, nil
+}
+
+// spoolBody replaces r's body, of at most maxBytes, with a hashed copy on
+// disk; done removes it.
+func spoolBody(r *http.Request, maxBytes int64) (done func(), err error) {
+	if r.ContentLength > maxBytes {
+		return nil, errors.New("signed body too large")
+	}
+	spool, err := os.CreateTemp("", "signed-body-*")
+	if err != nil {
+		return nil, fmt.Errorf("spooling body: %v", err)
+	}
+	done = func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(spool, hash), io.LimitReader(r.Body, maxBytes+1))
+	r.Body.Close()
+	if err != nil {
+		return done, fmt.Errorf("reading body: %v", err)
+	}
+	if n > maxBytes {
+		return done, errors.New("signed body too large")
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return done, fmt.Errorf("spooling body: %v", err)
+	}
+	r.Body = &spooledBody{File: spool, sum: hash.Sum(nil)}
+	return done, nil
+}
+
+// spooledBody is a signed body spooled to disk, with its SHA-256.
+type spooledBody struct {
+	*os.File
+	sum []byte
+}
+
+// nonceUsed reports whether a nonce was recorded and can't be reused yet.
+func (a *Authenticator) nonceUsed(key string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	until, ok := a.nonces[key]
+	return ok && time.Now().Before(until)
+}
+
+// useNonce records a nonce until its request could no longer pass the
+// timestamp check, reporting false if it was already recorded.
+func (a *Authenticator) useNonce(key string, signedAt time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	if now.Sub(a.lastSweep) > a.skew {
+		for k, until := range a.nonces {
+			if now.After(until) {
+				delete(a.nonces, k)
+			}
+		}
+		a.lastSweep = now
+	}
+	if until, ok := a.nonces[key]; ok && now.Before(until) {
+		return false
+	}
+	a.nonces[key] = signedAt.Add(a.skew)
+	return true
+}
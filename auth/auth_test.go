@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedRequests(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "clients.json")
+	config := `{"clients": [{"id": "signer", "signing_secret": "secret"}]}`
+	if err := os.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := Load(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := a.Middleware("", func(*Client) int64 { return 16 }, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+
+	// signed signs body with nonce; declare sends its hash as
+	// X-Content-SHA256, and sent replaces the body actually sent
+	signed := func(body, nonce string, declare bool, sent string) int {
+		sum := sha256.Sum256([]byte(body))
+		bodyHash := hex.EncodeToString(sum[:])
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		fmt.Fprintf(mac, "POST\n/convert\n%s\n%s\n%s", timestamp, nonce, bodyHash)
+
+		r := httptest.NewRequest(http.MethodPost, "/convert", strings.NewReader(sent))
+		r.Header.Set("X-Client-ID", "signer")
+		r.Header.Set("X-Timestamp", timestamp)
+		r.Header.Set("X-Nonce", nonce)
+		r.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		if declare {
+			r.Header.Set("X-Content-SHA256", bodyHash)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	small, large := "small body", strings.Repeat("x", 100)
+	for _, tc := range []struct {
+		name    string
+		body    string
+		nonce   string
+		declare bool
+		sent    string
+		want    int
+	}{
+		{"spooled", small, "n1", false, small, http.StatusOK},
+		{"replayed nonce", small, "n1", false, small, http.StatusUnauthorized},
+		{"spooled, tampered", small, "n2", false, "other body", http.StatusUnauthorized},
+		{"spooled, over the limit", large, "n3", false, large, http.StatusUnauthorized},
+		{"declared hash", small, "n4", true, small, http.StatusOK},
+		{"declared hash, over the limit", large, "n5", true, large, http.StatusUnauthorized},
+		{"declared hash, tampered", small, "n6", true, "other body", http.StatusUnauthorized},
+		{"declared hash, after a tampered body", small, "n6", true, small, http.StatusOK},
+	} {
+		if got := signed(tc.body, tc.nonce, tc.declare, tc.sent); got != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
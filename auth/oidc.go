@@ -0,0 +1,368 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCConfig validates bearer tokens issued by an OpenID Connect provider.
+type OIDCConfig struct {
+	Issuer string `json:"issuer"`
+	// Audience must appear in the token's aud claim.
+	Audience string `json:"audience"`
+	// JWKSURL is discovered from the issuer's openid-configuration when empty.
+	JWKSURL string `json:"jwks_url"`
+	// TenantClaim and QuotaClaim name the claims (dotted paths for nested
+	// objects) mapped to the client's tenant and quota identity. They default
+	// to "tenant" and "sub".
+	TenantClaim string `json:"tenant_claim"`
+	QuotaClaim  string `json:"quota_claim"`
+	// JWKSCacheTTL is how long fetched signing keys are trusted, e.g. "1h".
+	JWKSCacheTTL string `json:"jwks_cache_ttl"`
+}
+
+// Tolerated clock difference with the identity provider.
+const tokenLeeway = time.Minute
+
+// Unknown key IDs refetch the key set at most this often, so garbage tokens
+// can't hammer the provider.
+const jwksMinRefresh = time.Minute
+
+type oidcVerifier struct {
+	cfg    OIDCConfig
+	ttl    time.Duration
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func newOIDCVerifier(cfg OIDCConfig) (*oidcVerifier, error) {
+	if cfg.Issuer == "" || cfg.Audience == "" {
+		return nil, errors.New("oidc needs an issuer and an audience")
+	}
+	if cfg.TenantClaim == "" {
+		cfg.TenantClaim = "tenant"
+	}
+	if cfg.QuotaClaim == "" {
+		cfg.QuotaClaim = "sub"
+	}
+	v := &oidcVerifier{cfg: cfg, ttl: time.Hour, client: &http.Client{Timeout: 10 * time.Second}}
+	if cfg.JWKSCacheTTL != "" {
+		ttl, err := time.ParseDuration(cfg.JWKSCacheTTL)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("oidc: invalid jwks_cache_ttl %q", cfg.JWKSCacheTTL)
+		}
+		v.ttl = ttl
+	}
+	return v, nil
+}
+
+// looksLikeJWT tells tokens apart from API keys.
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && strings.HasPrefix(token, "eyJ")
+}
+
+// verify checks the token's signature and registered claims and maps it to
+// a client.
+func (v *oidcVerifier) verify(token string) (*Client, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWS(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %v", err)
+	}
+	if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+		return nil, fmt.Errorf("token issuer %q not accepted", iss)
+	}
+	if !audienceContains(claims["aud"], v.cfg.Audience) {
+		return nil, errors.New("token audience mismatch")
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(tokenLeeway)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(tokenLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not yet valid")
+	}
+
+	sub := claimString(claims, "sub")
+	if sub == "" {
+		return nil, errors.New("token has no subject")
+	}
+	client := &Client{
+		ID:     sub,
+		Tenant: claimString(claims, v.cfg.TenantClaim),
+		Quota:  claimString(claims, v.cfg.QuotaClaim),
+		Scopes: tokenScopes(claims),
+		Claims: claims,
+	}
+	if client.Quota == "" {
+		client.Quota = sub
+	}
+	return client, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func audienceContains(aud interface{}, want string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == want
+	case []interface{}:
+		for _, v := range a {
+			if s, _ := v.(string); s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tokenScopes reads the space separated "scope" claim, or the "scp" array
+// some providers use. Tokens never get unrestricted access: a token without
+// scopes may call nothing that needs one.
+func tokenScopes(claims map[string]interface{}) []string {
+	scopes := []string{}
+	if s, ok := claims["scope"].(string); ok {
+		scopes = append(scopes, strings.Fields(s)...)
+	}
+	if list, ok := claims["scp"].([]interface{}); ok {
+		for _, v := range list {
+			if s, ok := v.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	return scopes
+}
+
+// claimString looks up a dotted claim path, e.g. "org.id".
+func claimString(claims map[string]interface{}, path string) string {
+	var v interface{} = claims
+	for _, name := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = obj[name]
+	}
+	switch s := v.(type) {
+	case string:
+		return s
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	}
+	return ""
+}
+
+func verifyJWS(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg[min(len(alg), 2):] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+	var digest []byte
+	switch hash {
+	case crypto.SHA256:
+		sum := sha256.Sum256([]byte(signed))
+		digest = sum[:]
+	case crypto.SHA384:
+		sum := sha512.Sum384([]byte(signed))
+		digest = sum[:]
+	default:
+		sum := sha512.Sum512([]byte(signed))
+		digest = sum[:]
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			if rsa.VerifyPKCS1v15(k, hash, digest, signature) == nil {
+				return nil
+			}
+		case "PS":
+			if rsa.VerifyPSS(k, hash, digest, signature, nil) == nil {
+				return nil
+			}
+		default:
+			return fmt.Errorf("algorithm %q does not match the RSA key", alg)
+		}
+	case *ecdsa.PublicKey:
+		if alg[:2] != "ES" {
+			return fmt.Errorf("algorithm %q does not match the EC key", alg)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if ecdsa.Verify(k, digest, r, s) {
+			return nil
+		}
+	default:
+		return errors.New("unsupported signing key")
+	}
+	return errors.New("invalid token signature")
+}
+
+// key returns the signing key kid from the cached key set, refetching it
+// when stale or when kid is unknown (the provider may have rotated keys).
+func (v *oidcVerifier) key(kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	age := time.Since(v.fetchedAt)
+	key, known := v.keys[kid]
+	if age > v.ttl || (!known && age > jwksMinRefresh) {
+		keys, err := v.fetchKeys()
+		if err != nil {
+			if known {
+				// Keep using the stale key set while the provider is down
+				return key, nil
+			}
+			return nil, fmt.Errorf("fetching signing keys: %v", err)
+		}
+		v.keys, v.fetchedAt = keys, time.Now()
+		key, known = v.keys[kid]
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (v *oidcVerifier) fetchKeys() (map[string]crypto.PublicKey, error) {
+	jwksURL := v.cfg.JWKSURL
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(strings.TrimSuffix(v.cfg.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, err
+		}
+		if discovery.JWKSURI == "" {
+			return nil, errors.New("provider metadata has no jwks_uri")
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := v.getJSON(jwksURL, &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("key set has no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (v *oidcVerifier) getJSON(url string, out interface{}) error {
+	resp, err := v.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,448 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds deployment settings read from the environment at startup.
+type Config struct {
+	// Engines limits which compiled-in engines are started, e.g.
+	// "poppler,ghostscript". Empty starts everything the binary was built with.
+	Engines []string
+
+	// RenderBackend is "cpu" (pdftoppm) or "gpu" for PDF -> image, which
+	// runs on the gpu engine and falls back to the CPU when the GPU
+	// renderer is missing or fails.
+	RenderBackend string
+	// OperationEngines picks the engine for operations more than one engine
+	// can run: "render" (PDF -> image) and "extract-text", e.g.
+	// "render=mupdf,extract-text=mupdf". Unset operations use the default.
+	OperationEngines map[string]string
+	// ParallelRenderPages is the page count from which a PDF -> image
+	// render is split into page ranges rendered side by side on idle
+	// Poppler workers. 0 always renders in one pdftoppm run.
+	ParallelRenderPages int
+	// QueueWait is how long a request waits for room in a full engine
+	// queue before it is refused with 503.
+	QueueWait time.Duration
+
+	// ServeUI mounts the embedded web UI at /.
+	ServeUI bool
+	// DocsAssetsURL is where the API docs page (/docs) loads Swagger UI
+	// (the swagger-ui-dist package) from. Point it at a self-hosted copy
+	// where browsers can't reach the CDN.
+	DocsAssetsURL string
+
+	// Object stores reachable through the S3 API. GCS is accessed through
+	// its XML API with HMAC interoperability keys.
+	S3  ObjectStore
+	GCS ObjectStore
+	// Azure is Azure Blob Storage, accessed with a shared account key.
+	Azure AzureStore
+	// StorageURLSecret signs URLs of the "local" storage provider, which
+	// the API serves itself. They are refused while it is empty.
+	StorageURLSecret string
+
+	Ingest Ingest
+
+	// Policy switches operations off for this deployment.
+	Policy Policy
+
+	// AuthConfig points to a JSON list of API clients. The API is open when
+	// empty, unless OIDC is set.
+	AuthConfig string
+	// OIDC accepts bearer tokens from an identity provider, with or without
+	// AuthConfig. An "oidc" entry in AuthConfig takes precedence.
+	OIDC OIDC
+	// QuotaConfig points to a JSON description of per-caller request limits.
+	QuotaConfig string
+	// QuotaRedisURL keeps the quota counters in Redis (redis:// or
+	// rediss://), shared by all replicas, instead of in each one's memory.
+	QuotaRedisURL string
+	// LimitsConfig points to a JSON file of upload size limits per
+	// operation and tenant, overriding the built-in ones.
+	LimitsConfig string
+	// HooksConfig points to a JSON list of post-processing hooks run on
+	// every artifact before it is served or stored.
+	HooksConfig string
+
+	// Events such as quota warnings and job progress are logged and, with
+	// EventsWebhookURL, POSTed there signed with EventsWebhookSecret.
+	EventsWebhookURL    string
+	EventsWebhookSecret string
+	// EventsKafkaURL is a Kafka REST proxy; events are published to
+	// EventsKafkaTopic through it.
+	EventsKafkaURL   string
+	EventsKafkaTopic string
+	// EventsAudit adds an audit event for every API request.
+	EventsAudit bool
+
+	// RulesConfig points to a JSON file of content-based routing rules.
+	RulesConfig string
+
+	// DataDir holds state that outlives a request, such as async job results.
+	DataDir string
+	// ManualMigrations stops the service from upgrading DataDir's layout
+	// at startup; it refuses to start until "migrate" has been run.
+	ManualMigrations bool
+	// Maintenance starts the service in read-only maintenance mode (see
+	// POST /admin/maintenance).
+	Maintenance bool
+	// LeaderElection runs background work (job janitor, expiry notices,
+	// ingest pollers) only on the instance holding a lease in DataDir, for
+	// active-passive deployments sharing it. InstanceID names this instance
+	// (default host name and PID), also as the owner of the async jobs it
+	// runs; the lease lapses LeaseTTL after the
+	// leader stops renewing it.
+	LeaderElection bool
+	InstanceID     string
+	LeaseTTL       time.Duration
+	// ResultTTL is how long async job results are kept.
+	ResultTTL time.Duration
+	// ResultCompression stores results compressed at rest: "zstd" (falls
+	// back to gzip without the zstd CLI), "gzip" or empty for none.
+	ResultCompression string
+	// TagResultFilenames appends the request or job ID to download names,
+	// e.g. "merged-<id>.pdf", to trace files users send back to the logs.
+	TagResultFilenames bool
+	// PublicBaseURL is used for links handed to third parties, e.g.
+	// "https://convert.example.com". Derived from the request when empty.
+	PublicBaseURL string
+
+	// NotifyConfig points to a JSON description of per-tenant webhook and
+	// email targets warned NotifyBefore results expire.
+	NotifyConfig string
+	NotifyBefore time.Duration
+
+	Slack Slack
+	Teams Teams
+
+	Uploads   Uploads
+	Outputs   Outputs
+	SourceURL SourceURL
+	Proofs    Proofs
+	Links     Links
+}
+
+// Uploads configures direct-to-object-storage uploads via presigned URLs.
+type Uploads struct {
+	// Provider is "local", "s3", "gcs" or "azure"; Bucket receives the
+	// uploads. Presigning is disabled when Bucket is empty.
+	Provider string
+	Bucket   string
+	// URLTTL is how long a presigned upload URL stays valid.
+	URLTTL time.Duration
+	// MaxBytes bounds uploads that /convert will fetch.
+	MaxBytes int64
+	// ResumableTTL is how long a resumable (tus) upload may take, from its
+	// creation, before its parts are discarded.
+	ResumableTTL time.Duration
+}
+
+// Outputs configures handing large multi-file results (such as split
+// chunks) out as presigned object storage URLs instead of one zip. Objects
+// are not deleted by the server; give the bucket a lifecycle rule.
+type Outputs struct {
+	// Provider is "local", "s3", "gcs" or "azure". Storage delivery is
+	// disabled when Bucket is empty.
+	Provider string
+	Bucket   string
+	// URLTTL is how long the presigned download URLs stay valid.
+	URLTTL time.Duration
+}
+
+// SourceURL configures fetching inputs from a source_url instead of an
+// upload.
+type SourceURL struct {
+	// Timeout bounds each download, connecting included.
+	Timeout time.Duration
+	// PrivateHosts may resolve to private, loopback or link-local
+	// addresses, which are refused for every other host. They apply to
+	// the Slack, Teams and simple API downloads too.
+	PrivateHosts []string
+}
+
+// Links configures results kept for later download (delivery=link) behind
+// signed GET /download/{token} URLs.
+type Links struct {
+	// TTL is how long a result is kept when the request doesn't ask;
+	// link_ttl may ask for up to MaxTTL.
+	TTL    time.Duration
+	MaxTTL time.Duration
+	// Secret signs the tokens. A random one is used when empty, so links
+	// stop working when the process restarts.
+	Secret string
+}
+
+// Proofs configures soft-proofed previews (see /preview/proof).
+type Proofs struct {
+	// ProfilesDir holds the CMYK press profiles proofs may simulate, e.g.
+	// fogra39.icc. Each is selected by its file name without extension.
+	ProfilesDir string
+	// ScreenProfile is the RGB profile proofs are displayed in, sRGB.
+	ScreenProfile string
+}
+
+type Slack struct {
+	SigningSecret string
+	// BotToken (xoxb-...) downloads shared files and uploads results back.
+	BotToken string
+}
+
+type Teams struct {
+	// WebhookSecret is the base64 HMAC key of the Teams outgoing webhook.
+	WebhookSecret string
+	// DownloadHosts are host suffixes file attachments may be fetched from.
+	DownloadHosts []string
+}
+
+// Policy lists operation names (see handlers.Routes), or globs of them,
+// that are allowed or denied.
+type Policy struct {
+	Allow []string
+	Deny  []string
+}
+
+// OIDC names the identity provider whose JWTs authenticate API callers.
+// It is off while Issuer is empty.
+type OIDC struct {
+	Issuer   string
+	Audience string
+	// JWKSURL is discovered from the issuer when empty.
+	JWKSURL string
+	// TenantClaim and QuotaClaim map token claims (dotted paths) to the
+	// caller's tenant and quota identity, by default "tenant" and "sub".
+	TenantClaim  string
+	QuotaClaim   string
+	JWKSCacheTTL time.Duration
+}
+
+// ObjectStore holds credentials for an S3-compatible endpoint.
+type ObjectStore struct {
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+func (o ObjectStore) Configured() bool {
+	return o.AccessKeyID != "" && o.SecretAccessKey != ""
+}
+
+// AzureStore holds an Azure storage account's name and base64 shared key.
+// Endpoint defaults to https://<account>.blob.core.windows.net.
+type AzureStore struct {
+	Account  string
+	Key      string
+	Endpoint string
+}
+
+func (a AzureStore) Configured() bool {
+	return a.Account != "" && a.Key != ""
+}
+
+// Ingest configures event-driven conversions.
+type Ingest struct {
+	// WebhookToken must be supplied as ?token= or X-Ingest-Token. The
+	// webhook is disabled when empty.
+	WebhookToken string
+	// Pipeline runs on every ingested object, e.g. "convert:pdf,compress".
+	Pipeline string
+	// OutputSuffix is appended to the result's base name. Objects already
+	// carrying the suffix are ignored so results don't retrigger the hook.
+	OutputSuffix string
+	// SFTPConfig points to a JSON list of SFTP inboxes to poll.
+	SFTPConfig string
+	// IMAPConfig points to a JSON mailbox + attachment rules description.
+	IMAPConfig string
+}
+
+func Load() *Config {
+	return &Config{
+		Engines:             list("ENGINES"),
+		RenderBackend:       strings.ToLower(str("RENDER_BACKEND", "cpu")),
+		OperationEngines:    pairs("OPERATION_ENGINES"),
+		ParallelRenderPages: number("RENDER_PARALLEL_PAGES", 16),
+		QueueWait:           duration("QUEUE_WAIT", 10*time.Second),
+		ServeUI:             flag("SERVE_UI"),
+		DocsAssetsURL:       strings.TrimSuffix(str("DOCS_ASSETS_URL", "https://unpkg.com/swagger-ui-dist@5"), "/"),
+		S3: ObjectStore{
+			Endpoint:        str("S3_ENDPOINT", "https://s3."+str("S3_REGION", "us-east-1")+".amazonaws.com"),
+			Region:          str("S3_REGION", "us-east-1"),
+			AccessKeyID:     str("S3_ACCESS_KEY_ID", os.Getenv("AWS_ACCESS_KEY_ID")),
+			SecretAccessKey: str("S3_SECRET_ACCESS_KEY", os.Getenv("AWS_SECRET_ACCESS_KEY")),
+			SessionToken:    str("S3_SESSION_TOKEN", os.Getenv("AWS_SESSION_TOKEN")),
+		},
+		GCS: ObjectStore{
+			Endpoint:        str("GCS_ENDPOINT", "https://storage.googleapis.com"),
+			Region:          "auto",
+			AccessKeyID:     os.Getenv("GCS_HMAC_ACCESS_KEY"),
+			SecretAccessKey: os.Getenv("GCS_HMAC_SECRET"),
+		},
+		Azure: AzureStore{
+			Account:  os.Getenv("AZURE_STORAGE_ACCOUNT"),
+			Key:      os.Getenv("AZURE_STORAGE_KEY"),
+			Endpoint: str("AZURE_STORAGE_ENDPOINT", "https://"+os.Getenv("AZURE_STORAGE_ACCOUNT")+".blob.core.windows.net"),
+		},
+		StorageURLSecret: os.Getenv("STORAGE_URL_SECRET"),
+		Ingest: Ingest{
+			WebhookToken: os.Getenv("INGEST_WEBHOOK_TOKEN"),
+			Pipeline:     str("INGEST_PIPELINE", "convert:pdf"),
+			OutputSuffix: str("INGEST_OUTPUT_SUFFIX", "-processed"),
+			SFTPConfig:   os.Getenv("SFTP_CONFIG"),
+			IMAPConfig:   os.Getenv("IMAP_CONFIG"),
+		},
+		Policy: Policy{
+			Allow: list("OPERATIONS_ALLOW"),
+			Deny:  list("OPERATIONS_DENY"),
+		},
+		AuthConfig: os.Getenv("AUTH_CONFIG"),
+		OIDC: OIDC{
+			Issuer:       os.Getenv("OIDC_ISSUER"),
+			Audience:     os.Getenv("OIDC_AUDIENCE"),
+			JWKSURL:      os.Getenv("OIDC_JWKS_URL"),
+			TenantClaim:  os.Getenv("OIDC_TENANT_CLAIM"),
+			QuotaClaim:   os.Getenv("OIDC_QUOTA_CLAIM"),
+			JWKSCacheTTL: duration("OIDC_JWKS_CACHE_TTL", time.Hour),
+		},
+		QuotaConfig:         os.Getenv("QUOTA_CONFIG"),
+		QuotaRedisURL:       os.Getenv("QUOTA_REDIS_URL"),
+		LimitsConfig:        os.Getenv("LIMITS_CONFIG"),
+		HooksConfig:         os.Getenv("HOOKS_CONFIG"),
+		EventsWebhookURL:    os.Getenv("EVENTS_WEBHOOK_URL"),
+		EventsWebhookSecret: os.Getenv("EVENTS_WEBHOOK_SECRET"),
+		EventsKafkaURL:      os.Getenv("EVENTS_KAFKA_REST_URL"),
+		EventsKafkaTopic:    str("EVENTS_KAFKA_TOPIC", "docconv-events"),
+		EventsAudit:         flag("EVENTS_AUDIT"),
+		RulesConfig:         os.Getenv("RULES_CONFIG"),
+		DataDir:             str("DATA_DIR", "data"),
+		ManualMigrations:    flag("MANUAL_MIGRATIONS"),
+		Maintenance:         flag("MAINTENANCE_MODE"),
+		LeaderElection:      flag("LEADER_ELECTION"),
+		InstanceID:          str("INSTANCE_ID", instanceID()),
+		LeaseTTL:            duration("LEADER_LEASE_TTL", 30*time.Second),
+		ResultTTL:           duration("RESULT_TTL", 24*time.Hour),
+		ResultCompression:   strings.ToLower(os.Getenv("RESULT_COMPRESSION")),
+		PublicBaseURL:       os.Getenv("PUBLIC_BASE_URL"),
+		NotifyConfig:        os.Getenv("NOTIFY_CONFIG"),
+		NotifyBefore:        duration("NOTIFY_BEFORE", 2*time.Hour),
+		Slack: Slack{
+			SigningSecret: os.Getenv("SLACK_SIGNING_SECRET"),
+			BotToken:      os.Getenv("SLACK_BOT_TOKEN"),
+		},
+		Teams: Teams{
+			WebhookSecret: os.Getenv("TEAMS_WEBHOOK_SECRET"),
+			DownloadHosts: listOr("TEAMS_DOWNLOAD_HOSTS", []string{"sharepoint.com", "sharepoint.us"}),
+		},
+		Uploads: Uploads{
+			Provider:     str("UPLOAD_PROVIDER", "s3"),
+			Bucket:       os.Getenv("UPLOAD_BUCKET"),
+			URLTTL:       duration("UPLOAD_URL_TTL", 15*time.Minute),
+			MaxBytes:     bytes("UPLOAD_MAX_BYTES", 2<<30),
+			ResumableTTL: duration("UPLOAD_RESUMABLE_TTL", 24*time.Hour),
+		},
+		Outputs: Outputs{
+			Provider: str("OUTPUT_PROVIDER", "s3"),
+			Bucket:   os.Getenv("OUTPUT_BUCKET"),
+			URLTTL:   duration("OUTPUT_URL_TTL", time.Hour),
+		},
+		SourceURL: SourceURL{
+			Timeout:      duration("SOURCE_URL_TIMEOUT", time.Minute),
+			PrivateHosts: list("SOURCE_URL_PRIVATE_HOSTS"),
+		},
+		Links: Links{
+			TTL:    duration("DOWNLOAD_LINK_TTL", time.Hour),
+			MaxTTL: duration("DOWNLOAD_LINK_MAX_TTL", 7*24*time.Hour),
+			Secret: os.Getenv("DOWNLOAD_LINK_SECRET"),
+		},
+		Proofs: Proofs{
+			ProfilesDir:   str("ICC_PROFILES_DIR", "icc"),
+			ScreenProfile: str("ICC_SCREEN_PROFILE", "/usr/share/color/icc/ghostscript/srgb.icc"),
+		},
+	}
+}
+
+// duration reads a Go duration ("90s", "24h") with a default.
+func duration(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return def
+}
+
+// bytes reads a byte count with a default.
+func bytes(key string, def int64) int64 {
+	if n, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+// number reads a non-negative integer with a default.
+func number(key string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n >= 0 {
+		return n
+	}
+	return def
+}
+
+// listOr is list with a default for an unset variable.
+func listOr(key string, def []string) []string {
+	if v := list(key); len(v) > 0 {
+		return v
+	}
+	return def
+}
+
+// pairs reads a list of key=value entries, e.g. "render=mupdf,x=y".
+func pairs(key string) map[string]string {
+	out := map[string]string{}
+	for _, entry := range list(key) {
+		if k, v, ok := strings.Cut(entry, "="); ok && k != "" && v != "" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// str reads an environment variable with a default.
+func str(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// instanceID is the default INSTANCE_ID, "<host name>-<pid>".
+func instanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "instance"
+	}
+	return host + "-" + strconv.Itoa(os.Getpid())
+}
+
+// flag reads a boolean environment variable ("1", "true", "yes").
+func flag(key string) bool {
+	switch strings.ToLower(os.Getenv(key)) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// list reads a comma or space separated environment variable.
+func list(key string) []string {
+	var out []string
+	fields := strings.FieldsFunc(os.Getenv(key), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	for _, v := range fields {
+		out = append(out, strings.ToLower(v))
+	}
+	return out
+}
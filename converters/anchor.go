@@ -0,0 +1,166 @@
+package converters
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TextBox is where some text sits on a page, in PDF points from the
+// bottom-left of the page.
+type TextBox struct {
+	Page   int     `json:"page"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Poppler (pdftotext -bbox): Every occurrence of text, such as an anchor
+// marker like "{{sign_here}}". Words are joined with single spaces per page,
+// so text may span words; a match covers the words it touches.
+func FindText(inputPath, text string) ([]TextBox, error) {
+	pages, err := wordBoxes(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return nil, nil
+	}
+
+	var boxes []TextBox
+	for i, page := range pages {
+		var joined strings.Builder
+		starts := make([]int, len(page.words))
+		for j, w := range page.words {
+			if j > 0 {
+				joined.WriteByte(' ')
+			}
+			starts[j] = joined.Len()
+			joined.WriteString(w.text)
+		}
+		pageText := joined.String()
+
+		for offset := 0; ; {
+			at := strings.Index(pageText[offset:], text)
+			if at < 0 {
+				break
+			}
+			from, to := offset+at, offset+at+len(text)
+			offset = to
+			var xMin, yMin, xMax, yMax float64
+			found := false
+			for j, w := range page.words {
+				if starts[j] >= to || starts[j]+len(w.text) <= from {
+					continue
+				}
+				if !found {
+					xMin, yMin, xMax, yMax = w.xMin, w.yMin, w.xMax, w.yMax
+					found = true
+					continue
+				}
+				xMin, yMin = min(xMin, w.xMin), min(yMin, w.yMin)
+				xMax, yMax = max(xMax, w.xMax), max(yMax, w.yMax)
+			}
+			if found {
+				boxes = append(boxes, TextBox{
+					Page:   i + 1,
+					X:      xMin,
+					Y:      page.height - yMax,
+					Width:  xMax - xMin,
+					Height: yMax - yMin,
+				})
+			}
+		}
+	}
+	return boxes, nil
+}
+
+// Anchor places an item (a stamp, a form field) relative to text found in
+// the document rather than at fixed coordinates, so it lands in the right
+// spot across template versions. In JSON it is an object, or just the text
+// for the defaults.
+type Anchor struct {
+	Text string `json:"text"`
+	// Occurrence picks the matches to use: all (default), first, last or a
+	// 1-based number.
+	Occurrence string `json:"occurrence,omitempty"`
+	// Position is where the item goes: over the text (default, sharing its
+	// bottom-left corner), below, above, left or right of it.
+	Position string `json:"position,omitempty"`
+	// Distance is the gap between the text and the item, in points.
+	Distance float64 `json:"distance,omitempty"`
+}
+
+func (a *Anchor) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*a = Anchor{Text: text}
+		return nil
+	}
+	type plain Anchor
+	return json.Unmarshal(data, (*plain)(a))
+}
+
+// Validate checks the anchor's options.
+func (a Anchor) Validate() error {
+	if strings.TrimSpace(a.Text) == "" {
+		return fmt.Errorf("anchor text is empty")
+	}
+	switch a.Occurrence {
+	case "", "all", "first", "last":
+	default:
+		if n, err := strconv.Atoi(a.Occurrence); err != nil || n < 1 {
+			return fmt.Errorf("anchor occurrence must be all, first, last or a number")
+		}
+	}
+	switch a.Position {
+	case "", "over", "below", "above", "left", "right":
+	default:
+		return fmt.Errorf("anchor position must be over, below, above, left or right")
+	}
+	if a.Distance < 0 {
+		return fmt.Errorf("anchor distance must not be negative")
+	}
+	return nil
+}
+
+// Select keeps the occurrences of the anchor text the anchor asks for, out
+// of every occurrence in document order (see FindText).
+func (a Anchor) Select(boxes []TextBox) []TextBox {
+	if len(boxes) == 0 {
+		return nil
+	}
+	switch a.Occurrence {
+	case "", "all":
+		return boxes
+	case "first":
+		return boxes[:1]
+	case "last":
+		return boxes[len(boxes)-1:]
+	}
+	n, _ := strconv.Atoi(a.Occurrence)
+	if n < 1 || n > len(boxes) {
+		return nil
+	}
+	return boxes[n-1 : n]
+}
+
+// Place returns the bottom-left corner of a width x height item positioned
+// at an occurrence of the anchor text. Left of the text, an item of unknown
+// width (0) gets its right edge there instead.
+func (a Anchor) Place(box TextBox, width, height float64) (x, y float64) {
+	switch a.Position {
+	case "below":
+		return box.X, box.Y - a.Distance - height
+	case "above":
+		return box.X, box.Y + box.Height + a.Distance
+	case "left":
+		return box.X - a.Distance - width, box.Y
+	case "right":
+		return box.X + box.Width + a.Distance, box.Y
+	}
+	return box.X, box.Y
+}
@@ -0,0 +1,194 @@
+package converters
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Annotation is a reviewer markup on a page.
+type Annotation struct {
+	Page     int       `json:"page"`
+	Type     string    `json:"type"` // highlight, underline, text (sticky note), freetext, ...
+	Author   string    `json:"author,omitempty"`
+	Contents string    `json:"contents,omitempty"`
+	Text     string    `json:"text,omitempty"` // marked-up page text, for highlights etc.
+	Modified string    `json:"modified,omitempty"`
+	Rect     []float64 `json:"rect"`
+	ID       string    `json:"id"`
+	ReplyTo  string    `json:"reply_to,omitempty"`
+}
+
+// Subtypes that are structure rather than review comments.
+var nonCommentAnnots = map[string]bool{
+	"link":   true,
+	"widget": true,
+	"popup":  true,
+}
+
+// Subtypes that mark up text on the page.
+var textMarkupAnnots = map[string]bool{
+	"highlight": true,
+	"underline": true,
+	"strikeout": true,
+	"squiggly":  true,
+}
+
+// QPDF + Poppler (pdftotext): List review annotations with the text they mark
+func ExtractAnnotations(inputPath string) ([]Annotation, error) {
+	doc, err := loadQPDFJSON(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Annotation
+	for _, p := range doc.Pages {
+		page := doc.dict(p.Object)
+		mediaBox := doc.numbers(doc.inherited(page, "/MediaBox"))
+		for _, ref := range doc.array(page["/Annots"]) {
+			annot := doc.dict(ref)
+			subtype, _ := annot["/Subtype"].(string)
+			kind := strings.ToLower(strings.TrimPrefix(subtype, "/"))
+			if annot == nil || nonCommentAnnots[kind] {
+				continue
+			}
+			a := Annotation{
+				Page:     p.Number,
+				Type:     kind,
+				Author:   doc.pdfText(annot["/T"]),
+				Contents: doc.pdfText(annot["/Contents"]),
+				Modified: doc.pdfText(annot["/M"]),
+				Rect:     doc.numbers(annot["/Rect"]),
+			}
+			if s, ok := ref.(string); ok {
+				a.ID = s
+			}
+			if irt, ok := annot["/IRT"].(string); ok {
+				a.ReplyTo = irt
+			}
+			if textMarkupAnnots[kind] && len(mediaBox) == 4 {
+				box := markupBox(doc.numbers(annot["/QuadPoints"]), a.Rect)
+				a.Text, _ = textInBox(inputPath, p.Number, box, mediaBox)
+			}
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+// markupBox is the bounding box of an annotation's quadrilaterals, falling
+// back to its rectangle.
+func markupBox(quads, rect []float64) []float64 {
+	if len(quads) < 8 {
+		return rect
+	}
+	box := []float64{quads[0], quads[1], quads[0], quads[1]}
+	for i := 0; i+1 < len(quads); i += 2 {
+		x, y := quads[i], quads[i+1]
+		box[0], box[1] = min(box[0], x), min(box[1], y)
+		box[2], box[3] = max(box[2], x), max(box[3], y)
+	}
+	return box
+}
+
+// textInBox reads the text inside a PDF-space box on one page. pdftotext
+// crops in pixels from the top-left, which at 72 dpi are points.
+func textInBox(inputPath string, page int, box, mediaBox []float64) (string, error) {
+	if len(box) != 4 {
+		return "", nil
+	}
+	x0, y0 := min(box[0], box[2])-mediaBox[0], min(box[1], box[3])-mediaBox[1]
+	w, h := max(box[0], box[2])-min(box[0], box[2]), max(box[1], box[3])-min(box[1], box[3])
+	top := (mediaBox[3] - mediaBox[1]) - (y0 + h)
+	args := []string{
+		"-f", fmt.Sprint(page), "-l", fmt.Sprint(page),
+		"-r", "72",
+		"-x", fmt.Sprint(int(x0)), "-y", fmt.Sprint(int(top)),
+		"-W", fmt.Sprint(int(w + 1)), "-H", fmt.Sprint(int(h + 1)),
+		"-nopgbrk",
+		inputPath, "-",
+	}
+	cmd := exec.Command(binary("pdftotext"), args...)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("pdftotext failed: %v", err)
+	}
+	return strings.Join(strings.Fields(string(output)), " "), nil
+}
+
+// QPDF: Remove review annotations. types limits removal to those subtypes
+// (e.g. "highlight"); empty removes every comment type. Links and form
+// fields are kept.
+func RemoveAnnotations(inputPath, outputPath string, types []string) error {
+	doc, err := loadQPDFJSON(inputPath)
+	if err != nil {
+		return err
+	}
+	wanted := map[string]bool{}
+	for _, t := range types {
+		wanted[strings.ToLower(t)] = true
+	}
+	remove := func(annot map[string]interface{}) bool {
+		subtype, _ := annot["/Subtype"].(string)
+		kind := strings.ToLower(strings.TrimPrefix(subtype, "/"))
+		if nonCommentAnnots[kind] {
+			return false
+		}
+		return len(wanted) == 0 || wanted[kind]
+	}
+
+	updates := map[string]interface{}{}
+	for _, p := range doc.Pages {
+		page := doc.dict(p.Object)
+		annotsRef := page["/Annots"]
+		removed := map[string]bool{}
+		var kept []interface{}
+		for _, ref := range doc.array(annotsRef) {
+			if annot := doc.dict(ref); annot != nil && remove(annot) {
+				if s, ok := ref.(string); ok {
+					removed[s] = true
+				}
+				continue
+			}
+			kept = append(kept, ref)
+		}
+		if len(removed) == 0 {
+			continue
+		}
+		// Popups of removed comments go with them
+		filtered := []interface{}{}
+		for _, ref := range kept {
+			annot := doc.dict(ref)
+			if subtype, _ := annot["/Subtype"].(string); subtype == "/Popup" {
+				if parent, ok := annot["/Parent"].(string); ok && removed[parent] {
+					continue
+				}
+			}
+			filtered = append(filtered, ref)
+		}
+
+		if s, ok := annotsRef.(string); ok && strings.HasSuffix(s, " R") {
+			updates[s] = filtered
+			continue
+		}
+		newPage := map[string]interface{}{}
+		for k, v := range page {
+			newPage[k] = v
+		}
+		newPage["/Annots"] = filtered
+		updates[p.Object] = newPage
+	}
+
+	if len(updates) == 0 {
+		cmd := exec.Command(binary("qpdf"), inputPath, outputPath)
+		output, err := cmd.CombinedOutput()
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 3 {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("qpdf copy failed: %v, output: %s", err, string(output))
+		}
+		return nil
+	}
+	return updateQPDFJSON(inputPath, outputPath, doc.header, updates)
+}
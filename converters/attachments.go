@@ -0,0 +1,207 @@
+package converters
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Attachment is a file embedded in a PDF.
+type Attachment struct {
+	Key          string `json:"key"`
+	Name         string `json:"name"`
+	MimeType     string `json:"mime_type,omitempty"`
+	Description  string `json:"description,omitempty"`
+	Relationship string `json:"relationship,omitempty"` // PDF/A-3 AFRelationship, e.g. "Alternative"
+	Size         int    `json:"size"`
+}
+
+// AttachmentFile is a file to embed. Name is the key and file name shown
+// by PDF readers.
+type AttachmentFile struct {
+	Path        string
+	Name        string
+	MimeType    string
+	Description string
+}
+
+// AFRelationships are the PDF/A-3 relationships an embedded file may have
+// to the document. ZUGFeRD and Factur-X invoices use "Alternative" (or
+// "Data") for their XML.
+var AFRelationships = map[string]bool{
+	"Source":      true,
+	"Data":        true,
+	"Alternative": true,
+	"Supplement":  true,
+	"Unspecified": true,
+}
+
+// QPDF: Embed files as attachments. An existing attachment with the same
+// name is replaced only when replace is set. With a relationship, the files
+// are also registered as associated files (/AF) of the document, as PDF/A-3
+// requires.
+func AddAttachments(inputPath, outputPath string, files []AttachmentFile, relationship string, replace bool) error {
+	target := outputPath
+	if relationship != "" {
+		target = outputPath + ".attached.pdf"
+		defer os.Remove(target)
+	}
+
+	args := []string{inputPath}
+	for _, f := range files {
+		args = append(args, "--add-attachment", f.Path, "--key="+f.Name, "--filename="+f.Name)
+		if f.MimeType != "" {
+			args = append(args, "--mimetype="+f.MimeType)
+		}
+		if f.Description != "" {
+			args = append(args, "--description="+f.Description)
+		}
+		if replace {
+			args = append(args, "--replace")
+		}
+		args = append(args, "--")
+	}
+	args = append(args, target)
+	cmd := exec.Command(binary("qpdf"), args...)
+	output, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 3 {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("qpdf add attachment failed: %v, output: %s", err, string(output))
+	}
+	if relationship == "" {
+		return nil
+	}
+
+	keys := make([]string, len(files))
+	for i, f := range files {
+		keys[i] = f.Name
+	}
+	return markAssociatedFiles(target, outputPath, keys, relationship)
+}
+
+// qpdfAttachment is one entry of qpdf's --json-key=attachments output.
+type qpdfAttachment struct {
+	Filespec          string `json:"filespec"`
+	PreferredName     string `json:"preferredname"`
+	PreferredContents string `json:"preferredcontents"`
+}
+
+func loadAttachments(inputPath string) (map[string]qpdfAttachment, error) {
+	cmd := exec.Command(binary("qpdf"), "--json=2", "--json-key=attachments", inputPath)
+	output, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 3 {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("qpdf attachment listing failed: %v", err)
+	}
+	var raw struct {
+		Attachments map[string]qpdfAttachment `json:"attachments"`
+	}
+	if err := json.Unmarshal(output, &raw); err != nil {
+		return nil, fmt.Errorf("unexpected qpdf json output")
+	}
+	return raw.Attachments, nil
+}
+
+// markAssociatedFiles sets /AFRelationship on the file specs of keys and
+// lists them in the catalog's /AF array.
+func markAssociatedFiles(inputPath, outputPath string, keys []string, relationship string) error {
+	attachments, err := loadAttachments(inputPath)
+	if err != nil {
+		return err
+	}
+	doc, err := loadQPDFJSON(inputPath)
+	if err != nil {
+		return err
+	}
+	rootRef, _ := doc.dict(doc.trailer)["/Root"].(string)
+	root := doc.dict(rootRef)
+	if root == nil {
+		return fmt.Errorf("PDF has no document catalog")
+	}
+
+	updates := map[string]interface{}{}
+	af := doc.array(root["/AF"])
+	for _, key := range keys {
+		a, ok := attachments[key]
+		spec := doc.dict(a.Filespec)
+		if !ok || spec == nil {
+			return fmt.Errorf("attachment %q not found after embedding", key)
+		}
+		spec["/AFRelationship"] = "/" + relationship
+		updates[a.Filespec] = spec
+		listed := false
+		for _, ref := range af {
+			listed = listed || ref == a.Filespec
+		}
+		if !listed {
+			af = append(af, a.Filespec)
+		}
+	}
+	root["/AF"] = af
+	updates[rootRef] = root
+	return updateQPDFJSON(inputPath, outputPath, doc.header, updates)
+}
+
+// QPDF: List embedded files
+func ListAttachments(inputPath string) ([]Attachment, error) {
+	attachments, err := loadAttachments(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 {
+		return nil, nil
+	}
+	doc, err := loadQPDFJSON(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Attachment
+	for key, a := range attachments {
+		spec := doc.dict(a.Filespec)
+		relationship, _ := spec["/AFRelationship"].(string)
+		item := Attachment{
+			Key:          key,
+			Name:         a.PreferredName,
+			Description:  doc.pdfText(spec["/Desc"]),
+			Relationship: strings.TrimPrefix(relationship, "/"),
+		}
+		if stream := doc.dict(a.PreferredContents); stream != nil {
+			if subtype, ok := stream["/Subtype"].(string); ok {
+				// Names encode "/" in MIME types as #2f
+				item.MimeType = strings.ReplaceAll(strings.TrimPrefix(subtype, "/"), "#2f", "/")
+			}
+			if params := doc.dict(stream["/Params"]); params != nil {
+				if size, ok := doc.resolve(params["/Size"]).(float64); ok {
+					item.Size = int(size)
+				}
+			}
+		}
+		if item.Name == "" {
+			item.Name = key
+		}
+		out = append(out, item)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// QPDF: Write the contents of one attachment to outputPath
+func ExtractAttachment(inputPath, key, outputPath string) error {
+	cmd := exec.Command(binary("qpdf"), "--show-attachment="+key, inputPath)
+	output, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 3 {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("qpdf show attachment failed: %v", err)
+	}
+	return os.WriteFile(outputPath, output, 0644)
+}
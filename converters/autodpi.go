@@ -0,0 +1,90 @@
+package converters
+
+import (
+	"fmt"
+	"math"
+	"os/exec"
+	"sort"
+	"strconv"
+)
+
+// Auto DPI bounds. Pages render at autoDPIBase unless their small print
+// needs more to stay legible, or they are so large that the image would
+// pass autoDPIMaxPixels on its longer side.
+const (
+	autoDPIBase      = 150
+	autoDPIMin       = 72
+	autoDPIMax       = 300
+	autoDPIMaxPixels = 6000
+	// Rendered text lines should be at least this many pixels tall.
+	autoDPITextPixels = 22
+)
+
+// AutoDPI picks a render resolution for every page from its dimensions
+// and the size of its smallest text (the 5th percentile of word heights,
+// so stray superscripts don't count). Pages without text, such as scans,
+// get autoDPIBase.
+func AutoDPI(inputPath string) ([]int, error) {
+	pages, err := wordBoxes(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	dpis := make([]int, len(pages))
+	for i, page := range pages {
+		dpi := float64(autoDPIBase)
+		var heights []float64
+		for _, w := range page.words {
+			if h := w.yMax - w.yMin; h > 0 {
+				heights = append(heights, h)
+			}
+		}
+		if len(heights) > 0 {
+			sort.Float64s(heights)
+			small := heights[len(heights)/20]
+			// Points are 1/72 inch
+			dpi = max(dpi, autoDPITextPixels*72/small)
+		}
+		if longest := max(page.width, page.height); longest > 0 {
+			dpi = min(dpi, autoDPIMaxPixels*72/longest)
+		}
+		dpis[i] = int(math.Round(min(max(dpi, autoDPIMin), autoDPIMax)))
+	}
+	return dpis, nil
+}
+
+// pdfToImageAutoDPI renders each page with pdftoppm at its own resolution
+// (see AutoDPI), with the format flags in args. Images are named like
+// pdftoppm's own output, outputPrefix-<page>.<ext> with the page number
+// zero padded. first and last limit the pages rendered; zero means the
+// document's first or last page.
+func pdfToImageAutoDPI(inputPath, outputPrefix string, args []string, first, last int) error {
+	dpis, err := AutoDPI(inputPath)
+	if err != nil {
+		return err
+	}
+	if last == 0 || last > len(dpis) {
+		last = len(dpis)
+	}
+	if first > last {
+		return fmt.Errorf("page %d out of range (document has %d pages)", first, len(dpis))
+	}
+	digits := len(strconv.Itoa(len(dpis)))
+	for i, dpi := range dpis {
+		if i+1 < first || i+1 > last {
+			continue
+		}
+		page := strconv.Itoa(i + 1)
+		pageArgs := append(args[:len(args):len(args)],
+			"-singlefile",
+			"-f", page, "-l", page,
+			"-r", strconv.Itoa(dpi),
+			inputPath,
+			fmt.Sprintf("%s-%0*d", outputPrefix, digits, i+1),
+		)
+		cmd := exec.Command(binary("pdftoppm"), pageArgs...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("pdftoppm failed on page %d: %v, output: %s", i+1, err, string(output))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package converters
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Ghostscript (inkcov): Ink coverage per page, the sum of the C, M, Y and K
+// fractions of the page area (0 for an empty page).
+func InkCoverage(inputPath string) ([]float64, error) {
+	cmd := exec.Command(binary("gs"),
+		"-q", "-dNOPAUSE", "-dBATCH", "-dSAFER",
+		"-sDEVICE=inkcov",
+		"-o", "-",
+		inputPath,
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Ghostscript inkcov failed: %v", err)
+	}
+
+	var coverage []float64
+	for _, line := range strings.Split(string(output), "\n") {
+		// " 0.02104  0.01722  0.01676  0.03450 CMYK OK"
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[4] != "CMYK" {
+			continue
+		}
+		sum := 0.0
+		for _, f := range fields[:4] {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected inkcov output: %q", line)
+			}
+			sum += v
+		}
+		coverage = append(coverage, sum)
+	}
+	if len(coverage) == 0 {
+		return nil, fmt.Errorf("inkcov reported no pages")
+	}
+	return coverage, nil
+}
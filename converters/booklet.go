@@ -0,0 +1,90 @@
+package converters
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// BookletOrder returns the saddle-stitch page sequence for a document with
+// the given number of pages. Pages are grouped into signatures of
+// signatureSize pages (a multiple of 4, or 0 for a single signature holding
+// the whole document). Each consecutive pair in the result is one side of a
+// sheet; 0 marks a blank page used to pad the last signature.
+func BookletOrder(pageCount, signatureSize int) ([]int, error) {
+	if pageCount < 1 {
+		return nil, fmt.Errorf("document has no pages")
+	}
+	padded := (pageCount + 3) / 4 * 4
+	if signatureSize == 0 {
+		signatureSize = padded
+	}
+	if signatureSize < 4 || signatureSize%4 != 0 {
+		return nil, fmt.Errorf("signature size must be a positive multiple of 4, got %d", signatureSize)
+	}
+
+	var order []int
+	page := func(p int) int {
+		if p > pageCount {
+			return 0
+		}
+		return p
+	}
+	for start := 0; start < padded; start += signatureSize {
+		size := signatureSize
+		if start+size > padded {
+			size = padded - start
+		}
+		for sheet := 0; sheet < size/4; sheet++ {
+			// Front: last/first, back: second/second-to-last
+			order = append(order,
+				page(start+size-2*sheet), page(start+1+2*sheet),
+				page(start+2+2*sheet), page(start+size-1-2*sheet),
+			)
+		}
+	}
+	return order, nil
+}
+
+// BookletAvailable reports whether pdfjam, which imposes booklets, is
+// installed. It comes with TeX Live (texlive-extra-utils on Debian).
+func BookletAvailable() bool {
+	_, err := exec.LookPath(binary("pdfjam"))
+	return err == nil
+}
+
+// pdfjam: Booklet imposition (2-up, landscape sheets)
+func BookletPDF(inputPath, outputPath string, signatureSize int) error {
+	pageCount, err := PageCount(inputPath)
+	if err != nil {
+		return err
+	}
+	order, err := BookletOrder(pageCount, signatureSize)
+	if err != nil {
+		return err
+	}
+
+	// pdfjam uses {} for an inserted blank page
+	selection := make([]string, len(order))
+	for i, p := range order {
+		if p == 0 {
+			selection[i] = "{}"
+		} else {
+			selection[i] = strconv.Itoa(p)
+		}
+	}
+
+	args := []string{
+		"--nup", "2x1",
+		"--landscape",
+		"--outfile", outputPath,
+		inputPath, strings.Join(selection, ","),
+	}
+	cmd := exec.Command(binary("pdfjam"), args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("pdfjam booklet failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package converters
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Bookmark is one outline entry. Children hold the entries nested below it.
+type Bookmark struct {
+	Title    string     `json:"title"`
+	Page     int        `json:"page"`
+	Level    int        `json:"level"`
+	Children []Bookmark `json:"children,omitempty"`
+}
+
+// parseBookmarkDump reads the BookmarkBegin records of pdftk dump_data output
+// into a flat list in document order.
+func parseBookmarkDump(dump string) []Bookmark {
+	var flat []Bookmark
+	for _, line := range strings.Split(dump, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "BookmarkBegin" {
+			flat = append(flat, Bookmark{})
+			continue
+		}
+		if len(flat) == 0 {
+			continue
+		}
+		key, value, _ := strings.Cut(line, ": ")
+		cur := &flat[len(flat)-1]
+		switch key {
+		case "BookmarkTitle":
+			cur.Title = value
+		case "BookmarkLevel":
+			cur.Level, _ = strconv.Atoi(value)
+		case "BookmarkPageNumber":
+			cur.Page, _ = strconv.Atoi(value)
+		}
+	}
+	return flat
+}
+
+// bookmarkTree nests a flat, document-ordered list by level.
+func bookmarkTree(flat []Bookmark) []Bookmark {
+	var build func(i, level int) ([]Bookmark, int)
+	build = func(i, level int) ([]Bookmark, int) {
+		var out []Bookmark
+		for i < len(flat) && flat[i].Level >= level {
+			b := flat[i]
+			b.Children, i = build(i+1, b.Level+1)
+			out = append(out, b)
+		}
+		return out, i
+	}
+	tree, _ := build(0, 1)
+	return tree
+}
+
+// pdftk: Read the document outline as a tree
+func ExtractBookmarks(inputPath string) ([]Bookmark, error) {
+	cmd := exec.Command(binary("pdftk"), inputPath, "dump_data_utf8")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("pdftk dump_data failed: %v", err)
+	}
+	return bookmarkTree(parseBookmarkDump(string(output))), nil
+}
+
+// mergeBookmarks overlays extra onto base: entries whose title matches a
+// sibling's take its place in the order, with pages updated and children
+// merged; the rest are appended.
+func mergeBookmarks(base, extra []Bookmark) []Bookmark {
+	out := append([]Bookmark(nil), base...)
+	for _, b := range extra {
+		merged := false
+		for i := range out {
+			if out[i].Title == b.Title {
+				out[i].Page = b.Page
+				out[i].Children = mergeBookmarks(out[i].Children, b.Children)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// ValidateBookmarks checks that every entry has a title and a page inside
+// the document.
+func ValidateBookmarks(bookmarks []Bookmark, pageCount int) error {
+	for _, b := range bookmarks {
+		if strings.TrimSpace(b.Title) == "" {
+			return fmt.Errorf("bookmark titles must not be empty")
+		}
+		if b.Page < 1 || b.Page > pageCount {
+			return fmt.Errorf("bookmark %q points to page %d, document has %d pages", b.Title, b.Page, pageCount)
+		}
+		if err := ValidateBookmarks(b.Children, pageCount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeBookmarkRecords appends the tree in pdftk dump_data form, deriving
+// levels from nesting depth.
+func writeBookmarkRecords(sb *strings.Builder, bookmarks []Bookmark, level int) {
+	for _, b := range bookmarks {
+		title := strings.Join(strings.Fields(b.Title), " ")
+		fmt.Fprintf(sb, "BookmarkBegin\nBookmarkTitle: %s\nBookmarkLevel: %d\nBookmarkPageNumber: %d\n", title, level, b.Page)
+		writeBookmarkRecords(sb, b.Children, level+1)
+	}
+}
+
+// pdftk: Replace the document outline, or merge into it
+func SetBookmarks(inputPath, outputPath string, bookmarks []Bookmark, merge bool) error {
+	cmd := exec.Command(binary("pdftk"), inputPath, "dump_data_utf8")
+	dump, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("pdftk dump_data failed: %v", err)
+	}
+	if merge {
+		bookmarks = mergeBookmarks(bookmarkTree(parseBookmarkDump(string(dump))), bookmarks)
+	}
+
+	// Keep the Info and PageLabel records, drop the old outline
+	var sb strings.Builder
+	pageCount := 0
+	for _, line := range strings.Split(string(dump), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "Bookmark") {
+			continue
+		}
+		if v, ok := strings.CutPrefix(line, "NumberOfPages: "); ok {
+			pageCount, _ = strconv.Atoi(v)
+		}
+		sb.WriteString(line + "\n")
+	}
+	if err := ValidateBookmarks(bookmarks, pageCount); err != nil {
+		return err
+	}
+	writeBookmarkRecords(&sb, bookmarks, 1)
+
+	dir := filepath.Dir(outputPath)
+	infoPath := filepath.Join(dir, "bookmarks.info")
+	if err := os.WriteFile(infoPath, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write bookmark data: %v", err)
+	}
+	defer os.Remove(infoPath)
+
+	// pdftk adds to an existing outline, so start from a copy without one
+	strippedPath := filepath.Join(dir, "no-outline.pdf")
+	cmd = exec.Command(binary("qpdf"), "--empty", "--pages", inputPath, "--", strippedPath)
+	output, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 3 {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("qpdf outline removal failed: %v, output: %s", err, string(output))
+	}
+	defer os.Remove(strippedPath)
+
+	cmd = exec.Command(binary("pdftk"), strippedPath, "update_info_utf8", infoPath, "output", outputPath)
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("pdftk update_info failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package converters
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"unicode/utf16"
+)
+
+// Compound File Binary sector markers (MS-CFB 2.1)
+const (
+	cfbEndOfChain = 0xFFFFFFFE
+	cfbFreeSector = 0xFFFFFFFF
+	cfbNoStream   = 0xFFFFFFFF
+)
+
+// Directory entry types
+const (
+	cfbStorage = 1
+	cfbStream  = 2
+	cfbRoot    = 5
+)
+
+var cfbSignature = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+
+// cfbFile is a Compound File Binary (OLE2) container, the format of Outlook
+// .msg files and legacy Office documents: a small file system of storages
+// (directories) and streams.
+type cfbFile struct {
+	data           []byte
+	sectorSize     int
+	miniSectorSize int
+	miniCutoff     uint64
+	fat            []uint32
+	miniFAT        []uint32
+	miniStream     []byte
+	entries        []cfbEntry
+}
+
+type cfbEntry struct {
+	name               string
+	kind               byte
+	left, right, child uint32
+	start              uint32
+	size               uint64
+}
+
+// openCFB reads a compound file into memory.
+func openCFB(path string) (*cfbFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 512 || !bytes.Equal(data[:8], cfbSignature) {
+		return nil, fmt.Errorf("not a compound file")
+	}
+	f := &cfbFile{
+		data:           data,
+		sectorSize:     1 << le16(data[0x1E:]),
+		miniSectorSize: 1 << le16(data[0x20:]),
+		miniCutoff:     uint64(le32(data[0x38:])),
+	}
+	if f.sectorSize != 512 && f.sectorSize != 4096 || f.miniSectorSize != 64 {
+		return nil, fmt.Errorf("unsupported compound file sector size")
+	}
+
+	// The FAT's sectors are listed in the header, then in a chain of DIFAT
+	// sectors
+	var fatSectors []uint32
+	for i := 0; i < 109; i++ {
+		if s := le32(data[0x4C+4*i:]); s != cfbFreeSector {
+			fatSectors = append(fatSectors, s)
+		}
+	}
+	perSector := f.sectorSize/4 - 1
+	next := le32(data[0x44:])
+	for seen := 0; next != cfbEndOfChain && next != cfbFreeSector; seen++ {
+		sector := f.sector(next)
+		if sector == nil || seen > len(data)/f.sectorSize {
+			return nil, fmt.Errorf("corrupt compound file DIFAT")
+		}
+		for i := 0; i < perSector; i++ {
+			if s := le32(sector[4*i:]); s != cfbFreeSector {
+				fatSectors = append(fatSectors, s)
+			}
+		}
+		next = le32(sector[4*perSector:])
+	}
+	for _, s := range fatSectors {
+		sector := f.sector(s)
+		if sector == nil {
+			return nil, fmt.Errorf("corrupt compound file FAT")
+		}
+		for i := 0; i+4 <= len(sector); i += 4 {
+			f.fat = append(f.fat, le32(sector[i:]))
+		}
+	}
+
+	dir, err := f.readChain(le32(data[0x30:]), f.fat, f.sector)
+	if err != nil {
+		return nil, fmt.Errorf("compound file directory: %v", err)
+	}
+	for i := 0; i+128 <= len(dir); i += 128 {
+		e := dir[i : i+128]
+		nameLen := int(le16(e[0x40:]))
+		if nameLen > 64 {
+			nameLen = 64
+		}
+		units := make([]uint16, 0, 32)
+		for j := 0; j < nameLen-2; j += 2 {
+			units = append(units, le16(e[j:]))
+		}
+		entry := cfbEntry{
+			name:  string(utf16.Decode(units)),
+			kind:  e[0x42],
+			left:  le32(e[0x44:]),
+			right: le32(e[0x48:]),
+			child: le32(e[0x4C:]),
+			start: le32(e[0x74:]),
+			size:  le64(e[0x78:]),
+		}
+		// Version 3 files may leave garbage in the size's high half
+		if f.sectorSize == 512 {
+			entry.size &= 0xFFFFFFFF
+		}
+		f.entries = append(f.entries, entry)
+	}
+	if len(f.entries) == 0 || f.entries[0].kind != cfbRoot {
+		return nil, fmt.Errorf("compound file has no root entry")
+	}
+
+	miniFAT, err := f.readChain(le32(data[0x3C:]), f.fat, f.sector)
+	if err != nil {
+		return nil, fmt.Errorf("compound file mini FAT: %v", err)
+	}
+	for i := 0; i+4 <= len(miniFAT); i += 4 {
+		f.miniFAT = append(f.miniFAT, le32(miniFAT[i:]))
+	}
+	root := f.entries[0]
+	if f.miniStream, err = f.readChain(root.start, f.fat, f.sector); err != nil {
+		return nil, fmt.Errorf("compound file mini stream: %v", err)
+	}
+	return f, nil
+}
+
+// sector returns a regular sector, or nil when it is outside the file.
+func (f *cfbFile) sector(n uint32) []byte {
+	offset := (int64(n) + 1) * int64(f.sectorSize)
+	if offset+int64(f.sectorSize) > int64(len(f.data)) {
+		return nil
+	}
+	return f.data[offset : offset+int64(f.sectorSize)]
+}
+
+// miniSector returns a sector of the mini stream.
+func (f *cfbFile) miniSector(n uint32) []byte {
+	offset := int64(n) * int64(f.miniSectorSize)
+	if offset+int64(f.miniSectorSize) > int64(len(f.miniStream)) {
+		return nil
+	}
+	return f.miniStream[offset : offset+int64(f.miniSectorSize)]
+}
+
+// readChain concatenates a chain of sectors, guarding against loops.
+func (f *cfbFile) readChain(start uint32, fat []uint32, sector func(uint32) []byte) ([]byte, error) {
+	var out []byte
+	for n := start; n != cfbEndOfChain && n != cfbFreeSector; {
+		s := sector(n)
+		if s == nil || int(n) >= len(fat) || len(out) > len(f.data) {
+			return nil, fmt.Errorf("broken sector chain")
+		}
+		out = append(out, s...)
+		n = fat[n]
+	}
+	return out, nil
+}
+
+// read returns the contents of a stream.
+func (f *cfbFile) read(e cfbEntry) ([]byte, error) {
+	var data []byte
+	var err error
+	if e.size < f.miniCutoff {
+		data, err = f.readChain(e.start, f.miniFAT, f.miniSector)
+	} else {
+		data, err = f.readChain(e.start, f.fat, f.sector)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) < e.size {
+		return nil, fmt.Errorf("stream %s is truncated", e.name)
+	}
+	return data[:e.size], nil
+}
+
+// children lists the entries directly inside a storage, by name. The
+// entries of a storage form a tree through their left and right siblings.
+func (f *cfbFile) children(storage int) map[string]int {
+	out := map[string]int{}
+	seen := map[uint32]bool{}
+	var walk func(id uint32)
+	walk = func(id uint32) {
+		if id == cfbNoStream || int(id) >= len(f.entries) || seen[id] {
+			return
+		}
+		seen[id] = true
+		e := f.entries[id]
+		out[e.name] = int(id)
+		walk(e.left)
+		walk(e.right)
+	}
+	walk(f.entries[storage].child)
+	return out
+}
+
+// Compound files are little-endian.
+func le16(b []byte) uint16 { return uint16(b[0]) | uint16(b[1])<<8 }
+func le32(b []byte) uint32 { return uint32(le16(b)) | uint32(le16(b[2:]))<<16 }
+func le64(b []byte) uint64 { return uint64(le32(b)) | uint64(le32(b[4:]))<<32 }
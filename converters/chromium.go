@@ -0,0 +1,389 @@
+package converters
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PaperSizes are the named paper sizes for URLToPDF, in inches (width,
+// height) as Chrome takes them.
+var PaperSizes = map[string][2]float64{
+	"letter":  {8.5, 11},
+	"legal":   {8.5, 14},
+	"tabloid": {11, 17},
+	"a3":      {11.69, 16.54},
+	"a4":      {8.27, 11.69},
+	"a5":      {5.83, 8.27},
+}
+
+// PrintOptions tune URLToPDF. Lengths are in inches.
+type PrintOptions struct {
+	PaperWidth, PaperHeight                          float64
+	MarginTop, MarginRight, MarginBottom, MarginLeft float64
+	Landscape                                        bool
+	PrintBackground                                  bool
+	// WaitNetworkIdle waits until the page has had no network activity for
+	// half a second, for pages that load their content with scripts.
+	// Otherwise printing starts at the load event.
+	WaitNetworkIdle bool
+	Timeout         time.Duration // default 60s
+	// Dial, when set, makes every connection the browser opens, so it can
+	// refuse destinations (see startProxy). Otherwise the browser reaches
+	// the network directly.
+	Dial Dialer
+}
+
+// ParseLength reads a CSS-style length ("0.5in", "10mm", "1cm", "36pt",
+// "48px") in inches. A bare number is in inches.
+func ParseLength(s string) (float64, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	perInch := map[string]float64{"in": 1, "mm": 25.4, "cm": 2.54, "pt": 72, "px": 96}
+	for unit, per := range perInch {
+		if num, ok := strings.CutSuffix(s, unit); ok {
+			v, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid length %q", s)
+			}
+			return v / per, nil
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid length %q", s)
+	}
+	return v, nil
+}
+
+func chromiumTool() tool {
+	t := tool{key: "chromium", names: []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable"}}
+	switch runtime.GOOS {
+	case "darwin":
+		t.candidates = []string{
+			"/Applications/Chromium.app/Contents/MacOS/Chromium",
+			"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+		}
+	case "windows":
+		t.names = []string{"chrome.exe"}
+		t.candidates = []string{
+			`C:\Program Files\Google\Chrome\Application\chrome.exe`,
+			`C:\Program Files (x86)\Google\Chrome\Application\chrome.exe`,
+		}
+	}
+	return t
+}
+
+// Chromium (headless, DevTools protocol): Render a web page to PDF. The
+// browser is driven over --remote-debugging-pipe, which speaks the DevTools
+// protocol as NUL-terminated JSON on file descriptors 3 and 4, so paper size,
+// margins and waiting for network idle are available without a websocket
+// client. profileDir holds the throwaway browser profile. Not supported on
+// Windows, where extra file descriptors can't be passed to a child.
+func URLToPDF(pageURL, outputPath, profileDir string, opts PrintOptions) error {
+	if runtime.GOOS == "windows" {
+		return fmt.Errorf("URL rendering is not supported on Windows")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 60 * time.Second
+	}
+
+	args := []string{
+		"--headless=new",
+		"--remote-debugging-pipe",
+		"--user-data-dir=" + profileDir,
+		"--no-first-run",
+		"--no-default-browser-check",
+		"--disable-gpu",
+		"--disable-extensions",
+		"--hide-scrollbars",
+		"--mute-audio",
+	}
+	if os.Geteuid() == 0 {
+		// Chrome refuses to run its sandbox as root, the norm in containers
+		args = append(args, "--no-sandbox")
+	}
+	if opts.Dial != nil {
+		proxy, stop, err := startProxy(opts.Dial)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		args = append(args,
+			"--proxy-server=http://"+proxy,
+			// Loopback bypasses proxies unless told otherwise
+			"--proxy-bypass-list=<-loopback>",
+			// WebRTC would otherwise reach out over UDP on its own
+			"--force-webrtc-ip-handling-policy=disable_non_proxied_udp",
+		)
+	}
+	cmd := exec.Command(binary("chromium"), args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	// fd 3: the browser reads commands; fd 4: it writes replies and events
+	cmdRead, cmdWrite, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	replyRead, replyWrite, err := os.Pipe()
+	if err != nil {
+		cmdRead.Close()
+		cmdWrite.Close()
+		return err
+	}
+	cmd.ExtraFiles = []*os.File{cmdRead, replyWrite}
+	if err := cmd.Start(); err != nil {
+		cmdRead.Close()
+		cmdWrite.Close()
+		replyRead.Close()
+		replyWrite.Close()
+		return fmt.Errorf("Chromium failed to start: %v", err)
+	}
+	cmdRead.Close()
+	replyWrite.Close()
+	defer replyRead.Close()
+	defer cmdWrite.Close()
+
+	// Killing the browser breaks the pipe, which ends any pending read
+	timer := time.AfterFunc(opts.Timeout, func() { cmd.Process.Kill() })
+
+	cdp := &cdpPipe{w: cmdWrite, r: bufio.NewReader(replyRead)}
+	pdf, err := cdp.printPage(pageURL, opts)
+	if err == nil {
+		cdp.call("", "Browser.close", nil, nil)
+	} else {
+		cmd.Process.Kill()
+	}
+	cmd.Wait()
+	if !timer.Stop() {
+		return fmt.Errorf("Chromium timed out after %s", opts.Timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("Chromium failed: %v, output: %s", err, stderr.String())
+	}
+	return os.WriteFile(outputPath, pdf, 0644)
+}
+
+// cdpPipe is a minimal DevTools protocol client over the browser's pipe.
+type cdpPipe struct {
+	w      io.Writer
+	r      *bufio.Reader
+	nextID int
+	// lifecycle records the page lifecycle events seen, as
+	// "<loaderId> <name>"
+	lifecycle map[string]bool
+}
+
+type cdpMessage struct {
+	ID        int             `json:"id"`
+	Method    string          `json:"method"`
+	SessionID string          `json:"sessionId"`
+	Params    json.RawMessage `json:"params"`
+	Result    json.RawMessage `json:"result"`
+	Error     *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (c *cdpPipe) read() (cdpMessage, error) {
+	var msg cdpMessage
+	data, err := c.r.ReadBytes(0)
+	if err != nil {
+		return msg, fmt.Errorf("browser closed the DevTools pipe")
+	}
+	if err := json.Unmarshal(data[:len(data)-1], &msg); err != nil {
+		return msg, fmt.Errorf("unexpected DevTools message: %v", err)
+	}
+	if msg.Method == "Page.lifecycleEvent" {
+		var event struct {
+			LoaderID string `json:"loaderId"`
+			Name     string `json:"name"`
+		}
+		json.Unmarshal(msg.Params, &event)
+		if c.lifecycle == nil {
+			c.lifecycle = map[string]bool{}
+		}
+		c.lifecycle[event.LoaderID+" "+event.Name] = true
+	}
+	return msg, nil
+}
+
+// call sends a command (to a page when sessionID is set) and decodes its
+// result, recording the events that arrive meanwhile.
+func (c *cdpPipe) call(sessionID, method string, params, result interface{}) error {
+	c.nextID++
+	command := map[string]interface{}{"id": c.nextID, "method": method}
+	if params != nil {
+		command["params"] = params
+	}
+	if sessionID != "" {
+		command["sessionId"] = sessionID
+	}
+	data, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+	if _, err := c.w.Write(append(data, 0)); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return err
+		}
+		if msg.ID != c.nextID {
+			continue
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("%s: %s", method, msg.Error.Message)
+		}
+		if result != nil {
+			return json.Unmarshal(msg.Result, result)
+		}
+		return nil
+	}
+}
+
+// printPage opens pageURL in a new tab, waits for it and prints it.
+func (c *cdpPipe) printPage(pageURL string, opts PrintOptions) ([]byte, error) {
+	var target struct {
+		TargetID string `json:"targetId"`
+	}
+	if err := c.call("", "Target.createTarget", map[string]interface{}{"url": "about:blank"}, &target); err != nil {
+		return nil, err
+	}
+	var attached struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := c.call("", "Target.attachToTarget", map[string]interface{}{"targetId": target.TargetID, "flatten": true}, &attached); err != nil {
+		return nil, err
+	}
+	session := attached.SessionID
+	if err := c.call(session, "Page.enable", nil, nil); err != nil {
+		return nil, err
+	}
+	if err := c.call(session, "Page.setLifecycleEventsEnabled", map[string]interface{}{"enabled": true}, nil); err != nil {
+		return nil, err
+	}
+
+	var nav struct {
+		LoaderID  string `json:"loaderId"`
+		ErrorText string `json:"errorText"`
+	}
+	if err := c.call(session, "Page.navigate", map[string]interface{}{"url": pageURL}, &nav); err != nil {
+		return nil, err
+	}
+	if nav.ErrorText != "" {
+		return nil, fmt.Errorf("loading %s failed: %s", pageURL, nav.ErrorText)
+	}
+	waitFor := "load"
+	if opts.WaitNetworkIdle {
+		waitFor = "networkIdle"
+	}
+	for !c.lifecycle[nav.LoaderID+" "+waitFor] {
+		if _, err := c.read(); err != nil {
+			return nil, err
+		}
+	}
+
+	var printed struct {
+		Data string `json:"data"`
+	}
+	err := c.call(session, "Page.printToPDF", map[string]interface{}{
+		"landscape":       opts.Landscape,
+		"printBackground": opts.PrintBackground,
+		"paperWidth":      opts.PaperWidth,
+		"paperHeight":     opts.PaperHeight,
+		"marginTop":       opts.MarginTop,
+		"marginRight":     opts.MarginRight,
+		"marginBottom":    opts.MarginBottom,
+		"marginLeft":      opts.MarginLeft,
+	}, &printed)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(printed.Data)
+}
+
+// Chromium or wkhtmltopdf: Render an HTML page with its assets (a site
+// unpacked into siteDir) to PDF. The site is served from a loopback HTTP
+// server for the duration, rather than opened as a file: URL, so relative
+// links resolve while the page can't pull other local files into the PDF.
+// The page may load nothing but the site: the browser's traffic goes
+// through a proxy that only connects to that server (see startProxy), so
+// uploaded pages and their scripts can't reach internal services.
+// wkhtmltopdf is used when Chromium isn't installed; it ignores
+// WaitNetworkIdle.
+func HTMLToPDF(siteDir, entry, outputPath, profileDir string, opts PrintOptions) error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: http.FileServer(http.Dir(siteDir))}
+	go server.Serve(listener)
+	defer server.Close()
+
+	site := listener.Addr().String()
+	opts.Dial = siteOnly(site)
+	pageURL := (&url.URL{Scheme: "http", Host: site, Path: "/" + filepath.ToSlash(entry)}).String()
+	if _, err := exec.LookPath(binary("chromium")); err == nil {
+		return URLToPDF(pageURL, outputPath, profileDir, opts)
+	}
+	if _, err := exec.LookPath(binary("wkhtmltopdf")); err != nil {
+		return fmt.Errorf("neither Chromium nor wkhtmltopdf is installed")
+	}
+	proxy, stop, err := startProxy(opts.Dial)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	width, height := opts.PaperWidth, opts.PaperHeight
+	if opts.Landscape {
+		width, height = height, width
+	}
+	mm := func(inches float64) string { return fmt.Sprintf("%.2fmm", inches*25.4) }
+	args := []string{
+		"--quiet",
+		"--proxy", "http://" + proxy,
+		"--disable-local-file-access",
+		"--page-width", mm(width), "--page-height", mm(height),
+		"-T", mm(opts.MarginTop), "-R", mm(opts.MarginRight),
+		"-B", mm(opts.MarginBottom), "-L", mm(opts.MarginLeft),
+	}
+	if !opts.PrintBackground {
+		args = append(args, "--no-background")
+	}
+	args = append(args, pageURL, outputPath)
+	cmd := exec.Command(binary("wkhtmltopdf"), args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("wkhtmltopdf failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// siteOnly dials nothing but site, the address serving a page's bundle.
+func siteOnly(site string) Dialer {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr != site {
+			return nil, fmt.Errorf("%s is outside the page's own files", addr)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
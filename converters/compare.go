@@ -0,0 +1,214 @@
+package converters
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DiffLine is one line of a page diff.
+type DiffLine struct {
+	Op   string `json:"op"` // equal, insert, delete
+	Text string `json:"text"`
+}
+
+// PageDiff compares one page of two documents.
+type PageDiff struct {
+	Page   int        `json:"page"`
+	Status string     `json:"status"` // same, changed, added, removed
+	Lines  []DiffLine `json:"lines,omitempty"`
+}
+
+// Pages with more lines than this are reported as changed without a
+// line-by-line diff, to bound the quadratic diff.
+const maxDiffLines = 4000
+
+// pageTexts extracts the text of every page, split on form feeds.
+func pageTexts(inputPath string) ([]string, error) {
+	cmd := exec.Command(binary("pdftotext"), inputPath, "-")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("pdftotext failed: %v", err)
+	}
+	pages := strings.Split(string(output), "\f")
+	// pdftotext ends every page, including the last, with a form feed
+	if len(pages) > 0 && strings.TrimSpace(pages[len(pages)-1]) == "" {
+		pages = pages[:len(pages)-1]
+	}
+	return pages, nil
+}
+
+func textLines(page string) []string {
+	var lines []string
+	for _, l := range strings.Split(page, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, strings.Join(strings.Fields(l), " "))
+		}
+	}
+	return lines
+}
+
+// diffLines is a longest-common-subsequence line diff.
+func diffLines(a, b []string) []DiffLine {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []DiffLine
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, DiffLine{"equal", a[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, DiffLine{"delete", a[i]})
+			i++
+		default:
+			out = append(out, DiffLine{"insert", b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		out = append(out, DiffLine{"delete", a[i]})
+	}
+	for ; j < m; j++ {
+		out = append(out, DiffLine{"insert", b[j]})
+	}
+	return out
+}
+
+// Poppler (pdftotext): Per-page line diff of two PDFs. Unchanged pages
+// carry no lines.
+func CompareText(pathA, pathB string) ([]PageDiff, error) {
+	pagesA, err := pageTexts(pathA)
+	if err != nil {
+		return nil, err
+	}
+	pagesB, err := pageTexts(pathB)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := make([]PageDiff, 0, max(len(pagesA), len(pagesB)))
+	for p := 0; p < max(len(pagesA), len(pagesB)); p++ {
+		d := PageDiff{Page: p + 1}
+		switch {
+		case p >= len(pagesA):
+			d.Status = "added"
+			d.Lines = diffLines(nil, textLines(pagesB[p]))
+		case p >= len(pagesB):
+			d.Status = "removed"
+			d.Lines = diffLines(textLines(pagesA[p]), nil)
+		default:
+			a, b := textLines(pagesA[p]), textLines(pagesB[p])
+			if strings.Join(a, "\n") == strings.Join(b, "\n") {
+				d.Status = "same"
+			} else {
+				d.Status = "changed"
+				if len(a) <= maxDiffLines && len(b) <= maxDiffLines {
+					d.Lines = diffLines(a, b)
+				}
+			}
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, nil
+}
+
+// renderPage rasterizes one page to <prefix>.png.
+func renderPage(inputPath string, page, dpi int, prefix string) (string, error) {
+	args := []string{
+		"-png", "-singlefile",
+		"-r", strconv.Itoa(dpi),
+		"-f", strconv.Itoa(page), "-l", strconv.Itoa(page),
+		inputPath, prefix,
+	}
+	cmd := exec.Command(binary("pdftoppm"), args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("pdftoppm failed: %v, output: %s", err, string(output))
+	}
+	return prefix + ".png", nil
+}
+
+// Poppler (pdftoppm) + ImageMagick (compare): Visual diff PDF, one page per
+// compared page with differences highlighted in red. Pages whose sizes
+// differ are shown side by side. Returns the pages that changed.
+func CompareVisual(pathA, pathB, outputPath string, dpi int) ([]int, error) {
+	if dpi <= 0 {
+		dpi = 100
+	}
+	countA, err := PageCount(pathA)
+	if err != nil {
+		return nil, err
+	}
+	countB, err := PageCount(pathB)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(filepath.Dir(outputPath), "compare")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	var frames []string
+	var changed []int
+	for p := 1; p <= max(countA, countB); p++ {
+		frame := filepath.Join(dir, fmt.Sprintf("diff-%d.png", p))
+		var imgA, imgB string
+		if p <= countA {
+			if imgA, err = renderPage(pathA, p, dpi, filepath.Join(dir, fmt.Sprintf("a-%d", p))); err != nil {
+				return nil, err
+			}
+		}
+		if p <= countB {
+			if imgB, err = renderPage(pathB, p, dpi, filepath.Join(dir, fmt.Sprintf("b-%d", p))); err != nil {
+				return nil, err
+			}
+		}
+
+		switch {
+		case imgA == "" || imgB == "":
+			// Added or removed page: show it as is
+			frame = imgA + imgB
+			changed = append(changed, p)
+		default:
+			cmd := imageMagickCommand("compare", "-metric", "AE", "-fuzz", "1%", "-highlight-color", "red", imgA, imgB, frame)
+			output, err := cmd.CombinedOutput()
+			exitErr, _ := err.(*exec.ExitError)
+			switch {
+			case err == nil:
+			case exitErr != nil && exitErr.ExitCode() == 1:
+				changed = append(changed, p)
+			default:
+				// Usually mismatched page sizes
+				cmd = imageMagickCommand("convert", imgA, imgB, "+append", frame)
+				if out, err := cmd.CombinedOutput(); err != nil {
+					return nil, fmt.Errorf("ImageMagick compare failed: %s; side by side failed: %v, output: %s", string(output), err, string(out))
+				}
+				changed = append(changed, p)
+			}
+		}
+		frames = append(frames, frame)
+	}
+
+	if err := ImageToPDF(frames, outputPath); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
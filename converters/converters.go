@@ -1,28 +1,22 @@
 package converters
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 )
 
-// LibreOffice: DOCX -> PDF, PDF -> DOCX, PPT -> PDF, XLSX -> PDF
+// LibreOffice: DOCX/DOC/ODT/RTF, XLSX/XLS/ODS, PPTX/PPT/ODP -> PDF, PDF -> DOCX,
+// and between office formats of a kind (see OfficeConvertible)
 func LibreOfficeConvert(inputPath, outputDir, toFormat string) error {
-	sofficePath := "/opt/homebrew/bin/soffice"
-	if _, err := os.Stat(sofficePath); os.IsNotExist(err) {
-		sofficePath = "/Applications/LibreOffice.app/Contents/MacOS/soffice"
-	}
-	if _, err := os.Stat(sofficePath); os.IsNotExist(err) {
-		sofficePath = "/usr/bin/libreoffice"
-	}
-	if _, err := os.Stat(sofficePath); os.IsNotExist(err) {
-		sofficePath = "/usr/bin/soffice"
-	}
-	if _, err := os.Stat(sofficePath); os.IsNotExist(err) {
-		sofficePath = "soffice" // Fallback to PATH
-	}
+	sofficePath := binary("soffice")
 
 	absOutputDir, err := filepath.Abs(outputDir)
 	if err != nil {
@@ -41,7 +35,7 @@ func LibreOfficeConvert(inputPath, outputDir, toFormat string) error {
 	}
 
 	args := []string{
-		"-env:UserInstallation=file://" + userInstallDir,
+		"-env:UserInstallation=" + fileURL(userInstallDir),
 		"--headless",
 		"--convert-to", toFormat,
 		"--outdir", absOutputDir,
@@ -58,13 +52,53 @@ func LibreOfficeConvert(inputPath, outputDir, toFormat string) error {
 	return nil
 }
 
+// officeKinds groups the office formats LibreOffice converts between.
+var officeKinds = map[string]string{
+	"docx": "text", "doc": "text", "odt": "text", "rtf": "text", "txt": "text",
+	"xlsx": "spreadsheet", "xls": "spreadsheet", "ods": "spreadsheet", "csv": "spreadsheet",
+	"pptx": "presentation", "ppt": "presentation", "odp": "presentation",
+}
+
+// officeTargets are the formats LibreOffice writes for each kind.
+var officeTargets = map[string][]string{
+	"text":         {"docx", "doc", "odt", "rtf", "txt", "html"},
+	"spreadsheet":  {"xlsx", "xls", "ods", "csv", "html"},
+	"presentation": {"pptx", "ppt", "odp"},
+}
+
+// libreOfficeFilters pick export filters where LibreOffice's defaults don't
+// suit: text and CSV in UTF-8, and HTML with its images embedded rather
+// than written beside it. Spreadsheets export their first sheet to CSV.
+var libreOfficeFilters = map[string]string{
+	"text/txt":         "txt:Text (encoded):UTF8",
+	"text/html":        "html:XHTML Writer File:UTF8",
+	"spreadsheet/csv":  "csv:Text - txt - csv (StarCalc):44,34,76,1",
+	"spreadsheet/html": "html:XHTML Calc File:UTF8",
+}
+
+// OfficeConvertible reports whether LibreOffice converts from one office
+// format to another of the same kind, e.g. DOCX -> ODT or CSV -> XLSX.
+func OfficeConvertible(from, to string) bool {
+	kind := officeKinds[from]
+	return kind != "" && from != to && slices.Contains(officeTargets[kind], to)
+}
+
+// LibreOfficeTarget is the --convert-to argument for a conversion from one
+// format to another: the target format, with an export filter when needed.
+func LibreOfficeTarget(from, to string) string {
+	if filter, ok := libreOfficeFilters[officeKinds[from]+"/"+to]; ok {
+		return filter
+	}
+	return to
+}
+
 // Pandoc: TXT/MD -> PDF, HTML -> PDF
 func PandocConvert(inputPath, outputPath string) error {
 	args := []string{
 		inputPath,
 		"-o", outputPath,
 	}
-	cmd := exec.Command("pandoc", args...)
+	cmd := exec.Command(binary("pandoc"), args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("Pandoc failed: %v, output: %s", err, string(output))
@@ -72,8 +106,36 @@ func PandocConvert(inputPath, outputPath string) error {
 	return nil
 }
 
+// Calibre (ebook-convert): PDF -> EPUB. Calibre reflows the PDF's text into
+// chapters, which Pandoc cannot read at all.
+func EbookConvert(inputPath, outputPath string) error {
+	cmd := exec.Command(binary("calibre"), inputPath, outputPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ebook-convert failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// ImageOptions tune PDFToImage. Zero values keep pdftoppm's defaults
+// (150 DPI, its default JPEG quality).
+type ImageOptions struct {
+	DPI int
+	// AutoDPI picks the resolution per page instead (see AutoDPI).
+	AutoDPI bool
+	// Quality is the JPEG quality, 1-100.
+	Quality int
+	// ScaleTo fits each page's longer side to this many pixels, overriding
+	// the resolution.
+	ScaleTo int
+	// FirstPage and LastPage limit rendering to a range of pages; zero
+	// means the document's first or last page.
+	FirstPage int
+	LastPage  int
+}
+
 // Poppler (pdftoppm): PDF -> JPG/PNG
-func PDFToImage(inputPath, outputPrefix, format string) error {
+func PDFToImage(inputPath, outputPrefix, format string, opts ImageOptions) error {
 	var fmtFlag string
 	if format == "jpg" || format == "jpeg" {
 		fmtFlag = "-jpeg"
@@ -83,12 +145,26 @@ func PDFToImage(inputPath, outputPrefix, format string) error {
 		return fmt.Errorf("unsupported image format: %s", format)
 	}
 
-	args := []string{
-		fmtFlag,
-		inputPath,
-		outputPrefix,
+	args := []string{fmtFlag}
+	if opts.Quality > 0 && fmtFlag == "-jpeg" {
+		args = append(args, "-jpegopt", "quality="+strconv.Itoa(opts.Quality))
 	}
-	cmd := exec.Command("pdftoppm", args...)
+	switch {
+	case opts.ScaleTo > 0:
+		args = append(args, "-scale-to", strconv.Itoa(opts.ScaleTo))
+	case opts.AutoDPI:
+		return pdfToImageAutoDPI(inputPath, outputPrefix, args, opts.FirstPage, opts.LastPage)
+	case opts.DPI > 0:
+		args = append(args, "-r", strconv.Itoa(opts.DPI))
+	}
+	if opts.FirstPage > 0 {
+		args = append(args, "-f", strconv.Itoa(opts.FirstPage))
+	}
+	if opts.LastPage > 0 {
+		args = append(args, "-l", strconv.Itoa(opts.LastPage))
+	}
+	args = append(args, inputPath, outputPrefix)
+	cmd := exec.Command(binary("pdftoppm"), args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("pdftoppm failed: %v, output: %s", err, string(output))
@@ -96,10 +172,22 @@ func PDFToImage(inputPath, outputPrefix, format string) error {
 	return nil
 }
 
-// ImageMagick: JPG/PNG -> PDF, Multiple images -> PDF
+// ImageMagick: Images -> PDF, one page per image. Besides JPG and PNG this
+// takes TIFF, BMP, GIF (first frame), WebP and HEIC/HEIF; the last two go
+// through dwebp or heif-convert first when ImageMagick lacks the delegate.
 func ImageToPDF(inputPaths []string, outputPath string) error {
-	args := append(inputPaths, outputPath)
-	cmd := exec.Command("convert", args...)
+	dir := filepath.Dir(outputPath)
+	args := make([]string, 0, len(inputPaths)+1)
+	for i, in := range inputPaths {
+		input, cleanup, err := imageMagickInput(in, filepath.Join(dir, fmt.Sprintf("image-%d.png", i+1)))
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		args = append(args, input)
+	}
+	args = append(args, outputPath)
+	cmd := imageMagickCommand("convert", args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("ImageMagick failed: %v, output: %s", err, string(output))
@@ -107,10 +195,27 @@ func ImageToPDF(inputPaths []string, outputPath string) error {
 	return nil
 }
 
+// librsvg (rsvg-convert) or Inkscape: SVG -> PDF, keeping vectors and text
+// as vectors and text. rsvg-convert is preferred; Inkscape handles the SVG
+// features librsvg lacks but is much slower to start.
+func SVGToPDF(inputPath, outputPath string) error {
+	var cmd *exec.Cmd
+	if _, err := exec.LookPath(binary("rsvg")); err == nil {
+		cmd = exec.Command(binary("rsvg"), "-f", "pdf", "-o", outputPath, inputPath)
+	} else {
+		cmd = exec.Command(binary("inkscape"), "--export-type=pdf", "--export-filename="+outputPath, inputPath)
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %v, output: %s", filepath.Base(cmd.Path), err, string(output))
+	}
+	return nil
+}
+
 // Poppler (pdfunite): Merge PDFs
 func MergePDFs(inputPaths []string, outputPath string) error {
 	args := append(inputPaths, outputPath)
-	cmd := exec.Command("pdfunite", args...)
+	cmd := exec.Command(binary("pdfunite"), args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("pdfunite failed: %v, output: %s", err, string(output))
@@ -125,7 +230,7 @@ func SplitPDF(inputPath, outputPattern string) error {
 		inputPath,
 		outputPattern,
 	}
-	cmd := exec.Command("pdfseparate", args...)
+	cmd := exec.Command(binary("pdfseparate"), args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("pdfseparate failed: %v, output: %s", err, string(output))
@@ -133,19 +238,146 @@ func SplitPDF(inputPath, outputPattern string) error {
 	return nil
 }
 
+// CompressionLevels are the Ghostscript PDFSETTINGS presets, smallest
+// output first.
+var CompressionLevels = []string{"screen", "ebook", "printer", "prepress"}
+
+// CompressOptions tune CompressPDF. Level is one of CompressionLevels
+// (default "screen"). Quality, from 1 to 100, overrides the preset's image
+// handling: images are downsampled to between 72 and 300 DPI and JPEG
+// encoded at that quality.
+type CompressOptions struct {
+	Level   string
+	Quality int
+}
+
 // Ghostscript: Compress PDF
-func CompressPDF(inputPath, outputPath string) error {
+func CompressPDF(inputPath, outputPath string, opts CompressOptions) error {
+	level := opts.Level
+	if level == "" {
+		level = "screen"
+	}
+	known := false
+	for _, l := range CompressionLevels {
+		known = known || l == level
+	}
+	if !known {
+		return fmt.Errorf("unknown compression level: %s", level)
+	}
+	if opts.Quality < 0 || opts.Quality > 100 {
+		return fmt.Errorf("compression quality must be between 1 and 100")
+	}
+
 	args := []string{
 		"-sDEVICE=pdfwrite",
 		"-dCompatibilityLevel=1.4",
-		"-dPDFSETTINGS=/screen", // /screen is lowest, /ebook is medium, /printer and /prepress are higher
+		"-dPDFSETTINGS=/" + level,
 		"-dNOPAUSE",
 		"-dQUIET",
 		"-dBATCH",
-		"-sOutputFile=" + outputPath,
+	}
+	if opts.Quality > 0 {
+		dpi := strconv.Itoa(72 + (300-72)*opts.Quality/100)
+		args = append(args,
+			"-dDownsampleColorImages=true", "-dColorImageResolution="+dpi,
+			"-dDownsampleGrayImages=true", "-dGrayImageResolution="+dpi,
+			"-dAutoFilterColorImages=false", "-dColorImageFilter=/DCTEncode",
+			"-dAutoFilterGrayImages=false", "-dGrayImageFilter=/DCTEncode",
+			"-dJPEGQ="+strconv.Itoa(opts.Quality),
+		)
+	}
+	args = append(args, "-sOutputFile="+outputPath, inputPath)
+	cmd := exec.Command(binary("gs"), args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Ghostscript failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// Ghostscript: Replace every page by an image of itself at dpi, so text
+// and vector content can no longer be extracted
+func RasterizePDF(inputPath, outputPath string, dpi int) error {
+	cmd := exec.Command(binary("gs"),
+		"-sDEVICE=pdfimage24",
+		"-dNOPAUSE", "-dQUIET", "-dBATCH",
+		fmt.Sprintf("-r%d", dpi),
+		"-sOutputFile="+outputPath,
 		inputPath,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Ghostscript rasterize failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// QPDF: AES-256 encryption. Readers opening the PDF with userPassword may
+// view it and print at low resolution, but not copy text or modify it;
+// ownerPassword lifts those restrictions.
+func EncryptPDF(inputPath, outputPath, userPassword, ownerPassword string) error {
+	if strings.ContainsAny(userPassword+ownerPassword, "\r\n") {
+		return fmt.Errorf("passwords cannot contain line breaks")
+	}
+	// Pass the passwords in an argument file, not on the command line
+	// where other local users could read them
+	args := []string{
+		"--encrypt", userPassword, ownerPassword, "256",
+		"--print=low", "--extract=n", "--modify=none", "--",
+	}
+	argsPath := outputPath + ".args"
+	if err := os.WriteFile(argsPath, []byte(strings.Join(args, "\n")+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write qpdf arguments: %v", err)
+	}
+	defer os.Remove(argsPath)
+	cmd := exec.Command(binary("qpdf"), "@"+argsPath, inputPath, outputPath)
+	output, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 3 {
+		return nil
 	}
-	cmd := exec.Command("gs", args...)
+	if err != nil {
+		return fmt.Errorf("qpdf encrypt failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// TIFFModes are the PDFToTIFF output modes: 24-bit color, or bilevel
+// CCITT Group 4 as fax and document archives expect.
+var TIFFModes = map[string]string{
+	"color": "tiff24nc",
+	"fax":   "tiffg4",
+}
+
+// Ghostscript: PDF -> multipage TIFF, one image per page in a single file.
+// dpi defaults to 200 (fax "fine" resolution); first and last limit the
+// pages, zero meaning the document's first or last page.
+func PDFToTIFF(inputPath, outputPath, mode string, dpi, first, last int) error {
+	if mode == "" {
+		mode = "color"
+	}
+	device, ok := TIFFModes[mode]
+	if !ok {
+		return fmt.Errorf("unknown TIFF mode: %s", mode)
+	}
+	if dpi <= 0 {
+		dpi = 200
+	}
+	args := []string{
+		"-sDEVICE=" + device,
+		"-r" + strconv.Itoa(dpi),
+		"-dNOPAUSE",
+		"-dQUIET",
+		"-dBATCH",
+		"-dSAFER",
+	}
+	if first > 0 {
+		args = append(args, "-dFirstPage="+strconv.Itoa(first))
+	}
+	if last > 0 {
+		args = append(args, "-dLastPage="+strconv.Itoa(last))
+	}
+	args = append(args, "-sOutputFile="+outputPath, inputPath)
+	cmd := exec.Command(binary("gs"), args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("Ghostscript failed: %v, output: %s", err, string(output))
@@ -153,13 +385,50 @@ func CompressPDF(inputPath, outputPath string) error {
 	return nil
 }
 
+// Ghostscript: PDF -> PDF/A-2b for archiving
+func ConvertToPDFA(inputPath, outputPath string) error {
+	args := []string{
+		"-dPDFA=2",
+		"-dPDFACompatibilityPolicy=1", // drop features PDF/A forbids instead of failing
+		"-sColorConversionStrategy=RGB",
+		"-sDEVICE=pdfwrite",
+		"-dNOPAUSE",
+		"-dQUIET",
+		"-dBATCH",
+		"-sOutputFile=" + outputPath,
+		inputPath,
+	}
+	cmd := exec.Command(binary("gs"), args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Ghostscript PDF/A failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
+
 // Poppler (pdftotext): Extract Text
 func ExtractText(inputPath, outputPath string) error {
 	args := []string{
 		inputPath,
 		outputPath,
 	}
-	cmd := exec.Command("pdftotext", args...)
+	cmd := exec.Command(binary("pdftotext"), args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("pdftotext failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// Poppler (pdftotext): Extract text of pages first..last
+func ExtractTextRange(inputPath, outputPath string, first, last int) error {
+	args := []string{
+		"-f", strconv.Itoa(first),
+		"-l", strconv.Itoa(last),
+		inputPath,
+		outputPath,
+	}
+	cmd := exec.Command(binary("pdftotext"), args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("pdftotext failed: %v, output: %s", err, string(output))
@@ -174,7 +443,7 @@ func ExtractImages(inputPath, outputPrefix string) error {
 		inputPath,
 		outputPrefix,
 	}
-	cmd := exec.Command("pdfimages", args...)
+	cmd := exec.Command(binary("pdfimages"), args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("pdfimages failed: %v, output: %s", err, string(output))
@@ -182,15 +451,25 @@ func ExtractImages(inputPath, outputPrefix string) error {
 	return nil
 }
 
-// QPDF: Rotate PDF
-func RotatePDF(inputPath, outputPath string, angle int) error {
-	// angle can be 90, 180, 270
-	args := []string{
-		inputPath,
-		"--rotate=+" + fmt.Sprintf("%d", angle),
-		outputPath,
+// PageRotation turns Pages (every page when empty) by Angle degrees
+// clockwise; Angle is a multiple of 90 and may be negative.
+type PageRotation struct {
+	Pages []int
+	Angle int
+}
+
+// QPDF: Rotate PDF, each selection of pages by its own angle
+func RotatePDF(inputPath, outputPath string, rotations ...PageRotation) error {
+	args := []string{inputPath}
+	for _, rot := range rotations {
+		flag := fmt.Sprintf("--rotate=%+d", rot.Angle)
+		if len(rot.Pages) > 0 {
+			flag += ":" + pageList(rot.Pages)
+		}
+		args = append(args, flag)
 	}
-	cmd := exec.Command("qpdf", args...)
+	args = append(args, outputPath)
+	cmd := exec.Command(binary("qpdf"), args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("qpdf rotate failed: %v, output: %s", err, string(output))
@@ -206,10 +485,80 @@ func ReorderPDF(inputPath, outputPath string, pageOrder string) error {
 		"--pages", ".", pageOrder, "--",
 		outputPath,
 	}
-	cmd := exec.Command("qpdf", args...)
+	cmd := exec.Command(binary("qpdf"), args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("qpdf reorder failed: %v, output: %s", err, string(output))
 	}
 	return nil
 }
+
+// Poppler (pdfinfo): Page count
+func PageCount(inputPath string) (int, error) {
+	cmd := exec.Command(binary("pdfinfo"), inputPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("pdfinfo failed: %v, output: %s", err, string(output))
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "Pages:") {
+			return strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Pages:")))
+		}
+	}
+	return 0, fmt.Errorf("pdfinfo output has no page count")
+}
+
+// Poppler (pdftotext): Text of a whole PDF to memory, with the warnings
+// pdftotext printed along the way (damaged xref, missing fonts, ...).
+func ExtractTextWithWarnings(inputPath string) (text string, warnings []string, err error) {
+	cmd := exec.Command(binary("pdftotext"), "-enc", "UTF-8", inputPath, "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	for _, line := range strings.Split(stderr.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			warnings = append(warnings, line)
+		}
+	}
+	if err != nil {
+		return "", warnings, fmt.Errorf("pdftotext failed: %v, output: %s", err, stderr.String())
+	}
+	return string(output), warnings, nil
+}
+
+// Poppler (pdftotext): Text page by page as pdftotext produces it, so memory
+// stays flat however long the document is. Stops early if fn fails.
+func StreamPageText(inputPath string, fn func(page int, text string) error) error {
+	cmd := exec.Command(binary("pdftotext"), "-enc", "UTF-8", inputPath, "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("pdftotext failed: %v", err)
+	}
+
+	reader := bufio.NewReader(stdout)
+	page := 0
+	var fnErr error
+	for fnErr == nil {
+		// Every page, including the last, ends with a form feed
+		text, err := reader.ReadString('\f')
+		if err != nil {
+			break
+		}
+		page++
+		fnErr = fn(page, strings.TrimSuffix(text, "\f"))
+	}
+	if fnErr != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fnErr
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("pdftotext failed: %v, output: %s", err, stderr.String())
+	}
+	return nil
+}
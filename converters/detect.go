@@ -0,0 +1,123 @@
+package converters
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DetectFormat names the format of a file from its leading bytes, using the
+// extension to tell apart containers (ZIP, OLE) shared by several formats.
+func DetectFormat(path string) string {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	f, err := os.Open(path)
+	if err != nil {
+		return ext
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := f.Read(head)
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return "pdf"
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(head, []byte("\xff\xd8\xff")):
+		return "jpg"
+	case bytes.HasPrefix(head, []byte("GIF8")):
+		return "gif"
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return "tiff"
+	case bytes.HasPrefix(head, []byte("BM")) && ext == "bmp":
+		return "bmp"
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && string(head[8:12]) == "WEBP":
+		return "webp"
+	case len(head) >= 12 && string(head[4:8]) == "ftyp" && heifBrands[string(head[8:12])]:
+		return "heic"
+	case bytes.HasPrefix(head, []byte(`{\rtf`)):
+		return "rtf"
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		switch ext {
+		case "docx", "xlsx", "pptx", "odt", "ods", "odp", "epub":
+			return ext
+		}
+		return "zip"
+	case bytes.HasPrefix(head, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")):
+		switch ext {
+		case "doc", "xls", "ppt", "msg":
+			return ext
+		}
+		return "ole"
+	}
+	return ext
+}
+
+// InferFormat names a file's format for a conversion whose source format
+// wasn't given: from its leading bytes, then its extension. Zip containers
+// without a telling extension are looked inside; files whose format is
+// still unclear are an error naming the candidates.
+func InferFormat(path string) (string, error) {
+	switch format := DetectFormat(path); format {
+	case "zip":
+		if inner := zipDocumentFormat(path); inner != "" {
+			return inner, nil
+		}
+		return "", fmt.Errorf("the file is a zip archive, not a document")
+	case "ole":
+		return "", fmt.Errorf("the file is a legacy Office document (doc, xls, ppt or msg); name it with its extension or pass from")
+	case "":
+		return "", fmt.Errorf("the file has no extension and its content isn't recognised; pass from")
+	default:
+		return format, nil
+	}
+}
+
+// zipDocumentFormat tells OOXML, OpenDocument and EPUB files apart by their
+// contents, or returns "".
+func zipDocumentFormat(path string) string {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return ""
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		switch {
+		case f.Name == "mimetype":
+			rc, err := f.Open()
+			if err != nil {
+				return ""
+			}
+			mimetype, _ := io.ReadAll(io.LimitReader(rc, 100))
+			rc.Close()
+			switch strings.TrimSpace(string(mimetype)) {
+			case "application/vnd.oasis.opendocument.text":
+				return "odt"
+			case "application/vnd.oasis.opendocument.spreadsheet":
+				return "ods"
+			case "application/vnd.oasis.opendocument.presentation":
+				return "odp"
+			case "application/epub+zip":
+				return "epub"
+			}
+		case strings.HasPrefix(f.Name, "word/"):
+			return "docx"
+		case strings.HasPrefix(f.Name, "xl/"):
+			return "xlsx"
+		case strings.HasPrefix(f.Name, "ppt/"):
+			return "pptx"
+		}
+	}
+	return ""
+}
+
+// heifBrands are the ISO BMFF major brands of HEIC/HEIF images.
+var heifBrands = map[string]bool{
+	"heic": true, "heix": true, "hevc": true, "heim": true, "heis": true,
+	"mif1": true, "msf1": true,
+}
@@ -0,0 +1,453 @@
+package converters
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Email is a parsed email message, from an .eml file or an Outlook .msg.
+type Email struct {
+	From, To, Cc, Date, Subject string
+	TextBody, HTMLBody          string
+	Attachments                 []EmailAttachment
+}
+
+// EmailAttachment is an attached file, an inline image referenced from the
+// HTML body by Content-ID, or an attached email.
+type EmailAttachment struct {
+	Name, ContentType, ContentID string
+	Data                         []byte
+	Message                      *Email
+}
+
+// emailMaxDepth bounds the nesting of multipart bodies and attached emails.
+const emailMaxDepth = 8
+
+// ParseEML reads an RFC 5322 email with its MIME parts.
+func ParseEML(path string) (*Email, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseEML(f, 0)
+}
+
+func parseEML(r io.Reader, depth int) (*Email, error) {
+	msg, err := mail.ReadMessage(bufio.NewReader(r))
+	if err != nil {
+		return nil, fmt.Errorf("not an email: %v", err)
+	}
+	e := &Email{
+		From:    decodeMIMEHeader(msg.Header.Get("From")),
+		To:      decodeMIMEHeader(msg.Header.Get("To")),
+		Cc:      decodeMIMEHeader(msg.Header.Get("Cc")),
+		Subject: decodeMIMEHeader(msg.Header.Get("Subject")),
+		Date:    msg.Header.Get("Date"),
+	}
+	if t, err := mail.ParseDate(e.Date); err == nil {
+		e.Date = t.Format(emailDateLayout)
+	}
+	if err := e.addPart(textproto.MIMEHeader(msg.Header), msg.Body, depth); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+const emailDateLayout = "Mon, 2 Jan 2006 15:04:05 -0700"
+
+// addPart files a MIME part of the message as a body, an attachment or,
+// for multiparts, its parts.
+func (e *Email) addPart(header textproto.MIMEHeader, body io.Reader, depth int) error {
+	if depth > emailMaxDepth {
+		return fmt.Errorf("email nests too deeply")
+	}
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				// Keep what was readable of a truncated message
+				return nil
+			}
+			if err := e.addPart(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	var decoded io.Reader = body
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		decoded = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		decoded = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(decoded)
+	if err != nil && len(data) == 0 {
+		return fmt.Errorf("unreadable %s part: %v", mediaType, err)
+	}
+
+	disposition, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	name := decodeMIMEHeader(dispParams["filename"])
+	if name == "" {
+		name = decodeMIMEHeader(params["name"])
+	}
+	isBody := disposition != "attachment" && name == ""
+	switch {
+	case isBody && mediaType == "text/plain" && e.TextBody == "":
+		e.TextBody = decodeCharset(data, params["charset"])
+	case isBody && mediaType == "text/html" && e.HTMLBody == "":
+		e.HTMLBody = decodeCharset(data, params["charset"])
+	default:
+		a := EmailAttachment{
+			Name:        name,
+			ContentType: mediaType,
+			ContentID:   strings.Trim(header.Get("Content-Id"), "<> "),
+			Data:        data,
+		}
+		if mediaType == "message/rfc822" {
+			if nested, err := parseEML(bytes.NewReader(data), depth+1); err == nil {
+				a.Message = nested
+				if a.Name == "" {
+					a.Name = nested.Subject + ".eml"
+				}
+			}
+		}
+		e.Attachments = append(e.Attachments, a)
+	}
+	return nil
+}
+
+// decodeMIMEHeader decodes RFC 2047 encoded words ("=?UTF-8?Q?...?=").
+func decodeMIMEHeader(s string) string {
+	dec := mime.WordDecoder{CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		return strings.NewReader(decodeCharset(data, charset)), nil
+	}}
+	if decoded, err := dec.DecodeHeader(s); err == nil {
+		return decoded
+	}
+	return s
+}
+
+// windows1252 maps the bytes 0x80-0x9F of Windows-1252, where it differs
+// from Latin-1.
+var windows1252 = []rune("€\u0081‚ƒ„…†‡ˆ‰Š‹Œ\u008dŽ\u008f\u0090‘’“”•–—˜™š›œ\u009džŸ")
+
+// decodeCharset converts text in the common email charsets to UTF-8. Other
+// charsets are passed through as if UTF-8.
+func decodeCharset(data []byte, charset string) string {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "iso-8859-1", "latin1", "iso-8859-15", "windows-1252", "cp1252":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+			if b >= 0x80 && b <= 0x9F {
+				runes[i] = windows1252[b-0x80]
+			}
+		}
+		return string(runes)
+	}
+	return string(data)
+}
+
+// inlineParts reports the attachments the HTML body shows in place, by
+// Content-ID.
+func (e *Email) inlineParts() map[int]bool {
+	inline := map[int]bool{}
+	for i, a := range e.Attachments {
+		if a.ContentID != "" && strings.Contains(e.HTMLBody, "cid:"+a.ContentID) {
+			inline[i] = true
+		}
+	}
+	return inline
+}
+
+var (
+	emailScript  = regexp.MustCompile(`(?is)<script\b.*?</script\s*>`)
+	emailStyle   = regexp.MustCompile(`(?is)<style\b.*?</style\s*>`)
+	emailBody    = regexp.MustCompile(`(?is)<body\b[^>]*>(.*?)(?:</body\s*>|$)`)
+	emailHead    = regexp.MustCompile(`(?is)<head\b.*?</head\s*>`)
+	emailOpening = regexp.MustCompile(`(?is)<!doctype[^>]*>|</?html\b[^>]*>`)
+	// emailRemote matches links to remote images, such as tracking pixels
+	emailRemote = regexp.MustCompile(`(?i)\b(src|background)\s*=\s*(["'])\s*(?:https?:)?//[^"']*["']`)
+)
+
+// emailPolicy keeps an email's HTML from running scripts or fetching
+// anything (tracking pixels included) beyond its own inline images.
+const emailPolicy = `default-src 'none'; img-src 'self' data:; style-src 'self' 'unsafe-inline'; font-src 'self' data:`
+
+const emailCSS = `
+body { font-family: Helvetica, Arial, sans-serif; font-size: 11pt; }
+table.pdfbe-email { border-collapse: collapse; margin-bottom: 1em; }
+table.pdfbe-email th { text-align: left; vertical-align: top; padding: 2px 12px 2px 0; white-space: nowrap; }
+table.pdfbe-email td { padding: 2px 0; }
+pre.pdfbe-email { white-space: pre-wrap; word-wrap: break-word; font-family: inherit; }
+`
+
+// writeHTML lays the email out as a page in dir: a block with the sender,
+// recipients, date, subject and attachments, then the body, with its
+// inline images next to it. notes annotate attachments in the list.
+func (e *Email) writeHTML(dir string, inline map[int]bool, notes map[int]string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	body, styles := "", ""
+	if e.HTMLBody != "" {
+		doc := emailScript.ReplaceAllString(e.HTMLBody, "")
+		// Not every renderer enforces emailPolicy
+		doc = emailRemote.ReplaceAllString(doc, `$1=""`)
+		for _, style := range emailStyle.FindAllString(emailHead.FindString(doc), -1) {
+			styles += style + "\n"
+		}
+		if m := emailBody.FindStringSubmatch(doc); m != nil {
+			body = m[1]
+		} else {
+			body = emailOpening.ReplaceAllString(emailHead.ReplaceAllString(doc, ""), "")
+		}
+		for i, a := range e.Attachments {
+			if !inline[i] {
+				continue
+			}
+			name := fmt.Sprintf("inline-%d%s", i+1, attachmentExt(a))
+			if err := os.WriteFile(filepath.Join(dir, name), a.Data, 0644); err != nil {
+				return err
+			}
+			body = strings.ReplaceAll(body, "cid:"+a.ContentID, url.PathEscape(name))
+		}
+	} else {
+		body = `<pre class="pdfbe-email">` + html.EscapeString(e.TextBody) + "</pre>"
+	}
+
+	var page strings.Builder
+	page.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&page, "<meta http-equiv=\"Content-Security-Policy\" content=\"%s\">\n", emailPolicy)
+	fmt.Fprintf(&page, "<title>%s</title>\n<style>%s</style>\n%s</head><body>\n", html.EscapeString(e.Subject), emailCSS, styles)
+	page.WriteString("<table class=\"pdfbe-email\">\n")
+	row := func(label, value string) {
+		if value != "" {
+			fmt.Fprintf(&page, "<tr><th>%s</th><td>%s</td></tr>\n", label, html.EscapeString(value))
+		}
+	}
+	row("From:", e.From)
+	row("To:", e.To)
+	row("Cc:", e.Cc)
+	row("Date:", e.Date)
+	row("Subject:", e.Subject)
+	var listed []string
+	for i, a := range e.Attachments {
+		if inline[i] {
+			continue
+		}
+		item := attachmentName(a, i)
+		if len(a.Data) > 0 {
+			item += " (" + formatBytes(int64(len(a.Data))) + ")"
+		}
+		if note := notes[i]; note != "" {
+			item += " - " + note
+		}
+		listed = append(listed, html.EscapeString(item))
+	}
+	if len(listed) > 0 {
+		fmt.Fprintf(&page, "<tr><th>Attachments:</th><td>%s</td></tr>\n", strings.Join(listed, "<br>"))
+	}
+	page.WriteString("</table>\n<hr>\n")
+	page.WriteString(body)
+	page.WriteString("\n</body></html>\n")
+	return os.WriteFile(filepath.Join(dir, "index.html"), []byte(page.String()), 0644)
+}
+
+// attachmentName names an attachment for the list, numbering unnamed ones.
+func attachmentName(a EmailAttachment, i int) string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return fmt.Sprintf("attachment-%d%s", i+1, attachmentExt(a))
+}
+
+// attachmentExt is an attachment's file extension, from its name or else
+// its content type.
+func attachmentExt(a EmailAttachment) string {
+	if ext := filepath.Ext(a.Name); ext != "" {
+		return strings.ToLower(ext)
+	}
+	if a.Message != nil {
+		return ".eml"
+	}
+	if exts, _ := mime.ExtensionsByType(a.ContentType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// Go (net/mail, MS-OXMSG) + Chromium, wkhtmltopdf or LibreOffice: Email
+// (.eml, Outlook .msg) -> PDF. The page shows the headers, the attachment
+// list and the body with its inline images; the body's scripts and remote
+// content are blocked. With appendAttachments, attachments that can be
+// turned into PDFs (PDFs, images, office documents, attached emails)
+// follow as further pages.
+func EmailToPDF(inputPath, outputPath string, appendAttachments bool) error {
+	var e *Email
+	var err error
+	if strings.EqualFold(filepath.Ext(inputPath), ".msg") {
+		e, err = ParseMSG(inputPath)
+	} else {
+		e, err = ParseEML(inputPath)
+	}
+	if err != nil {
+		return err
+	}
+	return e.renderPDF(filepath.Join(filepath.Dir(outputPath), "email"), outputPath, appendAttachments, 0)
+}
+
+func (e *Email) renderPDF(workDir, outputPath string, appendAttachments bool, depth int) error {
+	inline := e.inlineParts()
+	notes := map[int]string{}
+	var appended []string
+	if appendAttachments {
+		for i, a := range e.Attachments {
+			if inline[i] {
+				continue
+			}
+			pdf, err := attachmentPDF(a, filepath.Join(workDir, fmt.Sprintf("attachment-%d", i+1)), depth)
+			switch {
+			case err != nil:
+				notes[i] = "could not be appended"
+			case pdf == "":
+				notes[i] = "not appended (format not supported)"
+			default:
+				notes[i] = "appended"
+				appended = append(appended, pdf)
+			}
+		}
+	}
+
+	siteDir := filepath.Join(workDir, "site")
+	if err := e.writeHTML(siteDir, inline, notes); err != nil {
+		return err
+	}
+	pagePath := outputPath
+	if len(appended) > 0 {
+		pagePath = filepath.Join(workDir, "email.pdf")
+	}
+	if err := emailPagePDF(siteDir, pagePath, filepath.Join(workDir, "profile")); err != nil {
+		return err
+	}
+	if len(appended) == 0 {
+		return nil
+	}
+	return MergePDFs(append([]string{pagePath}, appended...), outputPath)
+}
+
+// emailPagePDF prints the email page with Chromium or wkhtmltopdf, or with
+// LibreOffice when neither is installed.
+func emailPagePDF(siteDir, outputPath, profileDir string) error {
+	_, chromiumErr := exec.LookPath(binary("chromium"))
+	_, wkhtmlErr := exec.LookPath(binary("wkhtmltopdf"))
+	if chromiumErr == nil || wkhtmlErr == nil {
+		letter := PaperSizes["letter"]
+		return HTMLToPDF(siteDir, "index.html", outputPath, profileDir, PrintOptions{
+			PaperWidth: letter[0], PaperHeight: letter[1],
+			MarginTop: 0.5, MarginRight: 0.5, MarginBottom: 0.5, MarginLeft: 0.5,
+			PrintBackground: true,
+		})
+	}
+	if err := LibreOfficeConvert(filepath.Join(siteDir, "index.html"), siteDir, "pdf"); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(siteDir, "index.pdf"), outputPath)
+}
+
+// emailOfficeAttachments are the attachment types LibreOffice converts.
+var emailOfficeAttachments = map[string]bool{
+	".doc": true, ".docx": true, ".odt": true, ".rtf": true, ".txt": true,
+	".xls": true, ".xlsx": true, ".ods": true, ".csv": true,
+	".ppt": true, ".pptx": true, ".odp": true,
+}
+
+// attachmentPDF turns an attachment into a PDF in dir and returns its path,
+// or "" for formats it can't convert.
+func attachmentPDF(a EmailAttachment, dir string, depth int) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	ext := attachmentExt(a)
+	if a.Message == nil && ext == ".msg" && depth < emailMaxDepth {
+		path := filepath.Join(dir, "attachment.msg")
+		if err := os.WriteFile(path, a.Data, 0644); err != nil {
+			return "", err
+		}
+		nested, err := ParseMSG(path)
+		if err != nil {
+			return "", err
+		}
+		a.Message = nested
+	}
+	if a.Message != nil {
+		if depth >= emailMaxDepth {
+			return "", nil
+		}
+		out := filepath.Join(dir, "message.pdf")
+		return out, a.Message.renderPDF(dir, out, true, depth+1)
+	}
+
+	path := filepath.Join(dir, "attachment"+ext)
+	if err := os.WriteFile(path, a.Data, 0644); err != nil {
+		return "", err
+	}
+	out := filepath.Join(dir, "attachment.pdf")
+	switch {
+	case ext == ".pdf":
+		return path, nil
+	case ext == ".svg":
+		return out, SVGToPDF(path, out)
+	case emailImageAttachments[ext]:
+		return out, ImageToPDF([]string{path}, out)
+	case emailOfficeAttachments[ext]:
+		return out, LibreOfficeConvert(path, dir, "pdf")
+	}
+	return "", nil
+}
+
+// emailImageAttachments are the attachment types ImageMagick converts.
+var emailImageAttachments = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".bmp": true,
+	".tif": true, ".tiff": true, ".webp": true, ".heic": true, ".heif": true,
+}
@@ -0,0 +1,237 @@
+package converters
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Engine binaries are resolved once and cached. An explicit <NAME>_PATH
+// environment variable (e.g. SOFFICE_PATH, GS_PATH, MAGICK_PATH) always wins.
+var (
+	binMu    sync.Mutex
+	binCache = map[string]string{}
+)
+
+// tool describes how to find one engine binary on each platform.
+type tool struct {
+	key        string   // cache key and env override prefix
+	names      []string // executable names tried on PATH, in order
+	candidates []string // absolute paths or globs tried before PATH
+}
+
+func sofficeTool() tool {
+	t := tool{key: "soffice", names: []string{"soffice", "libreoffice"}}
+	switch runtime.GOOS {
+	case "darwin":
+		t.candidates = []string{
+			"/opt/homebrew/bin/soffice", // Apple Silicon Homebrew
+			"/usr/local/bin/soffice",    // Intel Homebrew
+			"/Applications/LibreOffice.app/Contents/MacOS/soffice",
+		}
+	case "windows":
+		// soffice.com is the console variant that waits for conversion to finish
+		t.names = []string{"soffice.com", "soffice.exe"}
+		t.candidates = []string{
+			`C:\Program Files\LibreOffice\program\soffice.com`,
+			`C:\Program Files (x86)\LibreOffice\program\soffice.com`,
+		}
+	default:
+		t.candidates = []string{
+			"/usr/bin/libreoffice",
+			"/usr/bin/soffice",
+			"/usr/lib/libreoffice/program/soffice",
+			"/opt/libreoffice*/program/soffice",
+			"/snap/bin/libreoffice",
+		}
+	}
+	return t
+}
+
+func ghostscriptTool() tool {
+	if runtime.GOOS == "windows" {
+		return tool{
+			key:   "gs",
+			names: []string{"gswin64c", "gswin32c"},
+			candidates: []string{
+				`C:\Program Files\gs\gs*\bin\gswin64c.exe`,
+				`C:\Program Files (x86)\gs\gs*\bin\gswin32c.exe`,
+			},
+		}
+	}
+	return tool{key: "gs", names: []string{"gs"}}
+}
+
+// imageMagickTool prefers the v7 "magick" entry point. The v6 "convert" name
+// is never used on Windows, where it collides with the system disk utility.
+func imageMagickTool() tool {
+	if runtime.GOOS == "windows" {
+		return tool{
+			key:        "magick",
+			names:      []string{"magick"},
+			candidates: []string{`C:\Program Files\ImageMagick-7*\magick.exe`},
+		}
+	}
+	return tool{key: "magick", names: []string{"magick", "convert"}}
+}
+
+// extraSearchDirs covers package manager prefixes that are often missing from
+// PATH when the service runs under launchd, systemd or a minimal container.
+func extraSearchDirs() []string {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"/opt/homebrew/bin", "/usr/local/bin", "/opt/local/bin"}
+	case "windows":
+		return nil
+	default:
+		return []string{"/usr/bin", "/usr/local/bin", "/home/linuxbrew/.linuxbrew/bin", "/snap/bin"}
+	}
+}
+
+func (t tool) resolve() string {
+	if p := os.Getenv(strings.ToUpper(t.key) + "_PATH"); p != "" {
+		return p
+	}
+	for _, c := range t.candidates {
+		matches, _ := filepath.Glob(c)
+		for _, m := range newestFirst(matches) {
+			if isExecutable(m) {
+				return m
+			}
+		}
+	}
+	for _, name := range t.names {
+		if p, err := exec.LookPath(name); err == nil {
+			return p
+		}
+	}
+	for _, dir := range extraSearchDirs() {
+		for _, name := range t.names {
+			if p := filepath.Join(dir, name); isExecutable(p) {
+				return p
+			}
+		}
+	}
+	return t.names[0] // Fallback to PATH at exec time
+}
+
+var versionNumber = regexp.MustCompile(`[0-9]+`)
+
+// newestFirst orders glob matches of one install pattern by the version
+// numbers in their paths, highest first, comparing them as numbers so gs10
+// comes before gs9 and libreoffice24.2 before libreoffice7.6.
+func newestFirst(paths []string) []string {
+	version := func(p string) []int {
+		var v []int
+		for _, n := range versionNumber.FindAllString(p, -1) {
+			i, _ := strconv.Atoi(n)
+			v = append(v, i)
+		}
+		return v
+	}
+	sorted := slices.Clone(paths)
+	slices.SortStableFunc(sorted, func(a, b string) int {
+		return slices.Compare(version(b), version(a))
+	})
+	return sorted
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode()&0111 != 0
+}
+
+func lookup(t tool) string {
+	binMu.Lock()
+	defer binMu.Unlock()
+	if p, ok := binCache[t.key]; ok {
+		return p
+	}
+	p := t.resolve()
+	binCache[t.key] = p
+	return p
+}
+
+// binary resolves an engine by its canonical (Linux) name.
+func binary(name string) string {
+	switch name {
+	case "soffice":
+		return lookup(sofficeTool())
+	case "gs":
+		return lookup(ghostscriptTool())
+	case "magick":
+		return lookup(imageMagickTool())
+	case "gpurender":
+		return lookup(tool{key: "gpurender", names: []string{"pdfrender-gpu"}})
+	case "chromium":
+		return lookup(chromiumTool())
+	case "rsvg":
+		return lookup(tool{key: "rsvg", names: []string{"rsvg-convert"}})
+	case "calibre":
+		return lookup(tool{key: "calibre", names: []string{"ebook-convert"}})
+	case "heif":
+		// libheif renamed heif-convert to heif-dec in 1.17
+		return lookup(tool{key: "heif", names: []string{"heif-dec", "heif-convert"}})
+	}
+	return lookup(tool{key: name, names: []string{name}})
+}
+
+// imageMagickCommand runs an ImageMagick tool ("convert", "compare",
+// "identify", ...) through whichever major version is installed.
+func imageMagickCommand(subcommand string, args ...string) *exec.Cmd {
+	bin := binary("magick")
+	if strings.TrimSuffix(filepath.Base(bin), ".exe") == "magick" {
+		if subcommand == "convert" {
+			// v7: "magick in out" replaces "convert in out"
+			return exec.Command(bin, args...)
+		}
+		return exec.Command(bin, append([]string{subcommand}, args...)...)
+	}
+	// v6 ships each tool as a separate binary next to convert
+	if subcommand != "convert" {
+		bin = filepath.Join(filepath.Dir(bin), subcommand)
+		if !isExecutable(bin) {
+			bin = subcommand
+		}
+	}
+	return exec.Command(bin, args...)
+}
+
+// fileURL formats a local path for LibreOffice's -env:UserInstallation,
+// which needs file:///C:/... on Windows.
+func fileURL(path string) string {
+	p := filepath.ToSlash(path)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return "file://" + p
+}
+
+// DiscoverEngines resolves every engine binary up front and logs where each
+// was found, so a misconfigured host is obvious at startup.
+func DiscoverEngines() {
+	for _, name := range []string{
+		"soffice", "gs", "magick", "pandoc", "qpdf", "pdfjam", "pdftk",
+		"pdftoppm", "pdftotext", "pdfinfo", "pdfimages", "pdfunite", "pdfseparate",
+		"gpurender", "mutool", "rsvg", "inkscape",
+		"heif", "dwebp", "calibre", "chromium", "wkhtmltopdf",
+		"pdflatex", "bibtex", "tectonic",
+	} {
+		p := binary(name)
+		if _, err := exec.LookPath(p); err != nil {
+			log.Printf("Engine %s not found (tried %s)", name, p)
+			continue
+		}
+		log.Printf("Engine %s: %s", name, p)
+	}
+}
@@ -0,0 +1,34 @@
+package converters
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNewestFirst(t *testing.T) {
+	for _, tc := range []struct {
+		matches []string
+		want    []string
+	}{
+		{
+			[]string{`C:\Program Files\gs\gs10.02.1\bin\gswin64c.exe`, `C:\Program Files\gs\gs9.56.1\bin\gswin64c.exe`},
+			[]string{`C:\Program Files\gs\gs10.02.1\bin\gswin64c.exe`, `C:\Program Files\gs\gs9.56.1\bin\gswin64c.exe`},
+		},
+		{
+			[]string{"/opt/libreoffice24.2/program/soffice", "/opt/libreoffice7.6/program/soffice"},
+			[]string{"/opt/libreoffice24.2/program/soffice", "/opt/libreoffice7.6/program/soffice"},
+		},
+		{
+			[]string{"/opt/libreoffice7.5/program/soffice", "/opt/libreoffice7.6/program/soffice", "/opt/libreoffice7/program/soffice"},
+			[]string{"/opt/libreoffice7.6/program/soffice", "/opt/libreoffice7.5/program/soffice", "/opt/libreoffice7/program/soffice"},
+		},
+		{
+			[]string{`C:\Program Files\ImageMagick-7.1.1-Q16\magick.exe`, `C:\Program Files\ImageMagick-7.1.10-Q16\magick.exe`},
+			[]string{`C:\Program Files\ImageMagick-7.1.10-Q16\magick.exe`, `C:\Program Files\ImageMagick-7.1.1-Q16\magick.exe`},
+		},
+	} {
+		if got := newestFirst(tc.matches); !slices.Equal(got, tc.want) {
+			t.Errorf("newestFirst(%q) = %q, want %q", tc.matches, got, tc.want)
+		}
+	}
+}
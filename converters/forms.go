@@ -0,0 +1,253 @@
+package converters
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// QPDF: Flatten form fields and annotations into page content
+func FlattenPDF(inputPath, outputPath string) error {
+	args := []string{
+		inputPath,
+		// Build appearance streams first so filled-in field values survive
+		"--generate-appearances",
+		"--flatten-annotations=all",
+		outputPath,
+	}
+	cmd := exec.Command(binary("qpdf"), args...)
+	output, err := cmd.CombinedOutput()
+	// qpdf exits 3 when it succeeded with warnings
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 3 {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("qpdf flatten failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// xfdfField is one (possibly nested) field in an XFDF document. Dotted
+// field names like "address.city" are written as nested fields.
+type xfdfField struct {
+	XMLName  xml.Name     `xml:"field"`
+	Name     string       `xml:"name,attr"`
+	Values   []string     `xml:"value"`
+	Children []*xfdfField `xml:"field"`
+}
+
+type xfdfDocument struct {
+	XMLName xml.Name     `xml:"http://ns.adobe.com/xfdf/ xfdf"`
+	Space   string       `xml:"xml:space,attr"`
+	Fields  []*xfdfField `xml:"fields>field"`
+}
+
+// formValueStrings turns a JSON value into XFDF values. Booleans map to the
+// conventional checkbox states; arrays select several list box options.
+func formValueStrings(v interface{}) []string {
+	switch val := v.(type) {
+	case nil:
+		return []string{""}
+	case bool:
+		if val {
+			return []string{"Yes"}
+		}
+		return []string{"Off"}
+	case string:
+		return []string{val}
+	case []interface{}:
+		var out []string
+		for _, item := range val {
+			out = append(out, formValueStrings(item)...)
+		}
+		return out
+	default:
+		return []string{fmt.Sprint(val)}
+	}
+}
+
+func buildXFDF(values map[string]interface{}) ([]byte, error) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	doc := xfdfDocument{Space: "preserve"}
+	for _, name := range names {
+		siblings := &doc.Fields
+		var field *xfdfField
+		for _, part := range strings.Split(name, ".") {
+			field = nil
+			for _, f := range *siblings {
+				if f.Name == part {
+					field = f
+					break
+				}
+			}
+			if field == nil {
+				field = &xfdfField{Name: part}
+				*siblings = append(*siblings, field)
+			}
+			siblings = &field.Children
+		}
+		field.Values = formValueStrings(values[name])
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// pdftk: Fill AcroForm fields from a name -> value map
+func FillForm(inputPath, outputPath string, values map[string]interface{}, flatten bool) error {
+	xfdf, err := buildXFDF(values)
+	if err != nil {
+		return fmt.Errorf("failed to build XFDF: %v", err)
+	}
+	xfdfPath := filepath.Join(filepath.Dir(outputPath), "fields.xfdf")
+	if err := os.WriteFile(xfdfPath, xfdf, 0644); err != nil {
+		return fmt.Errorf("failed to write XFDF: %v", err)
+	}
+	defer os.Remove(xfdfPath)
+
+	args := []string{
+		inputPath,
+		"fill_form", xfdfPath,
+		"output", outputPath,
+	}
+	if flatten {
+		args = append(args, "flatten")
+	} else {
+		args = append(args, "need_appearances")
+	}
+	cmd := exec.Command(binary("pdftk"), args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("pdftk fill_form failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// FormField describes one AcroForm field as reported by pdftk.
+type FormField struct {
+	Name          string   `json:"name"`
+	AltName       string   `json:"alt_name,omitempty"`
+	Type          string   `json:"type"` // text, checkbox, radio, button, combo, list, signature
+	Value         string   `json:"value"`
+	Values        []string `json:"values,omitempty"` // multi-select list boxes
+	Options       []string `json:"options,omitempty"`
+	Flags         int      `json:"flags"`
+	ReadOnly      bool     `json:"read_only"`
+	Required      bool     `json:"required"`
+	MaxLength     int      `json:"max_length,omitempty"`
+	Justification string   `json:"justification,omitempty"`
+}
+
+// AcroForm field flag bits (PDF 32000-1, 12.7.3 and 12.7.4)
+const (
+	fieldFlagReadOnly   = 1 << 0
+	fieldFlagRequired   = 1 << 1
+	fieldFlagRadio      = 1 << 15
+	fieldFlagPushButton = 1 << 16
+	fieldFlagCombo      = 1 << 17
+)
+
+func fieldKind(pdftkType string, flags int) string {
+	switch pdftkType {
+	case "Text":
+		return "text"
+	case "Button":
+		if flags&fieldFlagPushButton != 0 {
+			return "button"
+		}
+		if flags&fieldFlagRadio != 0 {
+			return "radio"
+		}
+		return "checkbox"
+	case "Choice":
+		if flags&fieldFlagCombo != 0 {
+			return "combo"
+		}
+		return "list"
+	case "Signature":
+		return "signature"
+	}
+	return strings.ToLower(pdftkType)
+}
+
+// parseFieldDump parses pdftk dump_data_fields output: records separated by
+// "---" lines, each a list of "Key: value" pairs.
+func parseFieldDump(dump string) []FormField {
+	var fields []FormField
+	var cur *FormField
+	var pdftkType string
+	flush := func() {
+		if cur != nil && cur.Name != "" {
+			cur.Type = fieldKind(pdftkType, cur.Flags)
+			cur.ReadOnly = cur.Flags&fieldFlagReadOnly != 0
+			cur.Required = cur.Flags&fieldFlagRequired != 0
+			if len(cur.Values) == 1 {
+				cur.Values = nil
+			}
+			fields = append(fields, *cur)
+		}
+		cur, pdftkType = nil, ""
+	}
+
+	for _, line := range strings.Split(dump, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "---" {
+			flush()
+			cur = &FormField{}
+			continue
+		}
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			key, value = strings.TrimSuffix(line, ":"), ""
+		}
+		if cur == nil {
+			cur = &FormField{}
+		}
+		switch key {
+		case "FieldType":
+			pdftkType = value
+		case "FieldName":
+			cur.Name = value
+		case "FieldNameAlt":
+			cur.AltName = value
+		case "FieldFlags":
+			cur.Flags, _ = strconv.Atoi(value)
+		case "FieldValue":
+			if len(cur.Values) == 0 {
+				cur.Value = value
+			}
+			cur.Values = append(cur.Values, value)
+		case "FieldStateOption":
+			cur.Options = append(cur.Options, value)
+		case "FieldJustification":
+			cur.Justification = strings.ToLower(value)
+		case "FieldMaxLength":
+			cur.MaxLength, _ = strconv.Atoi(value)
+		}
+	}
+	flush()
+	return fields
+}
+
+// pdftk: List AcroForm fields with types, options and current values
+func ExtractFormFields(inputPath string) ([]FormField, error) {
+	cmd := exec.Command(binary("pdftk"), inputPath, "dump_data_fields_utf8")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("pdftk dump_data_fields failed: %v", err)
+	}
+	return parseFieldDump(string(output)), nil
+}
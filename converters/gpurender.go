@@ -0,0 +1,63 @@
+package converters
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// The GPU renderer is an external rasterizer built on a GPU-backed PDF
+// library (for example pdfium with Skia's GPU backend, wrapped in a small
+// CLI). It is found as "pdfrender-gpu" or via GPURENDER_PATH, takes
+// pdftoppm-style arguments
+//
+//	pdfrender-gpu -format png|jpeg [-dpi N] [-quality Q] [-scale-to PX]
+//	    [-f first] [-l last] input.pdf outputPrefix
+//
+// and writes outputPrefix-<page>.<ext> with the page number zero padded,
+// exactly like pdftoppm, so results are interchangeable.
+
+// GPURenderAvailable reports whether the GPU renderer is installed.
+func GPURenderAvailable() bool {
+	_, err := exec.LookPath(binary("gpurender"))
+	return err == nil
+}
+
+// GPU renderer: PDF -> JPG/PNG. AutoDPI is not supported; callers fall back
+// to PDFToImage for it.
+func GPUPDFToImage(inputPath, outputPrefix, format string, opts ImageOptions) error {
+	var fmtName string
+	if format == "jpg" || format == "jpeg" {
+		fmtName = "jpeg"
+	} else if format == "png" {
+		fmtName = "png"
+	} else {
+		return fmt.Errorf("unsupported image format: %s", format)
+	}
+	if opts.AutoDPI {
+		return fmt.Errorf("GPU renderer does not support auto DPI")
+	}
+
+	args := []string{"-format", fmtName}
+	if opts.Quality > 0 && fmtName == "jpeg" {
+		args = append(args, "-quality", strconv.Itoa(opts.Quality))
+	}
+	if opts.ScaleTo > 0 {
+		args = append(args, "-scale-to", strconv.Itoa(opts.ScaleTo))
+	} else if opts.DPI > 0 {
+		args = append(args, "-dpi", strconv.Itoa(opts.DPI))
+	}
+	if opts.FirstPage > 0 {
+		args = append(args, "-f", strconv.Itoa(opts.FirstPage))
+	}
+	if opts.LastPage > 0 {
+		args = append(args, "-l", strconv.Itoa(opts.LastPage))
+	}
+	args = append(args, inputPath, outputPrefix)
+	cmd := exec.Command(binary("gpurender"), args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("GPU renderer failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package converters
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"math"
+	"os"
+	"strconv"
+)
+
+// WriteHOCR writes text with positions (see TextLayout) as hOCR 1.2: an
+// HTML page with an ocr_page per page, ocr_line per line and ocrx_word per
+// word. Boxes are in PDF points from the top-left of the page.
+func WriteHOCR(outputPath string, pages []TextPage) error {
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="en" lang="en">
+<head>
+<title></title>
+<meta http-equiv="Content-Type" content="text/html;charset=utf-8"/>
+<meta name="ocr-system" content="document-converter"/>
+<meta name="ocr-capabilities" content="ocr_page ocr_line ocrx_word ocrp_font"/>
+</head>
+<body>
+`)
+	for _, p := range pages {
+		fmt.Fprintf(w, "<div class=\"ocr_page\" id=\"page_%d\" title=\"bbox 0 0 %s %s; ppageno %d\">\n",
+			p.Page, formatPoints(p.Width), formatPoints(p.Height), p.Page-1)
+		for i, line := range p.Lines {
+			fmt.Fprintf(w, "<span class=\"ocr_line\" id=\"line_%d_%d\" title=\"%s\">", p.Page, i+1, hocrBox(p, line.TextWord))
+			for j, word := range line.Words {
+				if j > 0 {
+					w.WriteString(" ")
+				}
+				title := hocrBox(p, word)
+				if word.Font != "" {
+					title += fmt.Sprintf("; x_font %q; x_fsize %s", word.Font, formatPoints(word.Size))
+				}
+				fmt.Fprintf(w, "<span class=\"ocrx_word\" id=\"word_%d_%d_%d\" title=\"%s\">%s</span>",
+					p.Page, i+1, j+1, html.EscapeString(title), html.EscapeString(word.Text))
+			}
+			w.WriteString("</span>\n")
+		}
+		w.WriteString("</div>\n")
+	}
+	w.WriteString("</body>\n</html>\n")
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func hocrBox(p TextPage, b TextWord) string {
+	top := p.Height - b.Y - b.Height
+	return fmt.Sprintf("bbox %s %s %s %s", formatPoints(b.X), formatPoints(top), formatPoints(b.X+b.Width), formatPoints(top+b.Height))
+}
+
+// WriteALTO writes text with positions (see TextLayout) as ALTO 4 XML, a
+// TextBlock per page holding its lines. Positions are in PDF points, as
+// pixels at 72 dpi, from the top-left of the page.
+func WriteALTO(outputPath string, pages []TextPage) error {
+	// Fonts become shared text styles
+	styles := map[string]string{}
+	var styleList []string
+	styleOf := func(word TextWord) string {
+		if word.Font == "" {
+			return ""
+		}
+		key := word.Font + "\x00" + formatPoints(word.Size)
+		id, ok := styles[key]
+		if !ok {
+			id = fmt.Sprintf("font%d", len(styles))
+			styles[key] = id
+			styleList = append(styleList, fmt.Sprintf("<TextStyle ID=\"%s\" FONTFAMILY=\"%s\" FONTSIZE=\"%s\"/>",
+				id, html.EscapeString(word.Font), formatPoints(word.Size)))
+		}
+		return id
+	}
+	var layout []byte
+	for _, p := range pages {
+		layout = fmt.Appendf(layout, "<Page ID=\"page_%d\" PHYSICAL_IMG_NR=\"%d\" WIDTH=\"%s\" HEIGHT=\"%s\">\n",
+			p.Page, p.Page, formatPoints(p.Width), formatPoints(p.Height))
+		layout = fmt.Appendf(layout, "<PrintSpace HPOS=\"0\" VPOS=\"0\" WIDTH=\"%s\" HEIGHT=\"%s\">\n", formatPoints(p.Width), formatPoints(p.Height))
+		if len(p.Lines) > 0 {
+			layout = fmt.Appendf(layout, "<TextBlock ID=\"block_%d\" %s>\n", p.Page, altoBox(p, pageTextBox(p)))
+			for i, line := range p.Lines {
+				layout = fmt.Appendf(layout, "<TextLine ID=\"line_%d_%d\" %s>", p.Page, i+1, altoBox(p, line.TextWord))
+				for j, word := range line.Words {
+					if j > 0 {
+						layout = append(layout, "<SP/>"...)
+					}
+					style := ""
+					if id := styleOf(word); id != "" {
+						style = fmt.Sprintf(" STYLEREFS=\"%s\"", id)
+					}
+					layout = fmt.Appendf(layout, "<String ID=\"string_%d_%d_%d\" CONTENT=\"%s\" %s%s/>",
+						p.Page, i+1, j+1, html.EscapeString(word.Text), altoBox(p, word), style)
+				}
+				layout = append(layout, "</TextLine>\n"...)
+			}
+			layout = append(layout, "</TextBlock>\n"...)
+		}
+		layout = append(layout, "</PrintSpace>\n</Page>\n"...)
+	}
+
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<alto xmlns="http://www.loc.gov/standards/alto/ns-v4#" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.loc.gov/standards/alto/ns-v4# http://www.loc.gov/alto/v4/alto-4-2.xsd">
+<Description>
+<MeasurementUnit>pixel</MeasurementUnit>
+<sourceImageInformation><fileName></fileName></sourceImageInformation>
+</Description>
+`)
+	if len(styleList) > 0 {
+		w.WriteString("<Styles>\n")
+		for _, s := range styleList {
+			w.WriteString(s + "\n")
+		}
+		w.WriteString("</Styles>\n")
+	}
+	w.WriteString("<Layout>\n")
+	w.Write(layout)
+	w.WriteString("</Layout>\n</alto>\n")
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func altoBox(p TextPage, b TextWord) string {
+	top := p.Height - b.Y - b.Height
+	return fmt.Sprintf("HPOS=\"%s\" VPOS=\"%s\" WIDTH=\"%s\" HEIGHT=\"%s\"", formatPoints(b.X), formatPoints(top), formatPoints(b.Width), formatPoints(b.Height))
+}
+
+// pageTextBox is the box around all of a page's lines.
+func pageTextBox(p TextPage) TextWord {
+	box := p.Lines[0].TextWord
+	for _, line := range p.Lines[1:] {
+		xMax, yMax := max(box.X+box.Width, line.X+line.Width), max(box.Y+box.Height, line.Y+line.Height)
+		box.X, box.Y = min(box.X, line.X), min(box.Y, line.Y)
+		box.Width, box.Height = xMax-box.X, yMax-box.Y
+	}
+	return box
+}
+
+// formatPoints writes a coordinate with at most two decimals.
+func formatPoints(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
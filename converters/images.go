@@ -0,0 +1,65 @@
+package converters
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	imageMagickFormatsOnce sync.Once
+	imageMagickReadable    map[string]bool
+)
+
+// imageMagickCanRead reports whether the installed ImageMagick has a
+// delegate to read format ("HEIC", "WEBP", ...), from identify -list format.
+func imageMagickCanRead(format string) bool {
+	imageMagickFormatsOnce.Do(func() {
+		imageMagickReadable = map[string]bool{}
+		output, err := imageMagickCommand("identify", "-list", "format").Output()
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(output), "\n") {
+			// "     HEIC  HEIC      rw+   High Efficiency Image Format"
+			fields := strings.Fields(line)
+			if len(fields) < 3 || !strings.Contains(fields[2], "r") {
+				continue
+			}
+			imageMagickReadable[strings.TrimSuffix(fields[0], "*")] = true
+		}
+	})
+	return imageMagickReadable[format]
+}
+
+// imageMagickInput returns the argument under which ImageMagick should read
+// path. Formats it has no delegate for are decoded to a PNG at intermediate
+// first; cleanup removes it.
+func imageMagickInput(path, intermediate string) (input string, cleanup func(), err error) {
+	none := func() {}
+	var cmd *exec.Cmd
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gif":
+		// Only the first frame of an animation
+		return path + "[0]", none, nil
+	case ".heic", ".heif":
+		if imageMagickCanRead("HEIC") {
+			return path, none, nil
+		}
+		cmd = exec.Command(binary("heif"), path, intermediate)
+	case ".webp":
+		if imageMagickCanRead("WEBP") {
+			return path, none, nil
+		}
+		cmd = exec.Command(binary("dwebp"), path, "-o", intermediate)
+	default:
+		return path, none, nil
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", none, fmt.Errorf("%s failed: %v, output: %s", filepath.Base(cmd.Path), err, string(output))
+	}
+	return intermediate, func() { os.Remove(intermediate) }, nil
+}
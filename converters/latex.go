@@ -0,0 +1,104 @@
+package converters
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// latexMaxPasses bounds the pdflatex reruns that settle references.
+	latexMaxPasses = 4
+	// latexTimeout stops documents that loop or take too long, all passes
+	// included.
+	latexTimeout = 3 * time.Minute
+)
+
+// latexRerun matches the log messages asking for another pass.
+var latexRerun = regexp.MustCompile(`Rerun to get|Label\(s\) may have changed|Rerun LaTeX|There were undefined references`)
+
+// LaTeX (tectonic, else pdflatex and bibtex): .tex -> PDF. The document is
+// untrusted: shell escape is off, TeX may only open files below the
+// document's directory, and the build is stopped after latexTimeout.
+// pdflatex runs as often as the log asks for (up to latexMaxPasses), with a
+// bibtex run when the document has a bibliography; tectonic does all this
+// itself.
+func LaTeXToPDF(inputPath, outputPath string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), latexTimeout)
+	defer cancel()
+	dir := filepath.Dir(inputPath)
+	name := filepath.Base(inputPath)
+	jobName := strings.TrimSuffix(name, filepath.Ext(name))
+
+	run := func(bin string, args ...string) error {
+		cmd := exec.CommandContext(ctx, binary(bin), args...)
+		cmd.Dir = dir
+		// Paranoid mode: no reading or writing absolute paths, dotfiles or
+		// parent directories
+		cmd.Env = append(os.Environ(), "openin_any=p", "openout_any=p", "shell_escape=f")
+		output, err := cmd.CombinedOutput()
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("%s timed out after %s", bin, latexTimeout)
+		}
+		if err != nil {
+			return fmt.Errorf("%s failed: %v, output: %s", bin, err, latexLogTail(output))
+		}
+		return nil
+	}
+
+	if _, err := exec.LookPath(binary("tectonic")); err == nil {
+		if err := run("tectonic", "--untrusted", "--outdir", ".", name); err != nil {
+			return err
+		}
+	} else {
+		pdflatex := func() error {
+			return run("pdflatex", "-no-shell-escape", "-interaction=nonstopmode", "-halt-on-error", "-file-line-error", name)
+		}
+		if err := pdflatex(); err != nil {
+			return err
+		}
+		passes := 1
+		if aux, err := os.ReadFile(filepath.Join(dir, jobName+".aux")); err == nil && strings.Contains(string(aux), `\bibdata`) {
+			if err := run("bibtex", jobName); err != nil {
+				return err
+			}
+			// Once to read the bibliography, once more for its citations
+			if err := pdflatex(); err != nil {
+				return err
+			}
+			passes++
+		}
+		for ; passes < latexMaxPasses; passes++ {
+			texLog, _ := os.ReadFile(filepath.Join(dir, jobName+".log"))
+			if !latexRerun.Match(texLog) {
+				break
+			}
+			if err := pdflatex(); err != nil {
+				return err
+			}
+		}
+	}
+
+	pdfPath := filepath.Join(dir, jobName+".pdf")
+	if pdfPath == outputPath {
+		return nil
+	}
+	if err := os.Rename(pdfPath, outputPath); err != nil {
+		return fmt.Errorf("LaTeX produced no PDF: %v", err)
+	}
+	return nil
+}
+
+// latexLogTail keeps the end of TeX's output, where the error is.
+func latexLogTail(output []byte) string {
+	const keep = 2000
+	if len(output) > keep {
+		return "..." + string(output[len(output)-keep:])
+	}
+	return string(output)
+}
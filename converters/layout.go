@@ -0,0 +1,222 @@
+package converters
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// LayoutReference is what a document generated from a template must look
+// like: its page count, the fixed text it must contain and the form fields
+// it must have, optionally at given spots. Positions are the bottom-left
+// corner in PDF points from the bottom-left of the page.
+type LayoutReference struct {
+	Pages  int             `json:"pages,omitempty"` // 0 for any
+	Text   []ExpectedText  `json:"text,omitempty"`
+	Fields []ExpectedField `json:"fields,omitempty"`
+	// Tolerance is how far, in points, text and fields may sit from their
+	// positions (default 5).
+	Tolerance float64 `json:"tolerance,omitempty"`
+}
+
+// ExpectedText is fixed text the document must contain: anywhere, on a
+// page, or at a spot.
+type ExpectedText struct {
+	Text string   `json:"text"`
+	Page int      `json:"page,omitempty"`
+	X    *float64 `json:"x,omitempty"`
+	Y    *float64 `json:"y,omitempty"`
+}
+
+// ExpectedField is a form field the document must have, by its full name.
+type ExpectedField struct {
+	Name   string   `json:"name"`
+	Page   int      `json:"page,omitempty"`
+	X      *float64 `json:"x,omitempty"`
+	Y      *float64 `json:"y,omitempty"`
+	Width  *float64 `json:"width,omitempty"`
+	Height *float64 `json:"height,omitempty"`
+}
+
+// Validate checks a reference for checks that can't pass.
+func (ref LayoutReference) Validate() error {
+	if ref.Pages < 0 || ref.Tolerance < 0 {
+		return fmt.Errorf("pages and tolerance must not be negative")
+	}
+	for _, t := range ref.Text {
+		if strings.TrimSpace(t.Text) == "" {
+			return fmt.Errorf("expected text must not be empty")
+		}
+		if (t.X != nil || t.Y != nil) && t.Page < 1 {
+			return fmt.Errorf("text %q: a position needs a page", t.Text)
+		}
+	}
+	for _, f := range ref.Fields {
+		if f.Name == "" {
+			return fmt.Errorf("expected fields need a name")
+		}
+		if (f.X != nil || f.Y != nil) && f.Page < 1 {
+			return fmt.Errorf("field %s: a position needs a page", f.Name)
+		}
+	}
+	if len(ref.Text) == 0 && len(ref.Fields) == 0 && ref.Pages == 0 {
+		return fmt.Errorf("the reference checks nothing")
+	}
+	return nil
+}
+
+// Deviation is a way a document differs from its reference.
+type Deviation struct {
+	Check    string `json:"check"` // pages, text or field
+	Item     string `json:"item,omitempty"`
+	Page     int    `json:"page,omitempty"`
+	Expected string `json:"expected"`
+	Found    string `json:"found"`
+}
+
+// Poppler (pdfinfo, pdftotext -bbox) + QPDF: Check a document against a
+// layout reference. No deviations means it matches.
+func CheckLayout(inputPath string, ref LayoutReference) ([]Deviation, error) {
+	tolerance := ref.Tolerance
+	if tolerance == 0 {
+		tolerance = 5
+	}
+	near := func(want *float64, got float64) bool {
+		return want == nil || math.Abs(*want-got) <= tolerance
+	}
+	var deviations []Deviation
+
+	pages, err := PageCount(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	if ref.Pages > 0 && pages != ref.Pages {
+		deviations = append(deviations, Deviation{
+			Check:    "pages",
+			Expected: fmt.Sprintf("%d pages", ref.Pages),
+			Found:    fmt.Sprintf("%d pages", pages),
+		})
+	}
+
+	for _, t := range ref.Text {
+		boxes, err := FindText(inputPath, t.Text)
+		if err != nil {
+			return nil, err
+		}
+		var onPage []TextBox
+		matched := false
+		for _, b := range boxes {
+			if t.Page > 0 && b.Page != t.Page {
+				continue
+			}
+			onPage = append(onPage, b)
+			if near(t.X, b.X) && near(t.Y, b.Y) {
+				matched = true
+			}
+		}
+		if matched {
+			continue
+		}
+		d := Deviation{Check: "text", Item: t.Text, Page: t.Page, Expected: describeSpot(t.Page, t.X, t.Y)}
+		switch {
+		case len(onPage) > 0:
+			d.Found = describeSpot(onPage[0].Page, &onPage[0].X, &onPage[0].Y)
+		case len(boxes) > 0:
+			d.Found = describeSpot(boxes[0].Page, nil, nil)
+		default:
+			d.Found = "missing"
+		}
+		deviations = append(deviations, d)
+	}
+
+	if len(ref.Fields) == 0 {
+		return deviations, nil
+	}
+	widgets, err := fieldWidgets(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range ref.Fields {
+		found := widgets[f.Name]
+		matched := false
+		for _, w := range found {
+			if (f.Page == 0 || w.Page == f.Page) && near(f.X, w.X) && near(f.Y, w.Y) && near(f.Width, w.Width) && near(f.Height, w.Height) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+		d := Deviation{Check: "field", Item: f.Name, Page: f.Page, Expected: describeSpot(f.Page, f.X, f.Y)}
+		if f.Width != nil || f.Height != nil {
+			d.Expected += fmt.Sprintf(", %s x %s", describeLength(f.Width), describeLength(f.Height))
+		}
+		if len(found) == 0 {
+			d.Found = "missing"
+		} else {
+			w := found[0]
+			d.Found = describeSpot(w.Page, &w.X, &w.Y) + fmt.Sprintf(", %.0f x %.0f", w.Width, w.Height)
+		}
+		deviations = append(deviations, d)
+	}
+	return deviations, nil
+}
+
+func describeSpot(page int, x, y *float64) string {
+	s := "anywhere"
+	if page > 0 {
+		s = fmt.Sprintf("page %d", page)
+	}
+	if x != nil || y != nil {
+		s += fmt.Sprintf(" at (%s, %s)", describeLength(x), describeLength(y))
+	}
+	return s
+}
+
+func describeLength(v *float64) string {
+	if v == nil {
+		return "any"
+	}
+	return fmt.Sprintf("%.0f", *v)
+}
+
+// fieldWidgets finds the widgets of a PDF's form fields, by full field name
+// ("parent.child").
+func fieldWidgets(inputPath string) (map[string][]TextBox, error) {
+	doc, err := loadQPDFJSON(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	widgets := map[string][]TextBox{}
+	for _, p := range doc.Pages {
+		for _, ref := range doc.array(doc.dict(p.Object)["/Annots"]) {
+			annot := doc.dict(ref)
+			if subtype, _ := annot["/Subtype"].(string); subtype != "/Widget" {
+				continue
+			}
+			// A widget is its field, or a kid of it; names join up the
+			// /Parent chain
+			var parts []string
+			for field, depth := annot, 0; field != nil && depth < 32; depth++ {
+				if name := doc.pdfText(field["/T"]); name != "" {
+					parts = append([]string{name}, parts...)
+				}
+				field = doc.dict(field["/Parent"])
+			}
+			rect := doc.numbers(annot["/Rect"])
+			if len(parts) == 0 || len(rect) != 4 {
+				continue
+			}
+			name := strings.Join(parts, ".")
+			widgets[name] = append(widgets[name], TextBox{
+				Page:   p.Number,
+				X:      min(rect[0], rect[2]),
+				Y:      min(rect[1], rect[3]),
+				Width:  math.Abs(rect[2] - rect[0]),
+				Height: math.Abs(rect[3] - rect[1]),
+			})
+		}
+	}
+	return widgets, nil
+}
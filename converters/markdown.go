@@ -0,0 +1,223 @@
+package converters
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Heading thresholds, as multiples of the body text's line height.
+const (
+	markdownH1 = 1.8
+	markdownH2 = 1.4
+	markdownH3 = 1.15
+)
+
+var (
+	markdownCellGap  = regexp.MustCompile(`\s{2,}`)
+	markdownSpaces   = regexp.MustCompile(`\s+`)
+	markdownBlanks   = regexp.MustCompile(`\n{3,}`)
+	markdownBullet   = regexp.MustCompile(`^[•◦▪▸‣·*–-]\s+(.*)$`)
+	markdownNumbered = regexp.MustCompile(`^(\d{1,3})[.)]\s+(.*)$`)
+)
+
+// Poppler (pdftotext -layout, -bbox-layout): PDF -> Markdown. The layout
+// text gives the structure: blank lines separate paragraphs, bullets and
+// numbers start list items, and blocks whose lines all split into the same
+// columns at wide gaps become tables. Line heights from the bbox output tell
+// headings apart from body text. These are heuristics; multi-column pages
+// can come out as tables.
+func PDFToMarkdown(inputPath, outputPath string) error {
+	heights, body, err := lineHeights(inputPath)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(binary("pdftotext"), "-layout", "-enc", "UTF-8", inputPath, "-")
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("pdftotext -layout failed: %v", err)
+	}
+
+	md := &markdownWriter{heights: heights, body: body}
+	for _, page := range strings.Split(string(output), "\f") {
+		var block []string
+		for _, line := range strings.Split(page, "\n") {
+			if strings.TrimSpace(line) == "" {
+				md.block(block)
+				block = nil
+				continue
+			}
+			block = append(block, strings.TrimRight(line, " \t\r"))
+		}
+		md.block(block)
+	}
+	text := markdownBlanks.ReplaceAllString(md.out.String(), "\n\n")
+	return os.WriteFile(outputPath, []byte(strings.TrimSpace(text)+"\n"), 0644)
+}
+
+type markdownWriter struct {
+	heights map[string]float64
+	body    float64
+	out     strings.Builder
+	para    []string
+}
+
+// block writes one blank-line separated group of layout lines.
+func (m *markdownWriter) block(lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	if rows := tableRows(lines); rows != nil && m.headingLevel(lines[0]) == 0 {
+		m.table(rows)
+		return
+	}
+	for _, line := range lines {
+		text := strings.TrimSpace(markdownSpaces.ReplaceAllString(line, " "))
+		if level := m.headingLevel(line); level > 0 {
+			m.flush()
+			fmt.Fprintf(&m.out, "%s %s\n\n", strings.Repeat("#", level), text)
+			continue
+		}
+		if item := markdownBullet.FindStringSubmatch(text); item != nil {
+			m.flush()
+			fmt.Fprintf(&m.out, "- %s\n", item[1])
+			continue
+		}
+		if item := markdownNumbered.FindStringSubmatch(text); item != nil {
+			m.flush()
+			fmt.Fprintf(&m.out, "%s. %s\n", item[1], item[2])
+			continue
+		}
+		m.para = append(m.para, text)
+	}
+	m.flush()
+	m.out.WriteString("\n")
+}
+
+// flush writes the pending paragraph, rejoining words hyphenated across
+// lines.
+func (m *markdownWriter) flush() {
+	if len(m.para) == 0 {
+		return
+	}
+	var sb strings.Builder
+	for i, line := range m.para {
+		if i > 0 {
+			prev := m.para[i-1]
+			next := []rune(line)
+			if strings.HasSuffix(prev, "-") && len(next) > 0 && next[0] >= 'a' && next[0] <= 'z' {
+				s := sb.String()
+				sb.Reset()
+				sb.WriteString(strings.TrimSuffix(s, "-"))
+			} else {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(line)
+	}
+	m.out.WriteString(sb.String())
+	m.out.WriteString("\n\n")
+	m.para = nil
+}
+
+func (m *markdownWriter) table(rows [][]string) {
+	m.flush()
+	escape := func(cells []string) string {
+		for i, c := range cells {
+			cells[i] = strings.ReplaceAll(c, "|", `\|`)
+		}
+		return "| " + strings.Join(cells, " | ") + " |\n"
+	}
+	m.out.WriteString(escape(rows[0]))
+	m.out.WriteString("|" + strings.Repeat(" --- |", len(rows[0])) + "\n")
+	for _, row := range rows[1:] {
+		m.out.WriteString(escape(row))
+	}
+	m.out.WriteString("\n")
+}
+
+// headingLevel is 1-3 for a line set larger than body text, else 0.
+func (m *markdownWriter) headingLevel(line string) int {
+	text := strings.TrimSpace(markdownSpaces.ReplaceAllString(line, " "))
+	height, ok := m.heights[text]
+	if !ok || m.body <= 0 || len(text) > 200 {
+		return 0
+	}
+	switch ratio := height / m.body; {
+	case ratio >= markdownH1:
+		return 1
+	case ratio >= markdownH2:
+		return 2
+	case ratio >= markdownH3:
+		return 3
+	}
+	return 0
+}
+
+// tableRows splits a block into cells at gaps of two or more spaces. It is
+// a table when there are at least two rows and every row has the same
+// number (two or more) of cells.
+func tableRows(lines []string) [][]string {
+	if len(lines) < 2 {
+		return nil
+	}
+	var rows [][]string
+	for _, line := range lines {
+		cells := markdownCellGap.Split(strings.TrimSpace(line), -1)
+		if len(cells) < 2 || (len(rows) > 0 && len(cells) != len(rows[0])) {
+			return nil
+		}
+		rows = append(rows, cells)
+	}
+	return rows
+}
+
+// bboxLayout mirrors the parts of pdftotext -bbox-layout output used here.
+type bboxLayout struct {
+	Pages []struct {
+		Lines []struct {
+			YMin  float64  `xml:"yMin,attr"`
+			YMax  float64  `xml:"yMax,attr"`
+			Words []string `xml:"word"`
+		} `xml:"flow>block>line"`
+	} `xml:"body>doc>page"`
+}
+
+// lineHeights maps the text of each line (words joined by single spaces)
+// to its height, and returns the height of body text: the median line
+// height, weighted by words.
+func lineHeights(inputPath string) (map[string]float64, float64, error) {
+	cmd := exec.Command(binary("pdftotext"), "-bbox-layout", inputPath, "-")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, 0, fmt.Errorf("pdftotext -bbox-layout failed: %v", err)
+	}
+	var doc bboxLayout
+	if err := decodeLenientXML(output, &doc); err != nil {
+		return nil, 0, fmt.Errorf("unexpected pdftotext -bbox-layout output: %v", err)
+	}
+
+	heights := map[string]float64{}
+	var weighted []float64
+	for _, page := range doc.Pages {
+		for _, line := range page.Lines {
+			height := line.YMax - line.YMin
+			text := strings.Join(line.Words, " ")
+			if height <= 0 || text == "" {
+				continue
+			}
+			heights[text] = max(heights[text], height)
+			for range line.Words {
+				weighted = append(weighted, height)
+			}
+		}
+	}
+	if len(weighted) == 0 {
+		return heights, 0, nil
+	}
+	sort.Float64s(weighted)
+	return heights, weighted[len(weighted)/2], nil
+}
@@ -0,0 +1,209 @@
+package converters
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// MAPI properties read from Outlook messages (MS-OXPROPS)
+const (
+	propSubject          = 0x0037
+	propClientSubmitTime = 0x0039
+	propSenderName       = 0x0C1A
+	propSenderEmail      = 0x0C1F
+	propRecipientType    = 0x0C15
+	propDisplayCc        = 0x0E03
+	propDisplayTo        = 0x0E04
+	propDeliveryTime     = 0x0E06
+	propBody             = 0x1000
+	propHTML             = 0x1013
+	propDisplayName      = 0x3001
+	propEmailAddress     = 0x3003
+	propAttachData       = 0x3701
+	propAttachFilename   = 0x3704
+	propAttachMIMETag    = 0x370E
+	propAttachLongName   = 0x3707
+	propAttachContentID  = 0x3712
+	propSMTPAddress      = 0x39FE
+	propInternetCodepage = 0x3FDE
+	propSenderSMTP       = 0x5D01
+)
+
+// MAPI property types
+const (
+	propTypeString8 = 0x001E
+	propTypeUnicode = 0x001F
+	propTypeObject  = 0x000D
+	propTypeBinary  = 0x0102
+)
+
+// msgStorage is a storage of an Outlook message: the message itself, a
+// recipient, an attachment or an attached message.
+type msgStorage struct {
+	cfb     *cfbFile
+	entries map[string]int
+	// fixed holds the 8-byte values of fixed-size properties, by id
+	fixed map[uint16][]byte
+}
+
+// ParseMSG reads an Outlook .msg file (MS-OXMSG): a compound file with a
+// stream per message property, and storages for recipients and
+// attachments.
+func ParseMSG(path string) (*Email, error) {
+	cfb, err := openCFB(path)
+	if err != nil {
+		return nil, fmt.Errorf("not an Outlook message: %v", err)
+	}
+	// The top-level properties stream has a 32-byte header
+	return cfb.msgStorage(0, 32).message(0)
+}
+
+// msgStorage reads a storage's fixed-size properties, stored as 16-byte
+// records after a header of headerSize bytes.
+func (f *cfbFile) msgStorage(id, headerSize int) *msgStorage {
+	s := &msgStorage{cfb: f, entries: f.children(id), fixed: map[uint16][]byte{}}
+	if i, ok := s.entries["__properties_version1.0"]; ok {
+		if data, err := f.read(f.entries[i]); err == nil {
+			for off := headerSize; off+16 <= len(data); off += 16 {
+				s.fixed[uint16(le32(data[off:])>>16)] = data[off+8 : off+16]
+			}
+		}
+	}
+	return s
+}
+
+// stream reads the variable-size property id of type typ.
+func (s *msgStorage) stream(id, typ uint16) []byte {
+	i, ok := s.entries[fmt.Sprintf("__substg1.0_%04X%04X", id, typ)]
+	if !ok || s.cfb.entries[i].kind != cfbStream {
+		return nil
+	}
+	data, _ := s.cfb.read(s.cfb.entries[i])
+	return data
+}
+
+// text reads a string property, stored as UTF-16 or in the message's
+// 8-bit code page.
+func (s *msgStorage) text(id uint16) string {
+	if data := s.stream(id, propTypeUnicode); data != nil {
+		units := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			units = append(units, le16(data[i:]))
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	}
+	return strings.TrimRight(decodeCharset(s.stream(id, propTypeString8), "windows-1252"), "\x00")
+}
+
+// time reads a FILETIME property as a date, or "".
+func (s *msgStorage) time(id uint16) string {
+	v, ok := s.fixed[id]
+	if !ok {
+		return ""
+	}
+	ft := le64(v)
+	if ft == 0 {
+		return ""
+	}
+	// 100ns intervals since 1601
+	return time.Unix(int64(ft/10000000)-11644473600, 0).UTC().Format(emailDateLayout)
+}
+
+// sub lists the storages whose names start with prefix, in order.
+func (s *msgStorage) sub(prefix string) []int {
+	var names []string
+	for name, i := range s.entries {
+		if strings.HasPrefix(name, prefix) && s.cfb.entries[i].kind == cfbStorage {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	ids := make([]int, len(names))
+	for j, name := range names {
+		ids[j] = s.entries[name]
+	}
+	return ids
+}
+
+func (s *msgStorage) message(depth int) (*Email, error) {
+	if depth > emailMaxDepth {
+		return nil, fmt.Errorf("message nests too deeply")
+	}
+	e := &Email{
+		Subject:  s.text(propSubject),
+		TextBody: s.text(propBody),
+		Date:     s.time(propClientSubmitTime),
+	}
+	if e.Date == "" {
+		e.Date = s.time(propDeliveryTime)
+	}
+	if html := s.stream(propHTML, propTypeBinary); html != nil {
+		charset := "utf-8"
+		if cp, ok := s.fixed[propInternetCodepage]; ok && le32(cp) == 1252 {
+			charset = "windows-1252"
+		}
+		e.HTMLBody = decodeCharset(html, charset)
+	}
+	e.From = mailbox(s.text(propSenderName), s.text(propSenderSMTP), s.text(propSenderEmail))
+
+	var to, cc []string
+	for _, id := range s.sub("__recip_version1.0_") {
+		r := s.cfb.msgStorage(id, 8)
+		addr := mailbox(r.text(propDisplayName), r.text(propSMTPAddress), r.text(propEmailAddress))
+		switch le32(r.fixed[propRecipientType]) {
+		case 1:
+			to = append(to, addr)
+		case 2:
+			cc = append(cc, addr)
+		}
+	}
+	e.To, e.Cc = strings.Join(to, ", "), strings.Join(cc, ", ")
+	if e.To == "" && e.Cc == "" {
+		e.To, e.Cc = s.text(propDisplayTo), s.text(propDisplayCc)
+	}
+
+	for _, id := range s.sub("__attach_version1.0_") {
+		a := s.cfb.msgStorage(id, 8)
+		att := EmailAttachment{
+			Name:        a.text(propAttachLongName),
+			ContentType: a.text(propAttachMIMETag),
+			ContentID:   a.text(propAttachContentID),
+			Data:        a.stream(propAttachData, propTypeBinary),
+		}
+		if att.Name == "" {
+			att.Name = a.text(propAttachFilename)
+		}
+		if att.Name == "" {
+			att.Name = a.text(propDisplayName)
+		}
+		// Attached Outlook items are messages stored in a sub-storage
+		if i, ok := a.entries[fmt.Sprintf("__substg1.0_%04X%04X", propAttachData, propTypeObject)]; ok {
+			if nested, err := s.cfb.msgStorage(i, 24).message(depth + 1); err == nil {
+				att.Message = nested
+				if att.Name == "" {
+					att.Name = nested.Subject + ".msg"
+				}
+			}
+		}
+		e.Attachments = append(e.Attachments, att)
+	}
+	return e, nil
+}
+
+// mailbox formats a sender or recipient, preferring the SMTP address over
+// Exchange's internal one.
+func mailbox(name, smtp, address string) string {
+	if smtp == "" && strings.Contains(address, "@") {
+		smtp = address
+	}
+	switch {
+	case smtp == "":
+		return name
+	case name == "" || name == smtp:
+		return smtp
+	}
+	return fmt.Sprintf("%s <%s>", name, smtp)
+}
@@ -0,0 +1,105 @@
+package converters
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// MuPDF (mutool draw): PDF -> PNG/JPG. mutool writes PNG; JPEGs are encoded
+// from it by ImageMagick. Images are named outputPrefix-<page>.<ext> with
+// the page number zero padded, like pdftoppm's. AutoDPI is honoured page by
+// page; ScaleTo fits the longer side.
+func MuPDFToImage(inputPath, outputPrefix, format string, opts ImageOptions) error {
+	var ext string
+	if format == "jpg" || format == "jpeg" {
+		ext = ".jpg"
+	} else if format == "png" {
+		ext = ".png"
+	} else {
+		return fmt.Errorf("unsupported image format: %s", format)
+	}
+
+	pageCount, err := PageCount(inputPath)
+	if err != nil {
+		return err
+	}
+	first, last := max(opts.FirstPage, 1), opts.LastPage
+	if last == 0 || last > pageCount {
+		last = pageCount
+	}
+	if first > last {
+		return fmt.Errorf("page %d out of range (document has %d pages)", first, pageCount)
+	}
+	var dpis []int
+	if opts.AutoDPI && opts.ScaleTo == 0 {
+		if dpis, err = AutoDPI(inputPath); err != nil {
+			return err
+		}
+	}
+	digits := len(strconv.Itoa(pageCount))
+	draw := func(output, pages string, dpi int) error {
+		args := []string{"draw", "-q", "-F", "png", "-o", output}
+		if opts.ScaleTo > 0 {
+			// mutool fits within a box, so give it a square one
+			args = append(args, "-w", strconv.Itoa(opts.ScaleTo), "-h", strconv.Itoa(opts.ScaleTo))
+		} else {
+			args = append(args, "-r", strconv.Itoa(dpi))
+		}
+		args = append(args, inputPath, pages)
+		cmd := exec.Command(binary("mutool"), args...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("mutool draw failed: %v, output: %s", err, string(output))
+		}
+		return nil
+	}
+	if dpis == nil {
+		dpi := opts.DPI
+		if dpi <= 0 {
+			dpi = 150
+		}
+		// mutool fills in %0Nd with the page number
+		if err := draw(fmt.Sprintf("%s-%%0%dd.png", outputPrefix, digits), fmt.Sprintf("%d-%d", first, last), dpi); err != nil {
+			return err
+		}
+	} else {
+		for page := first - 1; page < min(last, len(dpis)); page++ {
+			dpi := dpis[page]
+			if err := draw(fmt.Sprintf("%s-%0*d.png", outputPrefix, digits, page+1), strconv.Itoa(page+1), dpi); err != nil {
+				return err
+			}
+		}
+	}
+	if ext == ".png" {
+		return nil
+	}
+
+	for page := first; page <= last; page++ {
+		pngPath := fmt.Sprintf("%s-%0*d.png", outputPrefix, digits, page)
+		jpgPath := strings.TrimSuffix(pngPath, ".png") + ext
+		args := []string{pngPath}
+		if opts.Quality > 0 {
+			args = append(args, "-quality", strconv.Itoa(opts.Quality))
+		}
+		cmd := imageMagickCommand("convert", append(args, jpgPath)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("ImageMagick failed: %v, output: %s", err, string(output))
+		}
+		os.Remove(pngPath)
+	}
+	return nil
+}
+
+// MuPDF (mutool draw -F txt): Extract Text. Pages end with a form feed, as
+// with pdftotext.
+func MuPDFExtractText(inputPath, outputPath string) error {
+	args := []string{"draw", "-q", "-F", "txt", "-o", outputPath, inputPath}
+	cmd := exec.Command(binary("mutool"), args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("mutool draw failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
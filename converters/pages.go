@@ -0,0 +1,227 @@
+package converters
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ParsePageRanges expands a page selection such as "1,3-5,8-last" against a
+// document of pageCount pages. "last" names the final page and ranges may
+// run backwards ("5-3"). Pages keep the order given.
+func ParsePageRanges(spec string, pageCount int) ([]int, error) {
+	page := func(s string) (int, error) {
+		s = strings.TrimSpace(s)
+		if strings.EqualFold(s, "last") || s == "z" {
+			return pageCount, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid page %q", s)
+		}
+		if n < 1 || n > pageCount {
+			return 0, fmt.Errorf("page %d out of range (document has %d pages)", n, pageCount)
+		}
+		return n, nil
+	}
+
+	var pages []int
+	for _, part := range strings.Split(spec, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := page(from)
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if isRange {
+			if last, err = page(to); err != nil {
+				return nil, err
+			}
+		}
+		step := 1
+		if last < first {
+			step = -1
+		}
+		for p := first; ; p += step {
+			pages = append(pages, p)
+			if p == last {
+				break
+			}
+		}
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no pages selected")
+	}
+	return pages, nil
+}
+
+// pageList formats pages for qpdf --pages, collapsing runs: [1 2 3 7] -> "1-3,7".
+func pageList(pages []int) string {
+	var parts []string
+	for i := 0; i < len(pages); {
+		j := i
+		for j+1 < len(pages) && pages[j+1] == pages[j]+1 {
+			j++
+		}
+		if j > i {
+			parts = append(parts, fmt.Sprintf("%d-%d", pages[i], pages[j]))
+		} else {
+			parts = append(parts, strconv.Itoa(pages[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// QPDF: Copy the given pages, in order, into a new PDF
+func ExtractPages(inputPath, outputPath string, pages []int) error {
+	args := []string{
+		"--empty",
+		"--pages", inputPath, pageList(pages), "--",
+		outputPath,
+	}
+	cmd := exec.Command(binary("qpdf"), args...)
+	output, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 3 {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("qpdf page extraction failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// QPDF: Split into as few consecutive chunks as possible that each stay
+// within maxBytes, found by trial extraction (shared fonts and images make
+// per-page sizes a poor guide). A single page larger than the cap becomes a
+// chunk of its own and is reported in oversized.
+func SplitBySize(inputPath, outputDir string, pageCount int, maxBytes int64) (chunks []PageSource, oversized []int, err error) {
+	extract := func(first, last int, path string) (int64, error) {
+		pages := make([]int, 0, last-first+1)
+		for p := first; p <= last; p++ {
+			pages = append(pages, p)
+		}
+		if err := ExtractPages(inputPath, path, pages); err != nil {
+			return 0, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+
+	trial := filepath.Join(outputDir, "trial.pdf")
+	defer os.Remove(trial)
+	for first := 1; first <= pageCount; {
+		// Gallop to bracket the largest fitting chunk, then bisect
+		fits, tooBig := first-1, pageCount+1
+		for step := 1; ; step *= 2 {
+			last := min(first+step-1, pageCount)
+			size, err := extract(first, last, trial)
+			if err != nil {
+				return nil, nil, err
+			}
+			if size > maxBytes {
+				tooBig = last
+				break
+			}
+			fits = last
+			if last == pageCount {
+				break
+			}
+		}
+		for tooBig-fits > 1 {
+			mid := (fits + tooBig) / 2
+			size, err := extract(first, mid, trial)
+			if err != nil {
+				return nil, nil, err
+			}
+			if size > maxBytes {
+				tooBig = mid
+			} else {
+				fits = mid
+			}
+		}
+		last := fits
+		if last < first {
+			last = first
+			oversized = append(oversized, first)
+		}
+
+		name := fmt.Sprintf("%02d-pages-%d-%d.pdf", len(chunks)+1, first, last)
+		if first == last {
+			name = fmt.Sprintf("%02d-pages-%d.pdf", len(chunks)+1, first)
+		}
+		path := filepath.Join(outputDir, name)
+		if _, err := extract(first, last, path); err != nil {
+			return nil, nil, err
+		}
+		chunk := PageSource{Path: path}
+		for p := first; p <= last; p++ {
+			chunk.Pages = append(chunk.Pages, p)
+		}
+		chunks = append(chunks, chunk)
+		first = last + 1
+	}
+	return chunks, oversized, nil
+}
+
+// PageSource is a selection of pages from one PDF.
+type PageSource struct {
+	Path  string
+	Pages []int
+}
+
+// QPDF: Assemble pages from several PDFs, in order, into one
+func AssemblePages(sources []PageSource, outputPath string) error {
+	args := []string{"--empty", "--pages"}
+	for _, src := range sources {
+		args = append(args, src.Path, pageList(src.Pages))
+	}
+	args = append(args, "--", outputPath)
+	cmd := exec.Command(binary("qpdf"), args...)
+	output, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 3 {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("qpdf page assembly failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// QPDF: Alternate the pages of two PDFs, a1 b1 a2 b2 ..., as when the fronts
+// and backs of a stack were scanned separately. With reverseSecond, b is
+// read last page first (the stack was flipped over). Leftover pages of the
+// longer document follow at the end.
+func InterleavePDF(pathA, pathB, outputPath string, reverseSecond bool) error {
+	countA, err := PageCount(pathA)
+	if err != nil {
+		return err
+	}
+	countB, err := PageCount(pathB)
+	if err != nil {
+		return err
+	}
+	var sources []PageSource
+	for i := 0; i < max(countA, countB); i++ {
+		if i < countA {
+			sources = append(sources, PageSource{Path: pathA, Pages: []int{i + 1}})
+		}
+		if i < countB {
+			page := i + 1
+			if reverseSecond {
+				page = countB - i
+			}
+			sources = append(sources, PageSource{Path: pathB, Pages: []int{page}})
+		}
+	}
+	return AssemblePages(sources, outputPath)
+}
@@ -0,0 +1,79 @@
+package converters
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"time"
+)
+
+// Dialer connects to addr ("host:port"), refusing destinations the caller
+// must not reach.
+type Dialer func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// startProxy runs an HTTP proxy on loopback that makes every connection
+// through dial, for a browser to send all its traffic through: pages,
+// redirects, subresources, scripts' fetches and websockets alike. Refused
+// connections are dropped, which the browser reports as a failed load.
+// stop shuts it down.
+func startProxy(dial Dialer) (addr string, stop func(), err error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	forward := &httputil.ReverseProxy{
+		// Proxy requests carry absolute URLs already
+		Director: func(*http.Request) {},
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dial,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Browser request to %s refused: %v", r.URL.Redacted(), err)
+			panic(http.ErrAbortHandler)
+		},
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			forward.ServeHTTP(w, r)
+			return
+		}
+		tunnel(w, r, dial)
+	})}
+	go server.Serve(listener)
+	return listener.Addr().String(), func() { server.Close() }, nil
+}
+
+// tunnel serves CONNECT (HTTPS and secure websockets) by splicing the
+// client's connection to the dialed destination.
+func tunnel(w http.ResponseWriter, r *http.Request, dial Dialer) {
+	upstream, err := dial(r.Context(), "tcp", r.Host)
+	if err != nil {
+		log.Printf("Browser connection to %s refused: %v", r.Host, err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "Tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	go func() {
+		// Bytes the client sent past the CONNECT request come first
+		io.Copy(upstream, buffered)
+		upstream.Close()
+	}()
+	io.Copy(client, upstream)
+	client.Close()
+}
@@ -0,0 +1,47 @@
+package converters
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestProxySiteOnly(t *testing.T) {
+	allowed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer allowed.Close()
+	refused := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer refused.Close()
+	tlsRefused := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsRefused.Close()
+
+	site := allowed.Listener.Addr().String()
+	proxy, stop, err := startProxy(siteOnly(site))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	client := tlsRefused.Client()
+	client.Transport.(*http.Transport).Proxy = http.ProxyURL(&url.URL{Scheme: "http", Host: proxy})
+	for _, tc := range []struct {
+		url string
+		ok  bool
+	}{
+		{allowed.URL, true},
+		{refused.URL, false},
+		{tlsRefused.URL, false},
+	} {
+		resp, err := client.Get(tc.url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if ok := err == nil && resp.StatusCode == http.StatusOK; ok != tc.ok {
+			t.Errorf("GET %s through the proxy: %v, %v; want ok = %v", tc.url, resp, err, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package converters
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf16"
+)
+
+// qpdfDocument is the object graph of a PDF as exported by qpdf --json=2.
+// Values follow qpdf's encoding: names are "/Name", references "12 0 R",
+// text strings "u:..." and binary strings "b:<hex>".
+type qpdfDocument struct {
+	Pages []struct {
+		Object string `json:"object"`
+		Number int    `json:"pageposfrom1"`
+	}
+	header  map[string]interface{}
+	trailer interface{}
+	objects map[string]interface{} // "12 0 R" -> value
+}
+
+// loadQPDFJSON exports the pages and objects of inputPath.
+func loadQPDFJSON(inputPath string) (*qpdfDocument, error) {
+	cmd := exec.Command(binary("qpdf"), "--json=2", "--json-key=pages", "--json-key=qpdf", inputPath)
+	output, err := cmd.Output()
+	// qpdf exits 3 when it succeeded with warnings
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 3 {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("qpdf json export failed: %v", err)
+	}
+
+	var raw struct {
+		Pages json.RawMessage   `json:"pages"`
+		QPDF  []json.RawMessage `json:"qpdf"`
+	}
+	if err := json.Unmarshal(output, &raw); err != nil || len(raw.QPDF) != 2 {
+		return nil, fmt.Errorf("unexpected qpdf json output")
+	}
+	doc := &qpdfDocument{objects: map[string]interface{}{}}
+	if err := json.Unmarshal(raw.Pages, &doc.Pages); err != nil {
+		return nil, fmt.Errorf("unexpected qpdf json pages: %v", err)
+	}
+	if err := json.Unmarshal(raw.QPDF[0], &doc.header); err != nil {
+		return nil, fmt.Errorf("unexpected qpdf json header: %v", err)
+	}
+	var objects map[string]struct {
+		Value  interface{} `json:"value"`
+		Stream *struct {
+			Dict interface{} `json:"dict"`
+		} `json:"stream"`
+	}
+	if err := json.Unmarshal(raw.QPDF[1], &objects); err != nil {
+		return nil, fmt.Errorf("unexpected qpdf json objects: %v", err)
+	}
+	for key, obj := range objects {
+		if key == "trailer" {
+			doc.trailer = obj.Value
+		}
+		ref, ok := strings.CutPrefix(key, "obj:")
+		if !ok {
+			continue
+		}
+		if obj.Stream != nil {
+			doc.objects[ref] = obj.Stream.Dict
+		} else {
+			doc.objects[ref] = obj.Value
+		}
+	}
+	return doc, nil
+}
+
+// resolve follows an indirect reference; other values are returned as is.
+func (d *qpdfDocument) resolve(v interface{}) interface{} {
+	if s, ok := v.(string); ok && strings.HasSuffix(s, " R") {
+		return d.objects[s]
+	}
+	return v
+}
+
+// dict resolves v and returns it as a dictionary, or nil.
+func (d *qpdfDocument) dict(v interface{}) map[string]interface{} {
+	m, _ := d.resolve(v).(map[string]interface{})
+	return m
+}
+
+// array resolves v and returns it as an array, or nil.
+func (d *qpdfDocument) array(v interface{}) []interface{} {
+	a, _ := d.resolve(v).([]interface{})
+	return a
+}
+
+// numbers resolves v as an array of numbers.
+func (d *qpdfDocument) numbers(v interface{}) []float64 {
+	var out []float64
+	for _, item := range d.array(v) {
+		if f, ok := d.resolve(item).(float64); ok {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// inherited looks key up on a page and then its /Parent chain.
+func (d *qpdfDocument) inherited(page map[string]interface{}, key string) interface{} {
+	for depth := 0; page != nil && depth < 32; depth++ {
+		if v, ok := page[key]; ok {
+			return v
+		}
+		page = d.dict(page["/Parent"])
+	}
+	return nil
+}
+
+// pdfText decodes a qpdf string value to UTF-8.
+func (d *qpdfDocument) pdfText(v interface{}) string {
+	s, _ := d.resolve(v).(string)
+	if text, ok := strings.CutPrefix(s, "u:"); ok {
+		return text
+	}
+	if h, ok := strings.CutPrefix(s, "b:"); ok {
+		data, err := hex.DecodeString(h)
+		if err != nil {
+			return ""
+		}
+		if len(data) >= 2 && data[0] == 0xFE && data[1] == 0xFF {
+			units := make([]uint16, 0, len(data)/2)
+			for i := 2; i+1 < len(data); i += 2 {
+				units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+			}
+			return string(utf16.Decode(units))
+		}
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+	return ""
+}
+
+// updateQPDFJSON writes outputPath from inputPath with the given objects
+// ("12 0 R" -> new value) replaced.
+func updateQPDFJSON(inputPath, outputPath string, header map[string]interface{}, objects map[string]interface{}) error {
+	update := map[string]interface{}{}
+	for ref, value := range objects {
+		update["obj:"+ref] = map[string]interface{}{"value": value}
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"qpdf": []interface{}{header, update},
+	})
+	if err != nil {
+		return err
+	}
+	updatePath := outputPath + ".json"
+	if err := os.WriteFile(updatePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write qpdf update: %v", err)
+	}
+	defer os.Remove(updatePath)
+
+	cmd := exec.Command(binary("qpdf"), inputPath, "--update-from-json="+updatePath, outputPath)
+	output, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 3 {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("qpdf json update failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
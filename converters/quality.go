@@ -0,0 +1,246 @@
+package converters
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// QualityReport holds heuristic fidelity signals for an office -> PDF
+// conversion. Score runs from 100 (nothing suspicious) down to 0.
+type QualityReport struct {
+	Score int `json:"score"`
+	Pages int `json:"pages"`
+	// ExpectedPages is the page count the source document records for
+	// itself (Word's last layout, the number of slides); 0 if unknown.
+	ExpectedPages    int      `json:"expected_pages,omitempty"`
+	EmptyPages       []int    `json:"empty_pages,omitempty"`
+	SourceFonts      []string `json:"source_fonts,omitempty"`
+	SubstitutedFonts []string `json:"substituted_fonts,omitempty"`
+	Warnings         []string `json:"warnings,omitempty"`
+}
+
+// Weights of the signals in the score, each scaled by how bad it is.
+const (
+	qualityPageWeight  = 40
+	qualityFontWeight  = 30
+	qualityEmptyWeight = 30
+	// Pages with at most this ink coverage count as empty (see InkCoverage).
+	qualityEmptyInk = 0.001
+)
+
+// ScoreConversion compares the PDF converted from sourcePath with what the
+// source says about itself: its recorded page count and the fonts it asks
+// for, which LibreOffice silently substitutes when they aren't installed.
+// Empty pages in the output are counted too.
+func ScoreConversion(sourcePath, pdfPath string) (*QualityReport, error) {
+	pages, err := PageCount(pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	report := &QualityReport{Pages: pages}
+	penalty := 0.0
+
+	report.ExpectedPages = SourcePageCount(sourcePath)
+	if expected := report.ExpectedPages; expected > 0 && expected != pages {
+		delta := math.Abs(float64(pages - expected))
+		penalty += qualityPageWeight * min(1, delta/float64(expected))
+		report.Warnings = append(report.Warnings, fmt.Sprintf("PDF has %d pages, the source about %d", pages, expected))
+	}
+
+	report.SourceFonts = SourceFonts(sourcePath)
+	if len(report.SourceFonts) > 0 {
+		fonts, err := PDFFontNames(pdfPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, font := range report.SourceFonts {
+			if !fontPresent(font, fonts) {
+				report.SubstitutedFonts = append(report.SubstitutedFonts, font)
+			}
+		}
+		if n := len(report.SubstitutedFonts); n > 0 {
+			penalty += qualityFontWeight * float64(n) / float64(len(report.SourceFonts))
+			quoted := make([]string, n)
+			for i, f := range report.SubstitutedFonts {
+				quoted[i] = fmt.Sprintf("%+q", f)
+			}
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%d of %d fonts substituted: %s", n, len(report.SourceFonts), strings.Join(quoted, ", ")))
+		}
+	}
+
+	coverage, err := InkCoverage(pdfPath)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range coverage {
+		if c <= qualityEmptyInk {
+			report.EmptyPages = append(report.EmptyPages, i+1)
+		}
+	}
+	if n := len(report.EmptyPages); n > 0 {
+		penalty += qualityEmptyWeight * float64(n) / float64(len(coverage))
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%d of %d pages are empty", n, len(coverage)))
+	}
+
+	report.Score = int(math.Round(max(0, 100-penalty)))
+	return report, nil
+}
+
+// SourcePageCount reads the page (or slide) count an OOXML or OpenDocument
+// file records in its metadata. It returns 0 for other files and when the
+// count is missing.
+func SourcePageCount(sourcePath string) int {
+	count := 0
+	readOfficeXML(sourcePath, func(name string) bool {
+		return name == "docProps/app.xml" || name == "meta.xml"
+	}, func(part string, el xml.StartElement, d *xml.Decoder) {
+		switch el.Name.Local {
+		case "Pages", "Slides":
+			var text string
+			if d.DecodeElement(&text, &el) == nil {
+				if n, err := strconv.Atoi(strings.TrimSpace(text)); err == nil && n > 0 {
+					count = n
+				}
+			}
+		case "document-statistic":
+			if n, err := strconv.Atoi(attr(el, "page-count")); err == nil && n > 0 {
+				count = n
+			}
+		}
+	})
+	return count
+}
+
+// SourceFonts lists the fonts an OOXML or OpenDocument file asks for, from
+// its run properties, themes and font declarations. Theme references such
+// as "+mn-lt" are skipped; their fonts come from the theme itself.
+func SourceFonts(sourcePath string) []string {
+	seen := map[string]bool{}
+	add := func(name string) {
+		name = strings.Trim(strings.TrimSpace(name), `'"`)
+		if name != "" && !strings.HasPrefix(name, "+") {
+			seen[name] = true
+		}
+	}
+	readOfficeXML(sourcePath, func(name string) bool {
+		switch {
+		case name == "word/document.xml", name == "word/styles.xml", name == "xl/styles.xml",
+			name == "content.xml", name == "styles.xml":
+			return true
+		case strings.HasPrefix(name, "ppt/slides/"), strings.HasSuffix(path.Dir(name), "/theme"):
+			return true
+		}
+		return false
+	}, func(part string, el xml.StartElement, d *xml.Decoder) {
+		switch el.Name.Local {
+		case "rFonts":
+			add(attr(el, "ascii"))
+			add(attr(el, "hAnsi"))
+		case "latin":
+			add(attr(el, "typeface"))
+		case "font-face":
+			add(attr(el, "font-family"))
+		case "name":
+			// <font><name val="Calibri"/></font>; Word uses <w:name> for
+			// style names
+			if part == "xl/styles.xml" {
+				add(attr(el, "val"))
+			}
+		}
+	})
+	fonts := make([]string, 0, len(seen))
+	for name := range seen {
+		fonts = append(fonts, name)
+	}
+	sort.Strings(fonts)
+	return fonts
+}
+
+// readOfficeXML calls visit for every element of the zip parts of an office
+// document that want selects, with the part's name. Files that aren't zips
+// are ignored.
+func readOfficeXML(sourcePath string, want func(name string) bool, visit func(part string, el xml.StartElement, d *xml.Decoder)) {
+	zr, err := zip.OpenReader(sourcePath)
+	if err != nil {
+		return
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if !want(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		d := xml.NewDecoder(io.LimitReader(rc, 64*1024*1024))
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				break
+			}
+			if el, ok := tok.(xml.StartElement); ok {
+				visit(f.Name, el, d)
+			}
+		}
+		rc.Close()
+	}
+}
+
+func attr(el xml.StartElement, local string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// Poppler (pdffonts): Names of the fonts used in a PDF, without subset
+// prefixes ("ABCDEF+Carlito-Bold" -> "Carlito-Bold")
+func PDFFontNames(inputPath string) ([]string, error) {
+	cmd := exec.Command(binary("pdffonts"), inputPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("pdffonts failed: %v, output: %s", err, string(output))
+	}
+	var names []string
+	for i, line := range strings.Split(string(output), "\n") {
+		// Skip the header and the dashed rule under it
+		fields := strings.Fields(line)
+		if i < 2 || len(fields) == 0 || fields[0] == "[none]" {
+			continue
+		}
+		name := fields[0]
+		if prefix, rest, ok := strings.Cut(name, "+"); ok && len(prefix) == 6 {
+			name = rest
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// fontPresent reports whether a font the source asked for shows up among
+// the PDF's fonts. PDF names drop spaces and add style suffixes, so
+// "Times New Roman" matches "TimesNewRomanPS-BoldMT".
+func fontPresent(font string, pdfFonts []string) bool {
+	key := fontKey(font)
+	for _, f := range pdfFonts {
+		if strings.HasPrefix(fontKey(f), key) {
+			return true
+		}
+	}
+	return false
+}
+
+func fontKey(name string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "#20", "", "-", "", ",", "", "_", "").Replace(name))
+}
@@ -0,0 +1,206 @@
+package converters
+
+import (
+	"fmt"
+	"html"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RedactionArea is a box to black out, in PDF points from the bottom-left of
+// the page.
+type RedactionArea struct {
+	Page   int     `json:"page"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Match  string  `json:"match"`
+}
+
+// RedactionPresets are ready-made patterns for common personal data.
+var RedactionPresets = map[string]string{
+	"ssn":         `\b\d{3}-\d{2}-\d{4}\b`,
+	"email":       `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	"phone":       `(?:\+?\d{1,3}[\s.-]?)?\(?\d{3}\)?[\s.-]?\d{3}[\s.-]?\d{4}\b`,
+	"credit-card": `\b(?:\d[ -]?){12,15}\d\b`,
+}
+
+var (
+	bboxPage = regexp.MustCompile(`<page width="([\d.]+)" height="([\d.]+)">`)
+	bboxWord = regexp.MustCompile(`<word xMin="([\d.]+)" yMin="([\d.]+)" xMax="([\d.]+)" yMax="([\d.]+)">([^<]*)</word>`)
+)
+
+type bboxWordBox struct {
+	text                   string
+	xMin, yMin, xMax, yMax float64
+}
+
+type bboxPageWords struct {
+	width, height float64
+	words         []bboxWordBox
+}
+
+// Poppler (pdftotext -bbox): Words with their boxes, per page
+func wordBoxes(inputPath string) ([]bboxPageWords, error) {
+	cmd := exec.Command(binary("pdftotext"), "-bbox", inputPath, "-")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("pdftotext -bbox failed: %v", err)
+	}
+
+	var pages []bboxPageWords
+	for _, chunk := range strings.Split(string(output), "</page>") {
+		m := bboxPage.FindStringSubmatch(chunk)
+		if m == nil {
+			continue
+		}
+		page := bboxPageWords{}
+		page.width, _ = strconv.ParseFloat(m[1], 64)
+		page.height, _ = strconv.ParseFloat(m[2], 64)
+		for _, w := range bboxWord.FindAllStringSubmatch(chunk, -1) {
+			box := bboxWordBox{text: html.UnescapeString(w[5])}
+			box.xMin, _ = strconv.ParseFloat(w[1], 64)
+			box.yMin, _ = strconv.ParseFloat(w[2], 64)
+			box.xMax, _ = strconv.ParseFloat(w[3], 64)
+			box.yMax, _ = strconv.ParseFloat(w[4], 64)
+			page.words = append(page.words, box)
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// FindRedactions locates every word touched by a pattern match. Words are
+// joined with single spaces per page, so patterns may span words.
+func FindRedactions(inputPath string, patterns []*regexp.Regexp) ([]RedactionArea, error) {
+	pages, err := wordBoxes(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var areas []RedactionArea
+	for i, page := range pages {
+		var text strings.Builder
+		starts := make([]int, len(page.words))
+		for j, w := range page.words {
+			if j > 0 {
+				text.WriteByte(' ')
+			}
+			starts[j] = text.Len()
+			text.WriteString(w.text)
+		}
+		pageText := text.String()
+
+		hit := make([]string, len(page.words))
+		for _, re := range patterns {
+			for _, loc := range re.FindAllStringIndex(pageText, -1) {
+				if loc[0] == loc[1] {
+					continue
+				}
+				for j, w := range page.words {
+					if starts[j] < loc[1] && starts[j]+len(w.text) > loc[0] {
+						hit[j] = pageText[loc[0]:loc[1]]
+					}
+				}
+			}
+		}
+		for j, w := range page.words {
+			if hit[j] == "" {
+				continue
+			}
+			areas = append(areas, RedactionArea{
+				Page:   i + 1,
+				X:      w.xMin - 1,
+				Y:      page.height - w.yMax - 1,
+				Width:  w.xMax - w.xMin + 2,
+				Height: w.yMax - w.yMin + 2,
+				Match:  hit[j],
+			})
+		}
+	}
+	return areas, nil
+}
+
+// Ghostscript + QPDF: Black out areas and rasterize the affected pages at
+// dpi, so the text under the boxes is gone from the file rather than merely
+// covered. Other pages keep their text.
+func RedactPDF(inputPath, outputPath string, areas []RedactionArea, dpi int) error {
+	if dpi <= 0 {
+		dpi = 150
+	}
+	dir := filepath.Dir(outputPath)
+
+	byPage := map[int][]RedactionArea{}
+	for _, a := range areas {
+		byPage[a.Page] = append(byPage[a.Page], a)
+	}
+	pages := make([]int, 0, len(byPage))
+	for p := range byPage {
+		pages = append(pages, p)
+	}
+	sort.Ints(pages)
+
+	var draw strings.Builder
+	draw.WriteString("0 setgray\n")
+	for _, p := range pages {
+		fmt.Fprintf(&draw, "pdfbe-page %d eq {", p)
+		for _, a := range byPage[p] {
+			fmt.Fprintf(&draw, " %.2f %.2f %.2f %.2f rectfill", a.X, a.Y, a.Width, a.Height)
+		}
+		draw.WriteString(" } if\n")
+	}
+	boxedPath := filepath.Join(dir, "boxed.pdf")
+	if err := stampPDF(inputPath, boxedPath, draw.String()); err != nil {
+		return err
+	}
+
+	// Replace each redacted page by an image-only rendering of itself
+	args := []string{"--empty", "--pages"}
+	next := 1
+	for _, p := range pages {
+		rasterPath := filepath.Join(dir, fmt.Sprintf("raster-%d.pdf", p))
+		cmd := exec.Command(binary("gs"),
+			"-sDEVICE=pdfimage24",
+			"-dNOPAUSE", "-dQUIET", "-dBATCH",
+			fmt.Sprintf("-r%d", dpi),
+			fmt.Sprintf("-dFirstPage=%d", p),
+			fmt.Sprintf("-dLastPage=%d", p),
+			"-sOutputFile="+rasterPath,
+			boxedPath,
+		)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("Ghostscript rasterize failed: %v, output: %s", err, string(output))
+		}
+		if p > next {
+			args = append(args, boxedPath, fmt.Sprintf("%d-%d", next, p-1))
+		}
+		args = append(args, rasterPath, "1")
+		next = p + 1
+	}
+	pageCount, err := PageCount(boxedPath)
+	if err != nil {
+		return err
+	}
+	if next <= pageCount {
+		args = append(args, boxedPath, fmt.Sprintf("%d-%d", next, pageCount))
+	}
+	args = append(args, "--", outputPath)
+	if len(pages) == 0 {
+		args = []string{boxedPath, outputPath}
+	}
+
+	cmd := exec.Command(binary("qpdf"), args...)
+	output, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 3 {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("qpdf page assembly failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package converters
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SignatureField is an empty form field for an e-signature provider to pick
+// up: a signature widget, or a text field the signer fills in.
+type SignatureField struct {
+	Name     string  `json:"name"`
+	Type     string  `json:"type"` // signature (default), initials, name, date or text
+	Page     int     `json:"page"`
+	X        float64 `json:"x"` // PDF points from the bottom-left of the page
+	Y        float64 `json:"y"`
+	Width    float64 `json:"width,omitempty"`
+	Height   float64 `json:"height,omitempty"`
+	Required bool    `json:"required,omitempty"`
+}
+
+// signatureFieldSizes are the default widths and heights of the field types,
+// in points.
+var signatureFieldSizes = map[string][2]float64{
+	"signature": {150, 40},
+	"initials":  {60, 30},
+	"name":      {150, 20},
+	"date":      {90, 20},
+	"text":      {150, 20},
+}
+
+// ValidSignatureFieldType reports whether t is a SignatureField type.
+func ValidSignatureFieldType(t string) bool {
+	_, ok := signatureFieldSizes[t]
+	return ok
+}
+
+// Size is the field's width and height, its type's default where unset.
+func (f SignatureField) Size() (width, height float64) {
+	size, ok := signatureFieldSizes[f.Type]
+	if !ok {
+		size = signatureFieldSizes["signature"]
+	}
+	width, height = size[0], size[1]
+	if f.Width > 0 {
+		width = f.Width
+	}
+	if f.Height > 0 {
+		height = f.Height
+	}
+	return width, height
+}
+
+// QPDF: Add empty signature and signer text fields to a PDF, ready for an
+// e-signature provider. Fields without a size get their type's default.
+// Text fields render in Helvetica at auto size once filled in.
+func AddSignatureFields(inputPath, outputPath string, fields []SignatureField) error {
+	doc, err := loadQPDFJSON(inputPath)
+	if err != nil {
+		return err
+	}
+	trailer, _ := doc.trailer.(map[string]interface{})
+	rootRef, _ := trailer["/Root"].(string)
+	catalog := doc.dict(rootRef)
+	if catalog == nil {
+		return fmt.Errorf("PDF has no document catalog")
+	}
+
+	// New objects are numbered after the highest existing one
+	next := 0
+	for ref := range doc.objects {
+		if n, err := strconv.Atoi(strings.Fields(ref)[0]); err == nil && n > next {
+			next = n
+		}
+	}
+	newRef := func() string {
+		next++
+		return fmt.Sprintf("%d 0 R", next)
+	}
+
+	pageRefs := map[int]string{}
+	for _, p := range doc.Pages {
+		pageRefs[p.Number] = p.Object
+	}
+
+	updates := map[string]interface{}{}
+	var fieldRefs []interface{}
+	widgets := map[string][]interface{}{} // page ref -> new widgets
+	textFields := false
+	for _, f := range fields {
+		pageRef, ok := pageRefs[f.Page]
+		if !ok {
+			return fmt.Errorf("field %s: the PDF has no page %d", f.Name, f.Page)
+		}
+		kind := f.Type
+		if kind == "" {
+			kind = "signature"
+		}
+		if !ValidSignatureFieldType(kind) {
+			return fmt.Errorf("field %s: unknown type %q", f.Name, f.Type)
+		}
+		width, height := f.Size()
+
+		widget := map[string]interface{}{
+			"/Type":    "/Annot",
+			"/Subtype": "/Widget",
+			"/T":       "u:" + f.Name,
+			"/TU":      "u:" + strings.ToUpper(kind[:1]) + kind[1:],
+			"/Rect":    []interface{}{f.X, f.Y, f.X + width, f.Y + height},
+			"/F":       4, // print
+			"/P":       pageRef,
+		}
+		if kind == "signature" {
+			widget["/FT"] = "/Sig"
+		} else {
+			widget["/FT"] = "/Tx"
+			widget["/DA"] = "u:/Helv 0 Tf 0 g"
+			textFields = true
+		}
+		if f.Required {
+			widget["/Ff"] = fieldFlagRequired
+		}
+		ref := newRef()
+		updates[ref] = widget
+		fieldRefs = append(fieldRefs, ref)
+		widgets[pageRef] = append(widgets[pageRef], ref)
+	}
+
+	// Pages list their widgets among their annotations
+	for pageRef, refs := range widgets {
+		page := doc.dict(pageRef)
+		annotsRef := page["/Annots"]
+		annots := append(append([]interface{}{}, doc.array(annotsRef)...), refs...)
+		if s, ok := annotsRef.(string); ok && strings.HasSuffix(s, " R") {
+			updates[s] = annots
+			continue
+		}
+		newPage := map[string]interface{}{}
+		for k, v := range page {
+			newPage[k] = v
+		}
+		newPage["/Annots"] = annots
+		updates[pageRef] = newPage
+	}
+
+	// The catalog's form lists the fields
+	form := map[string]interface{}{}
+	for k, v := range doc.dict(catalog["/AcroForm"]) {
+		form[k] = v
+	}
+	fieldsRef := form["/Fields"]
+	allFields := append(append([]interface{}{}, doc.array(fieldsRef)...), fieldRefs...)
+	if s, ok := fieldsRef.(string); ok && strings.HasSuffix(s, " R") {
+		updates[s] = allFields
+	} else {
+		form["/Fields"] = allFields
+	}
+	if textFields {
+		form["/NeedAppearances"] = true
+		if _, ok := form["/DA"]; !ok {
+			form["/DA"] = "u:/Helv 0 Tf 0 g"
+		}
+		resources := map[string]interface{}{}
+		for k, v := range doc.dict(form["/DR"]) {
+			resources[k] = v
+		}
+		fonts := map[string]interface{}{}
+		for k, v := range doc.dict(resources["/Font"]) {
+			fonts[k] = v
+		}
+		if _, ok := fonts["/Helv"]; !ok {
+			fontRef := newRef()
+			updates[fontRef] = map[string]interface{}{
+				"/Type":     "/Font",
+				"/Subtype":  "/Type1",
+				"/BaseFont": "/Helvetica",
+				"/Encoding": "/WinAnsiEncoding",
+			}
+			fonts["/Helv"] = fontRef
+		}
+		resources["/Font"] = fonts
+		form["/DR"] = resources
+	}
+	if s, ok := catalog["/AcroForm"].(string); ok && strings.HasSuffix(s, " R") {
+		updates[s] = form
+	} else {
+		newCatalog := map[string]interface{}{}
+		for k, v := range catalog {
+			newCatalog[k] = v
+		}
+		newCatalog["/AcroForm"] = form
+		updates[rootRef] = newCatalog
+	}
+
+	return updateQPDFJSON(inputPath, outputPath, doc.header, updates)
+}
@@ -0,0 +1,156 @@
+package converters
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RenderingIntents are the ICC rendering intents soft proofs take, with
+// Ghostscript's number for each. absolute also simulates the paper's
+// white, as a proof on the actual stock would show.
+var RenderingIntents = map[string]int{
+	"perceptual": 0,
+	"relative":   1,
+	"saturation": 2,
+	"absolute":   3,
+}
+
+var imageMagickIntents = map[string]string{
+	"perceptual": "Perceptual",
+	"relative":   "Relative",
+	"saturation": "Saturation",
+	"absolute":   "Absolute",
+}
+
+// ICCProfile is a CMYK output (printer) profile soft proofs can simulate,
+// such as a FOGRA or newsprint characterization.
+type ICCProfile struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Path        string `json:"-"`
+}
+
+// ICCProfiles lists the CMYK printer profiles (.icc or .icm) in dir, named
+// after their file without the extension, e.g. "fogra39". Other profiles
+// are skipped.
+func ICCProfiles(dir string) ([]ICCProfile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []ICCProfile
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || (ext != ".icc" && ext != ".icm") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		description, ok := cmykPrinterProfile(path)
+		if !ok {
+			continue
+		}
+		profiles = append(profiles, ICCProfile{
+			Name:        strings.ToLower(strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))),
+			Description: description,
+			Path:        path,
+		})
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, nil
+}
+
+// cmykPrinterProfile checks an ICC profile's header for an output device
+// class and CMYK data, and returns its description when it has an ASCII
+// one (ICC v2 'desc').
+func cmykPrinterProfile(path string) (string, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, 1<<20))
+	if err != nil || len(data) < 132 || string(data[36:40]) != "acsp" {
+		return "", false
+	}
+	if string(data[12:16]) != "prtr" || string(data[16:20]) != "CMYK" {
+		return "", false
+	}
+	count := int(be32(data[128:]))
+	for i := 0; i < count && 132+12*i+12 <= len(data); i++ {
+		tag := data[132+12*i:]
+		if string(tag[:4]) != "desc" {
+			continue
+		}
+		offset, size := int(be32(tag[4:])), int(be32(tag[8:]))
+		if offset+size > len(data) || size < 12 || string(data[offset:offset+4]) != "desc" {
+			break
+		}
+		n := int(be32(data[offset+8:]))
+		if n > 1 && offset+12+n <= len(data) {
+			return strings.TrimRight(string(data[offset+12:offset+12+n]), "\x00"), true
+		}
+	}
+	return "", true
+}
+
+func be32(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+// Ghostscript + ImageMagick: Render one page as it would print on the
+// press pressProfile describes. Ghostscript separates the page into the
+// press's CMYK, so content already in CMYK passes through as it would to
+// the plate, and ImageMagick converts the separation back through
+// screenProfile (sRGB) for display. format is png or jpeg. Returns the
+// image path.
+func SoftProof(inputPath, outputPrefix string, page, dpi int, pressProfile, screenProfile, intent, format string) (string, error) {
+	gsIntent, ok := RenderingIntents[intent]
+	if !ok {
+		return "", fmt.Errorf("unknown rendering intent: %s", intent)
+	}
+	ext := map[string]string{"png": ".png", "jpeg": ".jpg"}[format]
+	if ext == "" {
+		return "", fmt.Errorf("unsupported proof format: %s", format)
+	}
+
+	separation := outputPrefix + ".tif"
+	cmd := exec.Command(binary("gs"),
+		"-sDEVICE=tiff32nc",
+		"-r"+strconv.Itoa(dpi),
+		"-dFirstPage="+strconv.Itoa(page), "-dLastPage="+strconv.Itoa(page),
+		"-sOutputICCProfile="+pressProfile,
+		"--permit-file-read="+pressProfile,
+		"-dRenderIntent="+strconv.Itoa(gsIntent),
+		"-dNOPAUSE", "-dQUIET", "-dBATCH", "-dSAFER",
+		"-sOutputFile="+separation,
+		inputPath,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("Ghostscript failed: %v, output: %s", err, string(output))
+	}
+	defer os.Remove(separation)
+
+	imagePath := outputPrefix + ext
+	args := []string{
+		separation,
+		// The separation carries no profile, so the first assigns it
+		"-profile", pressProfile,
+		"-intent", imageMagickIntents[intent],
+		"-black-point-compensation",
+		"-profile", screenProfile,
+	}
+	if format == "jpeg" {
+		args = append(args, "-quality", "90")
+	}
+	cmd = imageMagickCommand("convert", append(args, imagePath)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("ImageMagick failed: %v, output: %s", err, string(output))
+	}
+	return imagePath, nil
+}
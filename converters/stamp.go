@@ -0,0 +1,246 @@
+package converters
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// HeaderFooter is the text stamped on every page. Each slot may contain the
+// variables {page}, {pages}, {date}, {filename} and {number}.
+type HeaderFooter struct {
+	HeaderLeft, HeaderCenter, HeaderRight string
+	FooterLeft, FooterCenter, FooterRight string
+
+	FontSize float64 // points, default 10
+	Margin   float64 // points from the page edge, default 36
+
+	Date     string // value for {date}
+	Filename string // value for {filename}
+	Number   string // value for {number}, a document number
+}
+
+// psPrelude defines the helpers shared by every stamping program: a
+// Latin-1 Helvetica and string concatenation.
+const psPrelude = `
+/Helvetica findfont dup length dict begin
+  { 1 index /FID ne { def } { pop pop } ifelse } forall
+  /Encoding ISOLatin1Encoding def
+  currentdict
+end /PDFBE-Helvetica exch definefont pop
+/pdfbe-concat {
+  exch dup length 2 index length add string
+  dup dup 4 2 roll copy length 4 -1 roll putinterval
+} bind def
+`
+
+// psString renders s as a PostScript string literal in Latin-1. Characters
+// outside Latin-1 become '?'.
+func psString(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || (r >= 0x7f && r <= 0xff):
+			fmt.Fprintf(&b, "\\%03o", r)
+		case r > 0xff:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// psPageText builds a PostScript expression that leaves the slot text on the
+// stack, splicing in the current page number (pdfbe-page) for {page}.
+func psPageText(text string) string {
+	parts := strings.Split(text, "{page}")
+	expr := psString(parts[0])
+	for _, part := range parts[1:] {
+		expr += " pdfbe-page 10 string cvs pdfbe-concat " + psString(part) + " pdfbe-concat"
+	}
+	return expr
+}
+
+// stampPDF rewrites inputPath through Ghostscript with drawProc (PostScript
+// drawing pdfbe-w/pdfbe-h sized page content) executed at the end of every
+// page.
+func stampPDF(inputPath, outputPath, drawProc string) error {
+	program := psPrelude + `
+<<
+  /EndPage {
+    exch 1 add /pdfbe-page exch def
+    dup 2 eq { pop false } {
+      pop
+      gsave initgraphics
+      currentpagedevice /PageSize get aload pop /pdfbe-h exch def /pdfbe-w exch def
+` + drawProc + `
+      grestore true
+    } ifelse
+  } bind
+>> setpagedevice
+`
+	psPath := filepath.Join(filepath.Dir(outputPath), "stamp.ps")
+	if err := os.WriteFile(psPath, []byte(program), 0644); err != nil {
+		return fmt.Errorf("failed to write stamp program: %v", err)
+	}
+	defer os.Remove(psPath)
+
+	args := []string{
+		"-sDEVICE=pdfwrite",
+		"-dNOPAUSE",
+		"-dQUIET",
+		"-dBATCH",
+		"-sOutputFile=" + outputPath,
+		psPath,
+		inputPath,
+	}
+	cmd := exec.Command(binary("gs"), args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Ghostscript stamp failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// Ghostscript: Header/footer text on every page
+func StampHeaderFooter(inputPath, outputPath string, hf HeaderFooter) error {
+	if hf.FontSize <= 0 {
+		hf.FontSize = 10
+	}
+	if hf.Margin <= 0 {
+		hf.Margin = 36
+	}
+
+	pages := ""
+	if strings.Contains(hf.HeaderLeft+hf.HeaderCenter+hf.HeaderRight+hf.FooterLeft+hf.FooterCenter+hf.FooterRight, "{pages}") {
+		n, err := PageCount(inputPath)
+		if err != nil {
+			return err
+		}
+		pages = fmt.Sprintf("%d", n)
+	}
+	vars := strings.NewReplacer("{pages}", pages, "{date}", hf.Date, "{filename}", hf.Filename, "{number}", hf.Number)
+
+	var draw strings.Builder
+	fmt.Fprintf(&draw, "/PDFBE-Helvetica findfont %g scalefont setfont\n", hf.FontSize)
+	slot := func(text, align string, header bool) {
+		if text == "" {
+			return
+		}
+		fmt.Fprintf(&draw, "%s /pdfbe-s exch def\n", psPageText(vars.Replace(text)))
+		switch align {
+		case "left":
+			fmt.Fprintf(&draw, "%g", hf.Margin)
+		case "center":
+			draw.WriteString("pdfbe-w pdfbe-s stringwidth pop sub 2 div")
+		case "right":
+			fmt.Fprintf(&draw, "pdfbe-w %g sub pdfbe-s stringwidth pop sub", hf.Margin)
+		}
+		if header {
+			fmt.Fprintf(&draw, " pdfbe-h %g sub %g sub", hf.Margin, hf.FontSize)
+		} else {
+			fmt.Fprintf(&draw, " %g", hf.Margin)
+		}
+		draw.WriteString(" moveto pdfbe-s show\n")
+	}
+	slot(hf.HeaderLeft, "left", true)
+	slot(hf.HeaderCenter, "center", true)
+	slot(hf.HeaderRight, "right", true)
+	slot(hf.FooterLeft, "left", false)
+	slot(hf.FooterCenter, "center", false)
+	slot(hf.FooterRight, "right", false)
+
+	return stampPDF(inputPath, outputPath, draw.String())
+}
+
+// Ghostscript: Large diagonal watermark text across every page, in gray
+// that is see-through where Ghostscript supports transparency
+func WatermarkPDF(inputPath, outputPath, text string) error {
+	var draw strings.Builder
+	draw.WriteString("0.5 setgray /.setfillconstantalpha where { pop 0.3 .setfillconstantalpha } { 0.8 setgray } ifelse\n")
+	fmt.Fprintf(&draw, "%s /pdfbe-s exch def\n", psString(text))
+	// Scale the text to span 70% of the page diagonal
+	draw.WriteString("/PDFBE-Helvetica findfont 100 scalefont setfont\n")
+	draw.WriteString("/pdfbe-d pdfbe-w dup mul pdfbe-h dup mul add sqrt def\n")
+	draw.WriteString("/PDFBE-Helvetica findfont 100 pdfbe-d 0.7 mul mul pdfbe-s stringwidth pop div scalefont setfont\n")
+	draw.WriteString("pdfbe-w 2 div pdfbe-h 2 div translate pdfbe-h pdfbe-w atan rotate\n")
+	// Center on the cap height, about 0.7 em
+	draw.WriteString("pdfbe-s stringwidth pop -2 div currentfont /FontMatrix get 3 get -350 mul moveto pdfbe-s show\n")
+	return stampPDF(inputPath, outputPath, draw.String())
+}
+
+// TextStamp is a line of text stamped at a spot on a page, like "APPROVED"
+// or a reviewer's initials.
+type TextStamp struct {
+	Text string
+	Page int // 0 for every page
+	// X and Y are the bottom-left corner of the stamp (the bottom-right with
+	// AlignRight), descenders and border included, in PDF points from the
+	// bottom-left of the page.
+	X, Y       float64
+	AlignRight bool
+	FontSize   float64    // points, default 12
+	Color      [3]float64 // RGB, 0-1
+	Border     bool       // a box around the text, as on a rubber stamp
+}
+
+func (s TextStamp) size() float64 {
+	if s.FontSize <= 0 {
+		return 12
+	}
+	return s.FontSize
+}
+
+func (s TextStamp) padding() float64 {
+	if s.Border {
+		return s.size() * 0.3
+	}
+	return 0
+}
+
+// Height is the height of the stamp, border included.
+func (s TextStamp) Height() float64 {
+	return s.size() + 2*s.padding()
+}
+
+// Ghostscript: Text stamps at given spots
+func StampText(inputPath, outputPath string, stamps []TextStamp) error {
+	var draw strings.Builder
+	for _, s := range stamps {
+		size, pad := s.size(), s.padding()
+		if s.Page > 0 {
+			fmt.Fprintf(&draw, "pdfbe-page %d eq {\n", s.Page)
+		} else {
+			draw.WriteString("{\n")
+		}
+		fmt.Fprintf(&draw, "%g %g %g setrgbcolor\n", s.Color[0], s.Color[1], s.Color[2])
+		fmt.Fprintf(&draw, "/PDFBE-Helvetica findfont %g scalefont setfont\n", size)
+		fmt.Fprintf(&draw, "%s /pdfbe-s exch def\n", psString(s.Text))
+		// pdfbe-x is where the text starts
+		if s.AlignRight {
+			fmt.Fprintf(&draw, "%g pdfbe-s stringwidth pop sub /pdfbe-x exch def\n", s.X-pad)
+		} else {
+			fmt.Fprintf(&draw, "%g /pdfbe-x exch def\n", s.X+pad)
+		}
+		// The baseline sits above the descenders, about a quarter em
+		fmt.Fprintf(&draw, "pdfbe-x %g moveto pdfbe-s show\n", s.Y+pad+0.25*size)
+		if s.Border {
+			fmt.Fprintf(&draw, "%g setlinewidth pdfbe-x %g sub %g pdfbe-s stringwidth pop %g add %g rectstroke\n",
+				max(size/12, 0.5), pad, s.Y, 2*pad, s.Height())
+		}
+		if s.Page > 0 {
+			draw.WriteString("} if\n")
+		} else {
+			draw.WriteString("} exec\n")
+		}
+	}
+	return stampPDF(inputPath, outputPath, draw.String())
+}
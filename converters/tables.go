@@ -0,0 +1,234 @@
+package converters
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Table detection thresholds, as multiples of a line's height: words
+// further apart than tableCellGap are in different cells, and rows further
+// apart than tableRowGap end a table.
+const (
+	tableCellGap = 0.8
+	tableRowGap  = 2.0
+)
+
+// Table is a table found on a page. Its box is in PDF points from the
+// bottom-left of the page.
+type Table struct {
+	Page   int        `json:"page"`
+	X      float64    `json:"x"`
+	Y      float64    `json:"y"`
+	Width  float64    `json:"width"`
+	Height float64    `json:"height"`
+	Rows   [][]string `json:"-"`
+}
+
+type tableCell struct {
+	text       string
+	xMin, xMax float64
+}
+
+type tableLine struct {
+	cells                  []tableCell
+	yMin, yMax, xMin, xMax float64
+}
+
+// Poppler (pdftotext -bbox): Tables, found from word positions. Words are
+// grouped into lines and split into cells at wide gaps; runs of two or more
+// lines with the same number (two or more) of cells, whose columns line up,
+// are tables. These are heuristics: ruled tables with wrapped cells split
+// into several tables or rows, and multi-column pages can come out as
+// tables.
+func FindTables(inputPath string) ([]Table, error) {
+	pages, err := wordBoxes(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	var tables []Table
+	for i, page := range pages {
+		lines := tableLines(page.words)
+		for start := 0; start < len(lines); {
+			end := start + 1
+			if len(lines[start].cells) >= 2 {
+				for end < len(lines) && continuesTable(lines[start:end], lines[end]) {
+					end++
+				}
+			}
+			if end-start >= 2 {
+				t := Table{Page: i + 1}
+				xMin, xMax := lines[start].xMin, lines[start].xMax
+				for _, line := range lines[start:end] {
+					xMin, xMax = min(xMin, line.xMin), max(xMax, line.xMax)
+					row := make([]string, len(line.cells))
+					for j, c := range line.cells {
+						row[j] = c.text
+					}
+					t.Rows = append(t.Rows, row)
+				}
+				t.X, t.Width = xMin, xMax-xMin
+				t.Y = page.height - lines[end-1].yMax
+				t.Height = lines[end-1].yMax - lines[start].yMin
+				tables = append(tables, t)
+			}
+			start = end
+		}
+	}
+	return tables, nil
+}
+
+// tableLines groups a page's words into lines, top to bottom, and each line
+// into cells.
+func tableLines(words []bboxWordBox) []tableLine {
+	sorted := append([]bboxWordBox(nil), words...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].yMin+sorted[i].yMax < sorted[j].yMin+sorted[j].yMax
+	})
+	var groups [][]bboxWordBox
+	for _, w := range sorted {
+		if n := len(groups); n > 0 {
+			last := groups[n-1][0]
+			mid := (w.yMin + w.yMax) / 2
+			if mid > last.yMin && mid < last.yMax {
+				groups[n-1] = append(groups[n-1], w)
+				continue
+			}
+		}
+		groups = append(groups, []bboxWordBox{w})
+	}
+
+	lines := make([]tableLine, 0, len(groups))
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool { return group[i].xMin < group[j].xMin })
+		line := tableLine{yMin: group[0].yMin, yMax: group[0].yMax, xMin: group[0].xMin, xMax: group[0].xMax}
+		for _, w := range group {
+			line.yMin, line.yMax = min(line.yMin, w.yMin), max(line.yMax, w.yMax)
+			line.xMin, line.xMax = min(line.xMin, w.xMin), max(line.xMax, w.xMax)
+		}
+		gap := (line.yMax - line.yMin) * tableCellGap
+		for j, w := range group {
+			if n := len(line.cells); j > 0 && w.xMin-line.cells[n-1].xMax <= gap {
+				line.cells[n-1].text += " " + w.text
+				line.cells[n-1].xMax = w.xMax
+				continue
+			}
+			line.cells = append(line.cells, tableCell{text: w.text, xMin: w.xMin, xMax: w.xMax})
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// continuesTable reports whether line is another row of the table rows: as
+// many cells, close below, and each cell overlapping its column.
+func continuesTable(rows []tableLine, line tableLine) bool {
+	last := rows[len(rows)-1]
+	if len(line.cells) != len(rows[0].cells) || line.yMin-last.yMax > (last.yMax-last.yMin)*tableRowGap {
+		return false
+	}
+	for j, c := range line.cells {
+		xMin, xMax := rows[0].cells[j].xMin, rows[0].cells[j].xMax
+		for _, row := range rows[1:] {
+			xMin, xMax = min(xMin, row.cells[j].xMin), max(xMax, row.cells[j].xMax)
+		}
+		if c.xMax < xMin || c.xMin > xMax {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteTableCSV writes a table's rows as CSV.
+func WriteTableCSV(outputPath string, rows [][]string) error {
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteTableXLSX writes a table's rows as a one-sheet Excel workbook.
+// Cells that are plain numbers are stored as numbers, the rest as text.
+func WriteTableXLSX(outputPath string, rows [][]string) error {
+	var sheet strings.Builder
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range rows {
+		fmt.Fprintf(&sheet, `<row r="%d">`, i+1)
+		for j, cell := range row {
+			ref := xlsxColumn(j) + strconv.Itoa(i+1)
+			if _, err := strconv.ParseFloat(cell, 64); err == nil && !strings.ContainsAny(cell, "xXpPiInN_") {
+				fmt.Fprintf(&sheet, `<c r="%s"><v>%s</v></c>`, ref, cell)
+				continue
+			}
+			fmt.Fprintf(&sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, html.EscapeString(cell))
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Table" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`</Relationships>`},
+		{"xl/worksheets/sheet1.xml", sheet.String()},
+	}
+
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(f)
+	for _, p := range parts {
+		w, err := zw.Create(p.name)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := w.Write([]byte(p.content)); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// xlsxColumn names a zero-based column: A-Z, AA, AB, ...
+func xlsxColumn(n int) string {
+	name := ""
+	for n++; n > 0; n = (n - 1) / 26 {
+		name = string(rune('A'+(n-1)%26)) + name
+	}
+	return name
+}
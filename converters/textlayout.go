@@ -0,0 +1,252 @@
+package converters
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// TextWord is a word and where it sits, in PDF points from the bottom-left
+// of the page. Font and Size are known when MuPDF extracted the text.
+type TextWord struct {
+	Text   string  `json:"text"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Font   string  `json:"font,omitempty"`
+	Size   float64 `json:"size,omitempty"`
+}
+
+// TextLine is a line of words; its font is its first word's.
+type TextLine struct {
+	TextWord
+	Words []TextWord `json:"words"`
+}
+
+// TextPage is the text of a page, top to bottom in reading order.
+type TextPage struct {
+	Page   int        `json:"page"`
+	Width  float64    `json:"width"`
+	Height float64    `json:"height"`
+	Lines  []TextLine `json:"lines"`
+}
+
+// MuPDF (mutool draw -F stext) or Poppler (pdftotext -bbox-layout): Text
+// with positions, by page, line and word. MuPDF, when installed, also
+// reports each word's font and size.
+func TextLayout(inputPath string) ([]TextPage, error) {
+	if _, err := exec.LookPath(binary("mutool")); err == nil {
+		return muPDFTextLayout(inputPath)
+	}
+	return popplerTextLayout(inputPath)
+}
+
+// stextDocument mirrors mutool's structured text output.
+type stextDocument struct {
+	Pages []struct {
+		Width  float64 `xml:"width,attr"`
+		Height float64 `xml:"height,attr"`
+		Lines  []struct {
+			Fonts []struct {
+				Name  string  `xml:"name,attr"`
+				Size  float64 `xml:"size,attr"`
+				Chars []struct {
+					Quad string `xml:"quad,attr"`
+					BBox string `xml:"bbox,attr"`
+					C    string `xml:"c,attr"`
+				} `xml:"char"`
+			} `xml:"font"`
+		} `xml:"block>line"`
+	} `xml:"page"`
+}
+
+func muPDFTextLayout(inputPath string) ([]TextPage, error) {
+	cmd := exec.Command(binary("mutool"), "draw", "-q", "-F", "stext", "-o", "-", inputPath)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("mutool draw -F stext failed: %v", err)
+	}
+	var doc stextDocument
+	if err := decodeLenientXML(output, &doc); err != nil {
+		return nil, fmt.Errorf("unexpected mutool stext output: %v", err)
+	}
+
+	pages := make([]TextPage, len(doc.Pages))
+	for i, p := range doc.Pages {
+		page := TextPage{Page: i + 1, Width: p.Width, Height: p.Height, Lines: []TextLine{}}
+		for _, l := range p.Lines {
+			var words []TextWord
+			var word *textBounds
+			flush := func() {
+				if word != nil {
+					words = append(words, word.word(p.Height))
+					word = nil
+				}
+			}
+			for _, f := range l.Fonts {
+				for _, c := range f.Chars {
+					if strings.TrimFunc(c.C, unicode.IsSpace) == "" {
+						flush()
+						continue
+					}
+					box, ok := charBox(c.Quad, c.BBox)
+					if !ok {
+						continue
+					}
+					if word == nil {
+						word = &textBounds{font: f.Name, size: f.Size, xMin: box[0], yMin: box[1], xMax: box[2], yMax: box[3]}
+					}
+					word.add(c.C, box)
+				}
+			}
+			flush()
+			if line, ok := lineOf(words); ok {
+				page.Lines = append(page.Lines, line)
+			}
+		}
+		pages[i] = page
+	}
+	return pages, nil
+}
+
+// charBox reads a character's box, top-left origin, from its quad (four
+// corners) or, from older mutool versions, its bbox.
+func charBox(quad, bbox string) ([4]float64, bool) {
+	var box [4]float64
+	v := strings.Fields(quad)
+	if len(v) != 8 {
+		v = strings.Fields(bbox)
+	}
+	var n []float64
+	for _, s := range v {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return box, false
+		}
+		n = append(n, f)
+	}
+	switch len(n) {
+	case 8:
+		box = [4]float64{min(n[0], n[4]), min(n[1], n[3]), max(n[2], n[6]), max(n[5], n[7])}
+	case 4:
+		box = [4]float64{n[0], n[1], n[2], n[3]}
+	default:
+		return box, false
+	}
+	return box, true
+}
+
+// textBounds collects a word, its box kept top-left origin as the tools
+// report it.
+type textBounds struct {
+	text                   strings.Builder
+	font                   string
+	size                   float64
+	xMin, yMin, xMax, yMax float64
+}
+
+func (b *textBounds) add(text string, box [4]float64) {
+	b.text.WriteString(text)
+	b.xMin, b.yMin = min(b.xMin, box[0]), min(b.yMin, box[1])
+	b.xMax, b.yMax = max(b.xMax, box[2]), max(b.yMax, box[3])
+}
+
+func (b *textBounds) word(pageHeight float64) TextWord {
+	return TextWord{
+		Text:   b.text.String(),
+		X:      b.xMin,
+		Y:      pageHeight - b.yMax,
+		Width:  b.xMax - b.xMin,
+		Height: b.yMax - b.yMin,
+		Font:   b.font,
+		Size:   b.size,
+	}
+}
+
+// lineOf joins words into a line.
+func lineOf(words []TextWord) (TextLine, bool) {
+	if len(words) == 0 {
+		return TextLine{}, false
+	}
+	first := words[0]
+	xMin, yMin := first.X, first.Y
+	xMax, yMax := first.X+first.Width, first.Y+first.Height
+	texts := make([]string, len(words))
+	for i, w := range words {
+		xMin, yMin = min(xMin, w.X), min(yMin, w.Y)
+		xMax, yMax = max(xMax, w.X+w.Width), max(yMax, w.Y+w.Height)
+		texts[i] = w.Text
+	}
+	return TextLine{
+		TextWord: TextWord{
+			Text:   strings.Join(texts, " "),
+			X:      xMin,
+			Y:      yMin,
+			Width:  xMax - xMin,
+			Height: yMax - yMin,
+			Font:   first.Font,
+			Size:   first.Size,
+		},
+		Words: words,
+	}, true
+}
+
+// bboxLayoutWords mirrors pdftotext -bbox-layout output down to its words.
+type bboxLayoutWords struct {
+	Pages []struct {
+		Width  float64 `xml:"width,attr"`
+		Height float64 `xml:"height,attr"`
+		Lines  []struct {
+			Words []struct {
+				XMin float64 `xml:"xMin,attr"`
+				YMin float64 `xml:"yMin,attr"`
+				XMax float64 `xml:"xMax,attr"`
+				YMax float64 `xml:"yMax,attr"`
+				Text string  `xml:",chardata"`
+			} `xml:"word"`
+		} `xml:"flow>block>line"`
+	} `xml:"body>doc>page"`
+}
+
+func popplerTextLayout(inputPath string) ([]TextPage, error) {
+	cmd := exec.Command(binary("pdftotext"), "-bbox-layout", inputPath, "-")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("pdftotext -bbox-layout failed: %v", err)
+	}
+	var doc bboxLayoutWords
+	if err := decodeLenientXML(output, &doc); err != nil {
+		return nil, fmt.Errorf("unexpected pdftotext -bbox-layout output: %v", err)
+	}
+
+	pages := make([]TextPage, len(doc.Pages))
+	for i, p := range doc.Pages {
+		page := TextPage{Page: i + 1, Width: p.Width, Height: p.Height, Lines: []TextLine{}}
+		for _, l := range p.Lines {
+			var words []TextWord
+			for _, w := range l.Words {
+				b := textBounds{xMin: w.XMin, yMin: w.YMin, xMax: w.XMax, yMax: w.YMax}
+				b.text.WriteString(w.Text)
+				words = append(words, b.word(p.Height))
+			}
+			if line, ok := lineOf(words); ok {
+				page.Lines = append(page.Lines, line)
+			}
+		}
+		pages[i] = page
+	}
+	return pages, nil
+}
+
+// decodeLenientXML decodes tool output that may be HTML-flavoured XML.
+func decodeLenientXML(data []byte, v interface{}) error {
+	d := xml.NewDecoder(strings.NewReader(string(data)))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	return d.Decode(v)
+}
@@ -0,0 +1,55 @@
+package converters
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// Poppler (pdftoppm -scale-to-x): Render one page at a fixed pixel width,
+// keeping its aspect ratio. format is png, jpeg or webp; WebP is encoded by
+// ImageMagick from a PNG render. Returns the image path.
+func Thumbnail(inputPath, outputPrefix string, page, width int, format string) (string, error) {
+	return renderThumbnail(inputPath, outputPrefix, page, format, "-scale-to-x", strconv.Itoa(width), "-scale-to-y", "-1")
+}
+
+// Poppler (pdftoppm -r): Render one page at a resolution, e.g. one picked
+// by AutoDPI. Otherwise as Thumbnail.
+func ThumbnailAtDPI(inputPath, outputPrefix string, page, dpi int, format string) (string, error) {
+	return renderThumbnail(inputPath, outputPrefix, page, format, "-r", strconv.Itoa(dpi))
+}
+
+func renderThumbnail(inputPath, outputPrefix string, page int, format string, sizeArgs ...string) (string, error) {
+	fmtFlag, ext := "-png", ".png"
+	switch format {
+	case "png", "webp":
+	case "jpg", "jpeg":
+		fmtFlag, ext = "-jpeg", ".jpg"
+	default:
+		return "", fmt.Errorf("unsupported thumbnail format: %s", format)
+	}
+
+	args := []string{
+		fmtFlag, "-singlefile",
+		"-f", strconv.Itoa(page), "-l", strconv.Itoa(page),
+	}
+	args = append(args, sizeArgs...)
+	args = append(args, inputPath, outputPrefix)
+	cmd := exec.Command(binary("pdftoppm"), args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("pdftoppm failed: %v, output: %s", err, string(output))
+	}
+	imagePath := outputPrefix + ext
+	if format != "webp" {
+		return imagePath, nil
+	}
+
+	webpPath := outputPrefix + ".webp"
+	cmd = imageMagickCommand("convert", imagePath, "-quality", "80", webpPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("ImageMagick failed: %v, output: %s", err, string(output))
+	}
+	os.Remove(imagePath)
+	return webpPath, nil
+}
@@ -0,0 +1,43 @@
+package converters
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TOCEntry is one line of a generated table of contents.
+type TOCEntry struct {
+	Title string `json:"title"`
+	Page  int    `json:"page"`
+}
+
+// TOCEntries numbers documents that follow tocPages contents pages, given
+// each document's page count.
+func TOCEntries(titles []string, pageCounts []int, tocPages int) []TOCEntry {
+	entries := make([]TOCEntry, len(titles))
+	page := tocPages + 1
+	for i, title := range titles {
+		entries[i] = TOCEntry{Title: title, Page: page}
+		page += pageCounts[i]
+	}
+	return entries
+}
+
+// TOCMarkdown renders entries as a Markdown contents page for Pandoc.
+func TOCMarkdown(heading string, entries []TOCEntry) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n| Document | Page |\n|:---|---:|\n", markdownEscape(heading))
+	for _, e := range entries {
+		fmt.Fprintf(&sb, "| %s | %d |\n", markdownEscape(e.Title), e.Page)
+	}
+	return sb.String()
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `|`, `\|`, `#`, `\#`,
+	`[`, `\[`, `]`, `\]`, `<`, `\<`, `>`, `\>`, `$`, `\$`, `~`, `\~`, `^`, `\^`,
+)
+
+func markdownEscape(s string) string {
+	return markdownEscaper.Replace(strings.Join(strings.Fields(s), " "))
+}
@@ -0,0 +1,188 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event is something operators may want to react to, e.g. "quota.exceeded".
+type Event struct {
+	ID   string                 `json:"id"`
+	Type string                 `json:"type"`
+	Time time.Time              `json:"time"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// Sink delivers events somewhere.
+type Sink interface {
+	Send(Event) error
+}
+
+// Bus fans events out to its sinks in the background, so emitting never
+// blocks a request. Events are dropped (and logged) when the queue is full.
+type Bus struct {
+	sinks []Sink
+	queue chan Event
+}
+
+func NewBus(ctx context.Context, sinks ...Sink) *Bus {
+	b := &Bus{sinks: sinks, queue: make(chan Event, 1024)}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-b.queue:
+				for _, s := range b.sinks {
+					if err := s.Send(e); err != nil {
+						log.Printf("Events: delivering %s %s failed: %v", e.Type, e.ID, err)
+					}
+				}
+			}
+		}
+	}()
+	return b
+}
+
+// New makes an event happening now.
+func New(eventType string, data map[string]interface{}) Event {
+	return Event{ID: uuid.New().String(), Type: eventType, Time: time.Now().UTC(), Data: data}
+}
+
+// Emit queues an event. A nil bus discards it.
+func (b *Bus) Emit(eventType string, data map[string]interface{}) {
+	b.Publish(New(eventType, data))
+}
+
+// Publish queues an event made elsewhere. A nil bus discards it.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	select {
+	case b.queue <- e:
+	default:
+		log.Printf("Events: queue full, dropping %s", e.Type)
+	}
+}
+
+// LogSink writes events to the server log as JSON.
+type LogSink struct{}
+
+func (LogSink) Send(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	log.Printf("Event: %s", data)
+	return nil
+}
+
+// WebhookSink POSTs each event as JSON. With a secret, the body is signed as
+// X-Signature: sha256=<hex HMAC>.
+type WebhookSink struct {
+	URL    string
+	Secret string
+	client *http.Client
+}
+
+func NewWebhookSink(url, secret string) *WebhookSink {
+	return &WebhookSink{URL: url, Secret: secret, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *WebhookSink) Send(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// KafkaRESTSink publishes each event to a Kafka topic through a Kafka REST
+// proxy (Confluent REST Proxy v2 API), keyed by its request or job ID so
+// one request's events stay in order on one partition. Credentials for the
+// proxy may be given as user:password in the URL.
+type KafkaRESTSink struct {
+	URL    string
+	Topic  string
+	client *http.Client
+}
+
+func NewKafkaRESTSink(url, topic string) *KafkaRESTSink {
+	return &KafkaRESTSink{URL: strings.TrimSuffix(url, "/"), Topic: topic, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *KafkaRESTSink) Send(e Event) error {
+	key := e.ID
+	for _, field := range []string{"request_id", "job_id"} {
+		if id, ok := e.Data[field].(string); ok && id != "" {
+			key = id
+			break
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"records": []map[string]interface{}{{"key": key, "value": e}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.URL+"/topics/"+url.PathEscape(s.Topic), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("kafka rest proxy returned %s", resp.Status)
+	}
+	// The proxy answers 200 even when single records fail
+	var result struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&result) == nil {
+		for _, o := range result.Offsets {
+			if o.ErrorCode != nil {
+				return fmt.Errorf("kafka rejected event: %s", o.Error)
+			}
+		}
+	}
+	return nil
+}
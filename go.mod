@@ -2,4 +2,4 @@ module github.com/akila/document-converter
 
 go 1.22.0
 
-require github.com/google/uuid v1.6.0 // indirect
+require github.com/google/uuid v1.6.0
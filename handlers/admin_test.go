@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/akila/document-converter/auth"
+	"github.com/akila/document-converter/config"
+)
+
+// adminTestClients are an unrestricted client, one with every scope but
+// the admin ones, and an admin.
+const adminTestClients = `{"clients": [
+	{"id": "open", "api_key": "open-key"},
+	{"id": "user", "api_key": "user-key", "scopes": ["*"]},
+	{"id": "admin", "api_key": "admin-key", "scopes": ["admin.*"]}
+]}`
+
+// newAdminTestServer mounts the routes, with authentication when
+// withAuth is set.
+func newAdminTestServer(t *testing.T, withAuth bool) (*ConversionHandler, *http.ServeMux) {
+	t.Helper()
+	h := &ConversionHandler{Config: &config.Config{}}
+	if withAuth {
+		file := filepath.Join(t.TempDir(), "clients.json")
+		if err := os.WriteFile(file, []byte(adminTestClients), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if h.Auth, err = auth.Load(file, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mux := http.NewServeMux()
+	h.Register(mux)
+	return h, mux
+}
+
+// adminRequest answers method target with apiKey, if any.
+func adminRequest(mux *http.ServeMux, method, target, body, apiKey string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if apiKey != "" {
+		r.Header.Set("X-API-Key", apiKey)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+func TestAdminMaintenanceNeedsAdminScope(t *testing.T) {
+	h, mux := newAdminTestServer(t, false)
+	if w := adminRequest(mux, http.MethodPost, "/admin/maintenance", "enabled=true", ""); w.Code != http.StatusForbidden {
+		t.Errorf("without auth: status %d, want 403", w.Code)
+	}
+	if h.maintenance.enabled {
+		t.Fatal("maintenance switched on without auth")
+	}
+
+	h, mux = newAdminTestServer(t, true)
+	for key, want := range map[string]int{
+		"":          http.StatusUnauthorized,
+		"open-key":  http.StatusForbidden,
+		"user-key":  http.StatusForbidden,
+		"admin-key": http.StatusOK,
+	} {
+		if w := adminRequest(mux, http.MethodPost, "/admin/maintenance", "enabled=true", key); w.Code != want {
+			t.Errorf("key %q: status %d, want %d", key, w.Code, want)
+		}
+	}
+	if !h.maintenance.enabled {
+		t.Error("admin could not switch maintenance on")
+	}
+}
+
+func TestAdminReprocessNeedsAdminScope(t *testing.T) {
+	routes := []struct{ method, target, body string }{
+		{http.MethodGet, "/admin/reprocess", ""},
+		{http.MethodPost, "/admin/reprocess", "pipeline=convert:pdf"},
+		{http.MethodGet, "/admin/reprocess/some-run", ""},
+		{http.MethodDelete, "/admin/reprocess/some-run", ""},
+	}
+	_, mux := newAdminTestServer(t, false)
+	for _, rt := range routes {
+		if w := adminRequest(mux, rt.method, rt.target, rt.body, ""); w.Code != http.StatusForbidden {
+			t.Errorf("%s %s without auth: status %d, want 403", rt.method, rt.target, w.Code)
+		}
+	}
+
+	_, mux = newAdminTestServer(t, true)
+	for _, rt := range routes {
+		if w := adminRequest(mux, rt.method, rt.target, rt.body, "user-key"); w.Code != http.StatusForbidden {
+			t.Errorf("%s %s without an admin scope: status %d, want 403", rt.method, rt.target, w.Code)
+		}
+	}
+	if w := adminRequest(mux, http.MethodGet, "/admin/reprocess", "", "admin-key"); w.Code != http.StatusOK {
+		t.Errorf("GET /admin/reprocess as admin: status %d, want 200", w.Code)
+	}
+}
+
+func TestAdminEngineCompareNeedsAdminScope(t *testing.T) {
+	_, mux := newAdminTestServer(t, false)
+	if w := adminRequest(mux, http.MethodPost, "/admin/engines/compare", "", ""); w.Code != http.StatusForbidden {
+		t.Errorf("without auth: status %d, want 403", w.Code)
+	}
+
+	_, mux = newAdminTestServer(t, true)
+	for key, want := range map[string]int{
+		"open-key": http.StatusForbidden,
+		"user-key": http.StatusForbidden,
+		// Past the guard, the missing upload is refused
+		"admin-key": http.StatusBadRequest,
+	} {
+		if w := adminRequest(mux, http.MethodPost, "/admin/engines/compare", "", key); w.Code != want {
+			t.Errorf("key %q: status %d, want %d", key, w.Code, want)
+		}
+	}
+}
+
+func TestMaintenanceRefusesWrites(t *testing.T) {
+	h, mux := newAdminTestServer(t, true)
+	if w := adminRequest(mux, http.MethodPost, "/admin/maintenance", "enabled=true", "admin-key"); w.Code != http.StatusOK {
+		t.Fatalf("switching maintenance on: status %d, want 200", w.Code)
+	}
+	if !h.Paused() {
+		t.Error("ingestion not paused in maintenance mode")
+	}
+
+	tests := []struct {
+		method, target, body string
+		want                 int
+	}{
+		{http.MethodGet, "/admin/reprocess", "", http.StatusOK},
+		{http.MethodGet, "/admin/maintenance", "", http.StatusOK},
+		{http.MethodPost, "/admin/reprocess", "pipeline=convert:pdf", http.StatusServiceUnavailable},
+		{http.MethodDelete, "/admin/reprocess/some-run", "", http.StatusServiceUnavailable},
+		{http.MethodPost, "/admin/engines/compare", "", http.StatusServiceUnavailable},
+		{http.MethodPost, "/ingest/webhook", "{}", http.StatusServiceUnavailable},
+		{http.MethodPost, "/admin/maintenance", "enabled=false", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := adminRequest(mux, tt.method, tt.target, tt.body, "admin-key"); w.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, w.Code, tt.want)
+		}
+	}
+	if h.Paused() {
+		t.Error("ingestion still paused after maintenance mode ended")
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/akila/document-converter/converters"
+)
+
+func (h *ConversionHandler) HandleAnnotationsExtract(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "annotations.extract")
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	annotations, err := converters.ExtractAnnotations(inputPath)
+	if err != nil {
+		log.Printf("[%s] Annotation extraction failed: %v", reqID, err)
+		http.Error(w, "Annotation extraction failed", http.StatusInternalServerError)
+		return
+	}
+	if annotations == nil {
+		annotations = []converters.Annotation{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"annotations": annotations})
+}
+
+func (h *ConversionHandler) HandleAnnotationsRemove(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "annotations.remove")
+	if !ok {
+		return
+	}
+
+	// Optional comma separated subtypes, e.g. "highlight,text"
+	var types []string
+	for _, t := range strings.Split(r.FormValue("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+
+	outputPath := filepath.Join(tempDir, "clean.pdf")
+	if err := converters.RemoveAnnotations(inputPath, outputPath, types); err != nil {
+		log.Printf("[%s] Annotation removal failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Annotation removal failed", http.StatusInternalServerError)
+		return
+	}
+
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/utils"
+)
+
+// HandleAttachmentsAdd embeds the uploaded "attachments" files into "file".
+// Options: description (applied to every attachment), relationship (a
+// PDF/A-3 AFRelationship such as Alternative, for ZUGFeRD/Factur-X
+// invoices) and replace=true to overwrite attachments of the same name.
+func (h *ConversionHandler) HandleAttachmentsAdd(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "attachments.add")
+	if !ok {
+		return
+	}
+
+	uploads := r.MultipartForm.File["attachments"]
+	if len(uploads) == 0 {
+		os.RemoveAll(tempDir)
+		http.Error(w, "At least one file required in attachments", http.StatusBadRequest)
+		return
+	}
+	relationship := r.FormValue("relationship")
+	if relationship != "" && !converters.AFRelationships[relationship] {
+		os.RemoveAll(tempDir)
+		http.Error(w, "relationship must be Source, Data, Alternative, Supplement or Unspecified", http.StatusBadRequest)
+		return
+	}
+
+	attachDir := filepath.Join(tempDir, "attachments")
+	os.MkdirAll(attachDir, 0755)
+	var files []converters.AttachmentFile
+	seen := map[string]bool{}
+	for _, fileHeader := range uploads {
+		name := filepath.Base(fileHeader.Filename)
+		if name == "." || name == string(filepath.Separator) || seen[name] {
+			os.RemoveAll(tempDir)
+			http.Error(w, fmt.Sprintf("Attachment names must be distinct file names (%q)", fileHeader.Filename), http.StatusBadRequest)
+			return
+		}
+		seen[name] = true
+		path := filepath.Join(attachDir, name)
+		if err := saveFormFile(fileHeader, path); err != nil {
+			os.RemoveAll(tempDir)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		mimeType := fileHeader.Header.Get("Content-Type")
+		if mimeType == "application/octet-stream" {
+			mimeType = ""
+		}
+		files = append(files, converters.AttachmentFile{
+			Path:        path,
+			Name:        name,
+			MimeType:    mimeType,
+			Description: r.FormValue("description"),
+		})
+	}
+
+	outputPath := filepath.Join(tempDir, "attached.pdf")
+	err := converters.AddAttachments(inputPath, outputPath, files, relationship, r.FormValue("replace") == "true")
+	if err != nil {
+		log.Printf("[%s] Adding attachments failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Adding attachments failed", http.StatusInternalServerError)
+		return
+	}
+
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
+
+// HandleAttachmentsExtract pulls embedded files out of a PDF: the one
+// named by "name", or all of them as a zip. list=true answers with the
+// attachments' details as JSON instead.
+func (h *ConversionHandler) HandleAttachmentsExtract(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "attachments.extract")
+	if !ok {
+		return
+	}
+
+	attachments, err := converters.ListAttachments(inputPath)
+	if err != nil {
+		log.Printf("[%s] Listing attachments failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Attachment extraction failed", http.StatusInternalServerError)
+		return
+	}
+
+	if r.FormValue("list") == "true" {
+		defer os.RemoveAll(tempDir)
+		if attachments == nil {
+			attachments = []converters.Attachment{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"attachments": attachments})
+		return
+	}
+
+	if name := r.FormValue("name"); name != "" {
+		var found []converters.Attachment
+		for _, a := range attachments {
+			if a.Key == name || a.Name == name {
+				found = append(found, a)
+				break
+			}
+		}
+		attachments = found
+	}
+	if len(attachments) == 0 {
+		os.RemoveAll(tempDir)
+		http.Error(w, "No attachments found in PDF", http.StatusNotFound)
+		return
+	}
+
+	outDir := filepath.Join(tempDir, "extracted")
+	os.MkdirAll(outDir, 0755)
+	var files []string
+	seen := map[string]bool{}
+	for i, a := range attachments {
+		// Names come from the PDF; keep them to a plain, unique file name
+		name := fileSafeName(filepath.Base(strings.ReplaceAll(a.Name, "\\", "/")))
+		if seen[strings.ToLower(name)] {
+			name = fmt.Sprintf("%d-%s", i+1, name)
+		}
+		seen[strings.ToLower(name)] = true
+		path := filepath.Join(outDir, name)
+		if err := converters.ExtractAttachment(inputPath, a.Key, path); err != nil {
+			log.Printf("[%s] Extracting attachment %q failed: %v", reqID, a.Key, err)
+			os.RemoveAll(tempDir)
+			http.Error(w, "Attachment extraction failed", http.StatusInternalServerError)
+			return
+		}
+		files = append(files, path)
+	}
+
+	if len(files) == 1 && r.FormValue("name") != "" {
+		if attachments[0].MimeType != "" {
+			w.Header().Set("Content-Type", attachments[0].MimeType)
+		}
+		h.serveAndCleanup(w, r, files[0], tempDir)
+		return
+	}
+	zipPath := filepath.Join(tempDir, "attachments.zip")
+	if err := utils.ZipFiles(zipPath, files); err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "Zipping failed", http.StatusInternalServerError)
+		return
+	}
+	h.serveAndCleanup(w, r, zipPath, tempDir)
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/akila/document-converter/converters"
+)
+
+// Limits for zip uploads to batch endpoints. They cover a zip and any zips
+// nested in it together.
+const (
+	batchMaxFiles = 500
+	batchMaxBytes = 500 * 1024 * 1024 // uncompressed
+	// Entries inflating more than this many times over are refused as
+	// likely zip bombs, once they pass a megabyte.
+	batchMaxRatio = 200
+)
+
+// batchInput is one document of a batch upload. Name is its path inside the
+// upload (zip entries keep their folders).
+type batchInput struct {
+	Name string
+	Path string
+}
+
+// receiveBatch saves the "files" of a multipart upload, expanding zips, into
+// tempDir. With expand_nested=true, zips found inside uploaded zips are
+// expanded too (one level), into a folder named after them.
+func receiveBatch(r *http.Request, tempDir string) ([]batchInput, error) {
+	files := r.MultipartForm.File["files"]
+	if len(files) == 0 {
+		return nil, fmt.Errorf("Missing files")
+	}
+	nested := r.FormValue("expand_nested") == "true"
+	var inputs []batchInput
+	for i, fileHeader := range files {
+		name := filepath.Base(fileHeader.Filename)
+		dir := filepath.Join(tempDir, fmt.Sprintf("upload_%d", i))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, name)
+		if err := saveFormFile(fileHeader, path); err != nil {
+			return nil, err
+		}
+		if isZipName(name) {
+			entries, err := expandZip(path, filepath.Join(dir, "unzipped"), batchMaxFiles-len(inputs), nested)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			inputs = append(inputs, entries...)
+		} else {
+			inputs = append(inputs, batchInput{Name: name, Path: path})
+		}
+		if len(inputs) > batchMaxFiles {
+			return nil, fmt.Errorf("At most %d documents per batch", batchMaxFiles)
+		}
+	}
+	return inputs, nil
+}
+
+func isZipName(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".zip")
+}
+
+// zipBudget is what is left of the batch limits while expanding a zip.
+type zipBudget struct {
+	files int
+	bytes int64
+}
+
+// expandZip extracts the files of a zip below dir, refusing entries that
+// would escape it and archives over the batch limits. With nested, zip
+// entries are expanded in place of themselves: "scans/box1.zip" becomes
+// the folder "scans/box1/".
+func expandZip(zipPath, dir string, maxFiles int, nested bool) ([]batchInput, error) {
+	budget := &zipBudget{files: maxFiles, bytes: batchMaxBytes}
+	depth := 0
+	if nested {
+		depth = 1
+	}
+	return expandZipEntries(zipPath, dir, "", depth, budget)
+}
+
+func expandZipEntries(zipPath, dir, prefix string, depth int, budget *zipBudget) ([]batchInput, error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip: %v", err)
+	}
+	defer zr.Close()
+
+	var inputs []batchInput
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(filepath.Base(f.Name), ".") || strings.HasPrefix(f.Name, "__MACOSX/") {
+			continue
+		}
+		name := filepath.Clean(filepath.FromSlash(f.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("entry %q escapes the archive", prefix+f.Name)
+		}
+		if budget.files <= 0 {
+			return nil, fmt.Errorf("more than %d documents", batchMaxFiles)
+		}
+
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		src, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("entry %q: %v", prefix+f.Name, err)
+		}
+		dst, err := os.Create(path)
+		if err != nil {
+			src.Close()
+			return nil, err
+		}
+		// Count real bytes rather than trusting the declared sizes
+		n, err := io.Copy(dst, io.LimitReader(src, budget.bytes+1))
+		src.Close()
+		dst.Close()
+		if err != nil {
+			return nil, fmt.Errorf("entry %q: %v", prefix+f.Name, err)
+		}
+		if budget.bytes -= n; budget.bytes < 0 {
+			return nil, fmt.Errorf("expands to more than %d MB", batchMaxBytes/(1024*1024))
+		}
+		if n > 1024*1024 && n > int64(f.CompressedSize64)*batchMaxRatio {
+			return nil, fmt.Errorf("entry %q is compressed suspiciously well", prefix+f.Name)
+		}
+
+		if depth > 0 && isZipName(name) {
+			// The nested zip's own bytes were only a staging copy
+			budget.bytes += n
+			inner := strings.TrimSuffix(name, filepath.Ext(name))
+			entries, err := expandZipEntries(path, filepath.Join(dir, inner), prefix+f.Name+"/", depth-1, budget)
+			os.Remove(path)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range entries {
+				e.Name = filepath.ToSlash(inner) + "/" + e.Name
+				inputs = append(inputs, e)
+			}
+			continue
+		}
+		budget.files--
+		inputs = append(inputs, batchInput{Name: filepath.ToSlash(name), Path: path})
+	}
+	return inputs, nil
+}
+
+type textRecord struct {
+	Filename string   `json:"filename"`
+	Pages    int      `json:"pages"`
+	Text     string   `json:"text"`
+	Warnings []string `json:"warnings,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// HandleExtractTextBatch extracts the text of many PDFs ("files", zips are
+// expanded, see receiveBatch) concurrently and answers with NDJSON, one
+// record per document in upload order, each written as soon as it and its
+// predecessors are done. Records are named by their path in the upload.
+func (h *ConversionHandler) HandleExtractTextBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.parseUpload(w, r, "extract-text.batch") {
+		return
+	}
+
+	reqID := requestID(r)
+	tempDir := filepath.Join("tmp", reqID)
+	os.MkdirAll(tempDir, 0755)
+	defer os.RemoveAll(tempDir)
+
+	inputs, err := receiveBatch(r, tempDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("[%s] Extracting text from %d documents", reqID, len(inputs))
+
+	results := make([]chan textRecord, len(inputs))
+	sem := make(chan struct{}, runtime.NumCPU())
+	for i, in := range inputs {
+		results[i] = make(chan textRecord, 1)
+		go func(in batchInput, out chan<- textRecord) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			rec := textRecord{Filename: in.Name}
+			if format := converters.DetectFormat(in.Path); format != "pdf" {
+				rec.Error = fmt.Sprintf("not a PDF (%s)", format)
+				out <- rec
+				return
+			}
+			text, warnings, err := converters.ExtractTextWithWarnings(in.Path)
+			rec.Warnings = warnings
+			if err != nil {
+				log.Printf("[%s] Text extraction of %s failed: %v", reqID, in.Name, err)
+				rec.Error = "text extraction failed"
+			} else {
+				// pdftotext ends every page with a form feed
+				rec.Pages = strings.Count(text, "\f")
+				rec.Text = text
+			}
+			out <- rec
+		}(in, results[i])
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	for _, ch := range results {
+		enc.Encode(<-ch)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
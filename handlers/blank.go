@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/akila/document-converter/converters"
+)
+
+// HandleRemoveBlankPages drops pages whose ink coverage is at or below
+// threshold (a fraction of the page area, default 0.001, so scanner specks
+// still count as blank). The dropped pages are listed in X-Removed-Pages.
+func (h *ConversionHandler) HandleRemoveBlankPages(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "remove-blank")
+	if !ok {
+		return
+	}
+
+	threshold := 0.001
+	if v := r.FormValue("threshold"); v != "" {
+		var err error
+		if threshold, err = strconv.ParseFloat(v, 64); err != nil || threshold < 0 || threshold > 1 {
+			os.RemoveAll(tempDir)
+			http.Error(w, "threshold must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+	}
+
+	coverage, err := converters.InkCoverage(inputPath)
+	if err != nil {
+		log.Printf("[%s] Blank page detection failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Blank page detection failed", http.StatusInternalServerError)
+		return
+	}
+	var keep []int
+	var removed []string
+	for i, c := range coverage {
+		if c <= threshold {
+			removed = append(removed, strconv.Itoa(i+1))
+		} else {
+			keep = append(keep, i+1)
+		}
+	}
+	log.Printf("[%s] Removing %d of %d pages as blank", reqID, len(removed), len(coverage))
+	if len(keep) == 0 {
+		os.RemoveAll(tempDir)
+		http.Error(w, fmt.Sprintf("All %d pages are blank", len(coverage)), http.StatusUnprocessableEntity)
+		return
+	}
+
+	outputPath := filepath.Join(tempDir, "cleaned.pdf")
+	if err := converters.ExtractPages(inputPath, outputPath, keep); err != nil {
+		log.Printf("[%s] Blank page removal failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Blank page removal failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Removed-Pages", strings.Join(removed, ","))
+	w.Header().Set("X-Removed-Count", strconv.Itoa(len(removed)))
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/akila/document-converter/converters"
+)
+
+// HandleBooklet imposes the uploaded PDF as a saddle-stitched booklet. It
+// answers 501 where pdfjam is not installed.
+func (h *ConversionHandler) HandleBooklet(w http.ResponseWriter, r *http.Request) {
+	if !converters.BookletAvailable() {
+		http.Error(w, "Operation not available in this deployment", http.StatusNotImplemented)
+		return
+	}
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "booklet")
+	if !ok {
+		return
+	}
+
+	// Pages per folded signature; 0 keeps the whole document in one signature
+	var signature int
+	if s := r.FormValue("signature"); s != "" {
+		var err error
+		if signature, err = strconv.Atoi(s); err != nil || signature < 0 || signature%4 != 0 {
+			os.RemoveAll(tempDir)
+			http.Error(w, "signature must be a multiple of 4", http.StatusBadRequest)
+			return
+		}
+	}
+
+	outputPath := filepath.Join(tempDir, "booklet.pdf")
+	if err := converters.BookletPDF(inputPath, outputPath, signature); err != nil {
+		log.Printf("[%s] Booklet failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Booklet imposition failed", http.StatusInternalServerError)
+		return
+	}
+
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
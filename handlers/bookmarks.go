@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/akila/document-converter/converters"
+)
+
+func (h *ConversionHandler) HandleBookmarksExtract(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "bookmarks.extract")
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	bookmarks, err := converters.ExtractBookmarks(inputPath)
+	if err != nil {
+		log.Printf("[%s] Bookmark extraction failed: %v", reqID, err)
+		http.Error(w, "Bookmark extraction failed", http.StatusInternalServerError)
+		return
+	}
+	if bookmarks == nil {
+		bookmarks = []converters.Bookmark{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"bookmarks": bookmarks})
+}
+
+func (h *ConversionHandler) HandleBookmarksSet(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "bookmarks.set")
+	if !ok {
+		return
+	}
+
+	// The tree comes as a "bookmarks" form value or JSON file part, either a
+	// bare array or the {"bookmarks": [...]} shape /bookmarks/extract returns
+	raw := []byte(r.FormValue("bookmarks"))
+	if len(raw) == 0 {
+		if f, _, err := r.FormFile("bookmarks"); err == nil {
+			raw, _ = io.ReadAll(f)
+			f.Close()
+		}
+	}
+	var bookmarks []converters.Bookmark
+	if err := json.Unmarshal(raw, &bookmarks); err != nil {
+		var wrapped struct {
+			Bookmarks []converters.Bookmark `json:"bookmarks"`
+		}
+		if err := json.Unmarshal(raw, &wrapped); err != nil {
+			os.RemoveAll(tempDir)
+			http.Error(w, "bookmarks must be a JSON array of {title, page, children}", http.StatusBadRequest)
+			return
+		}
+		bookmarks = wrapped.Bookmarks
+	}
+
+	mode := r.FormValue("mode")
+	if mode == "" {
+		mode = "replace"
+	}
+	if mode != "replace" && mode != "merge" {
+		os.RemoveAll(tempDir)
+		http.Error(w, "mode must be replace or merge", http.StatusBadRequest)
+		return
+	}
+
+	pageCount, err := converters.PageCount(inputPath)
+	if err != nil {
+		log.Printf("[%s] Page count failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Invalid PDF", http.StatusBadRequest)
+		return
+	}
+	if err := converters.ValidateBookmarks(bookmarks, pageCount); err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	outputPath := filepath.Join(tempDir, "bookmarked.pdf")
+	if err := converters.SetBookmarks(inputPath, outputPath, bookmarks, mode == "merge"); err != nil {
+		log.Printf("[%s] Setting bookmarks failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Setting bookmarks failed", http.StatusInternalServerError)
+		return
+	}
+
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/akila/document-converter/auth"
+	"github.com/akila/document-converter/converters"
+)
+
+// HandleCompare diffs two PDFs, sent as file_a and file_b (or two "files").
+// mode=text (default) answers with a JSON line diff per page; mode=visual
+// answers with a PDF whose pages highlight the differences in red.
+func (h *ConversionHandler) HandleCompare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.parseUpload(w, r, "compare") {
+		return
+	}
+
+	files := r.MultipartForm.File["files"]
+	if a, b := r.MultipartForm.File["file_a"], r.MultipartForm.File["file_b"]; len(a) > 0 && len(b) > 0 {
+		files = []*multipart.FileHeader{a[0], b[0]}
+	}
+	if len(files) != 2 {
+		http.Error(w, "Exactly 2 files required for compare (file_a and file_b)", http.StatusBadRequest)
+		return
+	}
+
+	mode := r.FormValue("mode")
+	if mode == "" {
+		mode = "text"
+	}
+	if mode != "text" && mode != "visual" {
+		http.Error(w, "mode must be text or visual", http.StatusBadRequest)
+		return
+	}
+	dpi, _ := strconv.Atoi(r.FormValue("dpi"))
+	if dpi < 0 || dpi > 300 {
+		http.Error(w, "dpi must be between 1 and 300", http.StatusBadRequest)
+		return
+	}
+
+	reqID := requestID(r)
+	tempDir := filepath.Join("tmp", reqID)
+	os.MkdirAll(tempDir, 0755)
+
+	var paths []string
+	for i, fileHeader := range files {
+		path := filepath.Join(tempDir, fmt.Sprintf("input_%c.pdf", 'a'+i))
+		if err := saveFormFile(fileHeader, path); err != nil {
+			os.RemoveAll(tempDir)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		paths = append(paths, path)
+	}
+
+	if mode == "text" {
+		defer os.RemoveAll(tempDir)
+		pages, err := converters.CompareText(paths[0], paths[1])
+		if err != nil {
+			log.Printf("[%s] Text compare failed: %v", reqID, err)
+			http.Error(w, "Compare failed", http.StatusInternalServerError)
+			return
+		}
+		changed := 0
+		for _, p := range pages {
+			if p.Status != "same" {
+				changed++
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"identical":     changed == 0,
+			"changed_pages": changed,
+			"pages":         pages,
+		})
+		return
+	}
+
+	outputPath := filepath.Join(tempDir, "compare.pdf")
+	changed, err := converters.CompareVisual(paths[0], paths[1], outputPath, dpi)
+	if err != nil {
+		log.Printf("[%s] Visual compare failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Compare failed", http.StatusInternalServerError)
+		return
+	}
+	pages := make([]string, len(changed))
+	for i, p := range changed {
+		pages[i] = strconv.Itoa(p)
+	}
+	w.Header().Set("X-Changed-Pages", strings.Join(pages, ","))
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
+
+// HandleCompareTemplate checks that a document generated from a catalog
+// template matches the layout reference stored for it (see
+// /templates/{name}/reference) before it is sent: the page count, the fixed
+// text and the form fields. template names the template, version picks one
+// other than the current. Answers with pass and the deviations found.
+func (h *ConversionHandler) HandleCompareTemplate(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "compare")
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	name := r.FormValue("template")
+	if name == "" {
+		http.Error(w, "template is required", http.StatusBadRequest)
+		return
+	}
+	version := 0
+	if v := r.FormValue("version"); v != "" {
+		var err error
+		if version, err = strconv.Atoi(v); err != nil || version < 1 {
+			http.Error(w, "version must be a version number", http.StatusBadRequest)
+			return
+		}
+	}
+	t, err := h.Templates.Get(auth.Tenant(r.Context()), name)
+	if err != nil {
+		templateError(w, r, err)
+		return
+	}
+	if version == 0 {
+		version = t.Current
+	}
+	var reference []byte
+	found := false
+	for _, v := range t.Versions {
+		if v.Version == version {
+			reference, found = v.Reference, true
+		}
+	}
+	if !found {
+		http.Error(w, fmt.Sprintf("Template %s has no version %d", name, version), http.StatusBadRequest)
+		return
+	}
+	var ref converters.LayoutReference
+	if len(reference) == 0 || json.Unmarshal(reference, &ref) != nil {
+		http.Error(w, fmt.Sprintf("Template %s version %d has no reference layout", name, version), http.StatusBadRequest)
+		return
+	}
+
+	deviations, err := converters.CheckLayout(inputPath, ref)
+	if err != nil {
+		log.Printf("[%s] Template compare failed: %v", reqID, err)
+		http.Error(w, "Compare failed", http.StatusInternalServerError)
+		return
+	}
+	if deviations == nil {
+		deviations = []converters.Deviation{}
+	}
+	log.Printf("[%s] Checked against template %s version %d: %d deviation(s)", reqID, name, version, len(deviations))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"pass":       len(deviations) == 0,
+		"template":   name,
+		"version":    version,
+		"deviations": deviations,
+	})
+}
+
+func saveFormFile(fileHeader *multipart.FileHeader, path string) error {
+	src, err := fileHeader.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
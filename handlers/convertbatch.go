@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/models"
+	"github.com/akila/document-converter/utils"
+)
+
+// convertRecord is one document's entry in a batch conversion's
+// manifest.json. Status is "converted", "copied" (already in the target
+// format) or "failed".
+type convertRecord struct {
+	Filename string `json:"filename"`
+	From     string `json:"from"`
+	Output   string `json:"output,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HandleConvertBatch converts many documents ("files", zips are expanded,
+// see receiveBatch) to the format to (default pdf), concurrently across
+// the engines' pools, and answers with a zip of the results, keeping the
+// upload's folders, and a manifest.json with each document's status.
+// Documents that fail are listed in the manifest; the rest are still
+// returned. Source formats are inferred as for /convert without from;
+// options as for /convert.
+func (h *ConversionHandler) HandleConvertBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.parseUpload(w, r, "convert.batch") {
+		return
+	}
+
+	to := strings.ToLower(r.FormValue("to"))
+	if to == "" {
+		to = "pdf"
+	}
+	options, err := imageOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reqID := requestID(r)
+	tempDir := filepath.Join("tmp", reqID)
+	os.MkdirAll(tempDir, 0755)
+
+	inputs, err := receiveBatch(r, tempDir)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("[%s] Converting %d documents to %s", reqID, len(inputs), to)
+
+	outDir := filepath.Join(tempDir, "converted")
+	outputs := batchOutputNames(inputs, to)
+	records := make([]convertRecord, len(inputs))
+	sem := make(chan struct{}, runtime.NumCPU())
+	// busy holds the error of a document refused by a full engine queue
+	var busy atomic.Value
+	var wg sync.WaitGroup
+	for i, in := range inputs {
+		wg.Add(1)
+		go func(i int, in batchInput) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			rec := convertRecord{Filename: in.Name}
+			from, err := converters.InferFormat(in.Path)
+			if err != nil {
+				rec.Status, rec.Error = "failed", err.Error()
+				records[i] = rec
+				return
+			}
+			rec.From = from
+			outputPath := filepath.Join(outDir, filepath.FromSlash(outputs[i]))
+			jobDir := filepath.Join(tempDir, fmt.Sprintf("convert_%d", i))
+			status, err := h.convertBatchInput(reqID, fmt.Sprintf("%s-%d", reqID, i+1), jobDir, in.Path, rec.From, to, maps.Clone(options), outputPath)
+			if err != nil {
+				log.Printf("[%s] Converting %s failed: %v", reqID, in.Name, err)
+				if errors.As(err, new(*queueFullError)) {
+					busy.Store(err)
+				}
+				rec.Status, rec.Error = "failed", err.Error()
+			} else {
+				rec.Status, rec.Output = status, outputs[i]
+			}
+			records[i] = rec
+		}(i, in)
+	}
+	wg.Wait()
+	if err, ok := busy.Load().(error); ok {
+		// A partial batch is no use to a client that will retry it whole
+		os.RemoveAll(tempDir)
+		h.queueFull(w, err)
+		return
+	}
+
+	var files []string
+	failed := 0
+	for _, rec := range records {
+		if rec.Status == "failed" {
+			failed++
+			continue
+		}
+		files = append(files, filepath.Join(outDir, filepath.FromSlash(rec.Output)))
+	}
+	manifestPath := filepath.Join(outDir, "manifest.json")
+	data, _ := json.MarshalIndent(map[string]interface{}{
+		"to":        to,
+		"converted": len(records) - failed,
+		"failed":    failed,
+		"files":     records,
+	}, "", "  ")
+	os.MkdirAll(outDir, 0755)
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	files = append(files, manifestPath)
+	log.Printf("[%s] Batch conversion done: %d converted, %d failed", reqID, len(records)-failed, failed)
+
+	zipPath := filepath.Join(tempDir, "converted.zip")
+	if err := utils.ZipFilesUnder(zipPath, outDir, files); err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "Zipping failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("X-Batch-Failed", fmt.Sprint(failed))
+	h.serveAndCleanup(w, r, zipPath, tempDir)
+}
+
+// convertBatchInput converts one document of a batch in its own jobDir,
+// since engines pick their output from the job's directory, and moves the
+// result to outputPath.
+func (h *ConversionHandler) convertBatchInput(reqID, jobID, jobDir, inputPath, from, to string, options map[string]interface{}, outputPath string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return "", err
+	}
+	if from == to {
+		return "copied", copyFile(inputPath, outputPath)
+	}
+	pool := h.selectPool(from, to)
+	if pool == nil {
+		return "", fmt.Errorf("unsupported conversion %s -> %s", from, to)
+	}
+	if err := os.MkdirAll(jobDir, 0755); err != nil {
+		return "", err
+	}
+	jobInput := filepath.Join(jobDir, filepath.Base(inputPath))
+	if err := os.Rename(inputPath, jobInput); err != nil {
+		return "", err
+	}
+	job := models.Job{
+		ID:         jobID,
+		RequestID:  reqID,
+		InputPath:  jobInput,
+		FromFormat: from,
+		ToFormat:   to,
+		Options:    options,
+		TempDir:    jobDir,
+	}
+	pool, err := h.routeJob(&job, pool)
+	if err != nil {
+		return "", err
+	}
+	resultPath, err := h.runJob(pool, job)
+	if err != nil {
+		return "", err
+	}
+	return "converted", os.Rename(resultPath, outputPath)
+}
+
+// batchOutputNames names each input's result: its path with the target's
+// extension, numbered when two inputs would share a name.
+func batchOutputNames(inputs []batchInput, to string) []string {
+	used := map[string]bool{"manifest.json": true}
+	names := make([]string, len(inputs))
+	for i, in := range inputs {
+		base := strings.TrimSuffix(in.Name, path.Ext(in.Name))
+		name := base + "." + to
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s-%d.%s", base, n, to)
+		}
+		used[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/akila/document-converter/storage"
+)
+
+// storedOutput describes one file of a result delivered through object
+// storage.
+type storedOutput struct {
+	Name      string `json:"name"`
+	FirstPage int    `json:"first_page,omitempty"`
+	LastPage  int    `json:"last_page,omitempty"`
+	Size      int64  `json:"size"`
+	URL       string `json:"url"`
+}
+
+// outputStore returns the backend for storage delivery, or an error when
+// the deployment has no output bucket.
+func (h *ConversionHandler) outputStore() (storage.Backend, error) {
+	if h.Config.Outputs.Bucket == "" {
+		return nil, fmt.Errorf("storage delivery is not configured")
+	}
+	return storage.Open(h.Config, h.Config.Outputs.Provider, h.Config.Outputs.Bucket)
+}
+
+// serveFromStorage uploads files to the output bucket under
+// outputs/<request id>/ and answers with a presigned download URL for each
+// instead of the files themselves. vars[i] describes files[i].
+func (h *ConversionHandler) serveFromStorage(w http.ResponseWriter, r *http.Request, reqID, tempDir string, files []string, vars []nameVars) {
+	defer os.RemoveAll(tempDir)
+	cfg := h.Config.Outputs
+	store, err := h.outputStore()
+	if err != nil {
+		http.Error(w, "Storage delivery is not configured", http.StatusNotFound)
+		return
+	}
+
+	outputs := make([]storedOutput, 0, len(files))
+	for _, file := range files {
+		if !h.postProcess(w, r, file) {
+			return
+		}
+	}
+	for i, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		name := filepath.Base(file)
+		key := "outputs/" + reqID + "/" + name
+		if err := storage.PutFile(store, key, file, mime.TypeByExtension(filepath.Ext(name))); err != nil {
+			log.Printf("[%s] Uploading %s failed: %v", reqID, name, err)
+			http.Error(w, "Storing results failed", http.StatusBadGateway)
+			return
+		}
+		downloadURL, err := store.SignURL(http.MethodGet, key, cfg.URLTTL)
+		if err != nil {
+			log.Printf("[%s] Signing %s failed: %v", reqID, name, err)
+			http.Error(w, "Storing results failed", http.StatusBadGateway)
+			return
+		}
+		out := storedOutput{
+			Name: name,
+			Size: info.Size(),
+			URL:  downloadURL,
+		}
+		if i < len(vars) {
+			out.FirstPage, out.LastPage = vars[i].Page, vars[i].Last
+		}
+		outputs = append(outputs, out)
+	}
+	log.Printf("[%s] Stored %d result files in %s", reqID, len(outputs), cfg.Bucket)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"files":      outputs,
+		"expires_at": time.Now().Add(cfg.URLTTL).UTC(),
+	})
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// downloadFile fetches url into path, refusing bodies over maxBytes. Like
+// source_url fetches it only reaches public addresses, redirects included
+// (see publicClient).
+func (h *ConversionHandler) downloadFile(url, path string, header http.Header, maxBytes int64) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := h.publicClient(2 * time.Minute).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed: %s", resp.Status)
+	}
+	if resp.ContentLength > maxBytes {
+		return fmt.Errorf("file too large (%d bytes)", resp.ContentLength)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := io.Copy(f, io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return err
+	}
+	if n > maxBytes {
+		return fmt.Errorf("file too large (over %d bytes)", maxBytes)
+	}
+	return nil
+}
+
+// sourceError is a failed source_url fetch and the status to answer with.
+type sourceError struct {
+	status  int
+	message string
+}
+
+func (e *sourceError) Error() string {
+	return e.message
+}
+
+// openSource opens the request's input: the uploaded "file" or, instead,
+// the document at source_url, downloaded within the upload limit name
+// sets. Downloads need the fetch-url operation and only reach public
+// addresses (see publicDialer). On failure it has already written the
+// error response.
+func (h *ConversionHandler) openSource(w http.ResponseWriter, r *http.Request, limit string) (io.ReadCloser, string, bool) {
+	file, header, err := r.FormFile("file")
+	sourceURL := strings.TrimSpace(r.FormValue("source_url"))
+	switch {
+	case err == nil && sourceURL != "":
+		file.Close()
+		http.Error(w, "Send either file or source_url", http.StatusBadRequest)
+		return nil, "", false
+	case err == nil:
+		return file, header.Filename, true
+	case sourceURL == "":
+		http.Error(w, "Missing file", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	if !h.OperationAllowed("fetch-url") {
+		policyDenied(w, "fetch-url")
+		return nil, "", false
+	}
+	f, name, err := h.fetchSource(sourceURL, "source_url", h.maxUpload(r, limit))
+	if err != nil {
+		log.Printf("[%s] Fetching source_url failed: %v", requestID(r), err)
+		status, message := http.StatusBadGateway, "Fetching source_url failed"
+		if e, ok := err.(*sourceError); ok {
+			status, message = e.status, e.message
+		}
+		http.Error(w, message, status)
+		return nil, "", false
+	}
+	return f, name, true
+}
+
+// fetchSource downloads rawURL to a temporary file, removed when closed,
+// and names it after the URL's path or the response's Content-Disposition.
+// Errors name the URL after field, the parameter it came in.
+func (h *ConversionHandler) fetchSource(rawURL, field string, maxBytes int64) (io.ReadCloser, string, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, "", &sourceError{http.StatusBadRequest, field + " must be an absolute http or https URL"}
+	}
+
+	resp, err := h.publicClient(h.Config.SourceURL.Timeout).Get(target.String())
+	if err != nil {
+		var blocked *blockedAddressError
+		if errors.As(err, &blocked) {
+			return nil, "", &sourceError{http.StatusBadRequest, field + " " + blocked.Error()}
+		}
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", &sourceError{http.StatusBadGateway, "Fetching " + field + " failed: " + resp.Status}
+	}
+	tooLarge := &sourceError{http.StatusRequestEntityTooLarge, fmt.Sprintf("%s is larger than the %d byte limit", field, maxBytes)}
+	if resp.ContentLength > maxBytes {
+		return nil, "", tooLarge
+	}
+
+	f, err := os.CreateTemp("tmp", "source-*")
+	if err != nil {
+		return nil, "", err
+	}
+	n, err := io.Copy(f, io.LimitReader(resp.Body, maxBytes+1))
+	if err == nil && n > maxBytes {
+		err = tooLarge
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, "", err
+	}
+
+	name := path.Base(resp.Request.URL.Path)
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		name = filepath.Base(params["filename"])
+	}
+	if name == "." || name == "/" || name == "" {
+		name = "download"
+	}
+	return &tempFile{f}, name, nil
+}
+
+// publicClient is an HTTP client for URLs that callers hand in: it connects
+// only to public addresses and SOURCE_URL_PRIVATE_HOSTS (see publicDialer)
+// and follows at most 5 redirects, all to http or https URLs.
+func (h *ConversionHandler) publicClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// No proxy: the dialer must see the real destination
+			Proxy:               nil,
+			DialContext:         publicDialer(h.Config.SourceURL.PrivateHosts),
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return fmt.Errorf("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to a %s URL", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// tempFile is removed when closed.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// blockedAddressError refuses a connection to a non-public address.
+type blockedAddressError struct {
+	host string
+	ip   net.IP
+}
+
+func (e *blockedAddressError) Error() string {
+	return fmt.Sprintf("host %s resolves to a non-public address (%s)", e.host, e.ip)
+}
+
+// publicDialer connects only to public addresses, resolving host names
+// itself and dialing the checked address so a second lookup can't swap it
+// (DNS rebinding). privateHosts (exact names) are exempt.
+func publicDialer(privateHosts []string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(privateHosts, strings.ToLower(host)) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		ips, err := publicAddresses(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.DialContext(ctx, network, net.JoinHostPort(ips[0].IP.String(), port))
+	}
+}
+
+// publicAddresses resolves host, refusing it with a *blockedAddressError
+// unless every address is public.
+func publicAddresses(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if !publicAddress(ip.IP) {
+			return nil, &blockedAddressError{host: host, ip: ip.IP}
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+	return ips, nil
+}
+
+// sharedAddressSpace is carrier-grade NAT space (RFC 6598), which
+// net.IP.IsPrivate doesn't cover.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicAddress reports whether ip is routable on the internet, as opposed
+// to loopback, private, link-local (cloud metadata services) and the like.
+func publicAddress(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
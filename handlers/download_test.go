@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/akila/document-converter/config"
+)
+
+func TestDownloadFileRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer srv.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(srv.URL, http.StatusFound))
+	defer redirect.Close()
+
+	h := &ConversionHandler{Config: &config.Config{}}
+	dest := filepath.Join(t.TempDir(), "input")
+	var blocked *blockedAddressError
+	if err := h.downloadFile(srv.URL, dest, nil, 1024); !errors.As(err, &blocked) {
+		t.Errorf("downloadFile(loopback) = %v, want a blocked address", err)
+	}
+
+	// An allowed host can't redirect to a refused one
+	h.Config.SourceURL.PrivateHosts = []string{"localhost"}
+	redirectURL := strings.Replace(redirect.URL, "127.0.0.1", "localhost", 1)
+	if err := h.downloadFile(redirectURL, dest, nil, 1024); !errors.As(err, &blocked) {
+		t.Errorf("downloadFile(redirect to loopback) = %v, want a blocked address", err)
+	}
+
+	// Hosts listed in SOURCE_URL_PRIVATE_HOSTS are reachable
+	h.Config.SourceURL.PrivateHosts = []string{"127.0.0.1"}
+	if err := h.downloadFile(srv.URL, dest, nil, 1024); err != nil {
+		t.Errorf("downloadFile with 127.0.0.1 allowed: %v", err)
+	}
+}
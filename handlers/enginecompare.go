@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/models"
+	"github.com/akila/document-converter/utils"
+)
+
+// engineRun is the outcome of one engine in an A/B comparison.
+type engineRun struct {
+	Engine     string  `json:"engine"`
+	Output     string  `json:"output,omitempty"`
+	Seconds    float64 `json:"seconds"`
+	Error      string  `json:"error,omitempty"`
+	Pages      int     `json:"pages,omitempty"`
+	OutputSize int64   `json:"output_size,omitempty"`
+}
+
+// HandleCompareEngines converts "file" from -> to (default pdf) with two
+// engines, engine_a and engine_b (names as in ENGINES, e.g. libreoffice and
+// mupdf), for evaluating engine upgrades on real documents. It answers with
+// a zip of both outputs, report.json (timings, page counts, errors) and,
+// when both produced PDFs, diff.pdf highlighting the pages that differ (at
+// dpi, default 100). This is an admin tool, served only to clients with an
+// admin scope (see requireAdmin).
+func (h *ConversionHandler) HandleCompareEngines(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "admin.engines.compare")
+	if !ok {
+		return
+	}
+
+	from, to := strings.ToLower(r.FormValue("from")), strings.ToLower(r.FormValue("to"))
+	if from == "" {
+		from = formatOf(inputPath)
+	}
+	if to == "" {
+		to = "pdf"
+	}
+	engines := []string{r.FormValue("engine_a"), r.FormValue("engine_b")}
+	for _, name := range engines {
+		if h.EngineManager.Pool(name) == nil {
+			os.RemoveAll(tempDir)
+			http.Error(w, fmt.Sprintf("engine_a and engine_b must name running engines (%s)", strings.Join(h.EngineManager.Engines(), ", ")), http.StatusBadRequest)
+			return
+		}
+	}
+	dpi, _ := strconv.Atoi(r.FormValue("dpi"))
+	if dpi < 0 || dpi > 300 {
+		os.RemoveAll(tempDir)
+		http.Error(w, "dpi must be between 1 and 300", http.StatusBadRequest)
+		return
+	}
+
+	runs := make([]engineRun, len(engines))
+	var files, pdfs []string
+	for i, name := range engines {
+		label := fmt.Sprintf("%c-%s", 'a'+i, name)
+		runDir := filepath.Join(tempDir, label)
+		os.MkdirAll(runDir, 0755)
+		runs[i].Engine = name
+
+		start := time.Now()
+		path, err := h.runJob(h.EngineManager.Pool(name), models.Job{
+			ID:         reqID,
+			RequestID:  reqID,
+			InputPath:  inputPath,
+			FromFormat: from,
+			ToFormat:   to,
+			TempDir:    runDir,
+		})
+		runs[i].Seconds = time.Since(start).Seconds()
+		if err == nil {
+			if info, statErr := os.Stat(path); statErr != nil {
+				err = fmt.Errorf("engine produced no output")
+			} else {
+				runs[i].OutputSize = info.Size()
+			}
+		}
+		if err != nil {
+			log.Printf("[%s] Engine %s failed: %v", reqID, name, err)
+			if errors.As(err, new(*queueFullError)) {
+				os.RemoveAll(tempDir)
+				h.queueFull(w, err)
+				return
+			}
+			runs[i].Error = err.Error()
+			continue
+		}
+
+		// Name outputs after their engine so the zip entries can't collide
+		named := filepath.Join(tempDir, label+filepath.Ext(path))
+		if err := os.Rename(path, named); err != nil {
+			os.RemoveAll(tempDir)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		runs[i].Output = filepath.Base(named)
+		files = append(files, named)
+		if formatOf(named) == "pdf" {
+			runs[i].Pages, _ = converters.PageCount(named)
+			pdfs = append(pdfs, named)
+		}
+	}
+	log.Printf("[%s] Engine comparison %s vs %s: %.1fs vs %.1fs", reqID, engines[0], engines[1], runs[0].Seconds, runs[1].Seconds)
+
+	report := map[string]interface{}{
+		"from":    from,
+		"to":      to,
+		"engines": runs,
+	}
+	if len(pdfs) == 2 {
+		diffPath := filepath.Join(tempDir, "diff.pdf")
+		changed, err := converters.CompareVisual(pdfs[0], pdfs[1], diffPath, dpi)
+		if err != nil {
+			log.Printf("[%s] Visual diff failed: %v", reqID, err)
+			report["diff_error"] = err.Error()
+		} else {
+			if changed == nil {
+				changed = []int{}
+			}
+			report["changed_pages"] = changed
+			files = append(files, diffPath)
+		}
+	}
+
+	reportPath := filepath.Join(tempDir, "report.json")
+	data, _ := json.MarshalIndent(report, "", "  ")
+	if err := os.WriteFile(reportPath, data, 0644); err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	files = append(files, reportPath)
+
+	zipPath := filepath.Join(tempDir, "engine-compare.zip")
+	if err := utils.ZipFiles(zipPath, files); err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "Zipping failed", http.StatusInternalServerError)
+		return
+	}
+	h.serveAndCleanup(w, r, zipPath, tempDir)
+}
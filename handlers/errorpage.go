@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Status}} {{.StatusText}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 40rem; margin: 4rem auto; padding: 0 1rem; color: #222; }
+h1 { font-size: 1.4rem; }
+pre { background: #f4f4f4; padding: .75rem; white-space: pre-wrap; }
+.id { color: #666; font-size: .9rem; }
+</style>
+</head>
+<body>
+<h1>{{.Status}} {{.StatusText}}</h1>
+<p>{{.Explanation}}</p>
+<pre>{{.Message}}</pre>
+<p class="id">Request ID: <code>{{.RequestID}}</code>. Quote it when reporting a problem.</p>
+</body>
+</html>
+`))
+
+var errorExplanations = map[int]string{
+	http.StatusBadRequest:            "The request was missing a file or had an invalid option. Check the form fields and try again.",
+	http.StatusUnauthorized:          "This endpoint needs an API key or token.",
+	http.StatusForbidden:             "Your credentials do not allow this operation, or it is disabled on this server.",
+	http.StatusNotFound:              "Nothing was found here. The job or file may have expired.",
+	http.StatusMethodNotAllowed:      "This endpoint expects a different HTTP method, usually a POST with a file upload.",
+	http.StatusRequestEntityTooLarge: "The upload is larger than this endpoint accepts.",
+	http.StatusUnprocessableEntity:   "The file was received but could not be processed as asked.",
+	http.StatusTooManyRequests:       "Too many requests. Wait a little and try again.",
+	http.StatusNotImplemented:        "This operation is not available on this server.",
+	http.StatusServiceUnavailable:    "The server is busy or under maintenance. Try again shortly.",
+}
+
+// wantsHTML tells browser navigations apart from API clients, which don't
+// ask for text/html.
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// htmlErrorWriter turns plain-text error responses (as written by
+// http.Error) into a small HTML page carrying the request ID.
+type htmlErrorWriter struct {
+	http.ResponseWriter
+	reqID  string
+	status int
+	body   bytes.Buffer
+}
+
+func (w *htmlErrorWriter) WriteHeader(status int) {
+	if status >= 400 && w.status == 0 && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		w.status = status
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *htmlErrorWriter) Write(b []byte) (int, error) {
+	if w.status != 0 {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *htmlErrorWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && w.status == 0 {
+		f.Flush()
+	}
+}
+
+func (w *htmlErrorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish renders the captured error, if any.
+func (w *htmlErrorWriter) finish() {
+	if w.status == 0 {
+		return
+	}
+	explanation := errorExplanations[w.status]
+	if explanation == "" {
+		explanation = "Something went wrong on the server while handling this request."
+	}
+	var page bytes.Buffer
+	errorPage.Execute(&page, map[string]interface{}{
+		"Status":      w.status,
+		"StatusText":  http.StatusText(w.status),
+		"Explanation": explanation,
+		"Message":     strings.TrimSpace(w.body.String()),
+		"RequestID":   w.reqID,
+	})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(page.Bytes())
+}
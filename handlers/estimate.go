@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/workers"
+)
+
+// stepCost models how long a step takes on one worker, and how much memory
+// it needs, from the pages and megabytes it processes. The figures are
+// rough ones for typical documents; estimates are for warning users up
+// front, not for billing.
+type stepCost struct {
+	Base     float64 // seconds
+	PerPage  float64
+	PerMB    float64
+	MemoryMB float64
+}
+
+// engineCosts are the costs of a convert step, by the engine running it.
+var engineCosts = map[string]stepCost{
+	"libreoffice": {Base: 4, PerPage: 0.25, PerMB: 0.5, MemoryMB: 400},
+	"pandoc":      {Base: 1.5, PerPage: 0.1, PerMB: 0.2, MemoryMB: 250},
+	"imagemagick": {Base: 0.5, PerPage: 0.3, PerMB: 0.2, MemoryMB: 200},
+	"ghostscript": {Base: 0.5, PerPage: 0.3, PerMB: 0.2, MemoryMB: 200},
+	"poppler":     {Base: 0.2, PerPage: 0.05, PerMB: 0.05, MemoryMB: 100},
+	"mupdf":       {Base: 0.2, PerPage: 0.05, PerMB: 0.05, MemoryMB: 100},
+	"gpu":         {Base: 0.5, PerPage: 0.08, MemoryMB: 300},
+}
+
+// renderCost replaces the engine's cost when a step renders pages to
+// images.
+var renderCost = stepCost{Base: 0.3, PerPage: 0.4, PerMB: 0.05, MemoryMB: 250}
+
+// stepCosts are the costs of the other pipeline steps.
+var stepCosts = map[string]stepCost{
+	"compress":     {Base: 0.5, PerPage: 0.15, PerMB: 0.3, MemoryMB: 200},
+	"extract-text": {Base: 0.2, PerPage: 0.03, PerMB: 0.02, MemoryMB: 80},
+	"rotate":       {Base: 0.1, PerPage: 0.002, PerMB: 0.02, MemoryMB: 50},
+	"flatten":      {Base: 0.1, PerPage: 0.005, PerMB: 0.03, MemoryMB: 50},
+	"pdfa":         {Base: 1, PerPage: 0.2, PerMB: 0.3, MemoryMB: 250},
+}
+
+// bytesPerPage guesses the page count of inputs that aren't PDFs.
+var bytesPerPage = map[string]float64{
+	"docx": 25 << 10, "doc": 25 << 10, "odt": 25 << 10, "rtf": 10 << 10,
+	"xlsx": 15 << 10, "xls": 15 << 10, "ods": 15 << 10, "csv": 5 << 10,
+	"pptx": 100 << 10, "ppt": 100 << 10, "odp": 100 << 10,
+	"html": 5 << 10, "md": 3 << 10, "markdown": 3 << 10, "txt": 3 << 10,
+	"tex": 3 << 10, "latex": 3 << 10, "epub": 30 << 10,
+	"eml": 20 << 10, "msg": 40 << 10,
+}
+
+// estimateLongRunning is when an estimate is flagged as long, in seconds.
+const estimateLongRunning = 30
+
+type stepEstimate struct {
+	Step     string  `json:"step"`
+	Engine   string  `json:"engine,omitempty"`
+	Seconds  float64 `json:"seconds"`
+	Queued   int     `json:"queued,omitempty"`
+	Wait     float64 `json:"wait_seconds,omitempty"`
+	MemoryMB float64 `json:"memory_mb"`
+}
+
+// HandleEstimate estimates, without running it, how long a pipeline (a spec
+// as ingestion and /admin/reprocess run, e.g. "convert:pdf,compress"; a
+// single operation is a one-step pipeline) would take on the uploaded file,
+// and its cost: worker seconds and peak memory. The file's format, size and
+// pages drive the estimate; pages of non-PDF inputs are guessed from their
+// size. Waiting for busy engines is included in seconds, and long is set
+// when that exceeds 30 seconds. validate_only=true only checks the
+// pipeline, see validatePipeline.
+func (h *ConversionHandler) HandleEstimate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.parseUpload(w, r, "estimate") {
+		return
+	}
+	if r.FormValue("validate_only") == "true" {
+		h.validatePipeline(w, r)
+		return
+	}
+	_, tempDir, inputPath, ok := h.saveSource(w, r, "estimate")
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	steps, err := parsePipeline(r.FormValue("pipeline"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if op, ok := h.pipelineAllowed(steps); !ok {
+		http.Error(w, fmt.Sprintf("operation %q is disabled in this deployment", op), http.StatusForbidden)
+		return
+	}
+
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	format := converters.DetectFormat(inputPath)
+	sizeMB := float64(info.Size()) / (1 << 20)
+	pages, estimated := 1, false
+	if format == "pdf" {
+		if pages, err = converters.PageCount(inputPath); err != nil {
+			http.Error(w, "file is not a readable PDF", http.StatusBadRequest)
+			return
+		}
+	} else if perPage, ok := bytesPerPage[format]; ok {
+		pages, estimated = max(1, int(math.Ceil(float64(info.Size())/perPage))), true
+	}
+
+	var estimates []stepEstimate
+	var total, workerSeconds, peakMemory float64
+	current := format
+	for _, step := range steps {
+		cost, engine, pool, next, err := h.stepCostOf(step, current)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		seconds := cost.Base + cost.PerPage*float64(pages) + cost.PerMB*sizeMB
+		e := stepEstimate{Step: step.String(), Engine: engine, Seconds: round1(seconds), MemoryMB: cost.MemoryMB}
+		if pool != nil && pool.Workers() > 0 {
+			e.Queued = pool.Queued()
+			// Queued jobs are assumed to be like this one
+			e.Wait = round1(math.Ceil(float64(e.Queued)/float64(pool.Workers())) * seconds)
+		}
+		estimates = append(estimates, e)
+		total += seconds + e.Wait
+		workerSeconds += seconds
+		peakMemory = max(peakMemory, cost.MemoryMB)
+		current = next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"input": map[string]interface{}{
+			"format":          format,
+			"size":            info.Size(),
+			"pages":           pages,
+			"pages_estimated": estimated,
+		},
+		"steps":          estimates,
+		"seconds":        round1(total),
+		"worker_seconds": round1(workerSeconds),
+		"peak_memory_mb": peakMemory,
+		"long":           total > estimateLongRunning,
+	})
+}
+
+// stepValidation is the validate_only report on one pipeline step.
+type stepValidation struct {
+	Step   string   `json:"step"`
+	Input  string   `json:"input_format,omitempty"`
+	Output string   `json:"output_format,omitempty"`
+	Engine string   `json:"engine,omitempty"`
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// validatePipeline answers /estimate?validate_only=true: whether the input
+// is present and each step of the pipeline is known, enabled and routable
+// from the format the step before produces, without stopping at the first
+// problem, so UIs can show every one before submitting. The input is the
+// file, the document at source_url, or instead a file uploaded through
+// /uploads/presign (or tus) named by upload_id, as for /convert; a missing
+// or oversized upload is reported rather than refused. The upload limit
+// and options were checked on the way in.
+func (h *ConversionHandler) validatePipeline(w http.ResponseWriter, r *http.Request) {
+	var tempDir, inputPath string
+	input := map[string]interface{}{}
+	valid := true
+	if uploadID := r.FormValue("upload_id"); uploadID != "" {
+		reqID := requestID(r)
+		input["upload_id"] = uploadID
+		tempDir = filepath.Join("tmp", reqID)
+		inputPath = filepath.Join(tempDir, uploadID)
+		err := os.MkdirAll(tempDir, 0755)
+		if err == nil && !uploadIDPattern.MatchString(uploadID) {
+			err = fmt.Errorf("invalid upload_id")
+		} else if err == nil {
+			err = h.fetchUpload(uploadID, inputPath)
+		}
+		if err != nil {
+			log.Printf("[%s] Fetching upload %s failed: %v", reqID, uploadID, err)
+			input["error"] = "upload not found or not usable"
+			inputPath, valid = "", false
+		}
+	} else {
+		var ok bool
+		if _, tempDir, inputPath, ok = h.saveSource(w, r, "estimate"); !ok {
+			return
+		}
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Steps are still checked without an input, from its unknown format
+	format := ""
+	if inputPath != "" {
+		format = converters.DetectFormat(inputPath)
+		input["format"] = format
+	}
+	if format == "pdf" {
+		if _, err := converters.PageCount(inputPath); err != nil {
+			input["error"] = "file is not a readable PDF"
+			valid = false
+		}
+	}
+
+	raws := pipelineSpecSteps(r.FormValue("pipeline"))
+	if len(raws) == 0 {
+		valid = false
+	}
+	report := []stepValidation{}
+	current := format
+	for _, raw := range raws {
+		v := stepValidation{Step: raw, Input: current}
+		step, err := parsePipelineStep(raw)
+		if err != nil {
+			v.Errors = append(v.Errors, err.Error())
+			current = ""
+		} else {
+			v.Step = step.String()
+			if !h.OperationAllowed(step.Op) {
+				v.Errors = append(v.Errors, fmt.Sprintf("operation %q is disabled in this deployment", step.Op))
+			}
+			v.Output = step.Arg
+			switch step.Op {
+			case "convert":
+			case "extract-text":
+				v.Output = "txt"
+			default:
+				v.Output = "pdf"
+			}
+			// Routing is only known from a known input
+			if current != "" {
+				_, engine, _, _, err := h.stepCostOf(step, current)
+				if err != nil {
+					v.Errors = append(v.Errors, err.Error())
+				}
+				v.Engine = engine
+			}
+			current = v.Output
+		}
+		v.Valid = len(v.Errors) == 0
+		valid = valid && v.Valid
+		report = append(report, v)
+	}
+
+	out := map[string]interface{}{
+		"valid": valid,
+		"input": input,
+		"steps": report,
+	}
+	if len(raws) == 0 {
+		out["error"] = "empty pipeline"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// stepCostOf finds the cost of a step on an input of format from, the pool
+// it runs on, if it is queued, and the format it produces.
+func (h *ConversionHandler) stepCostOf(step pipelineStep, from string) (stepCost, string, *workers.WorkerPool, string, error) {
+	if step.Op != "convert" {
+		if from != "pdf" {
+			return stepCost{}, "", nil, "", fmt.Errorf("step %s needs a PDF, not %s", step, from)
+		}
+		next := "pdf"
+		var pool *workers.WorkerPool
+		switch step.Op {
+		case "extract-text":
+			next = "txt"
+			pool = h.operationPool("extract-text", h.EngineManager.PopplerPool)
+		case "compress":
+			pool = h.EngineManager.GhostscriptPool
+		}
+		return stepCosts[step.Op], h.engineName(pool), pool, next, nil
+	}
+
+	pool := h.selectPool(from, step.Arg)
+	if pool == nil {
+		return stepCost{}, "", nil, "", fmt.Errorf("unsupported conversion %s -> %s", from, step.Arg)
+	}
+	engine := h.engineName(pool)
+	cost, ok := engineCosts[engine]
+	if !ok {
+		cost = engineCosts["libreoffice"]
+	}
+	if from == "pdf" && (step.Arg == "jpg" || step.Arg == "jpeg" || step.Arg == "png" || strings.HasPrefix(step.Arg, "tif")) {
+		cost = renderCost
+	}
+	return cost, engine, pool, step.Arg, nil
+}
+
+// engineName names the engine running pool, or "" for none.
+func (h *ConversionHandler) engineName(pool *workers.WorkerPool) string {
+	for _, name := range h.EngineManager.Engines() {
+		if pool != nil && h.EngineManager.Pool(name) == pool {
+			return name
+		}
+	}
+	return ""
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
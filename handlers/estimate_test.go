@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/akila/document-converter/config"
+	"github.com/akila/document-converter/storage"
+	"github.com/akila/document-converter/workers"
+)
+
+func TestValidateOnlyChecksUploads(t *testing.T) {
+	cfg := &config.Config{
+		DataDir: t.TempDir(),
+		Uploads: config.Uploads{Provider: "local", Bucket: "uploads", MaxBytes: 1 << 20},
+	}
+	store, err := storage.Open(cfg, "local", "uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const uploaded = "0f8fad5b-d9cb-469f-a165-70867728950e.txt"
+	if err := store.Put(uploadKey(uploaded), strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	h := &ConversionHandler{Config: cfg, EngineManager: &workers.EngineManager{}}
+	mux := http.NewServeMux()
+	h.Register(mux)
+
+	tests := []struct {
+		name       string
+		uploadID   string
+		inputError bool
+		format     string
+	}{
+		{"present", uploaded, false, "txt"},
+		{"missing", "7c9e6679-7425-40de-944b-e07fc1f90ae7.txt", true, ""},
+		{"malformed", "../../secrets", true, ""},
+	}
+	for _, tt := range tests {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("validate_only", "true")
+		form.WriteField("pipeline", "extract-text")
+		form.WriteField("upload_id", tt.uploadID)
+		form.Close()
+		r := httptest.NewRequest(http.MethodPost, "/estimate", &body)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status %d, want 200; body %s", tt.name, w.Code, w.Body)
+			continue
+		}
+		var report struct {
+			Valid bool                   `json:"valid"`
+			Input map[string]interface{} `json:"input"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		_, inputError := report.Input["error"]
+		format, _ := report.Input["format"].(string)
+		if inputError != tt.inputError || format != tt.format {
+			t.Errorf("%s: input = %v, want format %q and error %v", tt.name, report.Input, tt.format, tt.inputError)
+		}
+		if tt.inputError && report.Valid {
+			t.Errorf("%s: valid report without an input", tt.name)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/akila/document-converter/converters"
+)
+
+// HandleExcerpt cuts a shareable preview out of a PDF in one call: the
+// pages in "pages" (e.g. "1-3,10"), watermarked with "watermark" (default
+// "Preview", empty for none), optionally flattened to images at "dpi"
+// (36-300) so the text can't be lifted, and encrypted with "password".
+// "owner_password" lifts the copy and edit restrictions; without one a
+// random owner password is used and they are permanent.
+func (h *ConversionHandler) HandleExcerpt(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "excerpt")
+	if !ok {
+		return
+	}
+
+	password := r.FormValue("password")
+	if password == "" || strings.ContainsAny(password+r.FormValue("owner_password"), "\r\n") {
+		os.RemoveAll(tempDir)
+		http.Error(w, "password is required and cannot contain line breaks", http.StatusBadRequest)
+		return
+	}
+	ownerPassword := r.FormValue("owner_password")
+	if ownerPassword == "" {
+		buf := make([]byte, 16)
+		rand.Read(buf)
+		ownerPassword = hex.EncodeToString(buf)
+	}
+	watermark := "Preview"
+	if _, set := r.MultipartForm.Value["watermark"]; set {
+		watermark = r.FormValue("watermark")
+	}
+	dpi := 0
+	if v := r.FormValue("dpi"); v != "" {
+		var err error
+		if dpi, err = strconv.Atoi(v); err != nil || dpi < 36 || dpi > 300 {
+			os.RemoveAll(tempDir)
+			http.Error(w, "dpi must be between 36 and 300", http.StatusBadRequest)
+			return
+		}
+	}
+
+	pageCount, err := converters.PageCount(inputPath)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "File is not a valid PDF", http.StatusBadRequest)
+		return
+	}
+	spec := r.FormValue("pages")
+	if spec == "" {
+		os.RemoveAll(tempDir)
+		http.Error(w, "pages is required, e.g. 1-3", http.StatusBadRequest)
+		return
+	}
+	pages, err := converters.ParsePageRanges(spec, pageCount)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "Invalid pages: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	current := filepath.Join(tempDir, "excerpt.pdf")
+	if err := converters.ExtractPages(inputPath, current, pages); err != nil {
+		log.Printf("[%s] Excerpt page extraction failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Excerpt failed", http.StatusInternalServerError)
+		return
+	}
+	if watermark != "" {
+		next := filepath.Join(tempDir, "watermarked.pdf")
+		if err := converters.WatermarkPDF(current, next, watermark); err != nil {
+			log.Printf("[%s] Excerpt watermark failed: %v", reqID, err)
+			os.RemoveAll(tempDir)
+			http.Error(w, "Excerpt failed", http.StatusInternalServerError)
+			return
+		}
+		current = next
+	}
+	// Rasterize after watermarking so the watermark is part of the image
+	if dpi > 0 {
+		next := filepath.Join(tempDir, "rasterized.pdf")
+		if err := converters.RasterizePDF(current, next, dpi); err != nil {
+			log.Printf("[%s] Excerpt rasterize failed: %v", reqID, err)
+			os.RemoveAll(tempDir)
+			http.Error(w, "Excerpt failed", http.StatusInternalServerError)
+			return
+		}
+		current = next
+	}
+	outputPath := filepath.Join(tempDir, "preview.pdf")
+	if err := converters.EncryptPDF(current, outputPath, password, ownerPassword); err != nil {
+		log.Printf("[%s] Excerpt encryption failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Excerpt failed", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[%s] Excerpt of %d of %d pages", reqID, len(pages), pageCount)
+
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
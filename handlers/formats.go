@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// formatCandidates are the formats /formats tries as sources and targets.
+var formatCandidates = []string{
+	"pdf", "docx", "doc", "odt", "rtf", "txt", "html", "md", "markdown", "epub", "tex", "latex",
+	"xlsx", "xls", "ods", "csv", "pptx", "ppt", "odp", "eml", "msg",
+	"jpg", "jpeg", "png", "gif", "bmp", "tif", "tiff", "webp", "heic", "heif", "svg",
+}
+
+type conversionView struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Engine string `json:"engine"`
+}
+
+// HandleFormats lists the conversions /convert supports in this deployment,
+// with the engine running each, and the JSON Schema of each endpoint's
+// options, which may be sent as form fields or as one "options" object.
+func (h *ConversionHandler) HandleFormats(w http.ResponseWriter, r *http.Request) {
+	conversions := []conversionView{}
+	for _, from := range formatCandidates {
+		for _, to := range formatCandidates {
+			if from == to {
+				continue
+			}
+			if pool := h.selectPool(from, to); pool != nil {
+				conversions = append(conversions, conversionView{From: from, To: to, Engine: h.engineName(pool)})
+			}
+		}
+	}
+	sort.Slice(conversions, func(i, j int) bool {
+		if conversions[i].From != conversions[j].From {
+			return conversions[i].From < conversions[j].From
+		}
+		return conversions[i].To < conversions[j].To
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"conversions": conversions,
+		"options":     optionSchemas,
+	})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/akila/document-converter/converters"
+)
+
+func (h *ConversionHandler) HandleFlatten(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "flatten")
+	if !ok {
+		return
+	}
+
+	outputPath := filepath.Join(tempDir, "flattened.pdf")
+	if err := converters.FlattenPDF(inputPath, outputPath); err != nil {
+		log.Printf("[%s] Flatten failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Flatten failed", http.StatusInternalServerError)
+		return
+	}
+
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
+
+func (h *ConversionHandler) HandleFormsFill(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "forms.fill")
+	if !ok {
+		return
+	}
+
+	// Field values come as a "fields" form value or a "fields" JSON file part
+	raw := []byte(r.FormValue("fields"))
+	if len(raw) == 0 {
+		if f, _, err := r.FormFile("fields"); err == nil {
+			raw, _ = io.ReadAll(f)
+			f.Close()
+		}
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(raw, &values); err != nil || len(values) == 0 {
+		os.RemoveAll(tempDir)
+		http.Error(w, "fields must be a non-empty JSON object of field name to value", http.StatusBadRequest)
+		return
+	}
+	flatten := r.FormValue("flatten") == "true"
+
+	outputPath := filepath.Join(tempDir, "filled.pdf")
+	if err := converters.FillForm(inputPath, outputPath, values, flatten); err != nil {
+		log.Printf("[%s] Form fill failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Form fill failed", http.StatusInternalServerError)
+		return
+	}
+
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
+
+func (h *ConversionHandler) HandleFormsExtract(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "forms.extract")
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	fields, err := converters.ExtractFormFields(inputPath)
+	if err != nil {
+		log.Printf("[%s] Form field extraction failed: %v", reqID, err)
+		http.Error(w, "Form field extraction failed", http.StatusInternalServerError)
+		return
+	}
+	if fields == nil {
+		fields = []converters.FormField{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"fields": fields})
+}
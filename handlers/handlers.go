@@ -1,27 +1,78 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/akila/document-converter/auth"
+	"github.com/akila/document-converter/config"
 	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/events"
+	"github.com/akila/document-converter/hooks"
+	"github.com/akila/document-converter/jobs"
+	"github.com/akila/document-converter/limits"
 	"github.com/akila/document-converter/models"
+	"github.com/akila/document-converter/numbering"
+	"github.com/akila/document-converter/quota"
+	"github.com/akila/document-converter/rules"
+	"github.com/akila/document-converter/templates"
 	"github.com/akila/document-converter/utils"
 	"github.com/akila/document-converter/workers"
-	"github.com/google/uuid"
 )
 
 type ConversionHandler struct {
 	EngineManager *workers.EngineManager
+	Config        *config.Config
+	Jobs          *jobs.Manager
+	// Rules, when set, may reject inputs or redirect their conversion.
+	Rules *rules.Engine
+	// Auth, when set, requires an API key or signature on API routes.
+	Auth *auth.Authenticator
+	// Quotas, when set, limits request rates per caller.
+	Quotas *quota.Limiter
+	// Limits, when set, overrides upload size limits (see uploadLimits).
+	Limits *limits.Config
+	// Hooks, when set, post-process every artifact before it goes out.
+	Hooks  *hooks.Config
+	Events *events.Bus
+	// Numbering issues per-tenant document numbers.
+	Numbering *numbering.Registry
+	// Templates is the catalog /generate renders documents from.
+	Templates *templates.Catalog
+
+	maintenance maintenanceState
+	reprocess   reprocessRuns
+	// linkSecret signs download links (see serveLink)
+	linkSecret []byte
+	tus        tusUploads
 }
 
-func NewConversionHandler(mgr *workers.EngineManager) *ConversionHandler {
-	return &ConversionHandler{EngineManager: mgr}
+func NewConversionHandler(mgr *workers.EngineManager, cfg *config.Config, jobsMgr *jobs.Manager) *ConversionHandler {
+	h := &ConversionHandler{
+		EngineManager: mgr,
+		Config:        cfg,
+		Jobs:          jobsMgr,
+		Numbering:     numbering.Open(filepath.Join(cfg.DataDir, "numbering.json")),
+	}
+	if cfg.Maintenance {
+		h.maintenance.set(true, defaultMaintenanceMessage, defaultMaintenanceRetry)
+	}
+	h.linkSecret = []byte(cfg.Links.Secret)
+	if len(h.linkSecret) == 0 {
+		h.linkSecret = make([]byte, 32)
+		rand.Read(h.linkSecret)
+		log.Printf("DOWNLOAD_LINK_SECRET is not set; download links will stop working on restart")
+	}
+	return h
 }
 
 func (h *ConversionHandler) HandleConvert(w http.ResponseWriter, r *http.Request) {
@@ -30,31 +81,47 @@ func (h *ConversionHandler) HandleConvert(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Max 20MB
-	r.Body = http.MaxBytesReader(w, r.Body, 20*1024*1024)
-	err := r.ParseMultipartForm(20 * 1024 * 1024)
-	if err != nil {
-		http.Error(w, "File too large or invalid form", http.StatusBadRequest)
+	if !h.parseUpload(w, r, "convert") {
 		return
 	}
 
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, "Missing file", http.StatusBadRequest)
+	// The file is either in the form or was uploaded to object storage via
+	// /uploads/presign and is referenced by upload_id
+	uploadID := r.FormValue("upload_id")
+	var file io.ReadCloser
+	var filename string
+	var err error
+	if uploadID == "" {
+		var ok bool
+		if file, filename, ok = h.openSource(w, r, "convert"); !ok {
+			return
+		}
+		defer file.Close()
+	} else if !uploadIDPattern.MatchString(uploadID) {
+		http.Error(w, "Invalid upload_id", http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
 
 	from := r.FormValue("from")
 	to := r.FormValue("to")
 
-	if from == "" || to == "" {
-		http.Error(w, "Missing from/to parameters", http.StatusBadRequest)
+	if to == "" {
+		http.Error(w, "Missing to parameter", http.StatusBadRequest)
 		return
 	}
 
+	options, err := imageOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Emails: attachments as further pages
+	if r.FormValue("append_attachments") == "true" {
+		options["append_attachments"] = true
+	}
+
 	// Create temp directory for this request
-	reqID := uuid.New().String()
+	reqID := requestID(r)
 	log.Printf("[%s] Starting conversion request: %s -> %s", reqID, from, to)
 	tempDir := filepath.Join("tmp", reqID)
 	err = os.MkdirAll(tempDir, 0755)
@@ -64,27 +131,69 @@ func (h *ConversionHandler) HandleConvert(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	inputPath := filepath.Join(tempDir, header.Filename)
-	out, err := os.Create(inputPath)
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	var inputPath string
+	if uploadID != "" {
+		inputPath = filepath.Join(tempDir, uploadID)
+		if err := h.fetchUpload(uploadID, inputPath); err != nil {
+			log.Printf("[%s] Fetching upload %s failed: %v", reqID, uploadID, err)
+			os.RemoveAll(tempDir)
+			http.Error(w, "Upload not found or not usable", http.StatusBadRequest)
+			return
+		}
+	} else {
+		inputPath = filepath.Join(tempDir, filename)
+		out, err := os.Create(inputPath)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		defer out.Close()
+
+		_, err = io.Copy(out, file)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, file)
-	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	// Without from, the format is read from the file itself
+	if from == "" {
+		if from, err = converters.InferFormat(inputPath); err != nil {
+			os.RemoveAll(tempDir)
+			http.Error(w, "Can't infer the source format: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[%s] Inferred source format %s", reqID, from)
+		w.Header().Set("X-Source-Format", from)
+	}
+
+	// Renders of several pages come back as a zip; page=N asks for one image
+	spec := r.FormValue("pages")
+	if page := r.FormValue("page"); page != "" {
+		if spec != "" || strings.ContainsAny(page, ",-") {
+			os.RemoveAll(tempDir)
+			http.Error(w, "page takes a single page number and can't be combined with pages", http.StatusBadRequest)
+			return
+		}
+		spec = page
+	}
+	if spec != "" {
+		if err := pageRangeOptions(inputPath, from, spec, options); err != nil {
+			os.RemoveAll(tempDir)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
 	// Define job
 	resultChan := make(chan models.JobResult, 1)
 	job := models.Job{
 		ID:         reqID,
+		RequestID:  reqID,
 		InputPath:  inputPath,
 		FromFormat: from,
 		ToFormat:   to,
+		Options:    options,
 		ResultChan: resultChan,
 		TempDir:    tempDir,
 	}
@@ -96,9 +205,23 @@ func (h *ConversionHandler) HandleConvert(w http.ResponseWriter, r *http.Request
 		http.Error(w, "Unsupported conversion", http.StatusBadRequest)
 		return
 	}
+	pool, err = h.routeJob(&job, pool)
+	if err != nil {
+		job.Cleanup()
+		if _, ok := err.(*rejectedError); ok {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		log.Printf("[%s] Routing failed: %v", reqID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
+	if !h.enqueue(w, pool, job) {
+		job.Cleanup()
+		return
+	}
 	log.Printf("[%s] Job queued for %s -> %s", reqID, from, to)
-	pool.JobQueue <- job
 
 	// Wait for result
 	result := <-resultChan
@@ -111,6 +234,20 @@ func (h *ConversionHandler) HandleConvert(w http.ResponseWriter, r *http.Request
 
 	log.Printf("[%s] Conversion successful, streaming file: %s", reqID, result.Path)
 
+	if strings.ToLower(to) == "pdf" && officeFormats[strings.ToLower(from)] {
+		h.setQualityHeaders(w, reqID, inputPath, result.Path)
+	}
+
+	if !h.postProcess(w, r, result.Path) {
+		job.Cleanup()
+		return
+	}
+	if r.FormValue("delivery") == "link" {
+		h.serveLink(w, r, result.Path, tempDir)
+		job.Cleanup()
+		return
+	}
+
 	// Stream response
 	downloadFile, err := os.Open(result.Path)
 	if err != nil {
@@ -120,7 +257,7 @@ func (h *ConversionHandler) HandleConvert(w http.ResponseWriter, r *http.Request
 	}
 	defer downloadFile.Close()
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filepath.Base(result.Path)))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", h.resultFilename(filepath.Base(result.Path), reqID)))
 	w.Header().Set("Content-Type", "application/octet-stream")
 	io.Copy(w, downloadFile)
 
@@ -128,69 +265,137 @@ func (h *ConversionHandler) HandleConvert(w http.ResponseWriter, r *http.Request
 	job.Cleanup()
 }
 
+// imageFormats are the inputs the ImageMagick engine turns into PDFs.
+var imageFormats = map[string]bool{
+	"jpg": true, "jpeg": true, "png": true, "gif": true, "bmp": true,
+	"tif": true, "tiff": true, "webp": true, "heic": true, "heif": true,
+	"svg": true,
+}
+
+// officeFormats are the sources LibreOffice lays out itself, whose PDFs
+// get a quality score.
+var officeFormats = map[string]bool{
+	"docx": true, "doc": true, "odt": true, "rtf": true,
+	"xlsx": true, "xls": true, "ods": true,
+	"ppt": true, "pptx": true, "odp": true,
+}
+
+// setQualityHeaders scores an office -> PDF conversion (see
+// converters.ScoreConversion) and reports it in X-Quality-Score and
+// X-Quality-Warnings, so pipelines can send suspicious results for review.
+// Scoring is best effort; a failure only leaves the headers out.
+func (h *ConversionHandler) setQualityHeaders(w http.ResponseWriter, reqID, sourcePath, pdfPath string) {
+	report, err := converters.ScoreConversion(sourcePath, pdfPath)
+	if err != nil {
+		log.Printf("[%s] Quality scoring failed: %v", reqID, err)
+		return
+	}
+	log.Printf("[%s] Quality score %d (%d warnings)", reqID, report.Score, len(report.Warnings))
+	w.Header().Set("X-Quality-Score", strconv.Itoa(report.Score))
+	if len(report.Warnings) > 0 {
+		w.Header().Set("X-Quality-Warnings", strings.Join(report.Warnings, "; "))
+	}
+}
+
 func (h *ConversionHandler) selectPool(from, to string) *workers.WorkerPool {
 	from = strings.ToLower(from)
 	to = strings.ToLower(to)
 
 	// Image conversions
-	if (from == "jpg" || from == "png" || from == "jpeg") && to == "pdf" {
+	if imageFormats[from] && to == "pdf" {
 		return h.EngineManager.ImageMagickPool
 	}
+	if from == "pdf" && (to == "tif" || to == "tiff") {
+		return h.EngineManager.GhostscriptPool
+	}
 	if from == "pdf" && (to == "jpg" || to == "png" || to == "jpeg") {
-		return h.EngineManager.PopplerPool
+		if h.Config.RenderBackend == "gpu" && h.EngineManager.GPUPool != nil {
+			return h.operationPool("render", h.EngineManager.GPUPool)
+		}
+		return h.operationPool("render", h.EngineManager.PopplerPool)
 	}
 
 	// Document conversions
-	if (from == "docx" || from == "ppt" || from == "xlsx" || from == "csv" || from == "html") && to == "pdf" {
+	if (officeFormats[from] || from == "csv" || from == "html") && to == "pdf" {
 		return h.EngineManager.LibreOfficePool
 	}
 	if from == "pdf" && (to == "docx" || to == "xlsx" || to == "ppt") {
 		return h.EngineManager.LibreOfficePool
 	}
+	if converters.OfficeConvertible(from, to) {
+		return h.EngineManager.LibreOfficePool
+	}
+	// Emails render in Go and Chromium, falling back to LibreOffice, which
+	// also converts their attachments
+	if (from == "eml" || from == "msg") && to == "pdf" {
+		return h.EngineManager.LibreOfficePool
+	}
 
 	// Text/Markdown/HTML/EPUB
 	if (from == "md" || from == "markdown" || from == "epub") && to == "pdf" {
 		return h.EngineManager.PandocPool
 	}
-	if (from == "txt" || from == "html" || from == "docx" || from == "ppt" || from == "xlsx" || from == "csv") && to == "pdf" {
+	// LaTeX builds with the TeX Live installed alongside Pandoc
+	if (from == "tex" || from == "latex") && to == "pdf" {
+		return h.EngineManager.PandocPool
+	}
+	if from == "txt" && to == "pdf" {
 		return h.EngineManager.LibreOfficePool
 	}
 
+	// E-books
+	if (from == "pdf" || from == "docx" || from == "md" || from == "markdown" || from == "html") && to == "epub" {
+		return h.EngineManager.PandocPool
+	}
+
 	// PDF specific
 	if from == "pdf" && to == "txt" {
+		return h.operationPool("extract-text", h.EngineManager.PopplerPool)
+	}
+	if from == "pdf" && (to == "md" || to == "markdown") {
 		return h.EngineManager.PopplerPool
 	}
 
 	return nil
 }
 
+// operationPool returns the pool of the engine configured for operation
+// (see config.OperationEngines) if it is running, or def.
+func (h *ConversionHandler) operationPool(operation string, def *workers.WorkerPool) *workers.WorkerPool {
+	if name := h.Config.OperationEngines[operation]; name != "" {
+		if pool := h.EngineManager.Pool(name); pool != nil {
+			return pool
+		}
+	}
+	return def
+}
+
 func (h *ConversionHandler) HandleMerge(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	err := r.ParseMultipartForm(50 * 1024 * 1024) // 50MB for merge
-	if err != nil {
-		http.Error(w, "Invalid form", http.StatusBadRequest)
+	if !h.parseUpload(w, r, "merge") {
 		return
 	}
 
 	files := r.MultipartForm.File["files"]
-	if len(files) < 2 {
+	manifest := r.FormValue("manifest")
+	if len(files) < 2 && (manifest == "" || len(files) == 0) {
 		http.Error(w, "At least 2 files required for merge", http.StatusBadRequest)
 		return
 	}
 
-	reqID := uuid.New().String()
+	reqID := requestID(r)
 	tempDir := filepath.Join("tmp", reqID)
 	os.MkdirAll(tempDir, 0755)
 
-	var inputPaths []string
+	var inputPaths, titles []string
 	isImageMerge := false
 	for i, fileHeader := range files {
 		ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
-		if ext == ".jpg" || ext == ".jpeg" || ext == ".png" {
+		if format := strings.TrimPrefix(ext, "."); imageFormats[format] && format != "svg" {
 			isImageMerge = true
 		}
 		src, _ := fileHeader.Open()
@@ -200,10 +405,31 @@ func (h *ConversionHandler) HandleMerge(w http.ResponseWriter, r *http.Request)
 		src.Close()
 		dst.Close()
 		inputPaths = append(inputPaths, path)
+		titles = append(titles, tocTitle(fileHeader.Filename))
 	}
 
 	outputPath := filepath.Join(tempDir, "merged.pdf")
-	if isImageMerge {
+	var counts []int
+	var err error
+	if manifest != "" {
+		// Selected pages per file, assembled in manifest order
+		if isImageMerge {
+			os.RemoveAll(tempDir)
+			http.Error(w, "A manifest can only select pages of PDFs", http.StatusBadRequest)
+			return
+		}
+		var sources []converters.PageSource
+		sources, titles, err = parseMergeManifest(manifest, files, inputPaths)
+		if err != nil {
+			os.RemoveAll(tempDir)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, src := range sources {
+			counts = append(counts, len(src.Pages))
+		}
+		err = converters.AssemblePages(sources, outputPath)
+	} else if isImageMerge {
 		err = h.EngineManager.ImageToPDFSync(inputPaths, outputPath)
 	} else {
 		err = h.EngineManager.MergePDFsSync(inputPaths, outputPath)
@@ -215,15 +441,89 @@ func (h *ConversionHandler) HandleMerge(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	h.serveAndCleanup(w, outputPath, tempDir)
+	// Optionally prepend a contents page listing where each source starts
+	if r.FormValue("toc") == "true" {
+		var err error
+		if counts == nil {
+			counts, err = sourcePageCounts(inputPaths, isImageMerge)
+		}
+		if err == nil {
+			var tocPath string
+			tocPath, err = h.buildTOC(reqID, tempDir, r.FormValue("toc_title"), titles, counts)
+			if err == nil {
+				withTOC := filepath.Join(tempDir, "merged-toc.pdf")
+				err = h.EngineManager.MergePDFsSync([]string{tocPath, outputPath}, withTOC)
+				outputPath = withTOC
+			}
+		}
+		if err != nil {
+			log.Printf("[%s] TOC generation failed: %v", reqID, err)
+			os.RemoveAll(tempDir)
+			if h.queueFull(w, err) {
+				return
+			}
+			http.Error(w, "TOC generation failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.serveAndCleanup(w, r, outputPath, tempDir)
 }
 
 func (h *ConversionHandler) HandleCompress(w http.ResponseWriter, r *http.Request) {
 	h.handleGenericPDFOperation(w, r, "compress")
 }
 
+// HandleExtractText extracts a PDF's text. With ?format=json it answers with
+// the text by page, line and word instead, each with its box (see
+// converters.TextLayout), for pipelines that tie text to positions;
+// format=hocr and format=alto give the same as hOCR or ALTO XML, for
+// digitization tools.
 func (h *ConversionHandler) HandleExtractText(w http.ResponseWriter, r *http.Request) {
-	h.handleGenericPDFOperation(w, r, "extract-text")
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "text":
+		h.handleGenericPDFOperation(w, r, "extract-text")
+	case "json", "hocr", "alto":
+		h.extractTextLayout(w, r, format)
+	default:
+		http.Error(w, "format must be text, json, hocr or alto", http.StatusBadRequest)
+	}
+}
+
+func (h *ConversionHandler) extractTextLayout(w http.ResponseWriter, r *http.Request, format string) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "extract-text")
+	if !ok {
+		return
+	}
+
+	pages, err := converters.TextLayout(inputPath)
+	if err != nil {
+		log.Printf("[%s] Text layout extraction failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Operation failed", http.StatusInternalServerError)
+		return
+	}
+	if format == "json" {
+		defer os.RemoveAll(tempDir)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"pages": pages})
+		return
+	}
+
+	outputPath := filepath.Join(tempDir, "text.hocr")
+	write, contentType := converters.WriteHOCR, "text/vnd.hocr+html; charset=utf-8"
+	if format == "alto" {
+		outputPath = filepath.Join(tempDir, "text.alto.xml")
+		write, contentType = converters.WriteALTO, "application/alto+xml"
+	}
+	if err := write(outputPath, pages); err != nil {
+		log.Printf("[%s] Writing %s failed: %v", reqID, format, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Operation failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	h.serveAndCleanup(w, r, outputPath, tempDir)
 }
 
 func (h *ConversionHandler) HandleSplit(w http.ResponseWriter, r *http.Request) {
@@ -232,39 +532,161 @@ func (h *ConversionHandler) HandleSplit(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, 25*1024*1024)
-	if err := r.ParseMultipartForm(25 * 1024 * 1024); err != nil {
-		http.Error(w, "Invalid form", http.StatusBadRequest)
+	if !h.parseUpload(w, r, "split") {
 		return
 	}
 
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, "Missing file", http.StatusBadRequest)
+	file, filename, ok := h.openSource(w, r, "split")
+	if !ok {
 		return
 	}
 	defer file.Close()
 
-	reqID := uuid.New().String()
+	reqID := requestID(r)
 	tempDir := filepath.Join("tmp", reqID)
 	os.MkdirAll(tempDir, 0755)
 
-	inputPath := filepath.Join(tempDir, header.Filename)
+	inputPath := filepath.Join(tempDir, filename)
 	dst, _ := os.Create(inputPath)
 	io.Copy(dst, file)
 	dst.Close()
 
-	// Split PDF
-	outputPattern := filepath.Join(tempDir, "page-%d.pdf")
-	err = converters.SplitPDF(inputPath, outputPattern)
+	naming, err := formNameTemplate(r, "basename", "index", "page", "last", "name")
 	if err != nil {
 		os.RemoveAll(tempDir)
-		http.Error(w, "Split failed", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	basename := uploadBasename(filename)
+
+	// delivery=storage hands each part out as a presigned URL rather than
+	// one zip, for documents too large to download in one piece; link keeps
+	// the zip behind a download link (see serveLink)
+	delivery := r.FormValue("delivery")
+	if delivery != "" && delivery != "zip" && delivery != "storage" && delivery != "link" {
+		os.RemoveAll(tempDir)
+		http.Error(w, "delivery must be zip, storage or link", http.StatusBadRequest)
+		return
+	}
+	if delivery == "storage" {
+		if _, err := h.outputStore(); err != nil {
+			os.RemoveAll(tempDir)
+			http.Error(w, "Storage delivery is not configured", http.StatusNotFound)
+			return
+		}
+	}
+
+	var files []string
+	var vars []nameVars
+	ranges, mode := r.FormValue("ranges"), r.FormValue("mode")
+	if mode == "size" {
+		// Chunks of consecutive pages under max_mb each
+		maxMB, err := strconv.ParseFloat(r.FormValue("max_mb"), 64)
+		if err != nil || maxMB <= 0 {
+			os.RemoveAll(tempDir)
+			http.Error(w, "max_mb must be a positive number", http.StatusBadRequest)
+			return
+		}
+		pageCount, err := converters.PageCount(inputPath)
+		if err != nil {
+			os.RemoveAll(tempDir)
+			http.Error(w, "Invalid PDF", http.StatusBadRequest)
+			return
+		}
+		chunks, oversized, err := converters.SplitBySize(inputPath, tempDir, pageCount, int64(maxMB*1024*1024))
+		if err != nil {
+			log.Printf("[%s] Split by size failed: %v", reqID, err)
+			os.RemoveAll(tempDir)
+			http.Error(w, "Split failed", http.StatusInternalServerError)
+			return
+		}
+		for i, chunk := range chunks {
+			files = append(files, chunk.Path)
+			first, last := chunk.Pages[0], chunk.Pages[len(chunk.Pages)-1]
+			vars = append(vars, nameVars{Basename: basename, Name: fmt.Sprintf("pages-%d-%d", first, last), Index: i + 1, Page: first, Last: last})
+		}
+		if len(oversized) > 0 {
+			pages := make([]string, len(oversized))
+			for i, p := range oversized {
+				pages[i] = strconv.Itoa(p)
+			}
+			// These pages alone exceed the cap
+			w.Header().Set("X-Oversized-Pages", strings.Join(pages, ","))
+		}
+	} else if ranges != "" || mode == "bookmarks" {
+		pageCount, err := converters.PageCount(inputPath)
+		if err != nil {
+			os.RemoveAll(tempDir)
+			http.Error(w, "Invalid PDF", http.StatusBadRequest)
+			return
+		}
+		var parts []splitPart
+		if mode == "bookmarks" {
+			// One PDF per outline entry down to level (default top level)
+			level := 1
+			if v := r.FormValue("level"); v != "" {
+				if level, err = strconv.Atoi(v); err != nil || level < 1 {
+					os.RemoveAll(tempDir)
+					http.Error(w, "level must be a positive number", http.StatusBadRequest)
+					return
+				}
+			}
+			bms, err := converters.ExtractBookmarks(inputPath)
+			if err != nil {
+				log.Printf("[%s] Reading bookmarks failed: %v", reqID, err)
+				os.RemoveAll(tempDir)
+				http.Error(w, "Split failed", http.StatusInternalServerError)
+				return
+			}
+			if len(bms) == 0 {
+				os.RemoveAll(tempDir)
+				http.Error(w, "The PDF has no bookmarks", http.StatusUnprocessableEntity)
+				return
+			}
+			parts = bookmarkSplitParts(bms, level, pageCount)
+		} else {
+			// One PDF per range, e.g. "1-3,4-10,11-last"
+			if parts, err = parseSplitRanges(ranges, pageCount); err != nil {
+				os.RemoveAll(tempDir)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if files, err = writeSplitParts(inputPath, tempDir, parts); err != nil {
+			log.Printf("[%s] Split into parts failed: %v", reqID, err)
+			os.RemoveAll(tempDir)
+			http.Error(w, "Split failed", http.StatusInternalServerError)
+			return
+		}
+		for i, part := range parts {
+			vars = append(vars, nameVars{Basename: basename, Name: part.Name, Index: i + 1, Page: part.Pages[0], Last: part.Pages[len(part.Pages)-1]})
+		}
+	} else {
+		// Split PDF
+		outputPattern := filepath.Join(tempDir, "page-%d.pdf")
+		err = converters.SplitPDF(inputPath, outputPattern)
+		if err != nil {
+			os.RemoveAll(tempDir)
+			http.Error(w, "Split failed", http.StatusInternalServerError)
+			return
+		}
+		files, _ = filepath.Glob(filepath.Join(tempDir, "page-*.pdf"))
+		sort.Slice(files, func(i, j int) bool { return pageFromName(files[i], "page-") < pageFromName(files[j], "page-") })
+		for i, f := range files {
+			page := pageFromName(f, "page-")
+			vars = append(vars, nameVars{Basename: basename, Name: fmt.Sprintf("page-%d", page), Index: i + 1, Page: page, Last: page})
+		}
+	}
+
+	if files, ok = applyNameTemplate(w, naming, files, vars, tempDir); !ok {
+		return
+	}
+	if delivery == "storage" {
+		h.serveFromStorage(w, r, reqID, tempDir, files, vars)
 		return
 	}
 
 	// Zip the pages
-	files, _ := filepath.Glob(filepath.Join(tempDir, "page-*.pdf"))
 	zipPath := filepath.Join(tempDir, "pages.zip")
 	if err := utils.ZipFiles(zipPath, files); err != nil {
 		os.RemoveAll(tempDir)
@@ -272,7 +694,7 @@ func (h *ConversionHandler) HandleSplit(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	h.serveAndCleanup(w, zipPath, tempDir)
+	h.serveAndCleanup(w, r, zipPath, tempDir)
 }
 
 func (h *ConversionHandler) HandleExtractImages(w http.ResponseWriter, r *http.Request) {
@@ -281,28 +703,32 @@ func (h *ConversionHandler) HandleExtractImages(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, 25*1024*1024)
-	if err := r.ParseMultipartForm(25 * 1024 * 1024); err != nil {
-		http.Error(w, "Invalid form", http.StatusBadRequest)
+	if !h.parseUpload(w, r, "extract-images") {
 		return
 	}
 
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, "Missing file", http.StatusBadRequest)
+	file, filename, ok := h.openSource(w, r, "extract-images")
+	if !ok {
 		return
 	}
 	defer file.Close()
 
-	reqID := uuid.New().String()
+	reqID := requestID(r)
 	tempDir := filepath.Join("tmp", reqID)
 	os.MkdirAll(tempDir, 0755)
 
-	inputPath := filepath.Join(tempDir, header.Filename)
+	inputPath := filepath.Join(tempDir, filename)
 	dst, _ := os.Create(inputPath)
 	io.Copy(dst, file)
 	dst.Close()
 
+	naming, err := formNameTemplate(r, "basename", "index", "ext")
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Extract images
 	outputPrefix := filepath.Join(tempDir, "img")
 	err = converters.ExtractImages(inputPath, outputPrefix)
@@ -328,6 +754,14 @@ func (h *ConversionHandler) HandleExtractImages(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	vars := make([]nameVars, len(images))
+	for i := range images {
+		vars[i] = nameVars{Basename: uploadBasename(filename), Index: i + 1}
+	}
+	if images, ok = applyNameTemplate(w, naming, images, vars, tempDir); !ok {
+		return
+	}
+
 	zipPath := filepath.Join(tempDir, "images.zip")
 	if err := utils.ZipFiles(zipPath, images); err != nil {
 		os.RemoveAll(tempDir)
@@ -335,7 +769,7 @@ func (h *ConversionHandler) HandleExtractImages(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	h.serveAndCleanup(w, zipPath, tempDir)
+	h.serveAndCleanup(w, r, zipPath, tempDir)
 }
 
 func (h *ConversionHandler) HandleRotate(w http.ResponseWriter, r *http.Request) {
@@ -344,15 +778,12 @@ func (h *ConversionHandler) HandleRotate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, 20*1024*1024)
-	if err := r.ParseMultipartForm(20 * 1024 * 1024); err != nil {
-		http.Error(w, "Invalid form", http.StatusBadRequest)
+	if !h.parseUpload(w, r, "rotate") {
 		return
 	}
 
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, "Missing file", http.StatusBadRequest)
+	file, filename, ok := h.openSource(w, r, "rotate")
+	if !ok {
 		return
 	}
 	defer file.Close()
@@ -364,24 +795,36 @@ func (h *ConversionHandler) HandleRotate(w http.ResponseWriter, r *http.Request)
 		angle = 90 // Default
 	}
 
-	reqID := uuid.New().String()
+	reqID := requestID(r)
 	tempDir := filepath.Join("tmp", reqID)
 	os.MkdirAll(tempDir, 0755)
 
-	inputPath := filepath.Join(tempDir, header.Filename)
+	inputPath := filepath.Join(tempDir, filename)
 	dst, _ := os.Create(inputPath)
 	io.Copy(dst, file)
 	dst.Close()
 
+	// Optionally only some pages, or several ranges with their own angles
+	var err error
+	rotations := []converters.PageRotation{{Angle: angle}}
+	if r.FormValue("pages") != "" || r.FormValue("rotations") != "" {
+		rotations, err = pageRotations(inputPath, angle, r.FormValue("pages"), r.FormValue("rotations"))
+		if err != nil {
+			os.RemoveAll(tempDir)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	outputPath := filepath.Join(tempDir, "rotated.pdf")
-	err = converters.RotatePDF(inputPath, outputPath, angle)
+	err = converters.RotatePDF(inputPath, outputPath, rotations...)
 	if err != nil {
 		os.RemoveAll(tempDir)
 		http.Error(w, "Rotation failed", http.StatusInternalServerError)
 		return
 	}
 
-	h.serveAndCleanup(w, outputPath, tempDir)
+	h.serveAndCleanup(w, r, outputPath, tempDir)
 }
 
 func (h *ConversionHandler) HandleReorder(w http.ResponseWriter, r *http.Request) {
@@ -390,15 +833,12 @@ func (h *ConversionHandler) HandleReorder(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, 20*1024*1024)
-	if err := r.ParseMultipartForm(20 * 1024 * 1024); err != nil {
-		http.Error(w, "Invalid form", http.StatusBadRequest)
+	if !h.parseUpload(w, r, "reorder") {
 		return
 	}
 
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, "Missing file", http.StatusBadRequest)
+	file, filename, ok := h.openSource(w, r, "reorder")
+	if !ok {
 		return
 	}
 	defer file.Close()
@@ -409,24 +849,24 @@ func (h *ConversionHandler) HandleReorder(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	reqID := uuid.New().String()
+	reqID := requestID(r)
 	tempDir := filepath.Join("tmp", reqID)
 	os.MkdirAll(tempDir, 0755)
 
-	inputPath := filepath.Join(tempDir, header.Filename)
+	inputPath := filepath.Join(tempDir, filename)
 	dst, _ := os.Create(inputPath)
 	io.Copy(dst, file)
 	dst.Close()
 
 	outputPath := filepath.Join(tempDir, "reordered.pdf")
-	err = converters.ReorderPDF(inputPath, outputPath, order)
+	err := converters.ReorderPDF(inputPath, outputPath, order)
 	if err != nil {
 		os.RemoveAll(tempDir)
 		http.Error(w, "Reordering failed", http.StatusInternalServerError)
 		return
 	}
 
-	h.serveAndCleanup(w, outputPath, tempDir)
+	h.serveAndCleanup(w, r, outputPath, tempDir)
 }
 
 func (h *ConversionHandler) handleGenericPDFOperation(w http.ResponseWriter, r *http.Request, op string) {
@@ -435,25 +875,31 @@ func (h *ConversionHandler) handleGenericPDFOperation(w http.ResponseWriter, r *
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, 25*1024*1024)
-	err := r.ParseMultipartForm(25 * 1024 * 1024)
-	if err != nil {
-		http.Error(w, "Invalid form", http.StatusBadRequest)
+	if !h.parseUpload(w, r, op) {
 		return
 	}
 
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, "Missing file", http.StatusBadRequest)
+	var options map[string]interface{}
+	var err error
+	if op == "compress" {
+		// level=screen|ebook|printer|prepress and/or quality=1-100
+		if options, err = compressOptions(r.FormValue("level"), r.FormValue("quality")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	file, filename, ok := h.openSource(w, r, op)
+	if !ok {
 		return
 	}
 	defer file.Close()
 
-	reqID := uuid.New().String()
+	reqID := requestID(r)
 	tempDir := filepath.Join("tmp", reqID)
 	os.MkdirAll(tempDir, 0755)
 
-	inputPath := filepath.Join(tempDir, header.Filename)
+	inputPath := filepath.Join(tempDir, filename)
 	dst, _ := os.Create(inputPath)
 	io.Copy(dst, file)
 	dst.Close()
@@ -461,8 +907,10 @@ func (h *ConversionHandler) handleGenericPDFOperation(w http.ResponseWriter, r *
 	resultChan := make(chan models.JobResult, 1)
 	job := models.Job{
 		ID:         reqID,
+		RequestID:  reqID,
 		InputPath:  inputPath,
 		ToFormat:   "pdf", // Default
+		Options:    options,
 		ResultChan: resultChan,
 		TempDir:    tempDir,
 	}
@@ -472,9 +920,18 @@ func (h *ConversionHandler) handleGenericPDFOperation(w http.ResponseWriter, r *
 		pool = h.EngineManager.GhostscriptPool
 	} else if op == "extract-text" {
 		job.ToFormat = "txt"
+		pool = h.operationPool("extract-text", pool)
+	}
+	if pool == nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "Operation not available in this deployment", http.StatusNotImplemented)
+		return
 	}
 
-	pool.JobQueue <- job
+	if !h.enqueue(w, pool, job) {
+		os.RemoveAll(tempDir)
+		return
+	}
 	result := <-resultChan
 
 	if !result.Success {
@@ -483,10 +940,117 @@ func (h *ConversionHandler) handleGenericPDFOperation(w http.ResponseWriter, r *
 		return
 	}
 
-	h.serveAndCleanup(w, result.Path, tempDir)
+	h.serveAndCleanup(w, r, result.Path, tempDir)
+}
+
+// imageOptions reads the PDF -> image options of a conversion as job
+// options: dpi (36-600, or "auto" to pick per page), quality (JPEG, 1-100),
+// scale_to (pixels on the longer side, overriding dpi) and tiff_mode (color
+// or fax, for PDF -> TIFF).
+func imageOptions(r *http.Request) (map[string]interface{}, error) {
+	options := map[string]interface{}{}
+	number := func(field string, lo, hi int) (int, error) {
+		v := r.FormValue(field)
+		if v == "" && field == "scale_to" {
+			v = r.FormValue("scale-to")
+		}
+		if v == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < lo || n > hi {
+			return 0, fmt.Errorf("%s must be a number from %d to %d", field, lo, hi)
+		}
+		return n, nil
+	}
+
+	if r.FormValue("dpi") == "auto" {
+		options["dpi"] = "auto"
+	} else if dpi, err := number("dpi", 36, 600); err != nil {
+		return nil, fmt.Errorf("%v, or auto", err)
+	} else if dpi > 0 {
+		options["dpi"] = dpi
+	}
+	if quality, err := number("quality", 1, 100); err != nil {
+		return nil, err
+	} else if quality > 0 {
+		options["quality"] = quality
+	}
+	if scaleTo, err := number("scale_to", 16, 10000); err != nil {
+		return nil, err
+	} else if scaleTo > 0 {
+		options["scale_to"] = scaleTo
+	}
+	if mode := r.FormValue("tiff_mode"); mode != "" {
+		if _, ok := converters.TIFFModes[mode]; !ok {
+			return nil, fmt.Errorf("tiff_mode must be color or fax")
+		}
+		options["tiff_mode"] = mode
+	}
+	return options, nil
 }
 
-func (h *ConversionHandler) serveAndCleanup(w http.ResponseWriter, path, tempDir string) {
+// pageRangeOptions limits a PDF render to the pages in spec, such as "3-7",
+// "4" or "2-last". Renderers take a single run of pages, in order.
+func pageRangeOptions(inputPath, from, spec string, options map[string]interface{}) error {
+	if from != "pdf" {
+		return fmt.Errorf("pages is only supported when converting from pdf")
+	}
+	pageCount, err := converters.PageCount(inputPath)
+	if err != nil {
+		return fmt.Errorf("file is not a valid PDF")
+	}
+	pages, err := converters.ParsePageRanges(spec, pageCount)
+	if err != nil {
+		return fmt.Errorf("invalid pages: %v", err)
+	}
+	for i := 1; i < len(pages); i++ {
+		if pages[i] != pages[i-1]+1 {
+			return fmt.Errorf("pages must be a single ascending range such as 3-7")
+		}
+	}
+	options["first_page"] = pages[0]
+	options["last_page"] = pages[len(pages)-1]
+	return nil
+}
+
+// compressOptions turns a compression level and quality into Ghostscript
+// job options. A numeric level is taken as the quality.
+func compressOptions(level, quality string) (map[string]interface{}, error) {
+	options := map[string]interface{}{}
+	if _, err := strconv.Atoi(level); err == nil && quality == "" {
+		level, quality = "", level
+	}
+	if level != "" {
+		level = strings.ToLower(level)
+		known := false
+		for _, l := range converters.CompressionLevels {
+			known = known || l == level
+		}
+		if !known {
+			return nil, fmt.Errorf("level must be one of %s", strings.Join(converters.CompressionLevels, ", "))
+		}
+		options["preset"] = level
+	}
+	if quality != "" {
+		q, err := strconv.Atoi(quality)
+		if err != nil || q < 1 || q > 100 {
+			return nil, fmt.Errorf("quality must be a number from 1 to 100")
+		}
+		options["quality"] = q
+	}
+	return options, nil
+}
+
+func (h *ConversionHandler) serveAndCleanup(w http.ResponseWriter, r *http.Request, path, tempDir string) {
+	if !h.postProcess(w, r, path) {
+		os.RemoveAll(tempDir)
+		return
+	}
+	if r.FormValue("delivery") == "link" {
+		h.serveLink(w, r, path, tempDir)
+		return
+	}
 	f, err := os.Open(path)
 	if err != nil {
 		os.RemoveAll(tempDir)
@@ -495,7 +1059,57 @@ func (h *ConversionHandler) serveAndCleanup(w http.ResponseWriter, path, tempDir
 	}
 	defer f.Close()
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filepath.Base(path)))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", h.resultFilename(filepath.Base(path), w.Header().Get("X-Job-ID"))))
 	io.Copy(w, f)
 	os.RemoveAll(tempDir)
 }
+
+// receiveFile parses a single "file" upload into a fresh per-request temp
+// directory. On failure it has already written the error response.
+func (h *ConversionHandler) receiveFile(w http.ResponseWriter, r *http.Request, limit string) (reqID, tempDir, inputPath string, ok bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return "", "", "", false
+	}
+
+	if !h.parseUpload(w, r, limit) {
+		return "", "", "", false
+	}
+	return h.saveSource(w, r, limit)
+}
+
+// saveSource stores the parsed request's input (see openSource) in a fresh
+// per-request temp directory. On failure it has already written the error
+// response.
+func (h *ConversionHandler) saveSource(w http.ResponseWriter, r *http.Request, limit string) (reqID, tempDir, inputPath string, ok bool) {
+	file, filename, ok := h.openSource(w, r, limit)
+	if !ok {
+		return "", "", "", false
+	}
+	defer file.Close()
+
+	reqID = requestID(r)
+	tempDir = filepath.Join("tmp", reqID)
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		log.Printf("[%s] Failed to create temp dir: %v", reqID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return "", "", "", false
+	}
+
+	inputPath = filepath.Join(tempDir, filepath.Base(filename))
+	dst, err := os.Create(inputPath)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return "", "", "", false
+	}
+	_, err = io.Copy(dst, file)
+	dst.Close()
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return "", "", "", false
+	}
+
+	return reqID, tempDir, inputPath, true
+}
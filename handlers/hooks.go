@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+)
+
+type operationKey struct{}
+
+// withOperation records the route's operation on the request, for what
+// runs per operation deep inside handlers, such as post-processing hooks.
+func withOperation(operation string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), operationKey{}, operation)))
+	})
+}
+
+func operationOf(r *http.Request) string {
+	operation, _ := r.Context().Value(operationKey{}).(string)
+	return operation
+}
+
+// postProcess runs the post-processing hooks on an artifact of the
+// request's operation before it goes out. When a blocking hook fails it
+// answers 422 and returns false.
+func (h *ConversionHandler) postProcess(w http.ResponseWriter, r *http.Request, path string) bool {
+	if err := h.Hooks.Run(requestID(r), operationOf(r), path); err != nil {
+		w.Header().Set("X-Error-Code", "postprocess_blocked")
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/akila/document-converter/storage"
+	"github.com/google/uuid"
+)
+
+// objectRef identifies an object named in a storage event notification.
+type objectRef struct {
+	Provider string `json:"provider"` // "s3" or "gcs"
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+}
+
+// storageEvent covers the notification shapes we accept: S3 event records
+// (direct or wrapped in an SNS envelope), EventBridge S3 events, GCS Pub/Sub
+// push messages, and bare GCS object resources.
+type storageEvent struct {
+	// SNS envelope
+	Type         string `json:"Type"`
+	Message      string `json:"Message"`
+	SubscribeURL string `json:"SubscribeURL"`
+
+	// S3 event notification
+	Records []struct {
+		EventSource string `json:"eventSource"`
+		EventName   string `json:"eventName"`
+		S3          struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+
+	// EventBridge
+	Source     string `json:"source"`
+	DetailType string `json:"detail-type"`
+	Detail     struct {
+		Bucket struct {
+			Name string `json:"name"`
+		} `json:"bucket"`
+		Object struct {
+			Key string `json:"key"`
+		} `json:"object"`
+	} `json:"detail"`
+
+	// GCS Pub/Sub push
+	PubSub *struct {
+		Data       string            `json:"data"`
+		Attributes map[string]string `json:"attributes"`
+	} `json:"message"`
+
+	// GCS object resource
+	Kind   string `json:"kind"`
+	Bucket string `json:"bucket"`
+	Name   string `json:"name"`
+}
+
+func (h *ConversionHandler) HandleIngestWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg := h.Config.Ingest
+	if cfg.WebhookToken == "" {
+		http.Error(w, "Ingest webhook is not configured", http.StatusNotFound)
+		return
+	}
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = r.Header.Get("X-Ingest-Token")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.WebhookToken)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	steps, err := parsePipeline(cfg.Pipeline)
+	if err != nil {
+		log.Printf("Ingest pipeline misconfigured: %v", err)
+		http.Error(w, "Ingest pipeline misconfigured", http.StatusInternalServerError)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1024*1024))
+	if err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+
+	var event storageEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "Invalid event JSON", http.StatusBadRequest)
+		return
+	}
+
+	if event.Type == "SubscriptionConfirmation" {
+		if err := confirmSNSSubscription(event.SubscribeURL); err != nil {
+			log.Printf("SNS subscription confirmation failed: %v", err)
+			http.Error(w, "Subscription confirmation failed", http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	refs, err := event.objects()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var accepted []objectRef
+	for _, ref := range refs {
+		base := strings.TrimSuffix(path.Base(ref.Key), path.Ext(ref.Key))
+		if strings.HasSuffix(base, cfg.OutputSuffix) || strings.HasSuffix(ref.Key, "/") {
+			continue // our own output, or a folder placeholder
+		}
+		store, err := storage.Open(h.Config, ref.Provider, ref.Bucket)
+		if err != nil {
+			log.Printf("Ingest skipped %s://%s/%s: %v", ref.Provider, ref.Bucket, ref.Key, err)
+			continue
+		}
+		accepted = append(accepted, ref)
+		go h.ingestObject(store, ref, steps)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"accepted": accepted})
+}
+
+func (e *storageEvent) objects() ([]objectRef, error) {
+	if e.Type == "Notification" {
+		var inner storageEvent
+		if err := json.Unmarshal([]byte(e.Message), &inner); err != nil {
+			return nil, fmt.Errorf("invalid SNS message: %v", err)
+		}
+		return inner.objects()
+	}
+
+	var refs []objectRef
+	for _, rec := range e.Records {
+		if rec.EventSource != "aws:s3" || !strings.HasPrefix(rec.EventName, "ObjectCreated:") {
+			continue
+		}
+		// S3 event keys are form-encoded ("+" for spaces)
+		key, err := url.QueryUnescape(rec.S3.Object.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid object key %q", rec.S3.Object.Key)
+		}
+		refs = append(refs, objectRef{Provider: "s3", Bucket: rec.S3.Bucket.Name, Key: key})
+	}
+	if e.Records != nil {
+		return refs, nil
+	}
+
+	if e.Source == "aws.s3" {
+		if e.DetailType == "Object Created" {
+			refs = append(refs, objectRef{Provider: "s3", Bucket: e.Detail.Bucket.Name, Key: e.Detail.Object.Key})
+		}
+		return refs, nil
+	}
+
+	if e.PubSub != nil {
+		attrs := e.PubSub.Attributes
+		if t := attrs["eventType"]; t != "" && t != "OBJECT_FINALIZE" {
+			return nil, nil
+		}
+		if attrs["bucketId"] != "" && attrs["objectId"] != "" {
+			return []objectRef{{Provider: "gcs", Bucket: attrs["bucketId"], Key: attrs["objectId"]}}, nil
+		}
+		data, err := base64.StdEncoding.DecodeString(e.PubSub.Data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Pub/Sub message data")
+		}
+		var obj storageEvent
+		if err := json.Unmarshal(data, &obj); err != nil || obj.Bucket == "" || obj.Name == "" {
+			return nil, fmt.Errorf("Pub/Sub message does not describe a GCS object")
+		}
+		return []objectRef{{Provider: "gcs", Bucket: obj.Bucket, Key: obj.Name}}, nil
+	}
+
+	if e.Kind == "storage#object" && e.Bucket != "" && e.Name != "" {
+		return []objectRef{{Provider: "gcs", Bucket: e.Bucket, Key: e.Name}}, nil
+	}
+
+	return nil, fmt.Errorf("unrecognized storage event")
+}
+
+// confirmSNSSubscription follows the SubscribeURL of an SNS subscription
+// handshake. Only genuine SNS hosts are contacted.
+func confirmSNSSubscription(subscribeURL string) error {
+	u, err := url.Parse(subscribeURL)
+	if err != nil || u.Scheme != "https" || !strings.HasPrefix(u.Hostname(), "sns.") || !strings.HasSuffix(u.Hostname(), ".amazonaws.com") {
+		return fmt.Errorf("refusing SubscribeURL %q", subscribeURL)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("SNS returned %s", resp.Status)
+	}
+	return nil
+}
+
+// ingestObject downloads ref, runs the ingest pipeline and uploads the
+// result next to the source object.
+func (h *ConversionHandler) ingestObject(store storage.Backend, ref objectRef, steps []pipelineStep) {
+	reqID := uuid.New().String()
+	tempDir := filepath.Join("tmp", reqID)
+	defer os.RemoveAll(tempDir)
+	log.Printf("[%s] Ingesting %s://%s/%s", reqID, ref.Provider, ref.Bucket, ref.Key)
+
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		log.Printf("[%s] Failed to create temp dir: %v", reqID, err)
+		return
+	}
+	inputPath := filepath.Join(tempDir, path.Base(ref.Key))
+	if err := storage.GetFile(store, ref.Key, inputPath); err != nil {
+		log.Printf("[%s] Ingest download failed: %v", reqID, err)
+		return
+	}
+
+	outputPath, err := h.runPipelineQueued(reqID, tempDir, inputPath, steps)
+	if err != nil {
+		log.Printf("[%s] Ingest pipeline failed: %v", reqID, err)
+		return
+	}
+
+	if err := h.Hooks.Run(reqID, "ingest.webhook", outputPath); err != nil {
+		return
+	}
+
+	ext := filepath.Ext(outputPath)
+	outputKey := strings.TrimSuffix(ref.Key, path.Ext(ref.Key)) + h.Config.Ingest.OutputSuffix + ext
+	if err := storage.PutFile(store, outputKey, outputPath, mime.TypeByExtension(ext)); err != nil {
+		log.Printf("[%s] Ingest upload failed: %v", reqID, err)
+		return
+	}
+	log.Printf("[%s] Ingest finished: %s://%s/%s", reqID, ref.Provider, ref.Bucket, outputKey)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/akila/document-converter/converters"
+)
+
+// HandleInterleave collates two scans of a single-sided stack: file_a holds
+// the odd pages (fronts) and file_b the even pages (backs), or two "files"
+// in that order. reverse=true reads file_b backwards, for backs scanned
+// after flipping the stack over.
+func (h *ConversionHandler) HandleInterleave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.parseUpload(w, r, "interleave") {
+		return
+	}
+
+	files := r.MultipartForm.File["files"]
+	if a, b := r.MultipartForm.File["file_a"], r.MultipartForm.File["file_b"]; len(a) > 0 && len(b) > 0 {
+		files = []*multipart.FileHeader{a[0], b[0]}
+	}
+	if len(files) != 2 {
+		http.Error(w, "Exactly 2 files required for interleave (file_a and file_b)", http.StatusBadRequest)
+		return
+	}
+	reverse := r.FormValue("reverse") == "true"
+
+	reqID := requestID(r)
+	tempDir := filepath.Join("tmp", reqID)
+	os.MkdirAll(tempDir, 0755)
+
+	var paths []string
+	for i, fileHeader := range files {
+		path := filepath.Join(tempDir, fmt.Sprintf("input_%c.pdf", 'a'+i))
+		if err := saveFormFile(fileHeader, path); err != nil {
+			os.RemoveAll(tempDir)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		paths = append(paths, path)
+	}
+
+	outputPath := filepath.Join(tempDir, "interleaved.pdf")
+	if err := converters.InterleavePDF(paths[0], paths[1], outputPath, reverse); err != nil {
+		log.Printf("[%s] Interleave failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Interleave failed", http.StatusInternalServerError)
+		return
+	}
+
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akila/document-converter/auth"
+	"github.com/akila/document-converter/events"
+	"github.com/akila/document-converter/jobs"
+)
+
+// jobResponse is the public view of a job.
+type jobResponse struct {
+	jobs.Job
+	StatusURL string `json:"status_url"`
+	ResultURL string `json:"result_url,omitempty"`
+}
+
+func (h *ConversionHandler) jobView(r *http.Request, job jobs.Job) jobResponse {
+	view := jobResponse{Job: job, StatusURL: h.publicURL(r, "/jobs/"+job.ID)}
+	if job.Status == jobs.StatusSucceeded {
+		view.ResultURL = h.publicURL(r, "/jobs/"+job.ID+"/result")
+	}
+	return view
+}
+
+type basePathKey struct{}
+
+// WithBasePath records the version prefix (e.g. "/v1") the router stripped
+// from a request's path, so the URLs the API hands out keep it.
+func WithBasePath(ctx context.Context, prefix string) context.Context {
+	return context.WithValue(ctx, basePathKey{}, prefix)
+}
+
+// publicURL builds an absolute URL for links handed to third parties, using
+// PUBLIC_BASE_URL when set and the request's host otherwise. Requests made
+// under a version prefix get links under it.
+func (h *ConversionHandler) publicURL(r *http.Request, path string) string {
+	if r != nil {
+		prefix, _ := r.Context().Value(basePathKey{}).(string)
+		path = prefix + path
+	}
+	if base := h.Config.PublicBaseURL; base != "" {
+		return strings.TrimSuffix(base, "/") + path
+	}
+	scheme := "http"
+	if r != nil && (r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https") {
+		scheme = "https"
+	}
+	host := "localhost:8080"
+	if r != nil {
+		host = r.Host
+	}
+	return scheme + "://" + host + path
+}
+
+func (h *ConversionHandler) HandleJobStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.Jobs.Get(r.PathValue("id"))
+	if !ok || job.Tenant != auth.Tenant(r.Context()) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.jobView(r, job))
+}
+
+// HandleJobEvents streams a job's lifecycle events (job.queued,
+// job.running, job.succeeded and job.failed, as sent to event sinks) as
+// Server-Sent Events, so browsers can follow a job with an EventSource
+// instead of polling. The job's current status comes first; the stream
+// ends once the job has.
+func (h *ConversionHandler) HandleJobEvents(w http.ResponseWriter, r *http.Request) {
+	job, updates, stop, ok := h.Jobs.Watch(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	defer stop()
+	if job.Tenant != auth.Tenant(r.Context()) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keeps proxies such as nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	send := func(e events.Event) {
+		if e.Type == "job.succeeded" {
+			data := map[string]interface{}{"result_url": h.publicURL(r, "/jobs/"+job.ID+"/result")}
+			for k, v := range e.Data {
+				data[k] = v
+			}
+			e.Data = data
+		}
+		payload, _ := json.Marshal(e)
+		fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, payload)
+		flusher.Flush()
+	}
+	send(jobs.StatusEvent(job))
+	status := string(job.Status)
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for status != string(jobs.StatusSucceeded) && status != string(jobs.StatusFailed) {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case e := <-updates:
+			// The status the stream started with may be announced again
+			if s, _ := e.Data["status"].(string); s != status {
+				status = s
+				send(e)
+			}
+		}
+	}
+}
+
+func (h *ConversionHandler) HandleJobResult(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	job, ok := h.Jobs.Get(id)
+	if !ok || job.Tenant != auth.Tenant(r.Context()) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	switch job.Status {
+	case jobs.StatusFailed:
+		http.Error(w, fmt.Sprintf("Job failed: %s", job.Error), http.StatusUnprocessableEntity)
+		return
+	case jobs.StatusQueued, jobs.StatusRunning:
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Job is still processing, retry shortly", http.StatusAccepted)
+		return
+	}
+	h.serveJobResult(w, r, job)
+}
+
+// serveJobResult sends a succeeded job's result.
+func (h *ConversionHandler) serveJobResult(w http.ResponseWriter, r *http.Request, job jobs.Job) {
+	id := job.ID
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", h.resultFilename(job.ResultName, job.ID)))
+	if job.Compression == "" {
+		path, _ := h.Jobs.ResultPath(id)
+		f, err := os.Open(path)
+		if err != nil {
+			http.Error(w, "Result no longer available", http.StatusGone)
+			return
+		}
+		defer f.Close()
+		http.ServeContent(w, r, job.ResultName, job.CompletedAt, f)
+		return
+	}
+	h.serveCompressedResult(w, r, job)
+}
+
+// serveCompressedResult sends a result stored compressed at rest: as is with
+// Content-Encoding when the client accepts it, decompressed otherwise.
+// Range requests are not supported for these.
+func (h *ConversionHandler) serveCompressedResult(w http.ResponseWriter, r *http.Request, job jobs.Job) {
+	contentType := mime.TypeByExtension(filepath.Ext(job.ResultName))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Last-Modified", job.CompletedAt.UTC().Format(http.TimeFormat))
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	if acceptsEncoding(r, job.Compression) {
+		path, _ := h.Jobs.ResultPath(job.ID)
+		f, err := os.Open(path)
+		if err != nil {
+			http.Error(w, "Result no longer available", http.StatusGone)
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Encoding", job.Compression)
+		w.Header().Set("Content-Length", strconv.FormatInt(job.StoredSize, 10))
+		io.Copy(w, f)
+		return
+	}
+
+	rc, _, err := h.Jobs.OpenResult(job.ID)
+	if err != nil {
+		log.Printf("[%s] Opening result failed: %v", job.ID, err)
+		http.Error(w, "Result no longer available", http.StatusGone)
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Length", strconv.FormatInt(job.ResultSize, 10))
+	io.Copy(w, rc)
+}
+
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(name), encoding) && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akila/document-converter/auth"
+	"github.com/akila/document-converter/config"
+	"github.com/akila/document-converter/jobs"
+)
+
+// tenantTestClients are clients of two tenants.
+const tenantTestClients = `{"clients": [
+	{"id": "acme", "api_key": "acme-key", "tenant": "acme"},
+	{"id": "globex", "api_key": "globex-key", "tenant": "globex"}
+]}`
+
+func TestJobsAreTenantScoped(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "clients.json")
+	if err := os.WriteFile(file, []byte(tenantTestClients), 0644); err != nil {
+		t.Fatal(err)
+	}
+	authn, err := auth.Load(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobsMgr, err := jobs.NewManager(filepath.Join(dir, "jobs"), "test", time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := filepath.Join(dir, "report.pdf")
+	if err := os.WriteFile(result, []byte("%PDF-1.4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	job, err := jobsMgr.Keep("acme", "convert", result, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &ConversionHandler{Config: &config.Config{}, Auth: authn, Jobs: jobsMgr}
+	mux := http.NewServeMux()
+	h.Register(mux)
+
+	tests := []struct {
+		path   string
+		apiKey string
+		want   int
+	}{
+		{"/jobs/" + job.ID, "acme-key", http.StatusOK},
+		{"/jobs/" + job.ID, "globex-key", http.StatusNotFound},
+		{"/jobs/" + job.ID + "/result", "acme-key", http.StatusOK},
+		{"/jobs/" + job.ID + "/result", "globex-key", http.StatusNotFound},
+		{"/jobs/" + job.ID + "/events", "acme-key", http.StatusOK},
+		{"/jobs/" + job.ID + "/events", "globex-key", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		r.Header.Set("X-API-Key", tt.apiKey)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("GET %s as %s: status %d, want %d", tt.path, tt.apiKey, w.Code, tt.want)
+		}
+	}
+}
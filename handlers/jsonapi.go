@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// The JSON API mode is for clients that can't send multipart uploads (some
+// low-code platforms). A request with Content-Type: application/json to an
+// upload endpoint carries its files base64-encoded:
+//
+//	{"file": {"filename": "report.docx", "content": "<base64>"}, "to": "pdf"}
+//
+// A field whose value is such an object, or an array of them ("files"), is
+// a file part; the other fields are the endpoint's options (see
+// applyOptions). The result comes back the same way, see jsonResultWriter.
+
+// jsonFile is a base64-encoded file part of a JSON request.
+type jsonFile struct {
+	Filename string `json:"filename"`
+	Content  string `json:"content"`
+}
+
+// isJSONRequest tells JSON API requests apart from multipart uploads.
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// jsonFiles reads v as a file part or an array of file parts.
+func jsonFiles(v json.RawMessage) ([]jsonFile, bool) {
+	var files []jsonFile
+	if len(v) > 0 && v[0] == '[' {
+		var items []json.RawMessage
+		if json.Unmarshal(v, &items) != nil || len(items) == 0 {
+			return nil, false
+		}
+		for _, item := range items {
+			file, ok := jsonFileOf(item)
+			if !ok {
+				return nil, false
+			}
+			files = append(files, file)
+		}
+		return files, true
+	}
+	file, ok := jsonFileOf(v)
+	return append(files, file), ok
+}
+
+func jsonFileOf(v json.RawMessage) (jsonFile, bool) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(v, &fields) != nil || fields["content"] == nil {
+		return jsonFile{}, false
+	}
+	var file jsonFile
+	return file, json.Unmarshal(v, &file) == nil
+}
+
+// multipartFromJSON rewrites a JSON API request body as the multipart form
+// the handlers read: file parts decoded, options as the "options" object
+// (or plain fields for endpoints without a schema).
+func multipartFromJSON(r *http.Request) error {
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return err
+		}
+		return fmt.Errorf("body must be a JSON object")
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	options := map[string]json.RawMessage{}
+	for _, name := range names {
+		files, ok := jsonFiles(fields[name])
+		if !ok {
+			options[name] = fields[name]
+			continue
+		}
+		for i, file := range files {
+			data, err := base64.StdEncoding.DecodeString(file.Content)
+			if err != nil {
+				return fmt.Errorf("%s: content must be base64", name)
+			}
+			filename := file.Filename
+			if filename == "" {
+				filename = fmt.Sprintf("%s-%d", name, i+1)
+			}
+			part, err := mw.CreateFormFile(name, filename)
+			if err != nil {
+				return err
+			}
+			part.Write(data)
+		}
+	}
+	if len(options) > 0 {
+		if schemaFor(r.URL.Path) != nil {
+			data, _ := json.Marshal(options)
+			mw.WriteField("options", string(data))
+		} else {
+			for name, raw := range options {
+				var value string
+				if json.Unmarshal(raw, &value) != nil {
+					value = string(raw)
+				}
+				mw.WriteField(name, value)
+			}
+		}
+	}
+	mw.Close()
+
+	r.Body = io.NopCloser(&body)
+	r.ContentLength = int64(body.Len())
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return nil
+}
+
+// takesUploads tells whether route is an upload endpoint, one with an
+// upload limit.
+func takesUploads(route Route) bool {
+	_, path, _ := strings.Cut(route.Pattern, " ")
+	if path == "" {
+		path = route.Pattern
+	}
+	for _, limit := range uploadLimits {
+		if slices.Contains(limit.Paths, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// withJSONResults answers JSON API requests (see isJSONRequest) in JSON.
+func withJSONResults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isJSONRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		jw := &jsonResultWriter{ResponseWriter: w}
+		defer jw.finish()
+		next.ServeHTTP(jw, r)
+	})
+}
+
+// jsonResultWriter wraps a file response in JSON with its metadata:
+//
+//	{"filename": "report.pdf", "content_type": "application/pdf",
+//	 "headers": {"X-Page-Count": "3"}, "content": "<base64>", "size": 1234}
+//
+// Plain-text errors (as written by http.Error) become {"error": ...,
+// "code": ..., "request_id": ...}; JSON responses, such as job handles, pass through.
+type jsonResultWriter struct {
+	http.ResponseWriter
+	mode    int // 0 undecided, then one of the below
+	content io.WriteCloser
+	size    int64
+	status  int
+	body    bytes.Buffer
+}
+
+const (
+	jsonPassThrough = iota + 1
+	jsonWrapFile
+	jsonWrapError
+)
+
+func (w *jsonResultWriter) WriteHeader(status int) {
+	if w.mode != 0 {
+		return
+	}
+	header := w.Header()
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch {
+	case status >= 400 && mediaType == "text/plain":
+		w.mode, w.status = jsonWrapError, status
+		return
+	case status >= 300 || mediaType == "application/json" || mediaType == "application/x-ndjson" || mediaType == "text/event-stream":
+		w.mode = jsonPassThrough
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	w.mode = jsonWrapFile
+	filename := ""
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		filename = params["filename"]
+	}
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		mediaType = "application/octet-stream"
+		if byName := mime.TypeByExtension(filepath.Ext(filename)); byName != "" {
+			mediaType = byName
+		}
+	}
+	metadata := map[string]string{}
+	for name := range header {
+		if strings.HasPrefix(name, "X-") && name != "X-Content-Type-Options" {
+			metadata[name] = header.Get(name)
+		}
+	}
+	head, _ := json.Marshal(map[string]interface{}{
+		"filename":     filename,
+		"content_type": mediaType,
+		"headers":      metadata,
+	})
+
+	header.Del("Content-Length")
+	header.Del("Content-Disposition")
+	header.Del("Accept-Ranges")
+	header.Del("Last-Modified")
+	header.Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(status)
+	// The content is encoded as it streams, so results need not fit in memory
+	w.ResponseWriter.Write(head[:len(head)-1])
+	io.WriteString(w.ResponseWriter, `,"content":"`)
+	w.content = base64.NewEncoder(base64.StdEncoding, w.ResponseWriter)
+}
+
+func (w *jsonResultWriter) Write(b []byte) (int, error) {
+	if w.mode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	switch w.mode {
+	case jsonWrapFile:
+		n, err := w.content.Write(b)
+		w.size += int64(n)
+		return n, err
+	case jsonWrapError:
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *jsonResultWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && w.mode == jsonPassThrough {
+		f.Flush()
+	}
+}
+
+func (w *jsonResultWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish closes the wrapped file or renders the captured error.
+func (w *jsonResultWriter) finish() {
+	switch w.mode {
+	case jsonWrapFile:
+		w.content.Close()
+		fmt.Fprintf(w.ResponseWriter, `","size":%d}`+"\n", w.size)
+	case jsonWrapError:
+		out := map[string]interface{}{
+			"error":  strings.TrimSpace(w.body.String()),
+			"status": w.status,
+		}
+		if code := w.Header().Get("X-Error-Code"); code != "" {
+			out["code"] = code
+		}
+		if id := w.Header().Get("X-Request-ID"); id != "" {
+			out["request_id"] = id
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.ResponseWriter.WriteHeader(w.status)
+		json.NewEncoder(w.ResponseWriter).Encode(out)
+	}
+}
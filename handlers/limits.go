@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/akila/document-converter/auth"
+)
+
+// uploadLimit is an upload size limit and the endpoints it applies to. Limits
+// are named after their operation; endpoints of one operation that take
+// much larger uploads have their own.
+type uploadLimit struct {
+	Operation string
+	Paths     []string
+	Default   int64
+}
+
+// uploadLimits are the built-in upload limits, which LIMITS_CONFIG
+// overrides by name.
+var uploadLimits = map[string]uploadLimit{
+	"convert":               {"convert", []string{"/convert"}, 20 << 20},
+	"convert.html":          {"convert.html", []string{"/convert/html"}, 100 << 20},
+	"convert.batch":         {"convert", []string{"/convert/batch"}, 200 << 20},
+	"merge":                 {"merge", []string{"/merge"}, 50 << 20},
+	"toc":                   {"toc", []string{"/toc"}, 50 << 20},
+	"split":                 {"split", []string{"/split"}, 25 << 20},
+	"compress":              {"compress", []string{"/compress"}, 25 << 20},
+	"extract-text":          {"extract-text", []string{"/extract/text"}, 25 << 20},
+	"extract-text.batch":    {"extract-text", []string{"/extract/text/batch"}, 200 << 20},
+	"extract-text.stream":   {"extract-text", []string{"/extract/text/stream"}, 500 << 20},
+	"extract-images":        {"extract-images", []string{"/extract/images"}, 25 << 20},
+	"extract-tables":        {"extract-tables", []string{"/extract/tables"}, 50 << 20},
+	"thumbnail":             {"thumbnail", []string{"/thumbnail"}, 25 << 20},
+	"preview.proof":         {"preview.proof", []string{"/preview/proof"}, 50 << 20},
+	"rotate":                {"rotate", []string{"/rotate"}, 20 << 20},
+	"reorder":               {"reorder", []string{"/reorder"}, 20 << 20},
+	"remove-blank":          {"remove-blank", []string{"/pages/remove-blank"}, 25 << 20},
+	"booklet":               {"booklet", []string{"/booklet"}, 25 << 20},
+	"stamp":                 {"stamp", []string{"/stamp/header-footer", "/stamp/text"}, 25 << 20},
+	"flatten":               {"flatten", []string{"/flatten"}, 25 << 20},
+	"forms.fill":            {"forms.fill", []string{"/forms/fill"}, 25 << 20},
+	"forms.extract":         {"forms.extract", []string{"/forms/extract"}, 25 << 20},
+	"bookmarks.extract":     {"bookmarks.extract", []string{"/bookmarks/extract"}, 25 << 20},
+	"bookmarks.set":         {"bookmarks.set", []string{"/bookmarks/set"}, 25 << 20},
+	"annotations.extract":   {"annotations.extract", []string{"/annotations/extract"}, 25 << 20},
+	"annotations.remove":    {"annotations.remove", []string{"/annotations/remove"}, 25 << 20},
+	"attachments.add":       {"attachments.add", []string{"/attachments/add"}, 50 << 20},
+	"attachments.extract":   {"attachments.extract", []string{"/attachments/extract"}, 50 << 20},
+	"redact":                {"redact", []string{"/redact"}, 25 << 20},
+	"excerpt":               {"excerpt", []string{"/excerpt"}, 50 << 20},
+	"sign.placeholders":     {"sign.placeholders", []string{"/sign/placeholders"}, 25 << 20},
+	"estimate":              {"estimate", []string{"/estimate"}, 100 << 20},
+	"compare":               {"compare", []string{"/compare", "/compare/template"}, 50 << 20},
+	"interleave":            {"interleave", []string{"/interleave"}, 50 << 20},
+	"templates":             {"templates", []string{"/templates/{name}"}, 50 << 20},
+	"simple":                {"simple", []string{"/simple/{action}"}, 50 << 20},
+	"admin.engines.compare": {"admin.engines.compare", []string{"/admin/engines/compare"}, 50 << 20},
+}
+
+// maxUpload is the upload limit name sets for the request's tenant.
+func (h *ConversionHandler) maxUpload(r *http.Request, name string) int64 {
+	return h.Limits.MaxUpload(auth.Tenant(r.Context()), name, uploadLimits[name].Default)
+}
+
+// maxSignedForm bounds signed request bodies of routes without an upload
+// limit, which take small forms or JSON.
+const maxSignedForm = 10 << 20
+
+// signedBodyLimit is how much of a signed request to route auth may spool
+// to check its signature (see auth.Authenticator.Middleware): the route's
+// upload limit for the client's tenant, with room for JSON API encoding,
+// or the resumable upload limit for tus parts.
+func (h *ConversionHandler) signedBodyLimit(route Route) func(*auth.Client) int64 {
+	_, routePath, found := strings.Cut(route.Pattern, " ")
+	if !found {
+		routePath = route.Pattern
+	}
+	if route.Operation == "uploads" && strings.HasPrefix(routePath, TusPath+"/") {
+		return func(*auth.Client) int64 { return h.Config.Uploads.MaxBytes }
+	}
+	for name, limit := range uploadLimits {
+		if slices.Contains(limit.Paths, routePath) {
+			return func(client *auth.Client) int64 {
+				maxBytes := h.Limits.MaxUpload(client.Tenant, name, limit.Default)
+				return max(maxBytes/3*4+64<<10, maxSignedForm)
+			}
+		}
+	}
+	return func(*auth.Client) int64 { return maxSignedForm }
+}
+
+// parseUpload reads a multipart upload (or a JSON API request, see
+// multipartFromJSON) of at most the limit name sets, answering 413 when it
+// is larger, and applies its options object (see applyOptions).
+func (h *ConversionHandler) parseUpload(w http.ResponseWriter, r *http.Request, name string) bool {
+	maxBytes := h.maxUpload(r, name)
+	var tooLarge *http.MaxBytesError
+	var err error
+	if isJSONRequest(r) {
+		// Base64 takes 4 bytes for every 3
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes/3*4+64<<10)
+		if err = multipartFromJSON(r); err != nil && !errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return false
+		}
+	}
+	if err == nil {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		// Uploads beyond 32MB spill to disk rather than memory
+		err = r.ParseMultipartForm(min(maxBytes, 32<<20))
+	}
+	if err != nil {
+		if errors.As(err, &tooLarge) {
+			w.Header().Set("X-Error-Code", "upload_too_large")
+			http.Error(w, fmt.Sprintf("Upload exceeds the %s limit of %d bytes (see GET /limits)", name, maxBytes), http.StatusRequestEntityTooLarge)
+			return false
+		}
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return false
+	}
+	if err := applyOptions(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// HandleLimits lists the upload limits that apply to the caller, so clients
+// can check files before sending them. Operations disabled in this
+// deployment are left out.
+func (h *ConversionHandler) HandleLimits(w http.ResponseWriter, r *http.Request) {
+	type limitView struct {
+		Name      string   `json:"name"`
+		Operation string   `json:"operation"`
+		Paths     []string `json:"paths"`
+		MaxBytes  int64    `json:"max_bytes"`
+	}
+	out := []limitView{}
+	for name, limit := range uploadLimits {
+		if !h.OperationAllowed(limit.Operation) {
+			continue
+		}
+		out = append(out, limitView{Name: name, Operation: limit.Operation, Paths: limit.Paths, MaxBytes: h.maxUpload(r, name)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tenant": auth.Tenant(r.Context()),
+		"limits": out,
+	})
+}
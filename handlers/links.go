@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akila/document-converter/auth"
+	"github.com/akila/document-converter/jobs"
+)
+
+// linkTTL is how long a delivery=link result is kept: link_ttl (a Go
+// duration such as "30m" or "48h") up to the configured maximum, else the
+// default.
+func (h *ConversionHandler) linkTTL(r *http.Request) (time.Duration, error) {
+	cfg := h.Config.Links
+	v := r.FormValue("link_ttl")
+	if v == "" {
+		return cfg.TTL, nil
+	}
+	ttl, err := time.ParseDuration(v)
+	if err != nil || ttl <= 0 || ttl > cfg.MaxTTL {
+		return 0, fmt.Errorf("link_ttl must be a duration such as 30m or 48h, at most %v", cfg.MaxTTL)
+	}
+	return ttl, nil
+}
+
+// serveLink keeps the result at path for the link's TTL and answers with a
+// signed URL to download it later (GET /download/{token}) instead of the
+// file itself. The result expires with its job, see jobs.Manager.Keep.
+func (h *ConversionHandler) serveLink(w http.ResponseWriter, r *http.Request, path, tempDir string) {
+	defer os.RemoveAll(tempDir)
+	ttl, err := h.linkTTL(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reqID := requestID(r)
+	job, err := h.Jobs.Keep(auth.Tenant(r.Context()), operationOf(r), path, ttl)
+	if err != nil {
+		log.Printf("[%s] Keeping result failed: %v", reqID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[%s] Result kept as %s until %s", reqID, job.ID, job.ExpiresAt.UTC().Format(time.RFC3339))
+
+	w.Header().Del("Content-Disposition")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":        h.publicURL(r, "/download/"+h.linkToken(job.ID, job.ExpiresAt)),
+		"filename":   h.resultFilename(job.ResultName, job.ID),
+		"size":       job.ResultSize,
+		"expires_at": job.ExpiresAt.UTC(),
+	})
+}
+
+// linkToken signs a download of job's result until expires:
+// "<job id>.<expiry, unix seconds>.<HMAC-SHA256, base64url>".
+func (h *ConversionHandler) linkToken(jobID string, expires time.Time) string {
+	payload := jobID + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + h.linkSignature(payload)
+}
+
+func (h *ConversionHandler) linkSignature(payload string) string {
+	mac := hmac.New(sha256.New, h.linkSecret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// HandleDownload serves a result kept by delivery=link. The token is the
+// credential, so no API key is needed; it stops working when it expires.
+func (h *ConversionHandler) HandleDownload(w http.ResponseWriter, r *http.Request) {
+	token := r.PathValue("token")
+	i := strings.LastIndex(token, ".")
+	if i < 0 || !hmac.Equal([]byte(h.linkSignature(token[:i])), []byte(token[i+1:])) {
+		http.Error(w, "Invalid download link", http.StatusForbidden)
+		return
+	}
+	jobID, expiry, _ := strings.Cut(token[:i], ".")
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid download link", http.StatusForbidden)
+		return
+	}
+	job, ok := h.Jobs.Get(jobID)
+	if time.Now().Unix() > expires || !ok || job.Status != jobs.StatusSucceeded {
+		http.Error(w, "Download link expired", http.StatusGone)
+		return
+	}
+	h.serveJobResult(w, r, job)
+}
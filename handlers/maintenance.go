@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maintenanceState is the service's read-only switch. While it is on,
+// downloads and status queries keep working but new submissions are
+// answered 503, so migrations need not take the process down.
+type maintenanceState struct {
+	mu         sync.RWMutex
+	enabled    bool
+	message    string
+	retryAfter time.Duration
+	since      time.Time
+}
+
+const (
+	defaultMaintenanceMessage = "The service is undergoing maintenance; please retry shortly"
+	defaultMaintenanceRetry   = 5 * time.Minute
+)
+
+func (m *maintenanceState) set(enabled bool, message string, retryAfter time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if enabled && !m.enabled {
+		m.since = time.Now().UTC()
+	}
+	m.enabled = enabled
+	m.message = message
+	m.retryAfter = retryAfter
+}
+
+func (m *maintenanceState) view() map[string]interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	view := map[string]interface{}{"enabled": m.enabled}
+	if m.enabled {
+		view["message"] = m.message
+		view["retry_after"] = int(m.retryAfter.Seconds())
+		view["since"] = m.since
+	}
+	return view
+}
+
+// readOnlyRoute reports whether a route keeps working in maintenance mode:
+// GET routes (job status, results, documentation) and the maintenance
+// switch itself. Everything else is refused, the storage webhook included,
+// whose providers redeliver refused notifications later.
+func readOnlyRoute(route Route) bool {
+	return strings.HasPrefix(route.Pattern, "GET ") || route.Operation == "admin.maintenance"
+}
+
+// Paused reports whether maintenance mode is on, for the SFTP and IMAP
+// pollers to skip their rounds until it is off again.
+func (h *ConversionHandler) Paused() bool {
+	h.maintenance.mu.RLock()
+	defer h.maintenance.mu.RUnlock()
+	return h.maintenance.enabled
+}
+
+// checkMaintenance refuses route with 503 and Retry-After while the service
+// is in maintenance mode, unless it is read-only.
+func (h *ConversionHandler) checkMaintenance(route Route, next http.Handler) http.Handler {
+	if readOnlyRoute(route) {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := &h.maintenance
+		m.mu.RLock()
+		enabled, message, retryAfter := m.enabled, m.message, m.retryAfter
+		m.mu.RUnlock()
+		if enabled {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			w.Header().Set("X-Error-Code", "maintenance")
+			http.Error(w, message, http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HandleMaintenanceStatus reports whether maintenance mode is on.
+func (h *ConversionHandler) HandleMaintenanceStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.maintenance.view())
+}
+
+// HandleMaintenanceSet switches maintenance mode: enabled=true|false, with
+// an optional message for refused clients and retry_after (seconds, default
+// five minutes) for their Retry-After header.
+func (h *ConversionHandler) HandleMaintenanceSet(w http.ResponseWriter, r *http.Request) {
+	enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+	if err != nil {
+		http.Error(w, "enabled must be true or false", http.StatusBadRequest)
+		return
+	}
+	message := r.FormValue("message")
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	retryAfter := int(defaultMaintenanceRetry.Seconds())
+	if v := r.FormValue("retry_after"); v != "" {
+		if retryAfter, err = strconv.Atoi(v); err != nil || retryAfter < 1 {
+			http.Error(w, "retry_after must be a positive number of seconds", http.StatusBadRequest)
+			return
+		}
+	}
+	h.maintenance.set(enabled, message, time.Duration(retryAfter)*time.Second)
+	if enabled {
+		log.Printf("[%s] Maintenance mode on", requestID(r))
+	} else {
+		log.Printf("[%s] Maintenance mode off", requestID(r))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.maintenance.view())
+}
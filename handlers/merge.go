@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+
+	"github.com/akila/document-converter/converters"
+)
+
+// mergeEntry is one item of a merge manifest: pages of an uploaded file,
+// named by its filename or its 1-based position among the uploads.
+type mergeEntry struct {
+	File  string `json:"file"`
+	Index int    `json:"index"`
+	Pages string `json:"pages"`
+}
+
+// parseMergeManifest resolves a JSON manifest such as
+// [{"file":"a.pdf","pages":"1-3"},{"index":2,"pages":"5"}] against the
+// uploads. Entries without pages take the whole file; files may appear more
+// than once.
+func parseMergeManifest(manifest string, files []*multipart.FileHeader, inputPaths []string) ([]converters.PageSource, []string, error) {
+	var entries []mergeEntry
+	if err := json.Unmarshal([]byte(manifest), &entries); err != nil {
+		return nil, nil, fmt.Errorf("manifest must be a JSON array of {\"file\" or \"index\", \"pages\"} objects")
+	}
+	if len(entries) == 0 {
+		return nil, nil, fmt.Errorf("manifest is empty")
+	}
+
+	pageCounts := map[int]int{}
+	var sources []converters.PageSource
+	var titles []string
+	for n, e := range entries {
+		i := e.Index - 1
+		if e.File != "" {
+			i = -1
+			for j, f := range files {
+				if f.Filename == e.File {
+					i = j
+					break
+				}
+			}
+		}
+		if i < 0 || i >= len(files) {
+			return nil, nil, fmt.Errorf("manifest entry %d: no uploaded file %q (index %d)", n+1, e.File, e.Index)
+		}
+
+		count, ok := pageCounts[i]
+		if !ok {
+			var err error
+			if count, err = converters.PageCount(inputPaths[i]); err != nil {
+				return nil, nil, fmt.Errorf("%s is not a valid PDF", files[i].Filename)
+			}
+			pageCounts[i] = count
+		}
+		spec := e.Pages
+		if spec == "" {
+			spec = "1-last"
+		}
+		pages, err := converters.ParsePageRanges(spec, count)
+		if err != nil {
+			return nil, nil, fmt.Errorf("manifest entry %d (%s): %v", n+1, files[i].Filename, err)
+		}
+		sources = append(sources, converters.PageSource{Path: inputPaths[i], Pages: pages})
+		titles = append(titles, tocTitle(files[i].Filename))
+	}
+	return sources, titles, nil
+}
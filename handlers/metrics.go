@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/akila/document-converter/auth"
+	"github.com/akila/document-converter/metrics"
+)
+
+var requestDuration = metrics.NewHistogram(
+	"docconv_request_duration_seconds",
+	"Time to answer API requests, by operation and status code.",
+	metrics.DefaultBuckets,
+	"operation", "code",
+)
+
+// statusRecorder remembers the status code a handler answered with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// observe records how long operation's requests take. Requests carrying a
+// W3C traceparent header leave their trace ID as an exemplar, and in the
+// log next to the request ID.
+func observe(operation string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID := metrics.TraceID(r)
+		if traceID != "" {
+			log.Printf("[%s] Trace %s", requestID(r), traceID)
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		requestDuration.Observe(time.Since(start).Seconds(), traceID, operation, strconv.Itoa(rec.status))
+	})
+}
+
+// audit emits an audit.request event for every request once it has been
+// authenticated, naming the caller, when the deployment asks for them.
+func (h *ConversionHandler) audit(operation string, next http.Handler) http.Handler {
+	if !h.Config.EventsAudit {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		data := map[string]interface{}{
+			"request_id":  requestID(r),
+			"operation":   operation,
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      rec.status,
+			"duration_ms": time.Since(start).Milliseconds(),
+			"remote_addr": r.RemoteAddr,
+		}
+		if client := auth.FromContext(r.Context()); client != nil {
+			data["client"] = client.ID
+			if client.Tenant != "" {
+				data["tenant"] = client.Tenant
+			}
+		}
+		h.Events.Emit("audit.request", data)
+	})
+}
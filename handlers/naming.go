@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// nameTemplate names the files of a multi-file result, e.g.
+// "{{basename}}-p{{page:03d}}.pdf". Placeholders are {{basename}} (the
+// upload's name without extension), {{index}} (1-based position in the
+// result), {{page}} and {{last}} (first and last source page), {{name}}
+// (e.g. the bookmark title) and {{ext}}. Numbers take an optional printf
+// width such as :03d. Handlers say which placeholders make sense for them.
+type nameTemplate struct {
+	parts []namePart
+}
+
+type namePart struct {
+	literal string
+	field   string
+	format  string
+}
+
+// nameVars are the values available to a template for one output file.
+type nameVars struct {
+	Basename string
+	Name     string
+	Ext      string
+	Index    int
+	Page     int
+	Last     int
+}
+
+var (
+	namePlaceholder = regexp.MustCompile(`\{\{\s*([a-z]+)(?::(0?[1-9]?d))?\s*\}\}`)
+	numericFields   = map[string]bool{"index": true, "page": true, "last": true}
+)
+
+// parseNameTemplate validates tmpl against the placeholders a handler
+// supports. Literal text may not contain path separators or control
+// characters, so rendered names always stay inside the result.
+func parseNameTemplate(tmpl string, fields ...string) (*nameTemplate, error) {
+	if len(tmpl) > 200 {
+		return nil, fmt.Errorf("name_template is too long")
+	}
+	allowed := map[string]bool{}
+	for _, f := range fields {
+		allowed[f] = true
+	}
+
+	t := &nameTemplate{}
+	literal := func(s string) error {
+		if strings.Contains(s, "{{") || strings.Contains(s, "}}") {
+			return fmt.Errorf("name_template has a malformed placeholder near %q", s)
+		}
+		for _, r := range s {
+			if r == '/' || r == '\\' || r < 0x20 || r == 0x7f {
+				return fmt.Errorf("name_template may not contain %q", r)
+			}
+		}
+		if s != "" {
+			t.parts = append(t.parts, namePart{literal: s})
+		}
+		return nil
+	}
+
+	varying := false
+	last := 0
+	for _, m := range namePlaceholder.FindAllStringSubmatchIndex(tmpl, -1) {
+		if err := literal(tmpl[last:m[0]]); err != nil {
+			return nil, err
+		}
+		field := tmpl[m[2]:m[3]]
+		if !allowed[field] {
+			return nil, fmt.Errorf("name_template: {{%s}} is not available here (use %s)", field, placeholderList(fields))
+		}
+		format := "%v"
+		if m[4] >= 0 {
+			if !numericFields[field] {
+				return nil, fmt.Errorf("name_template: {{%s}} is not a number and takes no format", field)
+			}
+			format = "%" + tmpl[m[4]:m[5]]
+		}
+		if field != "basename" && field != "ext" {
+			varying = true
+		}
+		t.parts = append(t.parts, namePart{field: field, format: format})
+		last = m[1]
+	}
+	if err := literal(tmpl[last:]); err != nil {
+		return nil, err
+	}
+	if !varying {
+		var distinct []string
+		for _, f := range fields {
+			if f != "basename" && f != "ext" {
+				distinct = append(distinct, f)
+			}
+		}
+		return nil, fmt.Errorf("name_template must include one of %s to tell files apart", placeholderList(distinct))
+	}
+	return t, nil
+}
+
+func placeholderList(fields []string) string {
+	list := make([]string, len(fields))
+	for i, f := range fields {
+		list[i] = "{{" + f + "}}"
+	}
+	return strings.Join(list, ", ")
+}
+
+// render fills in the template. The output's extension is appended unless
+// the name already ends with it.
+func (t *nameTemplate) render(v nameVars) string {
+	var sb strings.Builder
+	for _, p := range t.parts {
+		if p.field == "" {
+			sb.WriteString(p.literal)
+			continue
+		}
+		var value interface{}
+		switch p.field {
+		case "basename":
+			value = v.Basename
+		case "name":
+			value = v.Name
+		case "ext":
+			value = v.Ext
+		case "index":
+			value = v.Index
+		case "page":
+			value = v.Page
+		case "last":
+			value = v.Last
+		}
+		fmt.Fprintf(&sb, p.format, value)
+	}
+	name := strings.TrimSpace(sb.String())
+	if v.Ext != "" && !strings.HasSuffix(strings.ToLower(name), "."+strings.ToLower(v.Ext)) {
+		name += "." + v.Ext
+	}
+	return name
+}
+
+// formNameTemplate reads the optional name_template form field; nil means
+// the handler keeps its default names.
+func formNameTemplate(r *http.Request, fields ...string) (*nameTemplate, error) {
+	tmpl := r.FormValue("name_template")
+	if tmpl == "" {
+		return nil, nil
+	}
+	return parseNameTemplate(tmpl, fields...)
+}
+
+// uploadBasename is the {{basename}} of an uploaded file.
+func uploadBasename(filename string) string {
+	return fileSafeName(strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)))
+}
+
+// names renders a name for each file; vars[i] describes files[i] and the
+// extension defaults to the file's own. Names must be distinct.
+func (t *nameTemplate) names(files []string, vars []nameVars) ([]string, error) {
+	seen := map[string]bool{}
+	names := make([]string, len(files))
+	for i, file := range files {
+		v := vars[i]
+		if v.Ext == "" {
+			v.Ext = strings.TrimPrefix(filepath.Ext(file), ".")
+		}
+		name := t.render(v)
+		if name == "" || strings.HasPrefix(name, ".") || len(name) > 255 {
+			return nil, fmt.Errorf("name_template gives an invalid file name %q", name)
+		}
+		key := strings.ToLower(name)
+		if seen[key] {
+			return nil, fmt.Errorf("name_template gives the same name %q to more than one file", name)
+		}
+		seen[key] = true
+		names[i] = name
+	}
+	return names, nil
+}
+
+// moveOutputs renames files into a fresh directory, so the new names can't
+// collide with inputs, and returns their new paths.
+func moveOutputs(files, names []string) ([]string, error) {
+	if len(files) == 0 {
+		return files, nil
+	}
+	dir := filepath.Join(filepath.Dir(files[0]), "named")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	moved := make([]string, len(files))
+	for i, file := range files {
+		moved[i] = filepath.Join(dir, names[i])
+		if err := os.Rename(file, moved[i]); err != nil {
+			return nil, err
+		}
+	}
+	return moved, nil
+}
+
+// applyNameTemplate renames files by t, answering the request itself when
+// that fails. A nil template leaves the files alone.
+func applyNameTemplate(w http.ResponseWriter, t *nameTemplate, files []string, vars []nameVars, tempDir string) ([]string, bool) {
+	if t == nil {
+		return files, true
+	}
+	names, err := t.names(files, vars)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if files, err = moveOutputs(files, names); err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return files, true
+}
+
+// pageFromName reads the page number from names such as "page-12.pdf".
+func pageFromName(path, prefix string) int {
+	n, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), prefix), filepath.Ext(path)))
+	return n
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/akila/document-converter/auth"
+	"github.com/akila/document-converter/numbering"
+)
+
+// sequenceView is a sequence as the API shows it.
+type sequenceView struct {
+	Name string `json:"sequence"`
+	numbering.Sequence
+	Preview string `json:"preview"`
+}
+
+// HandleNumberingGet shows one of the caller's tenant's number sequences,
+// with the number it issues next.
+func (h *ConversionHandler) HandleNumberingGet(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("sequence")
+	seq, found, err := h.Numbering.Get(auth.Tenant(r.Context()), name)
+	if err != nil {
+		log.Printf("[%s] Numbering registry: %v", requestID(r), err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Sequence not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sequenceView{Name: name, Sequence: seq, Preview: seq.Preview()})
+}
+
+// HandleNumberingSet creates or changes a number sequence: format (with
+// {seq} and {year}, default "{seq}"), width to zero-pad {seq}, next to move
+// the counter forward, and reset_yearly=true to restart at 1 every year.
+func (h *ConversionHandler) HandleNumberingSet(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("sequence")
+	if !numbering.ValidName(name) {
+		http.Error(w, "Sequence names are 1-64 letters, digits, '.', '_' or '-'", http.StatusBadRequest)
+		return
+	}
+	seq := numbering.Sequence{
+		Format:      r.FormValue("format"),
+		ResetYearly: r.FormValue("reset_yearly") == "true",
+	}
+	var err error
+	if v := r.FormValue("width"); v != "" {
+		if seq.Width, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "width must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.FormValue("next"); v != "" {
+		if seq.Next, err = strconv.ParseInt(v, 10, 64); err != nil || seq.Next < 1 {
+			http.Error(w, "next must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+	tenant := auth.Tenant(r.Context())
+	if err := h.Numbering.Configure(tenant, name, seq); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("[%s] Numbering sequence %s configured", requestID(r), name)
+	h.HandleNumberingGet(w, r)
+}
+
+// HandleNumberingNext issues the next number of a sequence, creating it
+// with the default format on first use.
+func (h *ConversionHandler) HandleNumberingNext(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("sequence")
+	if !numbering.ValidName(name) {
+		http.Error(w, "Invalid sequence name", http.StatusBadRequest)
+		return
+	}
+	issued, err := h.nextNumber(r, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(issued)
+}
+
+// nextNumber consumes the next number of the caller's tenant's sequence for
+// a request that uses it (number_sequence on /stamp/header-footer, for
+// example).
+func (h *ConversionHandler) nextNumber(r *http.Request, sequence string) (numbering.Issued, error) {
+	if !numbering.ValidName(sequence) {
+		return numbering.Issued{}, fmt.Errorf("invalid sequence name %q", sequence)
+	}
+	issued, err := h.Numbering.Next(auth.Tenant(r.Context()), sequence)
+	if err != nil {
+		log.Printf("[%s] Numbering registry: %v", requestID(r), err)
+		return issued, fmt.Errorf("could not issue a number from %s", sequence)
+	}
+	log.Printf("[%s] Issued number %s from %s", requestID(r), issued.Number, sequence)
+	return issued, nil
+}
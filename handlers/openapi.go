@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// uploadFields are the file fields of the upload endpoints that don't take
+// a single "file".
+var uploadFields = map[string][]string{
+	"/convert/batch":      {"files[]"},
+	"/merge":              {"files[]"},
+	"/toc":                {"files[]"},
+	"/extract/text/batch": {"files[]"},
+	"/compare":            {"files[]", "file_a", "file_b"},
+	"/interleave":         {"files[]", "file_a", "file_b"},
+	"/attachments/add":    {"file", "attachments[]"},
+}
+
+// HandleOpenAPI serves an OpenAPI 3.1 description of the API. It is built
+// from the route table, so it lists exactly the endpoints Register mounts
+// (less those the policy disables), with each upload endpoint's file fields
+// and options (see optionSchemas).
+func (h *ConversionHandler) HandleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	paths := map[string]map[string]interface{}{}
+	for _, route := range h.Routes() {
+		if !h.OperationAllowed(route.Operation) {
+			continue
+		}
+		method, path, found := strings.Cut(route.Pattern, " ")
+		if !found {
+			// Routes without a method take POSTs
+			method, path = http.MethodPost, route.Pattern
+		}
+		// OpenAPI has no wildcard segments: {path...} becomes {path}
+		path = strings.ReplaceAll(path, "...}", "}")
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(method)] = h.openAPIOperation(route, method, path)
+	}
+
+	securitySchemes := map[string]interface{}{}
+	if h.Auth != nil {
+		securitySchemes["apiKey"] = map[string]string{"type": "apiKey", "in": "header", "name": "X-API-Key"}
+		securitySchemes["bearer"] = map[string]string{"type": "http", "scheme": "bearer"}
+	}
+	doc := map[string]interface{}{
+		"openapi": "3.1.0",
+		"info":    map[string]string{"title": "Document Converter API", "version": "1.0.0"},
+		"servers": []map[string]string{{"url": h.publicURL(r, "")}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"securitySchemes": securitySchemes,
+			"schemas": map[string]interface{}{
+				"Base64File": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"content"},
+					"properties": map[string]interface{}{
+						"filename": map[string]string{"type": "string"},
+						"content":  map[string]string{"type": "string", "contentEncoding": "base64"},
+					},
+				},
+				"Error": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"error":      map[string]string{"type": "string"},
+						"status":     map[string]string{"type": "integer"},
+						"code":       map[string]string{"type": "string"},
+						"request_id": map[string]string{"type": "string"},
+					},
+				},
+			},
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+func (h *ConversionHandler) openAPIOperation(route Route, method, path string) map[string]interface{} {
+	var parameters []map[string]interface{}
+	for _, segment := range strings.Split(path, "/") {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     strings.TrimSuffix(name, "}"),
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]string{"type": "string"},
+			})
+		}
+	}
+
+	errorResult := map[string]interface{}{
+		"description": "Error, as text (JSON for JSON API requests)",
+		"content": map[string]interface{}{
+			"text/plain":       map[string]interface{}{"schema": map[string]string{"type": "string"}},
+			"application/json": map[string]interface{}{"schema": map[string]string{"$ref": "#/components/schemas/Error"}},
+		},
+	}
+	responses := map[string]interface{}{
+		"200":     map[string]string{"description": "OK"},
+		"403":     map[string]string{"description": "Operation disabled by policy, or missing scope " + route.Scope()},
+		"503":     map[string]string{"description": "Maintenance mode"},
+		"default": errorResult,
+	}
+	op := map[string]interface{}{
+		"operationId": operationID(method, path),
+		"tags":        []string{route.Operation},
+		"responses":   responses,
+	}
+	if parameters != nil {
+		op["parameters"] = parameters
+	}
+	if adminOperation(route.Operation) {
+		responses["403"] = map[string]string{"description": "Authentication is off, or missing the admin scope " + route.Scope()}
+	}
+	if selfAuthenticated[route.Operation] {
+		op["security"] = []map[string][]string{}
+	} else if h.Auth != nil {
+		op["security"] = []map[string][]string{{"apiKey": {}}, {"bearer": {}}}
+		op["description"] = "Requires the scope " + route.Scope() + "."
+		if adminOperation(route.Operation) {
+			op["description"] = "Requires an admin scope granting " + route.Scope() + ", e.g. admin.*."
+		}
+		responses["401"] = map[string]string{"description": "Missing or invalid credentials"}
+		if h.Quotas != nil {
+			responses["429"] = map[string]string{"description": "Quota exceeded"}
+		}
+	}
+
+	// The simple API takes JSON bodies and has its own description
+	if strings.HasPrefix(path, "/simple/") {
+		op["description"] = "See /simple/openapi.json."
+		return op
+	}
+	if method == http.MethodPost && takesUploads(route) {
+		op["requestBody"] = uploadRequestBody(path)
+		responses["200"] = map[string]string{"description": "The result file, or JSON for results that aren't files"}
+		responses["413"] = map[string]string{"description": "Upload too large (see GET /limits)"}
+	}
+	return op
+}
+
+// uploadRequestBody describes an upload endpoint's multipart form and its
+// JSON API equivalent (see multipartFromJSON).
+func uploadRequestBody(path string) map[string]interface{} {
+	form := map[string]interface{}{}
+	body := map[string]interface{}{}
+	if schema := schemaFor(path); schema != nil {
+		for name, option := range schema.Properties {
+			form[name] = option
+			body[name] = option
+		}
+		form["options"] = optString("the options as one JSON object, instead of separate fields")
+	}
+	fields, ok := uploadFields[path]
+	if !ok {
+		fields = []string{"file"}
+	}
+	binary := map[string]string{"type": "string", "format": "binary"}
+	encoded := map[string]string{"$ref": "#/components/schemas/Base64File"}
+	for _, field := range fields {
+		if name, many := strings.CutSuffix(field, "[]"); many {
+			form[name] = map[string]interface{}{"type": "array", "items": binary}
+			body[name] = map[string]interface{}{"type": "array", "items": encoded}
+			continue
+		}
+		form[field] = binary
+		body[field] = encoded
+	}
+	return map[string]interface{}{
+		"required": true,
+		"content": map[string]interface{}{
+			"multipart/form-data": map[string]interface{}{"schema": map[string]interface{}{"type": "object", "properties": form}},
+			"application/json":    map[string]interface{}{"schema": map[string]interface{}{"type": "object", "properties": body}},
+		},
+	}
+}
+
+// operationID names an operation after its method and path, e.g.
+// "post_extract_text_batch" or "get_jobs_id_result".
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, segment := range strings.Split(path, "/") {
+		segment = strings.Trim(segment, "{}")
+		if segment != "" {
+			id += "_" + strings.NewReplacer("-", "_", ".", "_").Replace(segment)
+		}
+	}
+	return id
+}
+
+var docsPage = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Document Converter API</title>
+<link rel="stylesheet" href="{{.Assets}}/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{.Assets}}/swagger-ui-bundle.js"></script>
+<script>
+  SwaggerUIBundle({ url: {{.Spec}}, dom_id: "#swagger-ui" });
+</script>
+</body>
+</html>
+`))
+
+// HandleDocs serves Swagger UI on the OpenAPI description (/openapi.json).
+// Its scripts come from DocsAssetsURL.
+func (h *ConversionHandler) HandleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	docsPage.Execute(w, map[string]string{
+		"Assets": h.Config.DocsAssetsURL,
+		"Spec":   h.publicURL(r, "/openapi.json"),
+	})
+}
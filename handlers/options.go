@@ -0,0 +1,429 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// optionSchema is the JSON Schema subset describing the options an endpoint
+// takes, in its form fields or as one "options" JSON object.
+type optionSchema struct {
+	Type                 schemaType               `json:"type"`
+	Description          string                   `json:"description,omitempty"`
+	Enum                 []string                 `json:"enum,omitempty"`
+	Minimum              *float64                 `json:"minimum,omitempty"`
+	Maximum              *float64                 `json:"maximum,omitempty"`
+	Items                *optionSchema            `json:"items,omitempty"`
+	Properties           map[string]*optionSchema `json:"properties,omitempty"`
+	AdditionalProperties *bool                    `json:"additionalProperties,omitempty"`
+
+	// repeated arrays are sent to the handler as a repeated form field;
+	// other arrays and objects as JSON text.
+	repeated bool
+}
+
+// schemaType is one JSON type, or several an option accepts.
+type schemaType []string
+
+func (t schemaType) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func optString(description string, enum ...string) *optionSchema {
+	return &optionSchema{Type: schemaType{"string"}, Description: description, Enum: enum}
+}
+
+func optInteger(description string, lo, hi float64) *optionSchema {
+	return &optionSchema{Type: schemaType{"integer"}, Description: description, Minimum: &lo, Maximum: &hi}
+}
+
+func optNumber(description string, lo, hi float64) *optionSchema {
+	return &optionSchema{Type: schemaType{"number"}, Description: description, Minimum: &lo, Maximum: &hi}
+}
+
+func optBoolean(description string) *optionSchema {
+	return &optionSchema{Type: schemaType{"boolean"}, Description: description}
+}
+
+// optJSON is an option whose value is a JSON array or object.
+func optJSON(description string) *optionSchema {
+	return &optionSchema{Type: schemaType{"array", "object"}, Description: description}
+}
+
+// optRepeated is a list of strings the form takes as a repeated field.
+func optRepeated(description string) *optionSchema {
+	return &optionSchema{Type: schemaType{"array", "string"}, Description: description, Items: optString(""), repeated: true}
+}
+
+// optDPI is a resolution from lo to hi, or "auto" to pick one per page.
+func optDPI(lo, hi float64) *optionSchema {
+	return &optionSchema{Type: schemaType{"integer", "string"}, Description: `dots per inch, or "auto"`, Minimum: &lo, Maximum: &hi}
+}
+
+// optionsOf builds an endpoint's schema from its options and those shared
+// with other endpoints.
+func optionsOf(properties map[string]*optionSchema, shared ...map[string]*optionSchema) *optionSchema {
+	all := map[string]*optionSchema{}
+	for _, set := range append(shared, properties) {
+		for name, s := range set {
+			all[name] = s
+		}
+	}
+	closed := false
+	return &optionSchema{Type: schemaType{"object"}, Properties: all, AdditionalProperties: &closed}
+}
+
+var imageOptionSchemas = map[string]*optionSchema{
+	"dpi":       optDPI(36, 600),
+	"quality":   optInteger("JPEG quality", 1, 100),
+	"scale_to":  optInteger("pixels on the longer side, overriding dpi", 16, 10000),
+	"tiff_mode": optString("PDF -> TIFF encoding", "color", "fax"),
+}
+
+var printOptionSchemas = map[string]*optionSchema{
+	"paper":         optString("paper size, e.g. letter or a4"),
+	"landscape":     optBoolean(""),
+	"background":    optBoolean("print background colors and images (default true)"),
+	"margin":        optString("all margins, e.g. 0.4in or 10mm"),
+	"margin_top":    optString(""),
+	"margin_right":  optString(""),
+	"margin_bottom": optString(""),
+	"margin_left":   optString(""),
+	"wait_until":    optString("", "load", "networkidle"),
+	"timeout":       optInteger("seconds", 1, 120),
+}
+
+var nameTemplateSchema = map[string]*optionSchema{
+	"name_template": optString("names of the output files (see the API docs)"),
+}
+
+var sourceSchema = map[string]*optionSchema{
+	"source_url": optString("an http(s) URL to download the input from, instead of file"),
+}
+
+var linkSchema = map[string]*optionSchema{
+	"delivery": optString("link: answer with a download URL instead of the file", "link"),
+	"link_ttl": optString("delivery=link: how long the URL works, e.g. 30m or 48h"),
+}
+
+// optionSchemas are the options of the endpoints taking uploads, by path.
+var optionSchemas = map[string]*optionSchema{
+	"/convert": optionsOf(map[string]*optionSchema{
+		"from":               optString("source format, inferred from the file when omitted"),
+		"to":                 optString("target format"),
+		"upload_id":          optString("a file uploaded through /uploads/presign, instead of file"),
+		"pages":              optString("PDF pages to render, a single range such as 3-7"),
+		"page":               optInteger("a single PDF page to render", 1, 1e6),
+		"append_attachments": optBoolean("emails: attachments as further pages"),
+	}, imageOptionSchemas, sourceSchema, linkSchema),
+	"/convert/batch": optionsOf(map[string]*optionSchema{
+		"to":            optString("target format (default pdf)"),
+		"expand_nested": optBoolean("expand zips inside uploaded zips"),
+	}, imageOptionSchemas, linkSchema),
+	"/convert/html": optionsOf(nil, printOptionSchemas, sourceSchema, linkSchema),
+	"/merge": optionsOf(map[string]*optionSchema{
+		"manifest":  optJSON("pages to take from each file, in order"),
+		"toc":       optBoolean("prepend a contents page"),
+		"toc_title": optString(""),
+	}, linkSchema),
+	"/toc": optionsOf(map[string]*optionSchema{"toc_title": optString("")}, linkSchema),
+	"/split": optionsOf(map[string]*optionSchema{
+		"mode":     optString("size, bookmarks, or by ranges or page when unset"),
+		"ranges":   optString("e.g. 1-3,4-10"),
+		"max_mb":   optNumber("mode=size: largest part", 0, 1e6),
+		"level":    optInteger("mode=bookmarks: outline depth", 1, 100),
+		"delivery": optString("", "zip", "storage", "link"),
+		"link_ttl": optString("delivery=link: how long the URL works"),
+	}, nameTemplateSchema, sourceSchema),
+	"/compress": optionsOf(map[string]*optionSchema{
+		"level":   optString("", "screen", "ebook", "printer", "prepress"),
+		"quality": optInteger("image quality", 1, 100),
+	}, sourceSchema, linkSchema),
+	"/extract/text": optionsOf(nil, sourceSchema, linkSchema),
+	"/extract/text/batch": optionsOf(map[string]*optionSchema{
+		"expand_nested": optBoolean("expand zips inside uploaded zips"),
+	}),
+	"/extract/text/stream": optionsOf(nil, sourceSchema),
+	"/extract/images":      optionsOf(nil, nameTemplateSchema, sourceSchema, linkSchema),
+	"/extract/tables": optionsOf(map[string]*optionSchema{
+		"format": optString("", "csv", "xlsx"),
+	}, sourceSchema, linkSchema),
+	"/thumbnail": optionsOf(map[string]*optionSchema{
+		"pages":  optString("e.g. 1,3-5 (default 1)"),
+		"width":  optInteger("pixels (default 200)", 1, 10000),
+		"dpi":    optString("", "auto"),
+		"format": optString("", "png", "jpeg", "webp"),
+	}, nameTemplateSchema, sourceSchema, linkSchema),
+	"/preview/proof": optionsOf(map[string]*optionSchema{
+		"profile": optString("the press profile to simulate (see GET /preview/profiles)"),
+		"pages":   optString("e.g. 1,3-5 (default 1)"),
+		"dpi":     optInteger("default 150", 36, 600),
+		"intent":  optString("default relative", "perceptual", "relative", "saturation", "absolute"),
+		"format":  optString("", "png", "jpeg", "jpg"),
+	}, nameTemplateSchema, sourceSchema, linkSchema),
+	"/rotate": optionsOf(map[string]*optionSchema{
+		"angle":     optInteger("degrees clockwise (default 90)", -270, 270),
+		"pages":     optString("pages to turn, e.g. 1-3,7"),
+		"rotations": optJSON(`per-range angles, e.g. [{"pages":"1-3","angle":90}]`),
+	}, sourceSchema, linkSchema),
+	"/reorder": optionsOf(map[string]*optionSchema{"order": optString("e.g. 1,3,2")}, sourceSchema, linkSchema),
+	"/pages/remove-blank": optionsOf(map[string]*optionSchema{
+		"threshold": optNumber("ink coverage, a fraction of the page", 0, 1),
+	}, sourceSchema, linkSchema),
+	"/booklet": optionsOf(map[string]*optionSchema{
+		"signature": optInteger("pages per folded section, a multiple of 4", 4, 1e6),
+	}, sourceSchema, linkSchema),
+	"/stamp/header-footer": optionsOf(map[string]*optionSchema{
+		"header_left":     optString(""),
+		"header_center":   optString(""),
+		"header_right":    optString(""),
+		"footer_left":     optString(""),
+		"footer_center":   optString(""),
+		"footer_right":    optString(""),
+		"date_format":     optString("Go layout (default 2006-01-02)"),
+		"font_size":       optNumber("", 1, 200),
+		"margin":          optNumber("points", 0, 1000),
+		"number_sequence": optString("a /numbering sequence"),
+	}, sourceSchema, linkSchema),
+	"/stamp/text":        optionsOf(map[string]*optionSchema{"stamps": optJSON("the stamps")}, sourceSchema, linkSchema),
+	"/flatten":           optionsOf(nil, sourceSchema, linkSchema),
+	"/forms/fill":        optionsOf(map[string]*optionSchema{"fields": optJSON("field values by name"), "flatten": optBoolean("")}, sourceSchema, linkSchema),
+	"/forms/extract":     optionsOf(nil, sourceSchema),
+	"/bookmarks/extract": optionsOf(nil, sourceSchema),
+	"/bookmarks/set": optionsOf(map[string]*optionSchema{
+		"bookmarks": optJSON("the bookmark tree"),
+		"mode":      optString("", "replace", "merge"),
+	}, sourceSchema, linkSchema),
+	"/annotations/extract": optionsOf(nil, sourceSchema),
+	"/annotations/remove": optionsOf(map[string]*optionSchema{
+		"types": optString("comma separated annotation subtypes"),
+	}, sourceSchema, linkSchema),
+	"/attachments/add": optionsOf(map[string]*optionSchema{
+		"description":  optString(""),
+		"relationship": optString("PDF/A-3 AFRelationship, e.g. Alternative"),
+		"replace":      optBoolean("overwrite attachments of the same name"),
+	}, sourceSchema, linkSchema),
+	"/attachments/extract": optionsOf(map[string]*optionSchema{
+		"name": optString("the attachment to extract"),
+		"list": optBoolean("list the attachments instead"),
+	}, sourceSchema, linkSchema),
+	"/redact": optionsOf(map[string]*optionSchema{
+		"pattern":  optRepeated("regular expressions"),
+		"patterns": optJSON("regular expressions"),
+		"term":     optRepeated("literal text"),
+		"presets":  optString("comma separated preset names"),
+		"dpi":      optInteger("", 36, 600),
+	}, sourceSchema, linkSchema),
+	"/excerpt": optionsOf(map[string]*optionSchema{
+		"pages":          optString("e.g. 1-3,10"),
+		"watermark":      optString(`default "Preview"`),
+		"dpi":            optInteger("flatten pages to images", 36, 300),
+		"password":       optString(""),
+		"owner_password": optString(""),
+	}, sourceSchema, linkSchema),
+	"/sign/placeholders": optionsOf(map[string]*optionSchema{"fields": optJSON("the fields")}, sourceSchema, linkSchema),
+	"/estimate": optionsOf(map[string]*optionSchema{
+		"pipeline":      optString("e.g. convert:pdf,compress"),
+		"validate_only": optBoolean("check the pipeline step by step instead of estimating it"),
+		"upload_id":     optString("validate_only: a file uploaded through /uploads/presign, instead of file"),
+	}, sourceSchema),
+	"/compare": optionsOf(map[string]*optionSchema{
+		"mode": optString("", "text", "visual"),
+		"dpi":  optInteger("", 36, 600),
+	}, linkSchema),
+	"/compare/template": optionsOf(map[string]*optionSchema{
+		"template": optString(""),
+		"version":  optInteger("", 1, 1e9),
+	}, sourceSchema),
+	"/interleave": optionsOf(map[string]*optionSchema{"reverse": optBoolean("read file_b backwards")}, linkSchema),
+	"/templates/{name}": optionsOf(map[string]*optionSchema{
+		"sample_data": optJSON("data for previews"),
+		"visibility":  optString("", "private", "public"),
+	}, sourceSchema, linkSchema),
+	"/admin/engines/compare": optionsOf(map[string]*optionSchema{
+		"from":     optString(""),
+		"to":       optString("default pdf"),
+		"engine_a": optString(""),
+		"engine_b": optString(""),
+		"dpi":      optInteger("", 36, 600),
+	}, sourceSchema, linkSchema),
+}
+
+// schemaFor finds the options schema of a request's path.
+func schemaFor(path string) *optionSchema {
+	if s, ok := optionSchemas[path]; ok {
+		return s
+	}
+	for pattern, s := range optionSchemas {
+		if strings.Contains(pattern, "{") && pathMatches(pattern, path) {
+			return s
+		}
+	}
+	return nil
+}
+
+// pathMatches matches a path against a pattern whose {name} segments match
+// any one segment.
+func pathMatches(pattern, path string) bool {
+	want, got := strings.Split(pattern, "/"), strings.Split(path, "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if !strings.HasPrefix(want[i], "{") && want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// applyOptions reads an "options" JSON object (a form value or a JSON file
+// part), validates it against the endpoint's schema and adds its entries to
+// the form, so handlers read them like form fields. Setting an option both
+// ways is an error.
+func applyOptions(r *http.Request) error {
+	raw := []byte(r.FormValue("options"))
+	if len(raw) == 0 {
+		if f, _, err := r.FormFile("options"); err == nil {
+			raw, _ = io.ReadAll(f)
+			f.Close()
+		}
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	schema := schemaFor(r.URL.Path)
+	if schema == nil {
+		return fmt.Errorf("this endpoint takes no options object")
+	}
+
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	var options map[string]interface{}
+	if err := d.Decode(&options); err != nil || options == nil {
+		return fmt.Errorf("options must be a JSON object")
+	}
+	if err := schema.validate("options", options); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := r.Form[name]; ok {
+			return fmt.Errorf("%s is set both as a form field and in options", name)
+		}
+		values, err := formValues(options[name], schema.Properties[name])
+		if err != nil {
+			return fmt.Errorf("options.%s: %v", name, err)
+		}
+		r.Form[name] = values
+	}
+	return nil
+}
+
+// formValues writes an option as the form field(s) handlers expect.
+func formValues(v interface{}, schema *optionSchema) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, nil
+	case json.Number:
+		return []string{v.String()}, nil
+	case bool:
+		return []string{strconv.FormatBool(v)}, nil
+	case []interface{}:
+		if schema.repeated {
+			values := make([]string, len(v))
+			for i, item := range v {
+				values[i] = item.(string)
+			}
+			return values, nil
+		}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return []string{string(data)}, nil
+}
+
+// validate checks v, the decoded JSON value at where, against s.
+func (s *optionSchema) validate(where string, v interface{}) error {
+	var kind string
+	switch v := v.(type) {
+	case string:
+		kind = "string"
+	case bool:
+		kind = "boolean"
+	case json.Number:
+		kind = "number"
+		if _, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			kind = "integer"
+		}
+	case []interface{}:
+		kind = "array"
+	case map[string]interface{}:
+		kind = "object"
+	default:
+		kind = "null"
+	}
+	if !slices.Contains(s.Type, kind) && !(kind == "integer" && slices.Contains(s.Type, "number")) {
+		return fmt.Errorf("%s must be a JSON %s", where, strings.Join(s.Type, " or "))
+	}
+
+	switch v := v.(type) {
+	case string:
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, v) {
+			return fmt.Errorf("%s must be one of %s", where, strings.Join(s.Enum, ", "))
+		}
+	case json.Number:
+		n, err := v.Float64()
+		if err != nil {
+			return fmt.Errorf("%s is not a number", where)
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			return fmt.Errorf("%s must be at least %v", where, *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			return fmt.Errorf("%s must be at most %v", where, *s.Maximum)
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", where, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		if s.Properties == nil {
+			break
+		}
+		for name, item := range v {
+			p, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s: unknown option %q", where, name)
+				}
+				continue
+			}
+			if err := p.validate(where+"."+name, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
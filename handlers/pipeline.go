@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/models"
+	"github.com/akila/document-converter/workers"
+)
+
+// A pipeline is a comma separated list of steps, each fed the previous
+// step's output, e.g. "convert:pdf,compress" or "rotate:90".
+type pipelineStep struct {
+	Op  string
+	Arg string
+}
+
+func (s pipelineStep) String() string {
+	if s.Arg == "" {
+		return s.Op
+	}
+	return s.Op + ":" + s.Arg
+}
+
+// pipelineOp runs one step on inputPath inside its own stepDir and returns
+// the path of the file it produced.
+type pipelineOp func(h *ConversionHandler, reqID, stepDir, inputPath, arg string) (string, error)
+
+var pipelineOps = map[string]pipelineOp{
+	"convert":      pipelineConvert,
+	"compress":     pipelineCompress,
+	"extract-text": pipelineExtractText,
+	"rotate":       pipelineRotate,
+	"flatten":      pipelineFlatten,
+	"pdfa":         pipelinePDFA,
+}
+
+// Steps that cannot run without an argument.
+var pipelineArgRequired = map[string]bool{
+	"convert": true,
+	"rotate":  true,
+}
+
+func parsePipeline(spec string) ([]pipelineStep, error) {
+	var steps []pipelineStep
+	for _, raw := range pipelineSpecSteps(spec) {
+		step, err := parsePipelineStep(raw)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("empty pipeline")
+	}
+	return steps, nil
+}
+
+// pipelineSpecSteps splits a pipeline spec into its unparsed steps.
+func pipelineSpecSteps(spec string) []string {
+	var raws []string
+	for _, raw := range strings.Split(spec, ",") {
+		if raw = strings.TrimSpace(raw); raw != "" {
+			raws = append(raws, raw)
+		}
+	}
+	return raws
+}
+
+func parsePipelineStep(raw string) (pipelineStep, error) {
+	op, arg, _ := strings.Cut(raw, ":")
+	op = strings.ToLower(op)
+	if _, ok := pipelineOps[op]; !ok {
+		return pipelineStep{}, fmt.Errorf("unknown pipeline step %q", op)
+	}
+	if pipelineArgRequired[op] && arg == "" {
+		return pipelineStep{}, fmt.Errorf("pipeline step %q needs an argument, e.g. %s:<value>", op, op)
+	}
+	return pipelineStep{Op: op, Arg: strings.ToLower(arg)}, nil
+}
+
+// runPipeline executes steps in order below tempDir and returns the final
+// output path. A step whose engine queue is full fails with a
+// *queueFullError, for requests to answer 503.
+func (h *ConversionHandler) runPipeline(reqID, tempDir, inputPath string, steps []pipelineStep) (string, error) {
+	return h.pipeline(reqID, tempDir, inputPath, steps, false)
+}
+
+// runPipelineQueued is runPipeline for background work, which has no
+// client to retry: a step refused by a full engine queue is retried with
+// backoff until there is room.
+func (h *ConversionHandler) runPipelineQueued(reqID, tempDir, inputPath string, steps []pipelineStep) (string, error) {
+	return h.pipeline(reqID, tempDir, inputPath, steps, true)
+}
+
+// Backoff between retries of a background step refused by a full queue.
+const (
+	queueRetryMin = time.Second
+	queueRetryMax = time.Minute
+)
+
+func (h *ConversionHandler) pipeline(reqID, tempDir, inputPath string, steps []pipelineStep, retry bool) (string, error) {
+	if op, ok := h.pipelineAllowed(steps); !ok {
+		return "", fmt.Errorf("operation %q is disabled in this deployment", op)
+	}
+	current := inputPath
+	for i, step := range steps {
+		stepDir := filepath.Join(tempDir, fmt.Sprintf("step-%d", i+1))
+		if err := os.MkdirAll(stepDir, 0755); err != nil {
+			return "", err
+		}
+		out, err := pipelineOps[step.Op](h, reqID, stepDir, current, step.Arg)
+		for backoff := queueRetryMin; retry && errors.Is(err, workers.ErrQueueFull); backoff = min(2*backoff, queueRetryMax) {
+			log.Printf("[%s] Step %d (%s) waiting %s for room in the engine queue", reqID, i+1, step, backoff)
+			time.Sleep(backoff)
+			out, err = pipelineOps[step.Op](h, reqID, stepDir, current, step.Arg)
+		}
+		if err != nil {
+			return "", fmt.Errorf("step %d (%s): %w", i+1, step, err)
+		}
+		current = out
+	}
+	return current, nil
+}
+
+// pipelineAllowed reports the first step the policy disables, if any.
+func (h *ConversionHandler) pipelineAllowed(steps []pipelineStep) (string, bool) {
+	for _, step := range steps {
+		if !h.OperationAllowed(step.Op) {
+			return step.Op, false
+		}
+	}
+	return "", true
+}
+
+// queueFullError is a job refused because its pool's queue stayed full
+// for QueueWait.
+type queueFullError struct {
+	depth, capacity int
+}
+
+func (e *queueFullError) Error() string {
+	return "queue_full: the engine queue is full, try again later"
+}
+
+func (e *queueFullError) Unwrap() error {
+	return workers.ErrQueueFull
+}
+
+// tryEnqueue queues job on pool, waiting at most QueueWait for room.
+func (h *ConversionHandler) tryEnqueue(pool *workers.WorkerPool, job models.Job) error {
+	if err := pool.TryEnqueue(job, h.Config.QueueWait); err != nil {
+		depth := pool.Queued()
+		log.Printf("[%s] Engine queue full (%d jobs waiting), refusing", job.ID, depth)
+		return &queueFullError{depth: depth, capacity: pool.Capacity()}
+	}
+	return nil
+}
+
+// runJob queues job on pool and waits for its result. A pool whose queue
+// stays full fails it with a *queueFullError.
+func (h *ConversionHandler) runJob(pool *workers.WorkerPool, job models.Job) (string, error) {
+	if pool == nil {
+		return "", fmt.Errorf("engine not available in this deployment")
+	}
+	resultChan := make(chan models.JobResult, 1)
+	job.ResultChan = resultChan
+	if err := h.tryEnqueue(pool, job); err != nil {
+		return "", err
+	}
+	result := <-resultChan
+	if !result.Success {
+		return "", result.Error
+	}
+	return result.Path, nil
+}
+
+// enqueue queues a request's job on pool, answering 503 (see queueFull)
+// when the pool is saturated.
+func (h *ConversionHandler) enqueue(w http.ResponseWriter, pool *workers.WorkerPool, job models.Job) bool {
+	return !h.queueFull(w, h.tryEnqueue(pool, job))
+}
+
+// queueFull answers 503 with the queue depth when err is a
+// *queueFullError, so clients back off instead of piling up blocked
+// requests, and reports whether it did.
+func (h *ConversionHandler) queueFull(w http.ResponseWriter, err error) bool {
+	if !h.queueFullHeaders(w, err) {
+		return false
+	}
+	http.Error(w, "Server busy, try again later", http.StatusServiceUnavailable)
+	return true
+}
+
+// queueFullHeaders sets queueFull's headers when err is a *queueFullError,
+// for handlers that write their own error body.
+func (h *ConversionHandler) queueFullHeaders(w http.ResponseWriter, err error) bool {
+	var full *queueFullError
+	if !errors.As(err, &full) {
+		return false
+	}
+	w.Header().Set("X-Queue-Depth", strconv.Itoa(full.depth))
+	w.Header().Set("X-Queue-Capacity", strconv.Itoa(full.capacity))
+	w.Header().Set("Retry-After", strconv.Itoa(max(int(h.Config.QueueWait.Seconds()), 1)))
+	w.Header().Set("X-Error-Code", "queue_full")
+	return true
+}
+
+func formatOf(path string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+}
+
+func pipelineConvert(h *ConversionHandler, reqID, stepDir, inputPath, to string) (string, error) {
+	from := formatOf(inputPath)
+	pool := h.selectPool(from, to)
+	if pool == nil {
+		return "", fmt.Errorf("unsupported conversion %s -> %s", from, to)
+	}
+	job := models.Job{
+		ID:         reqID,
+		RequestID:  reqID,
+		InputPath:  inputPath,
+		FromFormat: from,
+		ToFormat:   to,
+		TempDir:    stepDir,
+	}
+	pool, err := h.routeJob(&job, pool)
+	if err != nil {
+		return "", err
+	}
+	return h.runJob(pool, job)
+}
+
+// pipelineCompress takes an optional level or quality, e.g. "compress:ebook"
+// or "compress:60".
+func pipelineCompress(h *ConversionHandler, reqID, stepDir, inputPath, arg string) (string, error) {
+	options, err := compressOptions(arg, "")
+	if err != nil {
+		return "", err
+	}
+	return h.runJob(h.EngineManager.GhostscriptPool, models.Job{
+		ID:        reqID,
+		RequestID: reqID,
+		InputPath: inputPath,
+		ToFormat:  "pdf",
+		Options:   options,
+		TempDir:   stepDir,
+	})
+}
+
+func pipelineExtractText(h *ConversionHandler, reqID, stepDir, inputPath, _ string) (string, error) {
+	return h.runJob(h.operationPool("extract-text", h.EngineManager.PopplerPool), models.Job{
+		ID:        reqID,
+		RequestID: reqID,
+		InputPath: inputPath,
+		ToFormat:  "txt",
+		TempDir:   stepDir,
+	})
+}
+
+func pipelineRotate(h *ConversionHandler, reqID, stepDir, inputPath, arg string) (string, error) {
+	angle, err := strconv.Atoi(arg)
+	if err != nil {
+		return "", fmt.Errorf("invalid angle %q", arg)
+	}
+	outputPath := filepath.Join(stepDir, "rotated.pdf")
+	return outputPath, converters.RotatePDF(inputPath, outputPath, converters.PageRotation{Angle: angle})
+}
+
+func pipelineFlatten(h *ConversionHandler, reqID, stepDir, inputPath, _ string) (string, error) {
+	outputPath := filepath.Join(stepDir, "flattened.pdf")
+	return outputPath, converters.FlattenPDF(inputPath, outputPath)
+}
+
+func pipelinePDFA(h *ConversionHandler, reqID, stepDir, inputPath, _ string) (string, error) {
+	outputPath := filepath.Join(stepDir, "pdfa.pdf")
+	return outputPath, converters.ConvertToPDFA(inputPath, outputPath)
+}
+
+// ProcessFile runs a pipeline spec on a local file and the post-processing
+// hooks on its result. It backs the background ingestion sources, which
+// have no HTTP request to answer, so steps wait out full engine queues.
+func (h *ConversionHandler) ProcessFile(reqID, tempDir, inputPath, pipeline string) (string, error) {
+	steps, err := parsePipeline(pipeline)
+	if err != nil {
+		return "", err
+	}
+	outputPath, err := h.runPipelineQueued(reqID, tempDir, inputPath, steps)
+	if err != nil {
+		return "", err
+	}
+	return outputPath, h.Hooks.Run(reqID, "ingest", outputPath)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/utils"
+)
+
+// At most this many pages are proofed per request.
+const maxProofPages = 20
+
+// HandleProofProfiles lists the press profiles /preview/proof can simulate
+// and the rendering intents it takes.
+func (h *ConversionHandler) HandleProofProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles, err := converters.ICCProfiles(h.Config.Proofs.ProfilesDir)
+	if err != nil {
+		log.Printf("[%s] Listing ICC profiles failed: %v", requestID(r), err)
+		profiles = nil
+	}
+	if profiles == nil {
+		profiles = []converters.ICCProfile{}
+	}
+	intents := make([]string, 0, len(converters.RenderingIntents))
+	for intent := range converters.RenderingIntents {
+		intents = append(intents, intent)
+	}
+	sort.Strings(intents)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"profiles": profiles,
+		"intents":  intents,
+	})
+}
+
+// HandleProof renders soft proofs of a PDF's pages: each page as it would
+// print on the press a CMYK profile describes (profile, see GET
+// /preview/profiles; e.g. coated FOGRA or newsprint), shown in sRGB, so
+// print customers can approve color before production. Options: pages
+// ("1,3-5", default 1), dpi (default 150), intent (relative by default;
+// absolute also simulates the paper white) and format (png or jpeg). One
+// page answers with the image itself, several with a zip; name_template
+// (see nameTemplate) names the images.
+func (h *ConversionHandler) HandleProof(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "preview.proof")
+	if !ok {
+		return
+	}
+
+	profiles, err := converters.ICCProfiles(h.Config.Proofs.ProfilesDir)
+	if err != nil {
+		log.Printf("[%s] Listing ICC profiles failed: %v", reqID, err)
+	}
+	name := strings.ToLower(r.FormValue("profile"))
+	var profile *converters.ICCProfile
+	for i := range profiles {
+		if profiles[i].Name == name {
+			profile = &profiles[i]
+		}
+	}
+	if profile == nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "profile must name one of the press profiles (see GET /preview/profiles)", http.StatusBadRequest)
+		return
+	}
+
+	intent := strings.ToLower(r.FormValue("intent"))
+	if intent == "" {
+		intent = "relative"
+	}
+	if _, ok := converters.RenderingIntents[intent]; !ok {
+		os.RemoveAll(tempDir)
+		http.Error(w, "intent must be perceptual, relative, saturation or absolute", http.StatusBadRequest)
+		return
+	}
+	format := r.FormValue("format")
+	switch format {
+	case "":
+		format = "png"
+	case "jpg":
+		format = "jpeg"
+	}
+	contentType, known := thumbnailTypes[format]
+	if !known || format == "webp" {
+		os.RemoveAll(tempDir)
+		http.Error(w, "format must be png or jpeg", http.StatusBadRequest)
+		return
+	}
+	dpi := 150
+	if v := r.FormValue("dpi"); v != "" {
+		if dpi, err = strconv.Atoi(v); err != nil || dpi < 36 || dpi > 600 {
+			os.RemoveAll(tempDir)
+			http.Error(w, "dpi must be between 36 and 600", http.StatusBadRequest)
+			return
+		}
+	}
+
+	naming, err := formNameTemplate(r, "basename", "index", "page", "ext")
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	basename := uploadBasename(inputPath)
+
+	pageCount, err := converters.PageCount(inputPath)
+	if err != nil {
+		log.Printf("[%s] Proof page count failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Invalid PDF", http.StatusBadRequest)
+		return
+	}
+	spec := r.FormValue("pages")
+	if spec == "" {
+		spec = "1"
+	}
+	pages, err := converters.ParsePageRanges(spec, pageCount)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(pages) > maxProofPages {
+		os.RemoveAll(tempDir)
+		http.Error(w, fmt.Sprintf("At most %d pages per proof", maxProofPages), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[%s] Proofing %d pages through %s (%s)", reqID, len(pages), profile.Name, intent)
+	var images []string
+	var vars []nameVars
+	seen := map[int]bool{}
+	for _, page := range pages {
+		if seen[page] {
+			continue
+		}
+		seen[page] = true
+		prefix := filepath.Join(tempDir, fmt.Sprintf("proof-%d", page))
+		image, err := converters.SoftProof(inputPath, prefix, page, dpi, profile.Path, h.Config.Proofs.ScreenProfile, intent, format)
+		if err != nil {
+			log.Printf("[%s] Proof of page %d failed: %v", reqID, page, err)
+			os.RemoveAll(tempDir)
+			http.Error(w, "Proof rendering failed", http.StatusInternalServerError)
+			return
+		}
+		images = append(images, image)
+		vars = append(vars, nameVars{Basename: basename, Index: len(images), Page: page, Last: page})
+	}
+	if images, ok = applyNameTemplate(w, naming, images, vars, tempDir); !ok {
+		return
+	}
+
+	w.Header().Set("X-Proof-Profile", profile.Name)
+	if len(images) == 1 {
+		w.Header().Set("Content-Type", contentType)
+		h.serveAndCleanup(w, r, images[0], tempDir)
+		return
+	}
+	zipPath := filepath.Join(tempDir, "proofs.zip")
+	if err := utils.ZipFiles(zipPath, images); err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "Zipping failed", http.StatusInternalServerError)
+		return
+	}
+	h.serveAndCleanup(w, r, zipPath, tempDir)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akila/document-converter/config"
+	"github.com/akila/document-converter/jobs"
+	"github.com/akila/document-converter/models"
+	"github.com/akila/document-converter/workers"
+)
+
+func TestSimpleActionQueueFull(t *testing.T) {
+	// A pool without workers whose normal queue is already full
+	pool := workers.NewWorkerPool(1, func(models.Job) {})
+	for len(pool.JobQueue) < cap(pool.JobQueue) {
+		pool.Enqueue(models.Job{ID: "filler"})
+	}
+
+	jobsMgr, err := jobs.NewManager(t.TempDir(), "test", time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &ConversionHandler{
+		EngineManager: &workers.EngineManager{LibreOfficePool: pool},
+		Config:        &config.Config{QueueWait: 10 * time.Millisecond},
+		Jobs:          jobsMgr,
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"file_base64": base64.StdEncoding.EncodeToString([]byte("not really a document")),
+		"filename":    "report.docx",
+		"to":          "pdf",
+	})
+	r := httptest.NewRequest(http.MethodPost, "/simple/convert", strings.NewReader(string(body)))
+	r.SetPathValue("action", "convert")
+	w := httptest.NewRecorder()
+	h.HandleSimpleAction(w, r)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503; body %s", w.Code, w.Body)
+	}
+	for header, want := range map[string]string{
+		"X-Error-Code":     "queue_full",
+		"X-Queue-Depth":    "100",
+		"X-Queue-Capacity": "200",
+		"Retry-After":      "1",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	var view jobResponse
+	if err := json.NewDecoder(w.Body).Decode(&view); err != nil {
+		t.Fatal(err)
+	}
+	if view.Status != jobs.StatusFailed || !strings.Contains(view.Error, "queue_full") {
+		t.Errorf("job = %s %q, want failed with a queue_full error", view.Status, view.Error)
+	}
+}
+
+func TestBackgroundPipelineWaitsForRoom(t *testing.T) {
+	pool := workers.NewWorkerPool(1, func(job models.Job) {
+		if job.ResultChan != nil {
+			job.ResultChan <- models.JobResult{Success: true, Path: job.InputPath + ".pdf"}
+		}
+	})
+	for len(pool.JobQueue) < cap(pool.JobQueue) {
+		pool.Enqueue(models.Job{ID: "filler"})
+	}
+	h := &ConversionHandler{
+		EngineManager: &workers.EngineManager{LibreOfficePool: pool},
+		Config:        &config.Config{QueueWait: 10 * time.Millisecond},
+	}
+	steps, _ := parsePipeline("convert:pdf")
+	dir := t.TempDir()
+
+	if _, err := h.runPipeline("req", dir, "report.docx", steps); !errors.Is(err, workers.ErrQueueFull) {
+		t.Fatalf("runPipeline on a full queue = %v, want queue full", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := h.runPipelineQueued("req", dir, "report.docx", steps)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("runPipelineQueued returned %v while the queue was full", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	// Workers drain the queue; the step gets in on its next try
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool.Start(ctx)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("runPipelineQueued = %v, want success", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("runPipelineQueued still waiting after the queue drained")
+	}
+}
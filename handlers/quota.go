@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/akila/document-converter/auth"
+)
+
+// enforceQuota counts the request against its caller's limits, adding the
+// remaining allowance as response headers and refusing it with 429 once
+// the limits (plus any soft-mode overage) are used up. The bytes of the
+// body count against the daily byte quota as the handler reads them.
+func (h *ConversionHandler) enforceQuota(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity := "ip:" + r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			identity = "ip:" + host
+		}
+		if client := auth.FromContext(r.Context()); client != nil {
+			identity = client.Quota
+		}
+
+		d := h.Quotas.Count(identity, r.ContentLength)
+		for k, v := range d.Headers {
+			w.Header().Set(k, v)
+		}
+		if !d.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(d.RetryAfter.Seconds())+1))
+			w.Header().Set("X-Error-Code", "quota_exceeded")
+			http.Error(w, "Quota exceeded", http.StatusTooManyRequests)
+			return
+		}
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		defer func() { h.Quotas.AddBytes(identity, body.n) }()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/akila/document-converter/converters"
+)
+
+// HandleRedact removes text matching patterns from a PDF. Patterns come from
+// any mix of:
+//   - pattern: a regular expression (repeatable), or patterns: a JSON array
+//   - term: literal text, matched case-insensitively (repeatable)
+//   - presets: comma separated names from converters.RedactionPresets
+func (h *ConversionHandler) HandleRedact(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "redact")
+	if !ok {
+		return
+	}
+
+	patterns, err := redactionPatterns(r)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dpi, _ := strconv.Atoi(r.FormValue("dpi"))
+	if dpi < 0 || dpi > 600 {
+		os.RemoveAll(tempDir)
+		http.Error(w, "dpi must be between 1 and 600", http.StatusBadRequest)
+		return
+	}
+
+	areas, err := converters.FindRedactions(inputPath, patterns)
+	if err != nil {
+		log.Printf("[%s] Redaction search failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Redaction failed", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[%s] Redacting %d area(s)", reqID, len(areas))
+
+	outputPath := filepath.Join(tempDir, "redacted.pdf")
+	if err := converters.RedactPDF(inputPath, outputPath, areas, dpi); err != nil {
+		log.Printf("[%s] Redaction failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Redaction failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Redaction-Count", strconv.Itoa(len(areas)))
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
+
+func redactionPatterns(r *http.Request) ([]*regexp.Regexp, error) {
+	var sources []string
+	sources = append(sources, r.MultipartForm.Value["pattern"]...)
+	if raw := r.FormValue("patterns"); raw != "" {
+		var list []string
+		if err := json.Unmarshal([]byte(raw), &list); err != nil {
+			return nil, fmt.Errorf("patterns must be a JSON array of regular expressions")
+		}
+		sources = append(sources, list...)
+	}
+	for _, term := range r.MultipartForm.Value["term"] {
+		if term = strings.TrimSpace(term); term != "" {
+			sources = append(sources, "(?i)"+regexp.QuoteMeta(term))
+		}
+	}
+	for _, name := range strings.Split(r.FormValue("presets"), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		preset, ok := converters.RedactionPresets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset %q", name)
+		}
+		sources = append(sources, preset)
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("provide at least one pattern, term or preset")
+	}
+
+	patterns := make([]*regexp.Regexp, 0, len(sources))
+	for _, src := range sources {
+		re, err := regexp.Compile(src)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", src, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
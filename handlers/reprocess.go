@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/akila/document-converter/jobs"
+)
+
+// Reprocess limits: parallel artifacts per run, and failures kept in a
+// run's report.
+const (
+	reprocessMaxConcurrency = 8
+	reprocessMaxFailures    = 100
+)
+
+// reprocessRun is a batch re-run of a pipeline over stored job results.
+// Runs are kept in memory; a restart stops them, and starting the same run
+// again redoes every matching result.
+type reprocessRun struct {
+	ID          string      `json:"id"`
+	Pipeline    string      `json:"pipeline"`
+	Filter      jobs.Filter `json:"filter"`
+	Concurrency int         `json:"concurrency"`
+	// Rate caps the results started per minute; 0 is no limit.
+	Rate       int                `json:"rate,omitempty"`
+	Status     string             `json:"status"` // running, finished or cancelled
+	Total      int                `json:"total"`
+	Processed  int                `json:"processed"`
+	Failed     int                `json:"failed"`
+	Failures   []reprocessFailure `json:"failures,omitempty"`
+	StartedAt  time.Time          `json:"started_at"`
+	FinishedAt time.Time          `json:"finished_at,omitempty"`
+
+	cancel chan struct{}
+}
+
+type reprocessFailure struct {
+	JobID string `json:"job_id"`
+	Error string `json:"error"`
+}
+
+type reprocessRuns struct {
+	mu   sync.Mutex
+	runs map[string]*reprocessRun
+}
+
+func (p *reprocessRuns) add(run *reprocessRun) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.runs == nil {
+		p.runs = map[string]*reprocessRun{}
+	}
+	p.runs[run.ID] = run
+}
+
+// view returns a snapshot of a run.
+func (p *reprocessRuns) view(id string) (reprocessRun, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	run, ok := p.runs[id]
+	if !ok {
+		return reprocessRun{}, false
+	}
+	snapshot := *run
+	snapshot.Failures = append([]reprocessFailure(nil), run.Failures...)
+	return snapshot, true
+}
+
+func (p *reprocessRuns) update(run *reprocessRun, change func(*reprocessRun)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	change(run)
+}
+
+// HandleReprocessStart re-runs a pipeline (as for /pipeline, e.g.
+// "convert:pdf,pdfa") over every stored job result matching tenant,
+// created_after and created_before (RFC 3339 times or dates) and
+// source_format, the input's format. Each result is replaced by the
+// pipeline's output. concurrency (1-8, default 1) results are processed at
+// a time, and rate, when set, caps how many start per minute, to leave
+// capacity for live traffic. Answers 202 with the run, whose progress
+// GET /admin/reprocess/{id} reports. Runs cross tenants, so only admins
+// may start, list or cancel them (see requireAdmin).
+func (h *ConversionHandler) HandleReprocessStart(w http.ResponseWriter, r *http.Request) {
+	spec := r.FormValue("pipeline")
+	steps, err := parsePipeline(spec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if op, ok := h.pipelineAllowed(steps); !ok {
+		http.Error(w, fmt.Sprintf("operation %q is disabled in this deployment", op), http.StatusForbidden)
+		return
+	}
+
+	filter := jobs.Filter{Tenant: r.FormValue("tenant"), SourceFormat: r.FormValue("source_format")}
+	for _, bound := range []struct {
+		name string
+		to   *time.Time
+	}{{"created_after", &filter.CreatedAfter}, {"created_before", &filter.CreatedBefore}} {
+		v := r.FormValue(bound.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", v); err != nil {
+				http.Error(w, bound.name+" must be an RFC 3339 time or a date (YYYY-MM-DD)", http.StatusBadRequest)
+				return
+			}
+		}
+		*bound.to = t
+	}
+
+	concurrency, rate := 1, 0
+	if v := r.FormValue("concurrency"); v != "" {
+		if concurrency, err = strconv.Atoi(v); err != nil || concurrency < 1 || concurrency > reprocessMaxConcurrency {
+			http.Error(w, fmt.Sprintf("concurrency must be between 1 and %d", reprocessMaxConcurrency), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.FormValue("rate"); v != "" {
+		if rate, err = strconv.Atoi(v); err != nil || rate < 0 {
+			http.Error(w, "rate must be a number of results per minute", http.StatusBadRequest)
+			return
+		}
+	}
+
+	matched := h.Jobs.Find(filter)
+	run := &reprocessRun{
+		ID:          requestID(r),
+		Pipeline:    spec,
+		Filter:      filter,
+		Concurrency: concurrency,
+		Rate:        rate,
+		Status:      "running",
+		Total:       len(matched),
+		StartedAt:   time.Now().UTC(),
+		cancel:      make(chan struct{}),
+	}
+	h.reprocess.add(run)
+	log.Printf("[%s] Reprocessing %d result(s) with %s", run.ID, len(matched), spec)
+	go h.reprocessResults(run, matched, steps)
+
+	view, _ := h.reprocess.view(run.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(view)
+}
+
+// reprocessResults works through a run's results, throttled by its
+// concurrency and rate, until done or cancelled.
+func (h *ConversionHandler) reprocessResults(run *reprocessRun, matched []jobs.Job, steps []pipelineStep) {
+	var tick <-chan time.Time
+	if run.Rate > 0 {
+		ticker := time.NewTicker(time.Minute / time.Duration(run.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	slots := make(chan struct{}, run.Concurrency)
+	var wg sync.WaitGroup
+	cancelled := false
+	for i, job := range matched {
+		if i > 0 && tick != nil {
+			select {
+			case <-tick:
+			case <-run.cancel:
+				cancelled = true
+			}
+		}
+		if !cancelled {
+			select {
+			case slots <- struct{}{}:
+			case <-run.cancel:
+				cancelled = true
+			}
+		}
+		if cancelled {
+			break
+		}
+
+		wg.Add(1)
+		go func(job jobs.Job) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			_, err := h.Jobs.Reprocess(job.ID, run.Pipeline, func(inputPath, workDir string) (string, error) {
+				return h.runPipelineQueued(run.ID, workDir, inputPath, steps)
+			})
+			if err != nil {
+				log.Printf("[%s] Reprocessing job %s failed: %v", run.ID, job.ID, err)
+			}
+			h.reprocess.update(run, func(run *reprocessRun) {
+				run.Processed++
+				if err != nil {
+					run.Failed++
+					if len(run.Failures) < reprocessMaxFailures {
+						run.Failures = append(run.Failures, reprocessFailure{JobID: job.ID, Error: err.Error()})
+					}
+				}
+			})
+		}(job)
+	}
+	wg.Wait()
+
+	h.reprocess.update(run, func(run *reprocessRun) {
+		run.FinishedAt = time.Now().UTC()
+		if run.Status == "running" {
+			run.Status = "finished"
+		}
+	})
+	view, _ := h.reprocess.view(run.ID)
+	log.Printf("[%s] Reprocessing %s: %d of %d result(s), %d failed", run.ID, view.Status, view.Processed, view.Total, view.Failed)
+}
+
+// HandleReprocessList lists reprocessing runs, newest first.
+func (h *ConversionHandler) HandleReprocessList(w http.ResponseWriter, r *http.Request) {
+	h.reprocess.mu.Lock()
+	ids := make([]string, 0, len(h.reprocess.runs))
+	for id := range h.reprocess.runs {
+		ids = append(ids, id)
+	}
+	h.reprocess.mu.Unlock()
+
+	runs := make([]reprocessRun, 0, len(ids))
+	for _, id := range ids {
+		if run, ok := h.reprocess.view(id); ok {
+			runs = append(runs, run)
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].StartedAt.After(runs[j].StartedAt) })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"runs": runs})
+}
+
+// HandleReprocessStatus reports a run's progress.
+func (h *ConversionHandler) HandleReprocessStatus(w http.ResponseWriter, r *http.Request) {
+	run, ok := h.reprocess.view(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Run not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// HandleReprocessCancel stops a run from starting more results; those under
+// way finish.
+func (h *ConversionHandler) HandleReprocessCancel(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	h.reprocess.mu.Lock()
+	run, ok := h.reprocess.runs[id]
+	if ok && run.Status == "running" {
+		run.Status = "cancelled"
+		close(run.cancel)
+	}
+	h.reprocess.mu.Unlock()
+	if !ok {
+		http.Error(w, "Run not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("[%s] Reprocessing cancelled", id)
+	view, _ := h.reprocess.view(id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
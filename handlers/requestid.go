@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+type requestIDKey struct{}
+
+// maxRequestIDLength bounds the X-Request-ID a client may set.
+const maxRequestIDLength = 128
+
+// activeRequestIDs are the IDs of requests in progress, so a client reusing
+// its X-Request-ID concurrently (a retry, say) doesn't share a temp
+// directory with the first request.
+var activeRequestIDs sync.Map
+
+// withRequestID gives every API request an ID: the caller's X-Request-ID
+// when it sets a usable one, else a fresh UUID. It is echoed as
+// X-Request-ID and X-Job-ID. The same ID prefixes the request's log lines
+// and error pages, names its temp directory and engine jobs, and optionally
+// tags result filenames, so a complaint about a download can be traced
+// back to its logs, and a request through to the caller's own.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := uuid.New().String()
+		incoming := r.Header.Get("X-Request-ID")
+		if validRequestID(incoming) && claimRequestID(incoming) {
+			id = incoming
+			defer activeRequestIDs.Delete(id)
+		}
+		w.Header().Set("X-Request-ID", id)
+		w.Header().Set("X-Job-ID", id)
+		if incoming != "" && incoming != id {
+			log.Printf("[%s] X-Request-ID %q is invalid or in use, replaced", id, incoming)
+		}
+		log.Printf("[%s] %s %s from %s", id, r.Method, r.URL.Path, r.RemoteAddr)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+		if wantsHTML(r) {
+			// Browser users get readable error pages
+			hw := &htmlErrorWriter{ResponseWriter: w, reqID: id}
+			defer hw.finish()
+			w = hw
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validRequestID accepts IDs that are safe in file names and log lines:
+// letters, digits, '-', '_' and '.', not starting with a '.'.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength || id[0] == '.' {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// claimRequestID takes a caller's ID for a request, unless a request with it
+// is in progress or the temp directory of an earlier one (such as a queued
+// job's) remains.
+func claimRequestID(id string) bool {
+	if _, err := os.Stat(filepath.Join("tmp", id)); !os.IsNotExist(err) {
+		return false
+	}
+	_, busy := activeRequestIDs.LoadOrStore(id, true)
+	return !busy
+}
+
+// requestID returns the ID assigned by withRequestID, or a fresh one for
+// requests that did not pass through it.
+func requestID(r *http.Request) string {
+	if id, ok := r.Context().Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return uuid.New().String()
+}
+
+// resultFilename is the download name for a result, tagged with id when the
+// deployment asks for it: "merged.pdf" becomes "merged-<id>.pdf".
+func (h *ConversionHandler) resultFilename(name, id string) string {
+	if !h.Config.TagResultFilenames || id == "" {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-" + id + ext
+}
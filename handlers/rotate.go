@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/akila/document-converter/converters"
+)
+
+// pageRotations reads the page selection of a rotation: pages ("2,4-6")
+// turned by angle, and/or rotations, a JSON array of per-range angles such
+// as [{"pages":"1-3","angle":90},{"pages":"7","angle":180}].
+func pageRotations(inputPath string, angle int, pagesSpec, rotationsSpec string) ([]converters.PageRotation, error) {
+	pageCount, err := converters.PageCount(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid PDF")
+	}
+
+	type spec struct {
+		Pages string `json:"pages"`
+		Angle int    `json:"angle"`
+	}
+	var specs []spec
+	if pagesSpec != "" {
+		specs = append(specs, spec{pagesSpec, angle})
+	}
+	if rotationsSpec != "" {
+		var list []spec
+		if err := json.Unmarshal([]byte(rotationsSpec), &list); err != nil {
+			return nil, fmt.Errorf("rotations must be a JSON array of {\"pages\", \"angle\"} objects")
+		}
+		specs = append(specs, list...)
+	}
+
+	var rotations []converters.PageRotation
+	for _, s := range specs {
+		if s.Angle%90 != 0 || s.Angle == 0 {
+			return nil, fmt.Errorf("angle must be a non-zero multiple of 90, got %d", s.Angle)
+		}
+		pages, err := converters.ParsePageRanges(s.Pages, pageCount)
+		if err != nil {
+			return nil, fmt.Errorf("pages %q: %v", s.Pages, err)
+		}
+		rotations = append(rotations, converters.PageRotation{Pages: pages, Angle: s.Angle})
+	}
+	return rotations, nil
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/akila/document-converter/auth"
+)
+
+// Route is one API endpoint. Operation names the capability it exposes so
+// deployments can switch it off by policy; several routes may share one.
+type Route struct {
+	Pattern   string
+	Operation string
+	Handler   http.HandlerFunc
+}
+
+// Scope is what an authenticated caller needs to use the route:
+// "<operation>:read" for GET routes and "<operation>:write" for the rest,
+// e.g. "jobs:read" or "merge:write".
+func (r Route) Scope() string {
+	if strings.HasPrefix(r.Pattern, "GET ") {
+		return r.Operation + ":read"
+	}
+	return r.Operation + ":write"
+}
+
+// Routes is the API route table.
+func (h *ConversionHandler) Routes() []Route {
+	return []Route{
+		{"/convert", "convert", h.HandleConvert},
+		{"/convert/url", "convert.url", h.HandleConvertURL},
+		{"/convert/html", "convert.html", h.HandleConvertHTML},
+		{"/convert/batch", "convert", h.HandleConvertBatch},
+		{"/merge", "merge", h.HandleMerge},
+		{"/toc", "toc", h.HandleTOC},
+		{"/split", "split", h.HandleSplit},
+		{"/compress", "compress", h.HandleCompress},
+		{"/extract/text", "extract-text", h.HandleExtractText},
+		{"/extract/text/batch", "extract-text", h.HandleExtractTextBatch},
+		{"/extract/text/stream", "extract-text", h.HandleExtractTextStream},
+		{"/extract/images", "extract-images", h.HandleExtractImages},
+		{"/extract/tables", "extract-tables", h.HandleExtractTables},
+		{"/thumbnail", "thumbnail", h.HandleThumbnail},
+		{"POST /preview/proof", "preview.proof", h.HandleProof},
+		{"GET /preview/profiles", "preview.proof", h.HandleProofProfiles},
+		{"/rotate", "rotate", h.HandleRotate},
+		{"/reorder", "reorder", h.HandleReorder},
+		{"/pages/remove-blank", "remove-blank", h.HandleRemoveBlankPages},
+		{"/booklet", "booklet", h.HandleBooklet},
+		{"/stamp/header-footer", "stamp", h.HandleStampHeaderFooter},
+		{"/stamp/text", "stamp", h.HandleStampText},
+		{"/flatten", "flatten", h.HandleFlatten},
+		{"/forms/fill", "forms.fill", h.HandleFormsFill},
+		{"/forms/extract", "forms.extract", h.HandleFormsExtract},
+		{"/bookmarks/extract", "bookmarks.extract", h.HandleBookmarksExtract},
+		{"/bookmarks/set", "bookmarks.set", h.HandleBookmarksSet},
+		{"/annotations/extract", "annotations.extract", h.HandleAnnotationsExtract},
+		{"/annotations/remove", "annotations.remove", h.HandleAnnotationsRemove},
+		{"/attachments/add", "attachments.add", h.HandleAttachmentsAdd},
+		{"/attachments/extract", "attachments.extract", h.HandleAttachmentsExtract},
+		{"/redact", "redact", h.HandleRedact},
+		{"/excerpt", "excerpt", h.HandleExcerpt},
+		{"/sign/placeholders", "sign.placeholders", h.HandleSignaturePlaceholders},
+		{"/estimate", "estimate", h.HandleEstimate},
+		{"GET /limits", "limits", h.HandleLimits},
+		{"GET /formats", "formats", h.HandleFormats},
+		{"/compare", "compare", h.HandleCompare},
+		{"/compare/template", "compare", h.HandleCompareTemplate},
+		{"/interleave", "interleave", h.HandleInterleave},
+		{"/uploads/presign", "uploads", h.HandleUploadPresign},
+		{"POST " + TusPath, "uploads", h.HandleTusCreate},
+		{"HEAD " + TusPath + "/{id}", "uploads", h.HandleTusHead},
+		{"PATCH " + TusPath + "/{id}", "uploads", h.HandleTusPatch},
+		{"DELETE " + TusPath + "/{id}", "uploads", h.HandleTusDelete},
+		{"GET /storage/{path...}", "storage", h.HandleStorageGet},
+		{"PUT /storage/{path...}", "storage", h.HandleStoragePut},
+		{"GET /templates", "templates", h.HandleTemplatesList},
+		{"GET /templates/{name}", "templates", h.HandleTemplateGet},
+		{"POST /templates/{name}", "templates", h.HandleTemplateUpload},
+		{"POST /templates/{name}/settings", "templates", h.HandleTemplateSettings},
+		{"POST /templates/{name}/reference", "templates", h.HandleTemplateReference},
+		{"DELETE /templates/{name}", "templates", h.HandleTemplateDelete},
+		{"POST /templates/{name}/preview", "templates", h.HandleTemplatePreview},
+		{"/generate", "generate", h.HandleGenerate},
+		{"GET /numbering/{sequence}", "numbering", h.HandleNumberingGet},
+		{"POST /numbering/{sequence}", "numbering", h.HandleNumberingSet},
+		{"POST /numbering/{sequence}/next", "numbering", h.HandleNumberingNext},
+		{"GET /jobs/{id}", "jobs", h.HandleJobStatus},
+		{"GET /jobs/{id}/result", "jobs", h.HandleJobResult},
+		{"GET /jobs/{id}/events", "jobs", h.HandleJobEvents},
+		{"GET /download/{token}", "download", h.HandleDownload},
+		{"POST /simple/{action}", "simple", h.HandleSimpleAction},
+		{"GET /simple/openapi.json", "simple", h.HandleSimpleOpenAPI},
+		{"GET /openapi.json", "docs", h.HandleOpenAPI},
+		{"GET /docs", "docs", h.HandleDocs},
+		{"/integrations/slack/command", "integrations.slack", h.HandleSlackCommand},
+		{"/integrations/teams/messages", "integrations.teams", h.HandleTeamsMessage},
+		{"/ingest/webhook", "ingest.webhook", h.HandleIngestWebhook},
+		{"/admin/engines/compare", "admin.engines.compare", h.HandleCompareEngines},
+		{"GET /admin/maintenance", "admin.maintenance", h.HandleMaintenanceStatus},
+		{"POST /admin/maintenance", "admin.maintenance", h.HandleMaintenanceSet},
+		{"GET /admin/reprocess", "admin.reprocess", h.HandleReprocessList},
+		{"POST /admin/reprocess", "admin.reprocess", h.HandleReprocessStart},
+		{"GET /admin/reprocess/{id}", "admin.reprocess", h.HandleReprocessStatus},
+		{"DELETE /admin/reprocess/{id}", "admin.reprocess", h.HandleReprocessCancel},
+	}
+}
+
+// selfAuthenticated operations verify their callers themselves (platform
+// signatures, tokens), or are public like the API docs, and skip API
+// authentication.
+var selfAuthenticated = map[string]bool{
+	"integrations.slack": true,
+	"integrations.teams": true,
+	"ingest.webhook":     true,
+	"storage":            true,
+	"download":           true,
+	"docs":               true,
+}
+
+// Register mounts every route on mux behind request IDs, latency metrics,
+// maintenance mode, JSON API mode, authentication, quotas, the admin guard,
+// auditing and the operation policy.
+func (h *ConversionHandler) Register(mux *http.ServeMux) {
+	for _, route := range h.Routes() {
+		handler := h.audit(route.Operation, h.enforcePolicy(route.Operation, route.Handler))
+		if adminOperation(route.Operation) {
+			handler = h.requireAdmin(route.Scope(), handler)
+		}
+		if !selfAuthenticated[route.Operation] {
+			if h.Quotas != nil {
+				handler = h.enforceQuota(handler)
+			}
+			if h.Auth != nil {
+				handler = h.Auth.Middleware(route.Scope(), h.signedBodyLimit(route), handler)
+			}
+		}
+		if takesUploads(route) {
+			handler = withJSONResults(handler)
+		}
+		handler = withOperation(route.Operation, handler)
+		mux.Handle(route.Pattern, withRequestID(observe(route.Operation, h.checkMaintenance(route, handler))))
+	}
+}
+
+// adminOperation reports whether operation belongs to the admin API
+// (maintenance mode, reprocessing, engine comparisons).
+func adminOperation(operation string) bool {
+	return strings.HasPrefix(operation, "admin.")
+}
+
+// requireAdmin guards an admin route needing scope. The admin API is only
+// served with authentication on, to clients granted scope by an admin
+// scope such as "admin.*" or "admin.maintenance:write": unrestricted
+// clients and catch-alls like "*" don't reach it.
+func (h *ConversionHandler) requireAdmin(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.Auth == nil {
+			w.Header().Set("X-Error-Code", "admin_disabled")
+			http.Error(w, "The admin API needs authentication to be configured", http.StatusForbidden)
+			return
+		}
+		if client := auth.FromContext(r.Context()); !adminGranted(client, scope) {
+			log.Printf("[%s] Client %s lacks an admin scope for %s %s", requestID(r), client.ID, r.Method, r.URL.Path)
+			w.Header().Set("X-Error-Code", "insufficient_scope")
+			http.Error(w, fmt.Sprintf("Missing admin scope %q", scope), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminGranted reports whether one of client's admin scopes grants scope.
+func adminGranted(client *auth.Client, scope string) bool {
+	for _, granted := range client.Scopes {
+		if !strings.HasPrefix(granted, "admin") {
+			continue
+		}
+		if ok, _ := path.Match(granted, scope); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// OperationAllowed applies the deployment's allow/deny policy. Entries may
+// be globs such as "integrations.*"; deny wins over allow, and a non-empty
+// allow list permits only what it names.
+func (h *ConversionHandler) OperationAllowed(operation string) bool {
+	policy := h.Config.Policy
+	for _, pattern := range policy.Deny {
+		if ok, _ := path.Match(pattern, operation); ok {
+			return false
+		}
+	}
+	if len(policy.Allow) == 0 {
+		return true
+	}
+	for _, pattern := range policy.Allow {
+		if ok, _ := path.Match(pattern, operation); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *ConversionHandler) enforcePolicy(operation string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.OperationAllowed(operation) {
+			policyDenied(w, operation)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// policyDenied answers 403 with a machine-readable error code.
+func policyDenied(w http.ResponseWriter, operation string) {
+	w.Header().Set("X-Error-Code", "operation_disabled")
+	http.Error(w, fmt.Sprintf("Operation %q is disabled in this deployment", operation), http.StatusForbidden)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/models"
+	"github.com/akila/document-converter/rules"
+	"github.com/akila/document-converter/workers"
+)
+
+// Keyword rules read at most this much text.
+const (
+	rulesTextPages = 20
+	rulesTextBytes = 1024 * 1024
+)
+
+// rejectedError is returned when a routing rule refuses an input.
+type rejectedError struct {
+	rule, message string
+}
+
+func (e *rejectedError) Error() string {
+	return e.message
+}
+
+// routeJob applies the routing rules to job, which would otherwise run on
+// pool. It returns the pool to use, or a *rejectedError.
+func (h *ConversionHandler) routeJob(job *models.Job, pool *workers.WorkerPool) (*workers.WorkerPool, error) {
+	if h.Rules == nil {
+		return pool, nil
+	}
+	facts := inputFacts(job.InputPath, job.TempDir)
+	rule := h.Rules.Evaluate(facts)
+	if rule == nil {
+		return pool, nil
+	}
+	log.Printf("[%s] Routing rule %q matched (%s, %d bytes)", job.ID, rule.Name, facts.Format, facts.Size)
+
+	if rule.Action.Reject != "" {
+		return nil, &rejectedError{rule: rule.Name, message: rule.Action.Reject}
+	}
+	if rule.Action.Engine != "" {
+		forced := h.EngineManager.Pool(rule.Action.Engine)
+		if forced == nil {
+			return nil, fmt.Errorf("rule %q selects engine %q, which is not running", rule.Name, rule.Action.Engine)
+		}
+		pool = forced
+	}
+	if rule.Action.Queue == "low" {
+		job.LowPriority = true
+	}
+	if rule.Action.Preset != "" {
+		if job.Options == nil {
+			job.Options = map[string]interface{}{}
+		}
+		job.Options["preset"] = rule.Action.Preset
+	}
+	return pool, nil
+}
+
+// inputFacts describes a file for rule matching. Text is extracted into
+// scratchDir when a keyword rule asks for it.
+func inputFacts(path, scratchDir string) rules.Facts {
+	facts := rules.Facts{Format: converters.DetectFormat(path)}
+	if info, err := os.Stat(path); err == nil {
+		facts.Size = info.Size()
+	}
+	switch facts.Format {
+	case "pdf":
+		facts.Pages = func() (int, error) { return converters.PageCount(path) }
+		facts.Text = func() (string, error) {
+			out := filepath.Join(scratchDir, "rules-text.txt")
+			defer os.Remove(out)
+			pages, err := converters.PageCount(path)
+			if err != nil {
+				return "", err
+			}
+			if err := converters.ExtractTextRange(path, out, 1, min(pages, rulesTextPages)); err != nil {
+				return "", err
+			}
+			return readPrefix(out, rulesTextBytes)
+		}
+	case "txt", "md", "markdown", "html", "htm", "csv":
+		facts.Text = func() (string, error) { return readPrefix(path, rulesTextBytes) }
+	}
+	return facts
+}
+
+func readPrefix(path string, n int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, n))
+	return string(data), err
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/akila/document-converter/converters"
+)
+
+// placeholderSpec is a requested signature placeholder: a field at page, x
+// and y, or at an anchor, x and y then shifting it.
+type placeholderSpec struct {
+	converters.SignatureField
+	Anchor *converters.Anchor `json:"anchor"`
+}
+
+var fieldName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// HandleSignaturePlaceholders adds empty signature, initials, name and date
+// fields to a PDF, ready to hand to an e-signature provider. "fields" (a
+// form value or a JSON file part) is a JSON array of
+//
+//	{"name": "buyer_sign", "type": "signature", "page": 2, "x": 72, "y": 90}
+//	{"name": "buyer_date", "type": "date", "anchor": "{{date_here}}"}
+//
+// with optional width, height and required. The anchor may also be an
+// object choosing the occurrence and the position relative to the text (see
+// converters.Anchor). Anchored fields are placed on every selected
+// occurrence of their marker text, numbered buyer_date, buyer_date_2, ...;
+// an anchor that isn't found is an error. Markers stay visible unless
+// written in white, as e-signature providers expect.
+func (h *ConversionHandler) HandleSignaturePlaceholders(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "sign.placeholders")
+	if !ok {
+		return
+	}
+
+	raw := []byte(r.FormValue("fields"))
+	if len(raw) == 0 {
+		if f, _, err := r.FormFile("fields"); err == nil {
+			raw, _ = io.ReadAll(f)
+			f.Close()
+		}
+	}
+	var specs []placeholderSpec
+	if err := json.Unmarshal(raw, &specs); err != nil || len(specs) == 0 {
+		os.RemoveAll(tempDir)
+		http.Error(w, "fields must be a non-empty JSON array of fields", http.StatusBadRequest)
+		return
+	}
+
+	fields, err := placeSignatureFields(inputPath, specs)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("[%s] Adding %d signature placeholder(s)", reqID, len(fields))
+
+	outputPath := filepath.Join(tempDir, "placeholders.pdf")
+	if err := converters.AddSignatureFields(inputPath, outputPath, fields); err != nil {
+		log.Printf("[%s] Signature placeholders failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Adding signature fields failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Signature-Fields", strconv.Itoa(len(fields)))
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
+
+// placeSignatureFields validates the requested fields and resolves anchors
+// to positions.
+func placeSignatureFields(inputPath string, specs []placeholderSpec) ([]converters.SignatureField, error) {
+	pageCount, err := converters.PageCount(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("file is not a readable PDF")
+	}
+
+	var fields []converters.SignatureField
+	names := map[string]bool{}
+	anchors := newAnchorFinder(inputPath)
+	add := func(f converters.SignatureField) error {
+		if names[f.Name] {
+			return fmt.Errorf("field name %s is used twice", f.Name)
+		}
+		names[f.Name] = true
+		fields = append(fields, f)
+		return nil
+	}
+	for _, spec := range specs {
+		f := spec.SignatureField
+		if !fieldName.MatchString(f.Name) {
+			return nil, fmt.Errorf("field names are 1-64 letters, digits, '_' or '-': %q", f.Name)
+		}
+		if f.Type == "" {
+			f.Type = "signature"
+		}
+		if !converters.ValidSignatureFieldType(f.Type) {
+			return nil, fmt.Errorf("field %s: type must be signature, initials, name, date or text", f.Name)
+		}
+		if f.Width < 0 || f.Height < 0 {
+			return nil, fmt.Errorf("field %s: width and height must be positive", f.Name)
+		}
+
+		if spec.Anchor == nil {
+			if f.Page < 1 || f.Page > pageCount {
+				return nil, fmt.Errorf("field %s: page must be between 1 and %d", f.Name, pageCount)
+			}
+			if err := add(f); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		boxes, err := anchors.find(*spec.Anchor)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", f.Name, err)
+		}
+		width, height := f.Size()
+		for i, box := range boxes {
+			placed := f
+			placed.Page = box.Page
+			x, y := spec.Anchor.Place(box, width, height)
+			placed.X, placed.Y = x+f.X, y+f.Y
+			if i > 0 {
+				placed.Name = fmt.Sprintf("%s_%d", f.Name, i+1)
+			}
+			if err := add(placed); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return fields, nil
+}
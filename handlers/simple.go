@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/akila/document-converter/auth"
+	"github.com/akila/document-converter/jobs"
+)
+
+// The simple API is a flat JSON surface for no-code platforms (Zapier, Make):
+// one POST per action, the file as base64 or a URL, options as plain fields
+// and the result as a download URL.
+
+// simpleRequest holds every field any action accepts; each action documents
+// the ones it reads.
+type simpleRequest struct {
+	FileURL    string `json:"file_url"`
+	FileBase64 string `json:"file_base64"`
+	Filename   string `json:"filename"`
+	To         string `json:"to"`
+	Angle      int    `json:"angle"`
+	Level      string `json:"level"`
+}
+
+type simpleField struct {
+	Name        string
+	Type        string // OpenAPI type
+	Description string
+	Required    bool
+	Enum        []interface{}
+}
+
+type simpleAction struct {
+	OperationID string
+	Summary     string
+	Fields      []simpleField
+	// Pipeline builds the pipeline spec for the request.
+	Pipeline func(req simpleRequest) (string, error)
+}
+
+var simpleActions = map[string]simpleAction{
+	"convert": {
+		OperationID: "convertDocument",
+		Summary:     "Convert a document to another format",
+		Fields: []simpleField{
+			{Name: "to", Type: "string", Description: "Target format, e.g. pdf, docx, png", Required: true},
+		},
+		Pipeline: func(req simpleRequest) (string, error) {
+			if req.To == "" {
+				return "", fmt.Errorf("to is required")
+			}
+			return "convert:" + req.To, nil
+		},
+	},
+	"compress": {
+		OperationID: "compressPdf",
+		Summary:     "Compress a PDF",
+		Fields: []simpleField{
+			{Name: "level", Type: "string", Description: "Ghostscript preset, smallest output first (default screen)", Enum: []interface{}{"screen", "ebook", "printer", "prepress"}},
+		},
+		Pipeline: func(req simpleRequest) (string, error) {
+			if req.Level == "" {
+				return "compress", nil
+			}
+			if _, err := compressOptions(req.Level, ""); err != nil || strings.ContainsAny(req.Level, ",:") {
+				return "", fmt.Errorf("level must be screen, ebook, printer or prepress")
+			}
+			return "compress:" + req.Level, nil
+		},
+	},
+	"extract-text": {
+		OperationID: "extractPdfText",
+		Summary:     "Extract the text of a PDF",
+		Pipeline:    func(simpleRequest) (string, error) { return "extract-text", nil },
+	},
+	"rotate": {
+		OperationID: "rotatePdf",
+		Summary:     "Rotate every page of a PDF",
+		Fields: []simpleField{
+			{Name: "angle", Type: "integer", Description: "Clockwise rotation in degrees", Required: true, Enum: []interface{}{90, 180, 270}},
+		},
+		Pipeline: func(req simpleRequest) (string, error) {
+			if req.Angle%90 != 0 || req.Angle == 0 {
+				return "", fmt.Errorf("angle must be 90, 180 or 270")
+			}
+			return fmt.Sprintf("rotate:%d", req.Angle), nil
+		},
+	},
+	"flatten": {
+		OperationID: "flattenPdf",
+		Summary:     "Flatten form fields and annotations",
+		Pipeline:    func(simpleRequest) (string, error) { return "flatten", nil },
+	},
+	"pdfa": {
+		OperationID: "convertToPdfA",
+		Summary:     "Convert a PDF to PDF/A-2",
+		Pipeline:    func(simpleRequest) (string, error) { return "pdfa", nil },
+	},
+}
+
+// simpleWait is how long a request waits for its job before answering with
+// a status URL instead; no-code platforms time out around 30 seconds.
+const simpleWait = 25 * time.Second
+
+// HandleSimpleAction serves POST /simple/{action}.
+func (h *ConversionHandler) HandleSimpleAction(w http.ResponseWriter, r *http.Request) {
+	action, ok := simpleActions[r.PathValue("action")]
+	if !ok {
+		simpleError(w, http.StatusNotFound, "unknown action")
+		return
+	}
+
+	// maxBytes bounds decoded and downloaded input files
+	maxBytes := h.maxUpload(r, "simple")
+	var req simpleRequest
+	// base64 inflates by 4/3; leave room for the other fields
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes*4/3+64*1024)).Decode(&req); err != nil {
+		simpleError(w, http.StatusBadRequest, "body must be a JSON object")
+		return
+	}
+	req.To = strings.ToLower(strings.TrimSpace(req.To))
+
+	if (req.FileURL == "") == (req.FileBase64 == "") {
+		simpleError(w, http.StatusBadRequest, "provide exactly one of file_url or file_base64")
+		return
+	}
+	name := filepath.Base(filepath.Clean("/" + req.Filename))
+	if req.FileURL != "" {
+		u, err := url.Parse(req.FileURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			simpleError(w, http.StatusBadRequest, "file_url must be an absolute http or https URL")
+			return
+		}
+		if req.Filename == "" {
+			name = path.Base(u.Path)
+		}
+	}
+	if filepath.Ext(name) == "" {
+		simpleError(w, http.StatusBadRequest, "filename with an extension is required to tell the input format")
+		return
+	}
+	var data []byte
+	if req.FileBase64 != "" {
+		var err error
+		data, err = base64.StdEncoding.DecodeString(req.FileBase64)
+		if err != nil {
+			simpleError(w, http.StatusBadRequest, "file_base64 is not valid base64")
+			return
+		}
+	}
+
+	spec, err := action.Pipeline(req)
+	if err != nil {
+		simpleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	steps, err := parsePipeline(spec)
+	if err != nil {
+		simpleError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	disabled, ok := h.pipelineAllowed(steps)
+	if ok && req.FileURL != "" && !h.OperationAllowed("fetch-url") {
+		disabled, ok = "fetch-url", false
+	}
+	if !ok {
+		w.Header().Set("X-Error-Code", "operation_disabled")
+		simpleError(w, http.StatusForbidden, fmt.Sprintf("operation %q is disabled in this deployment", disabled))
+		return
+	}
+
+	done := make(chan jobs.Job, 1)
+	fileURL := req.FileURL
+	// runErr is the pipeline's error, read once done has the job
+	var runErr error
+	job, err := h.Jobs.SubmitFrom(auth.Tenant(r.Context()), "simple-"+r.PathValue("action"), formatOf(name), func(jobID, workDir string) (string, error) {
+		inputPath := filepath.Join(workDir, name)
+		if fileURL != "" {
+			if err := h.fetchInto(fileURL, inputPath, maxBytes); err != nil {
+				return "", err
+			}
+		} else if err := os.WriteFile(inputPath, data, 0644); err != nil {
+			return "", err
+		}
+		outputPath, err := h.runPipeline(jobID, workDir, inputPath, steps)
+		runErr = err
+		return outputPath, err
+	}, func(j jobs.Job) { done <- j })
+	if err != nil {
+		log.Printf("[%s] Simple action submit failed: %v", requestID(r), err)
+		simpleError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	log.Printf("[%s] Submitted job %s", requestID(r), job.ID)
+
+	status := http.StatusAccepted
+	select {
+	case job = <-done:
+		status = http.StatusOK
+		if job.Status == jobs.StatusFailed {
+			status = http.StatusUnprocessableEntity
+			// A saturated engine is worth retrying, unlike a bad input
+			if h.queueFullHeaders(w, runErr) {
+				status = http.StatusServiceUnavailable
+			}
+		}
+	case <-time.After(simpleWait):
+	case <-r.Context().Done():
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(h.jobView(r, job))
+}
+
+// fetchInto downloads file_url to inputPath like a source_url (see
+// fetchSource).
+func (h *ConversionHandler) fetchInto(fileURL, inputPath string, maxBytes int64) error {
+	src, _, err := h.fetchSource(fileURL, "file_url", maxBytes)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(inputPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+func simpleError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// HandleSimpleOpenAPI serves an OpenAPI 3 description of the simple API, one
+// operation per action, for import into no-code platforms.
+func (h *ConversionHandler) HandleSimpleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	paths := map[string]interface{}{}
+	for name, action := range simpleActions {
+		props := map[string]interface{}{
+			"file_url":    map[string]string{"type": "string", "format": "uri", "description": "Public URL of the input file"},
+			"file_base64": map[string]string{"type": "string", "format": "byte", "description": "Input file contents, base64 encoded"},
+			"filename":    map[string]string{"type": "string", "description": "Input file name; its extension selects the input format"},
+		}
+		var required []string
+		for _, f := range action.Fields {
+			prop := map[string]interface{}{"type": f.Type, "description": f.Description}
+			if len(f.Enum) > 0 {
+				prop["enum"] = f.Enum
+			}
+			props[f.Name] = prop
+			if f.Required {
+				required = append(required, f.Name)
+			}
+		}
+		schema := map[string]interface{}{"type": "object", "properties": props}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		result := map[string]interface{}{
+			"description": "Job result",
+			"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": map[string]string{"$ref": "#/components/schemas/Job"}}},
+		}
+		paths["/simple/"+name] = map[string]interface{}{
+			"post": map[string]interface{}{
+				"operationId": action.OperationID,
+				"summary":     action.Summary,
+				"requestBody": map[string]interface{}{
+					"required": true,
+					"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}},
+				},
+				"responses": map[string]interface{}{
+					"200": result,
+					"202": map[string]string{"description": "Still processing; poll status_url"},
+					"400": map[string]string{"description": "Invalid request"},
+					"422": map[string]string{"description": "Processing failed"},
+				},
+			},
+		}
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]string{"title": "Document Converter simple actions", "version": "1.0.0"},
+		"servers": []map[string]string{{"url": h.publicURL(r, "")}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"Job": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"id":          map[string]string{"type": "string"},
+						"status":      map[string]string{"type": "string"},
+						"error":       map[string]string{"type": "string"},
+						"result_name": map[string]string{"type": "string"},
+						"status_url":  map[string]string{"type": "string", "format": "uri"},
+						"result_url":  map[string]string{"type": "string", "format": "uri"},
+						"expires_at":  map[string]string{"type": "string", "format": "date-time"},
+					},
+				},
+			},
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akila/document-converter/config"
+	"github.com/akila/document-converter/jobs"
+)
+
+func TestSimpleActionRefusesPrivateFileURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer srv.Close()
+
+	jobsMgr, err := jobs.NewManager(t.TempDir(), "test", time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &ConversionHandler{Config: &config.Config{}, Jobs: jobsMgr}
+
+	for _, tc := range []struct {
+		fileURL string
+		status  int
+		error   string
+	}{
+		{srv.URL + "/report.pdf", http.StatusUnprocessableEntity, "file_url host 127.0.0.1 resolves to a non-public address"},
+		{"file:///etc/passwd.pdf", http.StatusBadRequest, "file_url must be an absolute http or https URL"},
+	} {
+		body, _ := json.Marshal(map[string]string{"file_url": tc.fileURL})
+		r := httptest.NewRequest(http.MethodPost, "/simple/flatten", strings.NewReader(string(body)))
+		r.SetPathValue("action", "flatten")
+		w := httptest.NewRecorder()
+		h.HandleSimpleAction(w, r)
+
+		var got struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(w.Body).Decode(&got)
+		if w.Code != tc.status || !strings.Contains(got.Error, tc.error) {
+			t.Errorf("%s: %d %q, want %d %q", tc.fileURL, w.Code, got.Error, tc.status, tc.error)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akila/document-converter/jobs"
+)
+
+// Slack file IDs look like F0123ABCD; permalinks embed them as /files/<user>/<id>/.
+var slackFileID = regexp.MustCompile(`(?:^|/files/[^/]+/)(F[A-Z0-9]{6,})`)
+
+// HandleSlackCommand implements a slash command such as
+// "/convert pdf <file permalink>". The file is converted through the async
+// job subsystem and posted back to the channel (or linked when no bot token
+// is configured).
+func (h *ConversionHandler) HandleSlackCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg := h.Config.Slack
+	if cfg.SigningSecret == "" {
+		http.Error(w, "Slack integration is not configured", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64*1024))
+	if err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+	if !verifySlackSignature(cfg.SigningSecret, r.Header, body) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+
+	args := strings.Fields(form.Get("text"))
+	if len(args) != 2 {
+		slackReply(w, "Usage: "+form.Get("command")+" <format> <file link>, e.g. pdf https://…/files/U123/F0123ABCD/report.docx")
+		return
+	}
+	to := strings.ToLower(args[0])
+	m := slackFileID.FindStringSubmatch(strings.Trim(args[1], "<>"))
+	if m == nil {
+		slackReply(w, "That doesn't look like a Slack file link.")
+		return
+	}
+	if cfg.BotToken == "" {
+		slackReply(w, "File access is not configured for this workspace.")
+		return
+	}
+	fileID := m[1]
+	responseURL := form.Get("response_url")
+	channelID := form.Get("channel_id")
+
+	steps, err := parsePipeline("convert:" + to)
+	if err != nil {
+		slackReply(w, err.Error())
+		return
+	}
+
+	_, err = h.Jobs.SubmitFor("slack:"+form.Get("team_id"), "slack-convert", func(jobID, workDir string) (string, error) {
+		name, downloadURL, err := slackFileInfo(cfg.BotToken, fileID)
+		if err != nil {
+			return "", err
+		}
+		inputPath := filepath.Join(workDir, filepath.Base(name))
+		header := http.Header{"Authorization": {"Bearer " + cfg.BotToken}}
+		if err := h.downloadFile(downloadURL, inputPath, header, 50*1024*1024); err != nil {
+			return "", err
+		}
+		return h.runPipelineQueued(jobID, workDir, inputPath, steps)
+	}, func(job jobs.Job) {
+		h.slackDeliver(responseURL, channelID, job)
+	})
+	if err != nil {
+		log.Printf("Slack job submit failed: %v", err)
+		slackReply(w, "Sorry, the conversion could not be started.")
+		return
+	}
+	slackReply(w, fmt.Sprintf("Converting to %s…", to))
+}
+
+// verifySlackSignature checks Slack's v0 request signature and rejects
+// requests older than five minutes.
+func verifySlackSignature(secret string, header http.Header, body []byte) bool {
+	ts, err := strconv.ParseInt(header.Get("X-Slack-Request-Timestamp"), 10, 64)
+	if err != nil || time.Since(time.Unix(ts, 0)).Abs() > 5*time.Minute {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%d:%s", ts, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature")))
+}
+
+func slackReply(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"response_type": "ephemeral", "text": text})
+}
+
+// slackAPI calls a Web API method and decodes the response into out.
+func slackAPI(token, method string, form url.Values, jsonBody interface{}, out interface{}) error {
+	var req *http.Request
+	var err error
+	endpoint := "https://slack.com/api/" + method
+	if jsonBody != nil {
+		data, _ := json.Marshal(jsonBody)
+		req, err = http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		}
+	} else {
+		req, err = http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("slack %s: invalid response", method)
+	}
+	if !envelope.OK {
+		return fmt.Errorf("slack %s: %s", method, envelope.Error)
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+func slackFileInfo(token, fileID string) (name, downloadURL string, err error) {
+	var info struct {
+		File struct {
+			Name               string `json:"name"`
+			URLPrivateDownload string `json:"url_private_download"`
+		} `json:"file"`
+	}
+	if err := slackAPI(token, "files.info", url.Values{"file": {fileID}}, nil, &info); err != nil {
+		return "", "", err
+	}
+	return info.File.Name, info.File.URLPrivateDownload, nil
+}
+
+// slackUpload shares a file in channelID using the external upload flow.
+func slackUpload(token, channelID, name string, data []byte, comment string) error {
+	var ticket struct {
+		UploadURL string `json:"upload_url"`
+		FileID    string `json:"file_id"`
+	}
+	form := url.Values{"filename": {name}, "length": {strconv.Itoa(len(data))}}
+	if err := slackAPI(token, "files.getUploadURLExternal", form, nil, &ticket); err != nil {
+		return err
+	}
+
+	resp, err := http.Post(ticket.UploadURL, "application/octet-stream", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack upload failed: %s", resp.Status)
+	}
+
+	return slackAPI(token, "files.completeUploadExternal", nil, map[string]interface{}{
+		"files":           []map[string]string{{"id": ticket.FileID, "title": name}},
+		"channel_id":      channelID,
+		"initial_comment": comment,
+	}, nil)
+}
+
+func (h *ConversionHandler) slackUploadResult(channelID string, job jobs.Job) error {
+	rc, _, err := h.Jobs.OpenResult(job.ID)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	return slackUpload(h.Config.Slack.BotToken, channelID, job.ResultName, data, "Here is your converted file.")
+}
+
+// slackDeliver reports a finished job: the file is uploaded to the channel
+// when possible, otherwise a download link is posted to the response URL.
+func (h *ConversionHandler) slackDeliver(responseURL, channelID string, job jobs.Job) {
+	var text string
+	if job.Status == jobs.StatusFailed {
+		text = "Conversion failed: " + job.Error
+	} else {
+		err := h.slackUploadResult(channelID, job)
+		if err == nil {
+			return
+		}
+		log.Printf("[%s] Slack upload failed, posting link instead: %v", job.ID, err)
+		link := h.publicURL(nil, "/jobs/"+job.ID+"/result")
+		text = fmt.Sprintf("Done: <%s|%s> (available until %s)", link, job.ResultName, job.ExpiresAt.Format(time.RFC1123))
+	}
+
+	if responseURL == "" {
+		return
+	}
+	data, _ := json.Marshal(map[string]string{"response_type": "ephemeral", "text": text})
+	resp, err := http.Post(responseURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		log.Printf("[%s] Slack response_url post failed: %v", job.ID, err)
+		return
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/akila/document-converter/converters"
+)
+
+// splitPart is one output file of a split.
+type splitPart struct {
+	Name  string
+	Pages []int
+}
+
+// parseSplitRanges reads one part per comma separated range of spec, e.g.
+// "1-3,4-10,11-last".
+func parseSplitRanges(spec string, pageCount int) ([]splitPart, error) {
+	var parts []splitPart
+	for i, rng := range strings.Split(spec, ",") {
+		rng = strings.TrimSpace(rng)
+		pages, err := converters.ParsePageRanges(rng, pageCount)
+		if err != nil {
+			return nil, fmt.Errorf("range %d (%q): %v", i+1, rng, err)
+		}
+		name := fmt.Sprintf("pages-%d", pages[0])
+		if len(pages) > 1 {
+			name += fmt.Sprintf("-%d", pages[len(pages)-1])
+		}
+		parts = append(parts, splitPart{Name: name, Pages: pages})
+	}
+	return parts, nil
+}
+
+// writeSplitParts extracts every part to its own numbered PDF.
+func writeSplitParts(inputPath, tempDir string, parts []splitPart) ([]string, error) {
+	var files []string
+	for i, part := range parts {
+		outputPath := filepath.Join(tempDir, fmt.Sprintf("%02d-%s.pdf", i+1, part.Name))
+		if err := converters.ExtractPages(inputPath, outputPath, part.Pages); err != nil {
+			return nil, err
+		}
+		files = append(files, outputPath)
+	}
+	return files, nil
+}
+
+// bookmarkSplitParts cuts the document at every outline entry down to
+// level (1 is top level). Each part runs to the page before the next cut and
+// is named after its bookmark; pages before the first bookmark form a
+// "front-matter" part. Bookmarks sharing a start page keep the first title.
+func bookmarkSplitParts(bms []converters.Bookmark, level, pageCount int) []splitPart {
+	type cut struct {
+		title string
+		page  int
+	}
+	var cuts []cut
+	var walk func([]converters.Bookmark, int)
+	walk = func(list []converters.Bookmark, depth int) {
+		for _, b := range list {
+			if b.Page >= 1 && b.Page <= pageCount {
+				cuts = append(cuts, cut{b.Title, b.Page})
+			}
+			if depth < level {
+				walk(b.Children, depth+1)
+			}
+		}
+	}
+	walk(bms, 1)
+	sort.SliceStable(cuts, func(i, j int) bool { return cuts[i].page < cuts[j].page })
+
+	var parts []splitPart
+	if len(cuts) == 0 || cuts[0].page > 1 {
+		cuts = append([]cut{{"front-matter", 1}}, cuts...)
+	}
+	for i, c := range cuts {
+		if i > 0 && c.page == cuts[i-1].page {
+			continue
+		}
+		last := pageCount
+		for _, next := range cuts[i+1:] {
+			if next.page > c.page {
+				last = next.page - 1
+				break
+			}
+		}
+		pages := make([]int, 0, last-c.page+1)
+		for p := c.page; p <= last; p++ {
+			pages = append(pages, p)
+		}
+		parts = append(parts, splitPart{Name: fileSafeName(c.title), Pages: pages})
+	}
+	return parts
+}
+
+// fileSafeName turns a title into a portable file name component.
+func fileSafeName(title string) string {
+	var sb strings.Builder
+	for _, r := range strings.TrimSpace(title) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '-', r == '_', r == '.':
+			sb.WriteRune(r)
+		case unicode.IsSpace(r):
+			sb.WriteRune('_')
+		}
+	}
+	name := strings.Trim(sb.String(), "._")
+	if runes := []rune(name); len(runes) > 80 {
+		name = string(runes[:80])
+	}
+	if name == "" {
+		name = "untitled"
+	}
+	return name
+}
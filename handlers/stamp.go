@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akila/document-converter/converters"
+)
+
+func (h *ConversionHandler) HandleStampHeaderFooter(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "stamp")
+	if !ok {
+		return
+	}
+
+	dateFormat := r.FormValue("date_format")
+	if dateFormat == "" {
+		dateFormat = "2006-01-02"
+	}
+	hf := converters.HeaderFooter{
+		HeaderLeft:   r.FormValue("header_left"),
+		HeaderCenter: r.FormValue("header_center"),
+		HeaderRight:  r.FormValue("header_right"),
+		FooterLeft:   r.FormValue("footer_left"),
+		FooterCenter: r.FormValue("footer_center"),
+		FooterRight:  r.FormValue("footer_right"),
+		Date:         time.Now().Format(dateFormat),
+		Filename:     filepath.Base(inputPath),
+	}
+	if hf.HeaderLeft+hf.HeaderCenter+hf.HeaderRight+hf.FooterLeft+hf.FooterCenter+hf.FooterRight == "" {
+		os.RemoveAll(tempDir)
+		http.Error(w, "At least one header or footer text is required", http.StatusBadRequest)
+		return
+	}
+	if v := r.FormValue("font_size"); v != "" {
+		hf.FontSize, _ = strconv.ParseFloat(v, 64)
+	}
+	if v := r.FormValue("margin"); v != "" {
+		hf.Margin, _ = strconv.ParseFloat(v, 64)
+	}
+
+	// Consume a number last, once the request is known to be valid
+	if sequence := r.FormValue("number_sequence"); sequence != "" {
+		issued, err := h.nextNumber(r, sequence)
+		if err != nil {
+			os.RemoveAll(tempDir)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		hf.Number = issued.Number
+		w.Header().Set("X-Document-Number", issued.Number)
+	}
+
+	outputPath := filepath.Join(tempDir, "stamped.pdf")
+	if err := converters.StampHeaderFooter(inputPath, outputPath, hf); err != nil {
+		log.Printf("[%s] Header/footer stamp failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Stamping failed", http.StatusInternalServerError)
+		return
+	}
+
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
+
+// textStampSpec is a requested text stamp: at page (0 or absent for every
+// page), x and y, or at an anchor, x and y then shifting it.
+type textStampSpec struct {
+	Text     string             `json:"text"`
+	Page     int                `json:"page"`
+	X        float64            `json:"x"`
+	Y        float64            `json:"y"`
+	FontSize float64            `json:"font_size"`
+	Color    string             `json:"color"`
+	Border   bool               `json:"border"`
+	Anchor   *converters.Anchor `json:"anchor"`
+}
+
+// HandleStampText stamps lines of text at spots on the pages. "stamps" (a
+// form value or a JSON file part) is a JSON array of
+//
+//	{"text": "PAID", "page": 1, "x": 400, "y": 700, "border": true}
+//	{"text": "Approved", "anchor": {"text": "Authorized by", "occurrence": "last", "position": "below", "distance": 20}}
+//
+// x and y are the stamp's bottom-left corner in points from the bottom-left
+// of the page; without page or anchor a stamp goes on every page. Anchored
+// stamps are positioned relative to text found in the document (see
+// converters.Anchor), so they follow it across template versions. Optional:
+// font_size (default 12), color (#rrggbb, default black) and border.
+func (h *ConversionHandler) HandleStampText(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "stamp")
+	if !ok {
+		return
+	}
+
+	raw := []byte(r.FormValue("stamps"))
+	if len(raw) == 0 {
+		if f, _, err := r.FormFile("stamps"); err == nil {
+			raw, _ = io.ReadAll(f)
+			f.Close()
+		}
+	}
+	var specs []textStampSpec
+	if err := json.Unmarshal(raw, &specs); err != nil || len(specs) == 0 {
+		os.RemoveAll(tempDir)
+		http.Error(w, "stamps must be a non-empty JSON array of stamps", http.StatusBadRequest)
+		return
+	}
+
+	stamps, err := placeTextStamps(inputPath, specs)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("[%s] Stamping %d text stamp(s)", reqID, len(stamps))
+
+	outputPath := filepath.Join(tempDir, "stamped.pdf")
+	if err := converters.StampText(inputPath, outputPath, stamps); err != nil {
+		log.Printf("[%s] Text stamp failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Stamping failed", http.StatusInternalServerError)
+		return
+	}
+
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
+
+// placeTextStamps validates the requested stamps and resolves anchors to
+// positions.
+func placeTextStamps(inputPath string, specs []textStampSpec) ([]converters.TextStamp, error) {
+	pageCount, err := converters.PageCount(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("file is not a readable PDF")
+	}
+	anchors := newAnchorFinder(inputPath)
+
+	var stamps []converters.TextStamp
+	for i, spec := range specs {
+		if strings.TrimSpace(spec.Text) == "" {
+			return nil, fmt.Errorf("stamp %d: text is required", i+1)
+		}
+		if spec.FontSize < 0 || spec.FontSize > 200 {
+			return nil, fmt.Errorf("stamp %d: font_size must be between 1 and 200", i+1)
+		}
+		color, err := parseColor(spec.Color)
+		if err != nil {
+			return nil, fmt.Errorf("stamp %d: %v", i+1, err)
+		}
+		s := converters.TextStamp{
+			Text:     spec.Text,
+			Page:     spec.Page,
+			X:        spec.X,
+			Y:        spec.Y,
+			FontSize: spec.FontSize,
+			Color:    color,
+			Border:   spec.Border,
+		}
+
+		if spec.Anchor == nil {
+			if s.Page < 0 || s.Page > pageCount {
+				return nil, fmt.Errorf("stamp %d: page must be between 1 and %d, or 0 for every page", i+1, pageCount)
+			}
+			stamps = append(stamps, s)
+			continue
+		}
+		boxes, err := anchors.find(*spec.Anchor)
+		if err != nil {
+			return nil, fmt.Errorf("stamp %d: %v", i+1, err)
+		}
+		for _, box := range boxes {
+			placed := s
+			placed.Page = box.Page
+			// The stamp's width isn't known here: left of the anchor, its
+			// right edge is placed instead
+			placed.AlignRight = spec.Anchor.Position == "left"
+			x, y := spec.Anchor.Place(box, 0, s.Height())
+			placed.X, placed.Y = x+s.X, y+s.Y
+			stamps = append(stamps, placed)
+		}
+	}
+	return stamps, nil
+}
+
+// parseColor reads a #rrggbb color, black when empty.
+func parseColor(s string) ([3]float64, error) {
+	var color [3]float64
+	if s == "" {
+		return color, nil
+	}
+	rgb, err := hex.DecodeString(strings.TrimPrefix(s, "#"))
+	if err != nil || len(rgb) != 3 {
+		return color, fmt.Errorf("color must be #rrggbb")
+	}
+	for i, c := range rgb {
+		color[i] = float64(c) / 255
+	}
+	return color, nil
+}
+
+// anchorFinder resolves anchors against the text of a PDF, searching for
+// each anchor text once.
+type anchorFinder struct {
+	inputPath string
+	found     map[string][]converters.TextBox
+}
+
+func newAnchorFinder(inputPath string) *anchorFinder {
+	return &anchorFinder{inputPath: inputPath, found: map[string][]converters.TextBox{}}
+}
+
+// find returns the occurrences of the anchor's text it selects, failing
+// when there are none.
+func (f *anchorFinder) find(a converters.Anchor) ([]converters.TextBox, error) {
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+	boxes, seen := f.found[a.Text]
+	if !seen {
+		var err error
+		if boxes, err = converters.FindText(f.inputPath, a.Text); err != nil {
+			return nil, fmt.Errorf("could not search the PDF's text")
+		}
+		f.found[a.Text] = boxes
+	}
+	selected := a.Select(boxes)
+	if len(selected) == 0 {
+		if len(boxes) > 0 {
+			return nil, fmt.Errorf("anchor %q occurs only %d time(s)", a.Text, len(boxes))
+		}
+		return nil, fmt.Errorf("anchor %q not found", a.Text)
+	}
+	return selected, nil
+}
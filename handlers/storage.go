@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/akila/document-converter/storage"
+)
+
+// localObject verifies a signed URL of the "local" storage provider and
+// opens its bucket. On failure it has already written the error response.
+func (h *ConversionHandler) localObject(w http.ResponseWriter, r *http.Request) (storage.Backend, string, bool) {
+	bucket, key, err := storage.VerifyLocalURL(h.Config.StorageURLSecret, r.Method, r.PathValue("path"), r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, "", false
+	}
+	store, err := storage.Open(h.Config, "local", bucket)
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return nil, "", false
+	}
+	return store, key, true
+}
+
+// HandleStorageGet serves an object of a local bucket through a URL from
+// its SignURL, as presigned URLs of object stores do.
+func (h *ConversionHandler) HandleStorageGet(w http.ResponseWriter, r *http.Request) {
+	store, key, ok := h.localObject(w, r)
+	if !ok {
+		return
+	}
+	rc, _, err := store.Get(key)
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	defer rc.Close()
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	io.Copy(w, rc)
+}
+
+// HandleStoragePut stores the request body in a local bucket through a URL
+// from its SignURL, e.g. a direct upload. Bodies are bounded by the direct
+// upload limit.
+func (h *ConversionHandler) HandleStoragePut(w http.ResponseWriter, r *http.Request) {
+	store, key, ok := h.localObject(w, r)
+	if !ok {
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, h.Config.Uploads.MaxBytes)
+	if err := store.Put(key, body, r.ContentLength, r.Header.Get("Content-Type")); err != nil {
+		log.Printf("Storing %s failed: %v", r.PathValue("path"), err)
+		http.Error(w, "Storing the object failed", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
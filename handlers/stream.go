@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/akila/document-converter/converters"
+)
+
+// HandleExtractTextStream streams the text of a (possibly huge) PDF as NDJSON,
+// one {"page", "text"} record per page flushed as soon as it is extracted,
+// and a final {"done": true, "pages"} record. A failure midway ends the
+// stream with an {"error"} record instead.
+func (h *ConversionHandler) HandleExtractTextStream(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "extract-text.stream")
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	pages := 0
+	err := converters.StreamPageText(inputPath, func(page int, text string) error {
+		pages = page
+		if err := enc.Encode(map[string]interface{}{"page": page, "text": text}); err != nil {
+			return err // client went away
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[%s] Streaming text extraction failed after %d pages: %v", reqID, pages, err)
+		enc.Encode(map[string]interface{}{"error": "text extraction failed", "pages": pages})
+		return
+	}
+	enc.Encode(map[string]interface{}{"done": true, "pages": pages})
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/utils"
+)
+
+// tableManifestEntry describes one extracted table in manifest.json.
+type tableManifestEntry struct {
+	File string `json:"file"`
+	converters.Table
+	Rows    int `json:"rows"`
+	Columns int `json:"columns"`
+}
+
+// HandleExtractTables finds the tables in a PDF and answers with a zip of
+// one file per table, table_1.csv, table_2.csv, ... (format=csv, default)
+// or .xlsx (format=xlsx), and a manifest.json listing each table's file,
+// page and box (in PDF points from the bottom-left of the page). Tables are
+// found from the text's layout (see converters.FindTables), so scans need
+// OCR first.
+func (h *ConversionHandler) HandleExtractTables(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "extract-tables")
+	if !ok {
+		return
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "xlsx" {
+		os.RemoveAll(tempDir)
+		http.Error(w, "format must be csv or xlsx", http.StatusBadRequest)
+		return
+	}
+
+	tables, err := converters.FindTables(inputPath)
+	if err != nil {
+		log.Printf("[%s] Table extraction failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Table extraction failed", http.StatusInternalServerError)
+		return
+	}
+	if len(tables) == 0 {
+		os.RemoveAll(tempDir)
+		http.Error(w, "No tables found in PDF", http.StatusNotFound)
+		return
+	}
+	log.Printf("[%s] Found %d table(s)", reqID, len(tables))
+
+	outDir := filepath.Join(tempDir, "tables")
+	os.MkdirAll(outDir, 0755)
+	write := converters.WriteTableCSV
+	if format == "xlsx" {
+		write = converters.WriteTableXLSX
+	}
+	var files []string
+	manifest := make([]tableManifestEntry, len(tables))
+	for i, t := range tables {
+		name := fmt.Sprintf("table_%d.%s", i+1, format)
+		path := filepath.Join(outDir, name)
+		if err := write(path, t.Rows); err != nil {
+			log.Printf("[%s] Writing %s failed: %v", reqID, name, err)
+			os.RemoveAll(tempDir)
+			http.Error(w, "Table extraction failed", http.StatusInternalServerError)
+			return
+		}
+		files = append(files, path)
+		manifest[i] = tableManifestEntry{File: name, Table: t, Rows: len(t.Rows), Columns: len(t.Rows[0])}
+	}
+
+	manifestPath := filepath.Join(outDir, "manifest.json")
+	data, _ := json.MarshalIndent(map[string]interface{}{"tables": manifest}, "", "  ")
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	files = append(files, manifestPath)
+
+	zipPath := filepath.Join(tempDir, "tables.zip")
+	if err := utils.ZipFiles(zipPath, files); err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "Zipping failed", http.StatusInternalServerError)
+		return
+	}
+	h.serveAndCleanup(w, r, zipPath, tempDir)
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// teamsActivity is the subset of a Bot Framework activity we read, for both
+// outgoing-webhook messages and message-extension submitAction invokes.
+type teamsActivity struct {
+	Type        string            `json:"type"`
+	Name        string            `json:"name"`
+	Text        string            `json:"text"`
+	Attachments []teamsAttachment `json:"attachments"`
+	ChannelData struct {
+		Tenant struct {
+			ID string `json:"id"`
+		} `json:"tenant"`
+	} `json:"channelData"`
+	Value struct {
+		Data struct {
+			Format string `json:"format"`
+		} `json:"data"`
+		MessagePayload struct {
+			Attachments []teamsAttachment `json:"attachments"`
+		} `json:"messagePayload"`
+	} `json:"value"`
+}
+
+type teamsAttachment struct {
+	ContentType string `json:"contentType"`
+	ContentURL  string `json:"contentUrl"`
+	Name        string `json:"name"`
+	Content     struct {
+		DownloadURL string `json:"downloadUrl"`
+	} `json:"content"`
+}
+
+var htmlTag = regexp.MustCompile(`<at>.*?</at>|<[^>]+>`)
+
+// HandleTeamsMessage serves a Teams outgoing webhook or message-extension
+// action: the first attached file is converted (to the format named in the
+// message, default PDF) by an async job and a download link is returned.
+func (h *ConversionHandler) HandleTeamsMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg := h.Config.Teams
+	if cfg.WebhookSecret == "" {
+		http.Error(w, "Teams integration is not configured", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1024*1024))
+	if err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+	if !verifyTeamsSignature(cfg.WebhookSecret, r.Header.Get("Authorization"), body) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var activity teamsActivity
+	if err := json.Unmarshal(body, &activity); err != nil {
+		http.Error(w, "Invalid activity", http.StatusBadRequest)
+		return
+	}
+	invoke := activity.Type == "invoke" && activity.Name == "composeExtension/submitAction"
+
+	to := strings.ToLower(strings.TrimSpace(activity.Value.Data.Format))
+	if to == "" {
+		if words := strings.Fields(htmlTag.ReplaceAllString(activity.Text, " ")); len(words) > 0 {
+			to = strings.ToLower(words[0])
+		}
+	}
+	if to == "" {
+		to = "pdf"
+	}
+
+	attachments := append(activity.Attachments, activity.Value.MessagePayload.Attachments...)
+	name, downloadURL := "", ""
+	for _, a := range attachments {
+		link := a.Content.DownloadURL
+		if link == "" && a.ContentType != "text/html" {
+			link = a.ContentURL
+		}
+		if link != "" && teamsHostAllowed(link, cfg.DownloadHosts) {
+			name, downloadURL = a.Name, link
+			break
+		}
+	}
+	if downloadURL == "" {
+		teamsReply(w, invoke, "Attach a file to convert, e.g. \"pdf\" with a Word document.")
+		return
+	}
+
+	steps, err := parsePipeline("convert:" + to)
+	if err != nil {
+		teamsReply(w, invoke, err.Error())
+		return
+	}
+
+	job, err := h.Jobs.SubmitFor("teams:"+activity.ChannelData.Tenant.ID, "teams-convert", func(jobID, workDir string) (string, error) {
+		inputPath := filepath.Join(workDir, filepath.Base(name))
+		if err := h.downloadFile(downloadURL, inputPath, nil, 50*1024*1024); err != nil {
+			return "", err
+		}
+		return h.runPipelineQueued(jobID, workDir, inputPath, steps)
+	}, nil)
+	if err != nil {
+		log.Printf("Teams job submit failed: %v", err)
+		teamsReply(w, invoke, "Sorry, the conversion could not be started.")
+		return
+	}
+
+	link := h.publicURL(r, "/jobs/"+job.ID+"/result")
+	teamsReply(w, invoke, fmt.Sprintf("Converting %s to %s. Download it here when ready: %s", name, strings.ToUpper(to), link))
+}
+
+// verifyTeamsSignature checks the "HMAC <base64>" Authorization header of a
+// Teams outgoing webhook against the base64-encoded shared secret.
+func verifyTeamsSignature(secret, authorization string, body []byte) bool {
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil || !strings.HasPrefix(authorization, "HMAC ") {
+		return false
+	}
+	given, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "HMAC "))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return hmac.Equal(given, mac.Sum(nil))
+}
+
+func teamsHostAllowed(link string, suffixes []string) bool {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "https" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, s := range suffixes {
+		if host == s || strings.HasSuffix(host, "."+s) {
+			return true
+		}
+	}
+	return false
+}
+
+func teamsReply(w http.ResponseWriter, invoke bool, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	if invoke {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"composeExtension": map[string]string{"type": "message", "text": text},
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"type": "message", "text": text})
+}
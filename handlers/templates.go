@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/akila/document-converter/auth"
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/templates"
+)
+
+// HandleTemplatesList lists the templates the caller's tenant can use.
+func (h *ConversionHandler) HandleTemplatesList(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Templates.List(auth.Tenant(r.Context()))
+	if err != nil {
+		templateError(w, r, err)
+		return
+	}
+	if list == nil {
+		list = []templates.Template{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"templates": list})
+}
+
+// HandleTemplateGet shows a template and its versions.
+func (h *ConversionHandler) HandleTemplateGet(w http.ResponseWriter, r *http.Request) {
+	t, err := h.Templates.Get(auth.Tenant(r.Context()), r.PathValue("name"))
+	if err != nil {
+		templateError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// HandleTemplateUpload adds a version of a template, creating the template
+// on first upload: "file" is the template page, a zip with its CSS and
+// assets (index.html is the page) or a single .html file, written as a Go
+// html/template. Optional: sample_data (JSON) for previews, and visibility,
+// private (default) or public.
+func (h *ConversionHandler) HandleTemplateUpload(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !templates.ValidName(name) {
+		http.Error(w, "Template names are 1-64 letters, digits, '.', '_' or '-'", http.StatusBadRequest)
+		return
+	}
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "templates")
+	if !ok {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	siteDir := filepath.Join(tempDir, "site")
+	entry, err := unpackSite(inputPath, siteDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var sample json.RawMessage
+	if v := r.FormValue("sample_data"); v != "" {
+		sample = json.RawMessage(v)
+	}
+	t, err := h.Templates.AddVersion(auth.Tenant(r.Context()), name, siteDir, entry, sample, r.FormValue("visibility"))
+	if err != nil {
+		templateError(w, r, err)
+		return
+	}
+	log.Printf("[%s] Template %s version %d stored", reqID, name, t.Current)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+// HandleTemplateSettings changes a template's visibility (private or
+// public) and current version (current=N, e.g. to roll back).
+func (h *ConversionHandler) HandleTemplateSettings(w http.ResponseWriter, r *http.Request) {
+	current := 0
+	if v := r.FormValue("current"); v != "" {
+		var err error
+		if current, err = strconv.Atoi(v); err != nil || current < 1 {
+			http.Error(w, "current must be a version number", http.StatusBadRequest)
+			return
+		}
+	}
+	t, err := h.Templates.Update(auth.Tenant(r.Context()), r.PathValue("name"), r.FormValue("visibility"), current)
+	if err != nil {
+		templateError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// HandleTemplateReference stores the layout documents generated from a
+// template version (version, default the current one) must match, as
+// checked by /compare/template: reference is a JSON object like
+//
+//	{"pages": 2, "text": [{"text": "INVOICE", "page": 1, "x": 72, "y": 740}],
+//	 "fields": [{"name": "buyer_sign", "page": 2}], "tolerance": 5}
+//
+// (see converters.LayoutReference). An empty reference removes it.
+func (h *ConversionHandler) HandleTemplateReference(w http.ResponseWriter, r *http.Request) {
+	version := 0
+	if v := r.FormValue("version"); v != "" {
+		var err error
+		if version, err = strconv.Atoi(v); err != nil || version < 1 {
+			http.Error(w, "version must be a version number", http.StatusBadRequest)
+			return
+		}
+	}
+	var raw json.RawMessage
+	if v := r.FormValue("reference"); v != "" {
+		var ref converters.LayoutReference
+		if err := json.Unmarshal([]byte(v), &ref); err != nil {
+			http.Error(w, "reference must be a JSON object", http.StatusBadRequest)
+			return
+		}
+		if err := ref.Validate(); err != nil {
+			http.Error(w, "reference: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		raw, _ = json.Marshal(ref)
+	}
+	t, err := h.Templates.SetReference(auth.Tenant(r.Context()), r.PathValue("name"), version, raw)
+	if err != nil {
+		templateError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// HandleTemplateDelete removes a template with all its versions.
+func (h *ConversionHandler) HandleTemplateDelete(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := h.Templates.Delete(auth.Tenant(r.Context()), name); err != nil {
+		templateError(w, r, err)
+		return
+	}
+	log.Printf("[%s] Template %s deleted", requestID(r), name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleTemplatePreview renders a template version (version, default the
+// current one) to PDF with its sample data, or with data (JSON) to try
+// other input. Print options as for /convert/url.
+func (h *ConversionHandler) HandleTemplatePreview(w http.ResponseWriter, r *http.Request) {
+	h.generate(w, r, r.PathValue("name"))
+}
+
+// HandleGenerate renders a document from a catalog template: template
+// names it, data (JSON) fills it in, version picks one other than the
+// current. With number_sequence, the next number of that sequence (see
+// /numbering) is available to the template as .number and returned in
+// X-Document-Number. Print options as for /convert/url.
+func (h *ConversionHandler) HandleGenerate(w http.ResponseWriter, r *http.Request) {
+	h.generate(w, r, r.FormValue("template"))
+}
+
+func (h *ConversionHandler) generate(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 10*1024*1024)
+	if name == "" {
+		http.Error(w, "template is required", http.StatusBadRequest)
+		return
+	}
+	version := 0
+	if v := r.FormValue("version"); v != "" {
+		var err error
+		if version, err = strconv.Atoi(v); err != nil || version < 1 {
+			http.Error(w, "version must be a version number", http.StatusBadRequest)
+			return
+		}
+	}
+	var data interface{}
+	if v := r.FormValue("data"); v != "" {
+		if err := json.Unmarshal([]byte(v), &data); err != nil {
+			http.Error(w, "data must be JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	opts, err := printOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tenant := auth.Tenant(r.Context())
+	if _, err := h.Templates.Get(tenant, name); err != nil {
+		templateError(w, r, err)
+		return
+	}
+
+	// Consume a number last, once the request is known to be valid
+	if sequence := r.FormValue("number_sequence"); sequence != "" {
+		fields, ok := data.(map[string]interface{})
+		if data != nil && !ok {
+			http.Error(w, "data must be a JSON object to receive a number", http.StatusBadRequest)
+			return
+		}
+		if fields == nil {
+			fields = map[string]interface{}{}
+		}
+		issued, err := h.nextNumber(r, sequence)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fields["number"] = issued.Number
+		data = fields
+		w.Header().Set("X-Document-Number", issued.Number)
+	}
+
+	reqID := requestID(r)
+	tempDir := filepath.Join("tmp", reqID)
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		log.Printf("[%s] Failed to create temp dir: %v", reqID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	siteDir := filepath.Join(tempDir, "site")
+	entry, err := h.Templates.Render(tenant, name, version, data, siteDir)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		templateError(w, r, err)
+		return
+	}
+
+	outputPath := filepath.Join(tempDir, name+".pdf")
+	if err := converters.HTMLToPDF(siteDir, entry, outputPath, filepath.Join(tempDir, "profile"), opts); err != nil {
+		log.Printf("[%s] Template rendering failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Rendering failed", http.StatusInternalServerError)
+		return
+	}
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
+
+// templateError answers for a catalog error: unknown and foreign templates
+// by status, anything else as a bad request.
+func templateError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, templates.ErrNotFound):
+		http.Error(w, "Template not found", http.StatusNotFound)
+	case errors.Is(err, templates.ErrNotOwner):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, os.ErrPermission):
+		log.Printf("[%s] Template catalog: %v", requestID(r), err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
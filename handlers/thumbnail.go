@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/utils"
+)
+
+// At most this many thumbnails are rendered per request.
+const maxThumbnails = 50
+
+var thumbnailTypes = map[string]string{
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"webp": "image/webp",
+}
+
+// HandleThumbnail renders preview images of a PDF at a fixed pixel width.
+// Options: pages ("1,3-5", default 1), width (pixels, default 200) or
+// dpi=auto (see converters.AutoDPI), and format (png, jpeg or webp). One
+// page answers with the image itself, several with a zip; name_template
+// (see nameTemplate) names the images.
+func (h *ConversionHandler) HandleThumbnail(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "thumbnail")
+	if !ok {
+		return
+	}
+
+	format := r.FormValue("format")
+	switch format {
+	case "":
+		format = "png"
+	case "jpg":
+		format = "jpeg"
+	}
+	contentType, known := thumbnailTypes[format]
+	if !known {
+		os.RemoveAll(tempDir)
+		http.Error(w, "format must be png, jpeg or webp", http.StatusBadRequest)
+		return
+	}
+	// dpi=auto renders each page at a resolution suited to its size and
+	// small print instead of a fixed width
+	autoDPI := r.FormValue("dpi") == "auto"
+	if v := r.FormValue("dpi"); v != "" && !autoDPI {
+		os.RemoveAll(tempDir)
+		http.Error(w, "dpi must be auto", http.StatusBadRequest)
+		return
+	}
+	width := 200
+	if v := r.FormValue("width"); v != "" && autoDPI {
+		os.RemoveAll(tempDir)
+		http.Error(w, "width and dpi=auto are exclusive", http.StatusBadRequest)
+		return
+	} else if v != "" {
+		var err error
+		if width, err = strconv.Atoi(v); err != nil || width < 16 || width > 2000 {
+			os.RemoveAll(tempDir)
+			http.Error(w, "width must be between 16 and 2000 pixels", http.StatusBadRequest)
+			return
+		}
+	}
+
+	naming, err := formNameTemplate(r, "basename", "index", "page", "ext")
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	basename := uploadBasename(inputPath)
+
+	pageCount, err := converters.PageCount(inputPath)
+	if err != nil {
+		log.Printf("[%s] Thumbnail page count failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Invalid PDF", http.StatusBadRequest)
+		return
+	}
+	spec := r.FormValue("pages")
+	if spec == "" {
+		spec = "1"
+	}
+	pages, err := converters.ParsePageRanges(spec, pageCount)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(pages) > maxThumbnails {
+		os.RemoveAll(tempDir)
+		http.Error(w, fmt.Sprintf("At most %d thumbnails per request", maxThumbnails), http.StatusBadRequest)
+		return
+	}
+
+	var dpis []int
+	if autoDPI {
+		if dpis, err = converters.AutoDPI(inputPath); err != nil || len(dpis) < pageCount {
+			log.Printf("[%s] Choosing thumbnail DPI failed: %v", reqID, err)
+			os.RemoveAll(tempDir)
+			http.Error(w, "Thumbnail generation failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var unique []int
+	seen := map[int]bool{}
+	for _, page := range pages {
+		if !seen[page] {
+			seen[page] = true
+			unique = append(unique, page)
+		}
+	}
+	images := make([]string, len(unique))
+	vars := make([]nameVars, len(unique))
+	render := func(i int) error {
+		page := unique[i]
+		prefix := filepath.Join(tempDir, fmt.Sprintf("page-%d", page))
+		var err error
+		if autoDPI {
+			images[i], err = converters.ThumbnailAtDPI(inputPath, prefix, page, dpis[page-1], format)
+		} else {
+			images[i], err = converters.Thumbnail(inputPath, prefix, page, width, format)
+		}
+		if err != nil {
+			return fmt.Errorf("page %d: %v", page, err)
+		}
+		vars[i] = nameVars{Basename: basename, Index: i + 1, Page: page, Last: page}
+		return nil
+	}
+	// Pages render side by side on idle Poppler workers when there are any
+	if pool := h.EngineManager.PopplerPool; pool != nil {
+		err = pool.Spread(len(unique), render)
+	} else {
+		for i := range unique {
+			if err = render(i); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("[%s] Thumbnail failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Thumbnail generation failed", http.StatusInternalServerError)
+		return
+	}
+	if images, ok = applyNameTemplate(w, naming, images, vars, tempDir); !ok {
+		return
+	}
+
+	if len(images) == 1 {
+		w.Header().Set("Content-Type", contentType)
+		h.serveAndCleanup(w, r, images[0], tempDir)
+		return
+	}
+	zipPath := filepath.Join(tempDir, "thumbnails.zip")
+	if err := utils.ZipFiles(zipPath, images); err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "Zipping failed", http.StatusInternalServerError)
+		return
+	}
+	h.serveAndCleanup(w, r, zipPath, tempDir)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/models"
+)
+
+// buildTOC renders a contents page listing titles with the page each
+// document starts on once the TOC itself is prepended. It re-renders once if
+// the TOC turns out longer than assumed.
+func (h *ConversionHandler) buildTOC(reqID, tempDir, heading string, titles []string, pageCounts []int) (string, error) {
+	if heading == "" {
+		heading = "Contents"
+	}
+	tocPages := 1
+	for attempt := 1; ; attempt++ {
+		dir := filepath.Join(tempDir, fmt.Sprintf("toc-%d", attempt))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+		mdPath := filepath.Join(dir, "toc.md")
+		md := converters.TOCMarkdown(heading, converters.TOCEntries(titles, pageCounts, tocPages))
+		if err := os.WriteFile(mdPath, []byte(md), 0644); err != nil {
+			return "", err
+		}
+		tocPath, err := h.runJob(h.EngineManager.PandocPool, models.Job{
+			ID:         reqID,
+			RequestID:  reqID,
+			InputPath:  mdPath,
+			FromFormat: "md",
+			ToFormat:   "pdf",
+			TempDir:    dir,
+		})
+		if err != nil {
+			return "", err
+		}
+		n, err := converters.PageCount(tocPath)
+		if err != nil {
+			return "", err
+		}
+		if n == tocPages || attempt == 2 {
+			return tocPath, nil
+		}
+		tocPages = n
+	}
+}
+
+// sourcePageCounts counts pages of merge inputs; images are one page each.
+func sourcePageCounts(paths []string, images bool) ([]int, error) {
+	counts := make([]int, len(paths))
+	for i, p := range paths {
+		if images {
+			counts[i] = 1
+			continue
+		}
+		n, err := converters.PageCount(p)
+		if err != nil {
+			return nil, err
+		}
+		counts[i] = n
+	}
+	return counts, nil
+}
+
+func tocTitle(filename string) string {
+	base := filepath.Base(filename)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// HandleTOC returns only the contents page for the uploaded files, numbered
+// as if it were prepended to them in upload order.
+func (h *ConversionHandler) HandleTOC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.parseUpload(w, r, "toc") {
+		return
+	}
+	files := r.MultipartForm.File["files"]
+	if len(files) == 0 {
+		http.Error(w, "At least 1 file required", http.StatusBadRequest)
+		return
+	}
+
+	reqID := requestID(r)
+	tempDir := filepath.Join("tmp", reqID)
+	os.MkdirAll(tempDir, 0755)
+
+	var inputPaths, titles []string
+	for i, fileHeader := range files {
+		if strings.ToLower(filepath.Ext(fileHeader.Filename)) != ".pdf" {
+			os.RemoveAll(tempDir)
+			http.Error(w, "Only PDF files are supported", http.StatusBadRequest)
+			return
+		}
+		src, _ := fileHeader.Open()
+		path := filepath.Join(tempDir, fmt.Sprintf("input_%d.pdf", i))
+		dst, _ := os.Create(path)
+		io.Copy(dst, src)
+		src.Close()
+		dst.Close()
+		inputPaths = append(inputPaths, path)
+		titles = append(titles, tocTitle(fileHeader.Filename))
+	}
+
+	counts, err := sourcePageCounts(inputPaths, false)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, "Invalid PDF", http.StatusBadRequest)
+		return
+	}
+	tocPath, err := h.buildTOC(reqID, tempDir, r.FormValue("toc_title"), titles, counts)
+	if err != nil {
+		log.Printf("[%s] TOC generation failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		if h.queueFull(w, err) {
+			return
+		}
+		http.Error(w, "TOC generation failed", http.StatusInternalServerError)
+		return
+	}
+
+	h.serveAndCleanup(w, r, tocPath, tempDir)
+}
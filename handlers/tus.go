@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akila/document-converter/auth"
+	"github.com/akila/document-converter/config"
+	"github.com/akila/document-converter/storage"
+	"github.com/google/uuid"
+)
+
+// Resumable uploads follow the tus protocol (https://tus.io, version 1.0.0
+// with the creation, termination and expiration extensions), so clients on
+// flaky connections can send large files in parts and pick up where they
+// left off. Parts are assembled on the node that received the upload, so
+// its requests need to reach that node; once complete, the file moves to
+// the upload store and its upload_id works with /convert like a presigned
+// upload's.
+
+const tusVersion = "1.0.0"
+
+// TusPath is where resumable uploads are created.
+const TusPath = "/uploads/tus"
+
+// tusUpload is an upload's state, kept next to its data.
+type tusUpload struct {
+	ID        string    `json:"id"`
+	Tenant    string    `json:"tenant"`
+	Filename  string    `json:"filename"`
+	Length    int64     `json:"length"`
+	Offset    int64     `json:"offset"`
+	Completed bool      `json:"completed"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// tusUploads serializes the requests to each upload.
+type tusUploads struct {
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+func (t *tusUploads) lock(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.busy == nil {
+		t.busy = map[string]bool{}
+	}
+	if t.busy[id] {
+		return false
+	}
+	t.busy[id] = true
+	return true
+}
+
+func (t *tusUploads) unlock(id string) {
+	t.mu.Lock()
+	delete(t.busy, id)
+	t.mu.Unlock()
+}
+
+// TusOptions sets the headers of a tus OPTIONS (discovery) response.
+func TusOptions(cfg *config.Config, header http.Header) {
+	header.Set("Tus-Resumable", tusVersion)
+	header.Set("Tus-Version", tusVersion)
+	header.Set("Tus-Extension", "creation,termination,expiration")
+	header.Set("Tus-Max-Size", strconv.FormatInt(cfg.Uploads.MaxBytes, 10))
+}
+
+func (h *ConversionHandler) tusDir() string {
+	return filepath.Join(h.Config.DataDir, "tus")
+}
+
+func (h *ConversionHandler) tusLoad(id string) (*tusUpload, error) {
+	if !uploadIDPattern.MatchString(id) {
+		return nil, os.ErrNotExist
+	}
+	data, err := os.ReadFile(filepath.Join(h.tusDir(), id+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var u tusUpload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (h *ConversionHandler) tusSave(u *tusUpload) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(h.tusDir(), u.ID+".json")
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (h *ConversionHandler) tusRemove(id string) {
+	os.Remove(filepath.Join(h.tusDir(), id))
+	os.Remove(filepath.Join(h.tusDir(), id+".json"))
+}
+
+// tusSweep removes expired uploads.
+func (h *ConversionHandler) tusSweep() {
+	entries, _ := os.ReadDir(h.tusDir())
+	now := time.Now()
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		if u, err := h.tusLoad(id); err == nil && now.After(u.ExpiresAt) && h.tus.lock(id) {
+			h.tusRemove(id)
+			h.tus.unlock(id)
+		}
+	}
+}
+
+// tusUploadFor loads the caller's upload named in the path, answering 404
+// (410 once expired) when there is none.
+func (h *ConversionHandler) tusUploadFor(w http.ResponseWriter, r *http.Request) (*tusUpload, bool) {
+	u, err := h.tusLoad(r.PathValue("id"))
+	if err != nil || u.Tenant != auth.Tenant(r.Context()) {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return nil, false
+	}
+	if time.Now().After(u.ExpiresAt) {
+		http.Error(w, "Upload expired", http.StatusGone)
+		return nil, false
+	}
+	return u, true
+}
+
+// tusPreamble answers with the protocol version and checks the client
+// speaks it. Clients must not get far without upload storage either.
+func (h *ConversionHandler) tusPreamble(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if v := r.Header.Get("Tus-Resumable"); v != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported Tus-Resumable version", http.StatusPreconditionFailed)
+		return false
+	}
+	if h.Config.Uploads.Bucket == "" {
+		http.Error(w, "Direct uploads are not configured", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// HandleTusCreate starts a resumable upload of Upload-Length bytes. The
+// Upload-Metadata "filename" names it, its extension becoming the
+// upload_id's. Answers 201 with the upload's URL in Location.
+func (h *ConversionHandler) HandleTusCreate(w http.ResponseWriter, r *http.Request) {
+	if !h.tusPreamble(w, r) {
+		return
+	}
+	cfg := h.Config.Uploads
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Upload-Length must be set (deferred lengths are not supported)", http.StatusBadRequest)
+		return
+	}
+	if length > cfg.MaxBytes {
+		http.Error(w, fmt.Sprintf("Upload exceeds the limit of %d bytes", cfg.MaxBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+	filename := tusMetadata(r.Header.Get("Upload-Metadata"))["filename"]
+	id := uuid.New().String() + strings.ToLower(filepath.Ext(filename))
+	if !uploadIDPattern.MatchString(id) {
+		http.Error(w, "Unsupported file extension", http.StatusBadRequest)
+		return
+	}
+
+	h.tusSweep()
+	if err := os.MkdirAll(h.tusDir(), 0755); err != nil {
+		log.Printf("[%s] Creating upload dir failed: %v", requestID(r), err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	u := &tusUpload{
+		ID:        id,
+		Tenant:    auth.Tenant(r.Context()),
+		Filename:  filepath.Base(filename),
+		Length:    length,
+		ExpiresAt: time.Now().Add(cfg.ResumableTTL),
+	}
+	f, err := os.Create(filepath.Join(h.tusDir(), id))
+	if err == nil {
+		f.Close()
+		err = h.tusSave(u)
+	}
+	if err != nil {
+		log.Printf("[%s] Creating upload failed: %v", requestID(r), err)
+		h.tusRemove(id)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[%s] Resumable upload %s started (%d bytes)", requestID(r), id, length)
+
+	w.Header().Set("Location", h.publicURL(r, TusPath+"/"+id))
+	w.Header().Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.Header().Set("X-Upload-ID", id)
+	if length == 0 {
+		// Nothing to wait for
+		if !h.tusComplete(w, r, u) {
+			return
+		}
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HandleTusHead reports how much of an upload has arrived.
+func (h *ConversionHandler) HandleTusHead(w http.ResponseWriter, r *http.Request) {
+	if !h.tusPreamble(w, r) {
+		return
+	}
+	u, ok := h.tusUploadFor(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+	w.Header().Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleTusPatch appends a part at Upload-Offset, which must be the bytes
+// received so far. The last part moves the file to the upload store.
+func (h *ConversionHandler) HandleTusPatch(w http.ResponseWriter, r *http.Request) {
+	if !h.tusPreamble(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+	id := r.PathValue("id")
+	if !h.tus.lock(id) {
+		http.Error(w, "Upload is busy with another request", http.StatusConflict)
+		return
+	}
+	defer h.tus.unlock(id)
+	u, ok := h.tusUploadFor(w, r)
+	if !ok {
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != u.Offset || u.Completed {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+		http.Error(w, "Upload-Offset does not match the upload", http.StatusConflict)
+		return
+	}
+
+	f, err := os.OpenFile(filepath.Join(h.tusDir(), id), os.O_WRONLY, 0)
+	if err != nil {
+		log.Printf("[%s] Opening upload %s failed: %v", requestID(r), id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// What arrived before a dropped connection counts; the client resumes
+	// from the offset HEAD reports
+	f.Truncate(offset)
+	f.Seek(offset, io.SeekStart)
+	n, copyErr := io.Copy(f, io.LimitReader(r.Body, u.Length-offset+1))
+	if copyErr == nil && offset+n > u.Length {
+		copyErr = errors.New("body runs past Upload-Length")
+		n = u.Length - offset
+		f.Truncate(u.Length)
+	}
+	if err := f.Close(); copyErr == nil {
+		copyErr = err
+	}
+	u.Offset += n
+	if err := h.tusSave(u); err != nil {
+		log.Printf("[%s] Saving upload %s failed: %v", requestID(r), id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	if copyErr != nil {
+		log.Printf("[%s] Upload %s part ended early at %d: %v", requestID(r), id, u.Offset, copyErr)
+		http.Error(w, "Part incomplete; resume from Upload-Offset", http.StatusBadRequest)
+		return
+	}
+	if u.Offset == u.Length && !h.tusComplete(w, r, u) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusComplete moves a fully received upload to the upload store, where
+// /convert finds it by upload_id. The upload's state stays until it
+// expires, so HEAD keeps reporting it complete.
+func (h *ConversionHandler) tusComplete(w http.ResponseWriter, r *http.Request, u *tusUpload) bool {
+	cfg := h.Config.Uploads
+	store, err := storage.Open(h.Config, cfg.Provider, cfg.Bucket)
+	if err == nil {
+		err = storage.PutFile(store, uploadKey(u.ID), filepath.Join(h.tusDir(), u.ID), "")
+	}
+	if err != nil {
+		log.Printf("[%s] Storing upload %s failed: %v", requestID(r), u.ID, err)
+		http.Error(w, "Storing the upload failed; retry an empty PATCH at the final offset", http.StatusInternalServerError)
+		return false
+	}
+	os.Remove(filepath.Join(h.tusDir(), u.ID))
+	u.Completed = true
+	h.tusSave(u)
+	log.Printf("[%s] Resumable upload %s complete", requestID(r), u.ID)
+	w.Header().Set("X-Upload-ID", u.ID)
+	return true
+}
+
+// HandleTusDelete abandons an upload.
+func (h *ConversionHandler) HandleTusDelete(w http.ResponseWriter, r *http.Request) {
+	if !h.tusPreamble(w, r) {
+		return
+	}
+	id := r.PathValue("id")
+	if !h.tus.lock(id) {
+		http.Error(w, "Upload is busy with another request", http.StatusConflict)
+		return
+	}
+	defer h.tus.unlock(id)
+	u, ok := h.tusUploadFor(w, r)
+	if !ok {
+		return
+	}
+	h.tusRemove(u.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusMetadata decodes Upload-Metadata: comma separated "key base64value"
+// pairs.
+func tusMetadata(header string) map[string]string {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		metadata[key] = string(decoded)
+	}
+	return metadata
+}
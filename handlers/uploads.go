@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/akila/document-converter/storage"
+	"github.com/google/uuid"
+)
+
+// Upload IDs are a UUID plus the original extension; the object lives at
+// uploads/<id> so any API node can find it without shared state.
+var uploadIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}(\.[a-z0-9]{1,10})?$`)
+
+func uploadKey(uploadID string) string {
+	return "uploads/" + uploadID
+}
+
+// HandleUploadPresign returns a presigned PUT URL so large files go straight
+// from the client to object storage. The returned upload_id is then passed
+// to /convert instead of a file.
+func (h *ConversionHandler) HandleUploadPresign(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg := h.Config.Uploads
+	if cfg.Bucket == "" {
+		http.Error(w, "Direct uploads are not configured", http.StatusNotFound)
+		return
+	}
+	store, err := storage.Open(h.Config, cfg.Provider, cfg.Bucket)
+	if err != nil {
+		log.Printf("Upload storage unavailable: %v", err)
+		http.Error(w, "Direct uploads are not configured", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Filename string `json:"filename"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		http.Error(w, "Body must be JSON with a filename", http.StatusBadRequest)
+		return
+	}
+	ext := strings.ToLower(filepath.Ext(req.Filename))
+	uploadID := uuid.New().String() + ext
+	if !uploadIDPattern.MatchString(uploadID) {
+		http.Error(w, "Unsupported file extension", http.StatusBadRequest)
+		return
+	}
+
+	uploadURL, err := store.SignURL(http.MethodPut, uploadKey(uploadID), cfg.URLTTL)
+	if err != nil {
+		log.Printf("Signing upload URL failed: %v", err)
+		http.Error(w, "Direct uploads are not configured", http.StatusNotFound)
+		return
+	}
+
+	response := map[string]interface{}{
+		"upload_id":  uploadID,
+		"upload_url": uploadURL,
+		"method":     http.MethodPut,
+		"expires_at": time.Now().Add(cfg.URLTTL).UTC(),
+		"max_bytes":  cfg.MaxBytes,
+	}
+	// Headers the PUT must carry, e.g. Azure's blob type
+	if headers := storage.UploadHeaders(store); headers != nil {
+		response["headers"] = headers
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// fetchUpload downloads a presigned upload to path and removes the object.
+func (h *ConversionHandler) fetchUpload(uploadID, path string) error {
+	cfg := h.Config.Uploads
+	if cfg.Bucket == "" {
+		return fmt.Errorf("direct uploads are not configured")
+	}
+	store, err := storage.Open(h.Config, cfg.Provider, cfg.Bucket)
+	if err != nil {
+		return err
+	}
+	key := uploadKey(uploadID)
+	rc, size, err := store.Get(key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if size > cfg.MaxBytes {
+		store.Delete(key)
+		return fmt.Errorf("upload too large (%d bytes)", size)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	// The size may be unknown, so the copy is bounded too
+	n, err := io.Copy(f, io.LimitReader(rc, cfg.MaxBytes+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > cfg.MaxBytes {
+		err = fmt.Errorf("upload too large (more than %d bytes)", cfg.MaxBytes)
+	}
+	if err != nil {
+		store.Delete(key)
+		return err
+	}
+	return store.Delete(key)
+}
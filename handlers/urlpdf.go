@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akila/document-converter/converters"
+)
+
+// HandleConvertURL renders the web page at "url" to PDF with headless
+// Chromium, which handles real-world pages (scripts, web fonts, modern CSS)
+// far better than LibreOffice's HTML import. Options:
+//   - paper: letter (default), legal, tabloid, a3, a4 or a5
+//   - landscape: true for landscape
+//   - margin: all four margins, e.g. "10mm" or "0.5in" (default 0.4in);
+//     margin_top, margin_right, margin_bottom and margin_left override it
+//   - background: false to leave out background colors and images
+//   - wait_until: load (default) or networkidle, for pages that fetch their
+//     content with scripts
+//   - timeout: seconds to allow for loading and printing (default 60, at
+//     most 120)
+//
+// Like a source_url, the page and everything it loads (redirects, images,
+// scripts' requests) may only come from public addresses and
+// SOURCE_URL_PRIVATE_HOSTS.
+func (h *ConversionHandler) HandleConvertURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	target, err := url.Parse(strings.TrimSpace(r.FormValue("url")))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		http.Error(w, "url must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+	privateHosts := h.Config.SourceURL.PrivateHosts
+	if !slices.Contains(privateHosts, strings.ToLower(target.Hostname())) {
+		var blocked *blockedAddressError
+		if _, err := publicAddresses(r.Context(), target.Hostname()); errors.As(err, &blocked) {
+			http.Error(w, "url "+blocked.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	opts, err := printOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.Dial = publicDialer(privateHosts)
+
+	reqID := requestID(r)
+	tempDir := filepath.Join("tmp", reqID)
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		log.Printf("[%s] Failed to create temp dir: %v", reqID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[%s] Rendering %s", reqID, target.Redacted())
+
+	outputPath := filepath.Join(tempDir, "page.pdf")
+	if err := converters.URLToPDF(target.String(), outputPath, filepath.Join(tempDir, "profile"), opts); err != nil {
+		log.Printf("[%s] URL rendering failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Rendering failed", http.StatusBadGateway)
+		return
+	}
+
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
+
+// HandleConvertHTML renders an HTML page to PDF with Chromium (or
+// wkhtmltopdf), keeping its styling and images: "file" is a zip of the page
+// with its CSS, images and fonts, or a single .html file. The zip's
+// index.html is rendered, or failing that its only HTML file; relative
+// links resolve within the zip. Options as for /convert/url. The page may
+// only load files from its bundle: anything else, scripts' requests
+// included, is refused.
+func (h *ConversionHandler) HandleConvertHTML(w http.ResponseWriter, r *http.Request) {
+	reqID, tempDir, inputPath, ok := h.receiveFile(w, r, "convert.html")
+	if !ok {
+		return
+	}
+	opts, err := printOptions(r)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	siteDir := filepath.Join(tempDir, "site")
+	entry, err := unpackSite(inputPath, siteDir)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("[%s] Rendering HTML bundle entry %s", reqID, entry)
+
+	outputPath := filepath.Join(tempDir, strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))+".pdf")
+	if err := converters.HTMLToPDF(siteDir, entry, outputPath, filepath.Join(tempDir, "profile"), opts); err != nil {
+		log.Printf("[%s] HTML rendering failed: %v", reqID, err)
+		os.RemoveAll(tempDir)
+		http.Error(w, "Rendering failed", http.StatusInternalServerError)
+		return
+	}
+
+	h.serveAndCleanup(w, r, outputPath, tempDir)
+}
+
+// unpackSite lays out an uploaded page in siteDir: a zip bundle is
+// expanded, a single .html file moved there. It returns the page to render
+// (see htmlEntry), relative to siteDir.
+func unpackSite(inputPath, siteDir string) (string, error) {
+	switch strings.ToLower(filepath.Ext(inputPath)) {
+	case ".zip":
+		files, err := expandZip(inputPath, siteDir, batchMaxFiles, false)
+		if err != nil {
+			return "", err
+		}
+		return htmlEntry(files)
+	case ".html", ".htm":
+		entry := filepath.Base(inputPath)
+		if err := os.MkdirAll(siteDir, 0755); err != nil {
+			return "", err
+		}
+		return entry, os.Rename(inputPath, filepath.Join(siteDir, entry))
+	}
+	return "", fmt.Errorf("file must be a .zip bundle or an .html file")
+}
+
+// htmlEntry picks the page to render from a bundle: the shallowest
+// index.html (zipping a folder adds one directory level), else the only
+// HTML file.
+func htmlEntry(files []batchInput) (string, error) {
+	var index, pages []string
+	for _, f := range files {
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".html", ".htm":
+			pages = append(pages, f.Name)
+			if base := strings.ToLower(path.Base(f.Name)); base == "index.html" || base == "index.htm" {
+				index = append(index, f.Name)
+			}
+		}
+	}
+	sort.SliceStable(index, func(i, j int) bool {
+		return strings.Count(index[i], "/") < strings.Count(index[j], "/")
+	})
+	switch {
+	case len(index) > 0:
+		return index[0], nil
+	case len(pages) == 1:
+		return pages[0], nil
+	case len(pages) == 0:
+		return "", fmt.Errorf("the zip contains no HTML page")
+	}
+	return "", fmt.Errorf("the zip has several HTML pages but no index.html")
+}
+
+func printOptions(r *http.Request) (converters.PrintOptions, error) {
+	opts := converters.PrintOptions{PrintBackground: true, Timeout: 60 * time.Second}
+
+	paper := strings.ToLower(r.FormValue("paper"))
+	if paper == "" {
+		paper = "letter"
+	}
+	size, ok := converters.PaperSizes[paper]
+	if !ok {
+		return opts, fmt.Errorf("unknown paper size: %s", paper)
+	}
+	opts.PaperWidth, opts.PaperHeight = size[0], size[1]
+	opts.Landscape = r.FormValue("landscape") == "true"
+	if v := r.FormValue("background"); v != "" {
+		opts.PrintBackground = v != "false"
+	}
+
+	margin := 0.4
+	if v := r.FormValue("margin"); v != "" {
+		var err error
+		if margin, err = converters.ParseLength(v); err != nil {
+			return opts, fmt.Errorf("margin: %v", err)
+		}
+	}
+	for field, dst := range map[string]*float64{
+		"margin_top":    &opts.MarginTop,
+		"margin_right":  &opts.MarginRight,
+		"margin_bottom": &opts.MarginBottom,
+		"margin_left":   &opts.MarginLeft,
+	} {
+		*dst = margin
+		if v := r.FormValue(field); v != "" {
+			length, err := converters.ParseLength(v)
+			if err != nil {
+				return opts, fmt.Errorf("%s: %v", field, err)
+			}
+			*dst = length
+		}
+	}
+
+	switch wait := strings.ToLower(r.FormValue("wait_until")); wait {
+	case "", "load":
+	case "networkidle":
+		opts.WaitNetworkIdle = true
+	default:
+		return opts, fmt.Errorf("wait_until must be load or networkidle")
+	}
+	if v := r.FormValue("timeout"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 1 || seconds > 120 {
+			return opts, fmt.Errorf("timeout must be between 1 and 120 seconds")
+		}
+		opts.Timeout = time.Duration(seconds) * time.Second
+	}
+	return opts, nil
+}
@@ -0,0 +1,247 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Config is the JSON post-processing hooks file. Every hook matching an
+// artifact's operation runs on it, in order, before it is served or stored.
+type Config struct {
+	Hooks []Hook `json:"hooks"`
+}
+
+// Hook is an external command or an HTTP endpoint, e.g. a customer's
+// stamping tool or a DLP scanner.
+type Hook struct {
+	Name string `json:"name"`
+	// Command runs with the artifact's path in place of a "{file}"
+	// argument, or appended. It may change the file; a non-zero exit is a
+	// failure.
+	Command []string `json:"command"`
+	// URL receives the artifact as a POST body. 200 with a body replaces
+	// the artifact, 204 (or an empty 200) keeps it; other statuses fail.
+	URL string `json:"url"`
+	// Timeout is a Go duration, default 30s.
+	Timeout string `json:"timeout"`
+	// OnFailure is "block" (the default: the artifact is withheld and the
+	// request fails) or "warn" (logged, the artifact goes out unchanged).
+	OnFailure string `json:"on_failure"`
+	// Operations are globs of operation names the hook applies to, e.g.
+	// ["convert", "simple-*"]. Empty applies to all.
+	Operations []string `json:"operations"`
+
+	timeout time.Duration
+}
+
+// BlockedError is a failure of a blocking hook.
+type BlockedError struct {
+	Hook string
+	Err  error
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("post-processing hook %s failed: %v", e.Hook, e.Err)
+}
+
+func Load(configPath string) (*Config, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid hooks file %s: %v", configPath, err)
+	}
+	for i := range cfg.Hooks {
+		h := &cfg.Hooks[i]
+		if h.Name == "" {
+			h.Name = fmt.Sprintf("#%d", i+1)
+		}
+		if (len(h.Command) == 0) == (h.URL == "") {
+			return nil, fmt.Errorf("hook %s: set exactly one of command and url", h.Name)
+		}
+		switch h.OnFailure {
+		case "":
+			h.OnFailure = "block"
+		case "block", "warn":
+		default:
+			return nil, fmt.Errorf("hook %s: on_failure must be block or warn", h.Name)
+		}
+		h.timeout = 30 * time.Second
+		if h.Timeout != "" {
+			if h.timeout, err = time.ParseDuration(h.Timeout); err != nil || h.timeout <= 0 {
+				return nil, fmt.Errorf("hook %s: invalid timeout %q", h.Name, h.Timeout)
+			}
+		}
+		for _, pattern := range h.Operations {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("hook %s: invalid operation pattern %q", h.Name, pattern)
+			}
+		}
+	}
+	return &cfg, nil
+}
+
+func (h *Hook) applies(operation string) bool {
+	if len(h.Operations) == 0 {
+		return true
+	}
+	for _, pattern := range h.Operations {
+		if ok, _ := path.Match(pattern, operation); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Run passes the artifact at file, produced by operation, through the
+// matching hooks. Each works on a copy that replaces file only when the
+// hook succeeds. A failing blocking hook stops the run with a
+// *BlockedError. A nil Config does nothing.
+func (c *Config) Run(reqID, operation, file string) error {
+	if c == nil {
+		return nil
+	}
+	for i := range c.Hooks {
+		h := &c.Hooks[i]
+		if !h.applies(operation) {
+			continue
+		}
+		start := time.Now()
+		err := h.run(operation, file)
+		if err == nil {
+			log.Printf("[%s] Post-processing hook %s done in %v", reqID, h.Name, time.Since(start).Round(time.Millisecond))
+			continue
+		}
+		if h.OnFailure == "warn" {
+			log.Printf("[%s] Post-processing hook %s failed, continuing: %v", reqID, h.Name, err)
+			continue
+		}
+		log.Printf("[%s] Post-processing hook %s failed, blocking: %v", reqID, h.Name, err)
+		return &BlockedError{Hook: h.Name, Err: err}
+	}
+	return nil
+}
+
+func (h *Hook) run(operation, file string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	work, err := copyAside(file)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(work)
+	if len(h.Command) > 0 {
+		err = h.runCommand(ctx, operation, work)
+	} else {
+		err = h.post(ctx, operation, filepath.Base(file), work)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %v", h.timeout)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(work, file)
+}
+
+func (h *Hook) runCommand(ctx context.Context, operation, file string) error {
+	args := make([]string, 0, len(h.Command))
+	placed := false
+	for _, arg := range h.Command[1:] {
+		if strings.Contains(arg, "{file}") {
+			arg, placed = strings.ReplaceAll(arg, "{file}", file), true
+		}
+		args = append(args, arg)
+	}
+	if !placed {
+		args = append(args, file)
+	}
+	cmd := exec.CommandContext(ctx, h.Command[0], args...)
+	cmd.Env = append(os.Environ(), "HOOK_OPERATION="+operation)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v, output: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+func (h *Hook) post(ctx context.Context, operation, name, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, f)
+	if err != nil {
+		return err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Hook-Operation", operation)
+	req.Header.Set("X-Hook-Filename", name)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusOK:
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s, body: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	// The response replaces the artifact, unless empty
+	replaced := file + ".response"
+	out, err := os.Create(replaced)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, resp.Body)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || n == 0 {
+		os.Remove(replaced)
+		return err
+	}
+	return os.Rename(replaced, file)
+}
+
+// copyAside copies file next to itself for a hook to work on.
+func copyAside(file string) (string, error) {
+	in, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(file), ".hook-*"+filepath.Ext(file))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), out.Close()
+}
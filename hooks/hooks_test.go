@@ -0,0 +1,147 @@
+package hooks
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadHooks(t *testing.T, hooks string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hooks.json")
+	if err := os.WriteFile(path, []byte(hooks), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+func TestApplies(t *testing.T) {
+	for _, tc := range []struct {
+		operations []string
+		operation  string
+		want       bool
+	}{
+		{nil, "convert", true},
+		{[]string{"convert"}, "convert", true},
+		{[]string{"convert"}, "convert.url", false},
+		{[]string{"convert*"}, "convert.url", true},
+		{[]string{"simple-*"}, "simple-convert", true},
+		{[]string{"simple-*"}, "convert", false},
+		{[]string{"merge", "split"}, "split", true},
+		{[]string{"merge", "split"}, "compress", false},
+	} {
+		h := Hook{Operations: tc.operations}
+		if got := h.applies(tc.operation); got != tc.want {
+			t.Errorf("hook for %q applies to %s = %v, want %v", tc.operations, tc.operation, got, tc.want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	for _, tc := range []struct {
+		hooks   string
+		wantErr bool
+	}{
+		{`{"hooks": [{"command": ["true"]}, {"url": "http://scanner.internal/scan", "on_failure": "warn", "timeout": "5s"}]}`, false},
+		{`{"hooks": [{"name": "both", "command": ["true"], "url": "http://scanner.internal/scan"}]}`, true},
+		{`{"hooks": [{"name": "neither"}]}`, true},
+		{`{"hooks": [{"command": ["true"], "on_failure": "ignore"}]}`, true},
+		{`{"hooks": [{"command": ["true"], "timeout": "soon"}]}`, true},
+		{`{"hooks": [{"command": ["true"], "timeout": "-1s"}]}`, true},
+		{`{"hooks": [{"command": ["true"], "operations": ["[convert"]}]}`, true},
+	} {
+		if _, err := loadHooks(t, tc.hooks); (err != nil) != tc.wantErr {
+			t.Errorf("Load(%s) error = %v, want error %v", tc.hooks, err, tc.wantErr)
+		}
+	}
+
+	cfg, _ := loadHooks(t, `{"hooks": [{"command": ["true"]}]}`)
+	if h := cfg.Hooks[0]; h.Name != "#1" || h.OnFailure != "block" || h.timeout.String() != "30s" {
+		t.Errorf("defaults: name %q, on_failure %q, timeout %v", h.Name, h.OnFailure, h.timeout)
+	}
+}
+
+func TestRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/stamp":
+			w.Write(append(body, " stamped by "+r.Header.Get("X-Hook-Operation")...))
+		case "/scan":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "infected", http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name      string
+		hooks     string
+		operation string
+		want      string
+		blockedBy string
+	}{
+		{
+			"url hook replaces the artifact",
+			`{"hooks": [{"url": "` + server.URL + `/stamp"}]}`,
+			"convert", "report stamped by convert", "",
+		},
+		{
+			"204 keeps it",
+			`{"hooks": [{"url": "` + server.URL + `/scan"}]}`,
+			"convert", "report", "",
+		},
+		{
+			"command hook changes it in place",
+			`{"hooks": [{"command": ["sh", "-c", "printf ' for %s' \"$HOOK_OPERATION\" >> \"$0\"", "{file}"]}]}`,
+			"merge", "report for merge", "",
+		},
+		{
+			"hooks for other operations are skipped",
+			`{"hooks": [{"url": "` + server.URL + `/stamp", "operations": ["split"]}]}`,
+			"merge", "report", "",
+		},
+		{
+			"failing warn hook leaves it unchanged",
+			`{"hooks": [{"url": "` + server.URL + `/reject", "on_failure": "warn"}, {"url": "` + server.URL + `/stamp"}]}`,
+			"convert", "report stamped by convert", "",
+		},
+		{
+			"failing blocking hook stops the run",
+			`{"hooks": [{"name": "dlp", "url": "` + server.URL + `/reject"}, {"url": "` + server.URL + `/stamp"}]}`,
+			"convert", "report", "dlp",
+		},
+		{
+			"failed command is not applied",
+			`{"hooks": [{"name": "broken", "command": ["sh", "-c", "echo changed > \"$0\"; exit 1", "{file}"]}]}`,
+			"convert", "report", "broken",
+		},
+	} {
+		cfg, err := loadHooks(t, tc.hooks)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		file := filepath.Join(t.TempDir(), "report.txt")
+		if err := os.WriteFile(file, []byte("report"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err = cfg.Run("req", tc.operation, file)
+		var blocked *BlockedError
+		if errors.As(err, &blocked) != (tc.blockedBy != "") || (blocked != nil && blocked.Hook != tc.blockedBy) {
+			t.Errorf("%s: Run = %v, want blocked by %q", tc.name, err, tc.blockedBy)
+		}
+		if got, _ := os.ReadFile(file); string(got) != tc.want {
+			t.Errorf("%s: artifact %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	var none *Config
+	if err := none.Run("req", "convert", "missing.pdf"); err != nil {
+		t.Errorf("nil config: %v", err)
+	}
+}
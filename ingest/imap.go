@@ -0,0 +1,382 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IMAPConfig describes a mailbox whose incoming mail attachments are
+// converted according to Rules.
+type IMAPConfig struct {
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	TLS         *bool  `json:"tls"` // default true (imaps)
+	User        string `json:"user"`
+	Password    string `json:"password"`
+	PasswordEnv string `json:"password_env"` // read the password from this variable instead
+	Mailbox     string `json:"mailbox"`
+	Interval    string `json:"interval"`
+
+	// Rules are matched in order against attachment file names; the first
+	// match wins. A rule with an empty pipeline skips the attachment.
+	Rules []IMAPRule `json:"rules"`
+
+	// ProcessedMailbox receives handled messages; otherwise they are only
+	// marked \Seen.
+	ProcessedMailbox string `json:"processed_mailbox"`
+	// OutboxDir files results locally as <date>/<message-uid>/<name>.
+	OutboxDir string `json:"outbox_dir"`
+	// Reply sends results back to the sender when SMTP is configured.
+	Reply bool        `json:"reply"`
+	SMTP  *SMTPConfig `json:"smtp"`
+}
+
+type IMAPRule struct {
+	Match    string `json:"match"` // glob on the lower-cased file name, e.g. "*.docx"
+	Pipeline string `json:"pipeline"`
+}
+
+func (c *IMAPConfig) pipelineFor(filename string) string {
+	name := strings.ToLower(filename)
+	for _, rule := range c.Rules {
+		if ok, _ := path.Match(strings.ToLower(rule.Match), name); ok {
+			return rule.Pipeline
+		}
+	}
+	return ""
+}
+
+// LoadIMAPConfig reads and validates the mailbox configuration at path.
+func LoadIMAPConfig(path string) (*IMAPConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg IMAPConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid IMAP config %s: %v", path, err)
+	}
+	if cfg.Host == "" || cfg.User == "" || len(cfg.Rules) == 0 {
+		return nil, fmt.Errorf("IMAP config: host, user and rules are required")
+	}
+	if cfg.PasswordEnv != "" {
+		cfg.Password = os.Getenv(cfg.PasswordEnv)
+	}
+	if cfg.TLS == nil {
+		on := true
+		cfg.TLS = &on
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 143
+		if *cfg.TLS {
+			cfg.Port = 993
+		}
+	}
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = "INBOX"
+	}
+	if cfg.Reply && cfg.SMTP == nil {
+		return nil, fmt.Errorf("IMAP config: reply requires smtp settings")
+	}
+	if !cfg.Reply && cfg.OutboxDir == "" {
+		return nil, fmt.Errorf("IMAP config: set reply or outbox_dir so results go somewhere")
+	}
+	return &cfg, nil
+}
+
+// IMAPPoller converts attachments of unseen messages in one mailbox.
+type IMAPPoller struct {
+	cfg       *IMAPConfig
+	processor Processor
+	interval  time.Duration
+}
+
+func NewIMAPPoller(cfg *IMAPConfig, processor Processor) *IMAPPoller {
+	interval, err := time.ParseDuration(cfg.Interval)
+	if err != nil || interval <= 0 {
+		interval = time.Minute
+	}
+	return &IMAPPoller{cfg: cfg, processor: processor, interval: interval}
+}
+
+func (p *IMAPPoller) Run(ctx context.Context) {
+	log.Printf("IMAP poller %s@%s/%s started (every %s)", p.cfg.User, p.cfg.Host, p.cfg.Mailbox, p.interval)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		if !p.processor.Paused() {
+			if err := p.poll(); err != nil {
+				log.Printf("IMAP %s: %v", p.cfg.Host, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *IMAPPoller) poll() error {
+	c, err := dialIMAP(p.cfg.Host, p.cfg.Port, *p.cfg.TLS)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	if _, err := c.command("LOGIN " + imapQuote(p.cfg.User) + " " + imapQuote(p.cfg.Password)); err != nil {
+		return fmt.Errorf("login failed: %v", err)
+	}
+	if _, err := c.command("SELECT " + imapQuote(p.cfg.Mailbox)); err != nil {
+		return err
+	}
+	lines, err := c.command("UID SEARCH UNSEEN")
+	if err != nil {
+		return err
+	}
+
+	var uids []string
+	for _, line := range lines {
+		if strings.HasPrefix(line.text, "* SEARCH") {
+			uids = append(uids, strings.Fields(strings.TrimPrefix(line.text, "* SEARCH"))...)
+		}
+	}
+
+	for _, uid := range uids {
+		lines, err := c.command("UID FETCH " + uid + " BODY.PEEK[]")
+		if err != nil {
+			log.Printf("IMAP fetch %s failed: %v", uid, err)
+			continue
+		}
+		var raw []byte
+		for _, line := range lines {
+			if len(line.literals) > 0 {
+				raw = line.literals[0]
+				break
+			}
+		}
+		if raw == nil {
+			continue
+		}
+
+		p.handleMessage(uid, raw)
+
+		if p.cfg.ProcessedMailbox != "" {
+			if _, err := c.command("UID MOVE " + uid + " " + imapQuote(p.cfg.ProcessedMailbox)); err == nil {
+				continue
+			}
+		}
+		if _, err := c.command("UID STORE " + uid + ` +FLAGS (\Seen)`); err != nil {
+			log.Printf("IMAP marking %s seen failed: %v", uid, err)
+		}
+	}
+
+	c.command("LOGOUT")
+	return nil
+}
+
+func (p *IMAPPoller) handleMessage(uid string, raw []byte) {
+	reqID, tempDir, err := newWorkDir()
+	if err != nil {
+		log.Printf("IMAP: failed to create temp dir: %v", err)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	msg, err := parseMail(raw)
+	if err != nil {
+		log.Printf("[%s] IMAP message %s unreadable: %v", reqID, uid, err)
+		return
+	}
+	log.Printf("[%s] IMAP message %s from %s: %q, %d attachment(s)", reqID, uid, msg.From, msg.Subject, len(msg.Attachments))
+
+	var results []string
+	for i, att := range msg.Attachments {
+		pipeline := p.cfg.pipelineFor(att.Filename)
+		if pipeline == "" {
+			continue
+		}
+		attDir := filepath.Join(tempDir, fmt.Sprintf("att-%d", i+1))
+		if err := os.MkdirAll(attDir, 0755); err != nil {
+			continue
+		}
+		inputPath := filepath.Join(attDir, att.Filename)
+		if err := os.WriteFile(inputPath, att.Data, 0644); err != nil {
+			continue
+		}
+		output, err := p.processor.ProcessFile(reqID, attDir, inputPath, pipeline)
+		if err != nil {
+			log.Printf("[%s] IMAP attachment %s failed: %v", reqID, att.Filename, err)
+			continue
+		}
+		named := filepath.Join(attDir, strings.TrimSuffix(att.Filename, filepath.Ext(att.Filename))+filepath.Ext(output))
+		if named != output && os.Rename(output, named) == nil {
+			output = named
+		}
+		results = append(results, output)
+	}
+	if len(results) == 0 {
+		return
+	}
+
+	if p.cfg.OutboxDir != "" {
+		dir := filepath.Join(p.cfg.OutboxDir, time.Now().Format("2006-01-02"), uid)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Printf("[%s] IMAP outbox: %v", reqID, err)
+		}
+		for _, r := range results {
+			if err := copyFile(r, filepath.Join(dir, filepath.Base(r))); err != nil {
+				log.Printf("[%s] IMAP outbox: %v", reqID, err)
+			}
+		}
+	}
+	if p.cfg.Reply {
+		if err := sendReply(p.cfg.SMTP, msg, results); err != nil {
+			log.Printf("[%s] IMAP reply failed: %v", reqID, err)
+		}
+	}
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// StartIMAP launches the mailbox poller described by configPath.
+func StartIMAP(ctx context.Context, configPath string, processor Processor) error {
+	cfg, err := LoadIMAPConfig(configPath)
+	if err != nil {
+		return err
+	}
+	go NewIMAPPoller(cfg, processor).Run(ctx)
+	return nil
+}
+
+// imapConn is a minimal IMAP4rev1 client: enough to log in, search, fetch
+// whole messages and update flags.
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapLine is one response line with any literals it carried.
+type imapLine struct {
+	text     string
+	literals [][]byte
+}
+
+func dialIMAP(host string, port int, useTLS bool) (*imapConn, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+	greeting, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting.text, "* OK") && !strings.HasPrefix(greeting.text, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected IMAP greeting: %s", greeting.text)
+	}
+	return c, nil
+}
+
+func (c *imapConn) close() {
+	c.conn.Close()
+}
+
+// readLine reads a response line, pulling in "{n}" literals as it goes.
+func (c *imapConn) readLine() (imapLine, error) {
+	var line imapLine
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(2 * time.Minute))
+		part, err := c.r.ReadString('\n')
+		if err != nil {
+			return line, err
+		}
+		part = strings.TrimRight(part, "\r\n")
+		line.text += part
+
+		if !strings.HasSuffix(part, "}") {
+			return line, nil
+		}
+		open := strings.LastIndexByte(part, '{')
+		if open < 0 {
+			return line, nil
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(part[open+1:len(part)-1], "+"))
+		if err != nil {
+			return line, nil
+		}
+		literal := make([]byte, n)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return line, err
+		}
+		line.literals = append(line.literals, literal)
+	}
+}
+
+// command sends one tagged command and returns the untagged responses.
+func (c *imapConn) command(cmd string) ([]imapLine, error) {
+	c.tag++
+	tag := fmt.Sprintf("A%04d", c.tag)
+	c.conn.SetWriteDeadline(time.Now().Add(time.Minute))
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, cmd); err != nil {
+		return nil, err
+	}
+
+	var lines []imapLine
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(line.text, tag+" ") {
+			status := strings.TrimPrefix(line.text, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				return lines, fmt.Errorf("IMAP %s: %s", strings.Fields(cmd)[0], status)
+			}
+			return lines, nil
+		}
+		lines = append(lines, line)
+	}
+}
+
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,25 @@
+package ingest
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+)
+
+// Processor runs a pipeline spec (e.g. "convert:pdf,compress") on a local
+// file and returns the path of the result inside tempDir.
+type Processor interface {
+	ProcessFile(reqID, tempDir, inputPath, pipeline string) (string, error)
+	// Paused reports whether ingestion should hold off for now, e.g. while
+	// the service is in maintenance mode. Pollers skip their rounds then.
+	Paused() bool
+}
+
+// newWorkDir creates a per-file temp directory under tmp/, matching the
+// layout used by the HTTP handlers.
+func newWorkDir() (reqID, dir string, err error) {
+	reqID = uuid.New().String()
+	dir = filepath.Join("tmp", reqID)
+	return reqID, dir, os.MkdirAll(dir, 0755)
+}
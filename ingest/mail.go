@@ -0,0 +1,215 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPConfig is used to send results back to the sender.
+type SMTPConfig struct {
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	User        string `json:"user"`
+	Password    string `json:"password"`
+	PasswordEnv string `json:"password_env"`
+	From        string `json:"from"`
+}
+
+type mailAttachment struct {
+	Filename string
+	Data     []byte
+}
+
+type mailMessage struct {
+	MessageID   string
+	From        string
+	ReplyTo     string
+	Subject     string
+	Attachments []mailAttachment
+}
+
+var wordDecoder = &mime.WordDecoder{}
+
+func parseMail(raw []byte) (*mailMessage, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	subject, err := wordDecoder.DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		subject = m.Header.Get("Subject")
+	}
+	msg := &mailMessage{
+		MessageID: m.Header.Get("Message-Id"),
+		From:      m.Header.Get("From"),
+		ReplyTo:   m.Header.Get("Reply-To"),
+		Subject:   subject,
+	}
+	err = walkParts(textproto.MIMEHeader(m.Header), m.Body, func(header textproto.MIMEHeader, filename string, body io.Reader) error {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		msg.Attachments = append(msg.Attachments, mailAttachment{Filename: filename, Data: data})
+		return nil
+	})
+	return msg, err
+}
+
+// walkParts visits every leaf MIME part that carries a file name, decoding
+// its transfer encoding.
+func walkParts(header textproto.MIMEHeader, body io.Reader, visit func(textproto.MIMEHeader, string, io.Reader) error) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkParts(part.Header, part, visit); err != nil {
+				return err
+			}
+		}
+	}
+
+	filename := ""
+	if _, dparams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		filename = dparams["filename"]
+	}
+	if filename == "" {
+		filename = params["name"]
+	}
+	if filename == "" {
+		return nil
+	}
+	if decoded, err := wordDecoder.DecodeHeader(filename); err == nil {
+		filename = decoded
+	}
+	filename = filepath.Base(filepath.Clean("/" + filename))
+
+	return visit(header, filename, decodeTransfer(header.Get("Content-Transfer-Encoding"), body))
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &stripNewlines{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// stripNewlines drops CR/LF so base64 bodies wrapped at 76 columns decode.
+type stripNewlines struct {
+	r io.Reader
+}
+
+func (s *stripNewlines) Read(p []byte) (int, error) {
+	for {
+		n, err := s.r.Read(p)
+		j := 0
+		for _, b := range p[:n] {
+			if b != '\r' && b != '\n' {
+				p[j] = b
+				j++
+			}
+		}
+		if j > 0 || err != nil {
+			return j, err
+		}
+	}
+}
+
+// sendReply mails results back to the sender of msg.
+func sendReply(cfg *SMTPConfig, msg *mailMessage, files []string) error {
+	to := msg.ReplyTo
+	if to == "" {
+		to = msg.From
+	}
+	addr, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("no usable reply address: %v", err)
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	subject := msg.Subject
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+	fmt.Fprintf(&buf, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", addr.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	if msg.MessageID != "" {
+		fmt.Fprintf(&buf, "In-Reply-To: %s\r\nReferences: %s\r\n", msg.MessageID, msg.MessageID)
+	}
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	text, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	fmt.Fprintf(text, "Your %d converted file(s) are attached.\r\n", len(files))
+
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		name := filepath.Base(f)
+		ctype := mime.TypeByExtension(filepath.Ext(name))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		part, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {ctype},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		enc := base64.StdEncoding.EncodeToString(data)
+		for len(enc) > 76 {
+			io.WriteString(part, enc[:76]+"\r\n")
+			enc = enc[76:]
+		}
+		io.WriteString(part, enc+"\r\n")
+	}
+	mw.Close()
+
+	password := cfg.Password
+	if cfg.PasswordEnv != "" {
+		password = os.Getenv(cfg.PasswordEnv)
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if cfg.User != "" {
+		auth = smtp.PlainAuth("", cfg.User, password, cfg.Host)
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid smtp from address: %v", err)
+	}
+	return smtp.SendMail(cfg.Host+":"+strconv.Itoa(port), auth, from.Address, []string{addr.Address}, buf.Bytes())
+}
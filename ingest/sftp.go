@@ -0,0 +1,255 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SFTPSource is one remote inbox polled for new files. Results are written
+// to Outbox under the same name with the pipeline's output extension.
+type SFTPSource struct {
+	Name         string `json:"name"`
+	Host         string `json:"host"`
+	Port         int    `json:"port"`
+	User         string `json:"user"`
+	IdentityFile string `json:"identity_file"`
+	KnownHosts   string `json:"known_hosts"`
+	Inbox        string `json:"inbox"`
+	Outbox       string `json:"outbox"`
+	// Archive receives processed source files; they are deleted when empty.
+	Archive string `json:"archive"`
+	// Failed receives files whose pipeline failed; they stay in the inbox
+	// (and are not retried until they change) when empty.
+	Failed   string `json:"failed"`
+	Pipeline string `json:"pipeline"`
+	Interval string `json:"interval"`
+}
+
+// LoadSFTPSources reads the JSON list of sources from path.
+func LoadSFTPSources(path string) ([]SFTPSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sources []SFTPSource
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return nil, fmt.Errorf("invalid SFTP config %s: %v", path, err)
+	}
+	for i := range sources {
+		s := &sources[i]
+		if s.Host == "" || s.User == "" || s.Inbox == "" || s.Outbox == "" || s.Pipeline == "" {
+			return nil, fmt.Errorf("SFTP source %d: host, user, inbox, outbox and pipeline are required", i)
+		}
+		if s.Name == "" {
+			s.Name = s.User + "@" + s.Host + ":" + s.Inbox
+		}
+		if s.Port == 0 {
+			s.Port = 22
+		}
+	}
+	return sources, nil
+}
+
+// SFTPPoller moves files from one SFTP inbox through a pipeline into the
+// outbox. A file is only picked up once its size is unchanged across two
+// polls, so uploads still in progress are left alone.
+type SFTPPoller struct {
+	source    SFTPSource
+	processor Processor
+	interval  time.Duration
+
+	lastSize map[string]int64 // size seen on the previous poll
+	failed   map[string]int64 // failed files and the size they failed at
+}
+
+func NewSFTPPoller(source SFTPSource, processor Processor) *SFTPPoller {
+	interval, err := time.ParseDuration(source.Interval)
+	if err != nil || interval <= 0 {
+		interval = time.Minute
+	}
+	return &SFTPPoller{
+		source:    source,
+		processor: processor,
+		interval:  interval,
+		lastSize:  map[string]int64{},
+		failed:    map[string]int64{},
+	}
+}
+
+// Run polls until ctx is cancelled.
+func (p *SFTPPoller) Run(ctx context.Context) {
+	log.Printf("SFTP poller %s started (every %s)", p.source.Name, p.interval)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		if !p.processor.Paused() {
+			p.poll()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *SFTPPoller) poll() {
+	entries, err := p.list()
+	if err != nil {
+		log.Printf("SFTP %s: listing inbox failed: %v", p.source.Name, err)
+		return
+	}
+
+	seen := map[string]int64{}
+	for name, size := range entries {
+		seen[name] = size
+		if prev, ok := p.lastSize[name]; !ok || prev != size {
+			continue // new or still growing
+		}
+		if failedSize, ok := p.failed[name]; ok && failedSize == size {
+			continue
+		}
+		p.handle(name, size)
+	}
+	p.lastSize = seen
+	for name := range p.failed {
+		if _, ok := seen[name]; !ok {
+			delete(p.failed, name)
+		}
+	}
+}
+
+func (p *SFTPPoller) handle(name string, size int64) {
+	reqID, tempDir, err := newWorkDir()
+	if err != nil {
+		log.Printf("SFTP %s: failed to create temp dir: %v", p.source.Name, err)
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	remote := path.Join(p.source.Inbox, name)
+	local := filepath.Join(tempDir, filepath.Base(name))
+	log.Printf("[%s] SFTP %s: processing %s", reqID, p.source.Name, remote)
+
+	if _, err := p.run("get " + quote(remote) + " " + quote(local)); err != nil {
+		log.Printf("[%s] SFTP download failed: %v", reqID, err)
+		return
+	}
+
+	output, err := p.processor.ProcessFile(reqID, tempDir, local, p.source.Pipeline)
+	if err != nil {
+		log.Printf("[%s] SFTP pipeline failed: %v", reqID, err)
+		if p.source.Failed != "" {
+			if _, err := p.run("rename " + quote(remote) + " " + quote(path.Join(p.source.Failed, name))); err != nil {
+				log.Printf("[%s] SFTP move to failed dir failed: %v", reqID, err)
+			}
+			return
+		}
+		p.failed[name] = size
+		return
+	}
+
+	outName := strings.TrimSuffix(name, path.Ext(name)) + filepath.Ext(output)
+	commands := []string{"put " + quote(output) + " " + quote(path.Join(p.source.Outbox, outName))}
+	if p.source.Archive != "" {
+		commands = append(commands, "rename "+quote(remote)+" "+quote(path.Join(p.source.Archive, name)))
+	} else {
+		commands = append(commands, "rm "+quote(remote))
+	}
+	if _, err := p.run(commands...); err != nil {
+		log.Printf("[%s] SFTP upload failed: %v", reqID, err)
+		return
+	}
+	log.Printf("[%s] SFTP %s: wrote %s", reqID, p.source.Name, path.Join(p.source.Outbox, outName))
+}
+
+// "-rw-r--r--    1 1000     1000        12345 Jan  1 12:00 name with spaces"
+var lsLine = regexp.MustCompile(`^-\S+\s+\d+\s+\S+\s+\S+\s+(\d+)\s+\S+\s+\S+\s+\S+\s(.+)$`)
+
+// list returns the regular files in the inbox with their sizes.
+func (p *SFTPPoller) list() (map[string]int64, error) {
+	out, err := p.run("ls -ln " + quote(p.source.Inbox))
+	if err != nil {
+		return nil, err
+	}
+	return parseListing(out), nil
+}
+
+// parseListing reads the names and sizes of the files in an sftp "ls -ln"
+// listing, leaving out directories, links, hidden files and uploads still
+// being written under a temporary name.
+func parseListing(out string) map[string]int64 {
+	entries := map[string]int64{}
+	for _, line := range strings.Split(out, "\n") {
+		m := lsLine.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		name := path.Base(m[2])
+		if strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".part") || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		size, _ := strconv.ParseInt(m[1], 10, 64)
+		entries[name] = size
+	}
+	return entries
+}
+
+// run executes commands in one non-interactive sftp session.
+func (p *SFTPPoller) run(commands ...string) (string, error) {
+	batch, err := os.CreateTemp("", "sftp-batch-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(batch.Name())
+	batch.WriteString(strings.Join(commands, "\n") + "\n")
+	batch.Close()
+
+	args := []string{
+		"-b", batch.Name(),
+		"-P", strconv.Itoa(p.source.Port),
+		"-o", "BatchMode=yes",
+		"-o", "ConnectTimeout=30",
+	}
+	if p.source.IdentityFile != "" {
+		args = append(args, "-i", p.source.IdentityFile)
+	}
+	if p.source.KnownHosts != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+p.source.KnownHosts, "-o", "StrictHostKeyChecking=yes")
+	}
+	args = append(args, p.source.User+"@"+p.source.Host)
+
+	cmd := exec.Command("sftp", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("sftp failed: %v, output: %s", err, string(output))
+	}
+	return string(output), nil
+}
+
+// quote escapes a path for an sftp batch file.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// StartSFTP launches one poller per configured source.
+func StartSFTP(ctx context.Context, configPath string, processor Processor) error {
+	sources, err := LoadSFTPSources(configPath)
+	if err != nil {
+		return err
+	}
+	for _, source := range sources {
+		go NewSFTPPoller(source, processor).Run(ctx)
+	}
+	return nil
+}
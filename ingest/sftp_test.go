@@ -0,0 +1,55 @@
+package ingest
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseListing(t *testing.T) {
+	for _, tc := range []struct {
+		listing string
+		want    map[string]int64
+	}{
+		{
+			"sftp> ls -ln \"/inbox\"\n" +
+				"-rw-r--r--    1 1000     1000        12345 Jan  1 12:00 /inbox/report.docx\n" +
+				"-rw-r--r--    1 1000     1000            0 Mar 14  2023 /inbox/empty.txt\n",
+			map[string]int64{"report.docx": 12345, "empty.txt": 0},
+		},
+		{
+			"-rw-r--r--    1 1000     1000      2048 Jan  1 12:00 /inbox/name with  spaces.pdf\r\n",
+			map[string]int64{"name with  spaces.pdf": 2048},
+		},
+		{
+			"-rw-------    1 0        0     9876543210 Dec 31 23:59 relative.xlsx\n",
+			map[string]int64{"relative.xlsx": 9876543210},
+		},
+		{
+			// Directories, links, hidden files and partial uploads are skipped
+			"drwxr-xr-x    2 1000     1000         4096 Jan  1 12:00 /inbox/archive\n" +
+				"lrwxrwxrwx    1 1000     1000           11 Jan  1 12:00 /inbox/latest -> report.pdf\n" +
+				"-rw-r--r--    1 1000     1000          100 Jan  1 12:00 /inbox/.hidden.pdf\n" +
+				"-rw-r--r--    1 1000     1000          100 Jan  1 12:00 /inbox/upload.pdf.part\n" +
+				"-rw-r--r--    1 1000     1000          100 Jan  1 12:00 /inbox/upload.pdf.tmp\n",
+			map[string]int64{},
+		},
+		{"", map[string]int64{}},
+		{"Can't ls: \"/inbox\" not found\n", map[string]int64{}},
+	} {
+		if got := parseListing(tc.listing); !maps.Equal(got, tc.want) {
+			t.Errorf("parseListing(%q) = %v, want %v", tc.listing, got, tc.want)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"/inbox", `"/inbox"`},
+		{`/in "box"`, `"/in \"box\""`},
+		{`C:\inbox`, `"C:\\inbox"`},
+	} {
+		if got := quote(tc.in); got != tc.want {
+			t.Errorf("quote(%q) = %s, want %s", tc.in, got, tc.want)
+		}
+	}
+}
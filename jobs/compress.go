@@ -0,0 +1,143 @@
+package jobs
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// Results can be compressed at rest. zstd needs the zstd CLI; gzip is done
+// in-process and is used instead when zstd is unavailable.
+const (
+	CompressionNone = ""
+	CompressionZstd = "zstd"
+	CompressionGzip = "gzip"
+)
+
+var compressionExt = map[string]string{
+	CompressionZstd: ".zst",
+	CompressionGzip: ".gz",
+}
+
+func zstdBinary() (string, bool) {
+	if p := os.Getenv("ZSTD_PATH"); p != "" {
+		return p, true
+	}
+	p, err := exec.LookPath("zstd")
+	return p, err == nil
+}
+
+// effectiveCompression resolves the configured method to one that works on
+// this host.
+func effectiveCompression(method string) string {
+	switch method {
+	case CompressionZstd:
+		if _, ok := zstdBinary(); ok {
+			return CompressionZstd
+		}
+		return CompressionGzip
+	case CompressionGzip:
+		return CompressionGzip
+	}
+	return CompressionNone
+}
+
+// compressFile replaces path with a compressed copy and returns its path.
+func compressFile(path, method string) (string, error) {
+	dest := path + compressionExt[method]
+	switch method {
+	case CompressionZstd:
+		bin, _ := zstdBinary()
+		cmd := exec.Command(bin, "-q", "-f", "-T0", "-o", dest, path)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("zstd failed: %v, output: %s", err, string(output))
+		}
+	case CompressionGzip:
+		if err := gzipFile(path, dest); err != nil {
+			os.Remove(dest)
+			return "", fmt.Errorf("gzip failed: %v", err)
+		}
+	default:
+		return path, nil
+	}
+	return dest, os.Remove(path)
+}
+
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// openDecompressed streams the original contents of a stored file.
+func openDecompressed(path, method string) (io.ReadCloser, error) {
+	switch method {
+	case CompressionZstd:
+		bin, ok := zstdBinary()
+		if !ok {
+			return nil, fmt.Errorf("zstd is not installed")
+		}
+		cmd := exec.Command(bin, "-q", "-d", "-c", path)
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, err
+		}
+		return &commandReader{ReadCloser: stdout, cmd: cmd}, nil
+	case CompressionGzip:
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &gzipReader{Reader: zr, file: f}, nil
+	}
+	return os.Open(path)
+}
+
+// commandReader reaps the decompressor when the stream is closed.
+type commandReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r *commandReader) Close() error {
+	r.ReadCloser.Close()
+	r.cmd.Process.Kill()
+	r.cmd.Wait()
+	return nil
+}
+
+type gzipReader struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (r *gzipReader) Close() error {
+	r.Reader.Close()
+	return r.file.Close()
+}
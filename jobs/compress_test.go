@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	content := []byte(strings.Repeat("%PDF-1.7 stream of a converted document\n", 1000))
+	for _, tc := range []struct {
+		method string
+		ext    string
+	}{
+		{CompressionNone, ""},
+		{CompressionGzip, ".gz"},
+		{CompressionZstd, ".zst"},
+	} {
+		if tc.method == CompressionZstd {
+			if _, ok := zstdBinary(); !ok {
+				t.Log("zstd is not installed, skipping its round trip")
+				continue
+			}
+		}
+		path := filepath.Join(t.TempDir(), "result.pdf")
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		stored, err := compressFile(path, tc.method)
+		if err != nil {
+			t.Errorf("%q: compressFile: %v", tc.method, err)
+			continue
+		}
+		if stored != path+tc.ext {
+			t.Errorf("%q: stored as %s, want %s", tc.method, stored, path+tc.ext)
+		}
+		if tc.method != CompressionNone {
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("%q: original left behind", tc.method)
+			}
+			if info, err := os.Stat(stored); err != nil || info.Size() >= int64(len(content)) {
+				t.Errorf("%q: stored copy not compressed: %v", tc.method, err)
+			}
+		}
+
+		r, err := openDecompressed(stored, tc.method)
+		if err != nil {
+			t.Errorf("%q: openDecompressed: %v", tc.method, err)
+			continue
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, content) {
+			t.Errorf("%q: round trip gave %d bytes (%v), want the original %d", tc.method, len(got), err, len(content))
+		}
+	}
+}
+
+func TestEffectiveCompression(t *testing.T) {
+	t.Setenv("ZSTD_PATH", "")
+	_, haveZstd := zstdBinary()
+	zstd := CompressionGzip
+	if haveZstd {
+		zstd = CompressionZstd
+	}
+	for _, tc := range []struct {
+		method string
+		want   string
+	}{
+		{"", CompressionNone},
+		{"brotli", CompressionNone},
+		{CompressionGzip, CompressionGzip},
+		// gzip stands in where the zstd CLI is missing
+		{CompressionZstd, zstd},
+	} {
+		if got := effectiveCompression(tc.method); got != tc.want {
+			t.Errorf("effectiveCompression(%q) = %q, want %q", tc.method, got, tc.want)
+		}
+	}
+}
+
+func TestCompressedResults(t *testing.T) {
+	content := []byte(strings.Repeat("converted ", 500))
+	for _, method := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		m, err := NewManager(t.TempDir(), "test", time.Hour, method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "out.txt")
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		job, err := m.Keep("", "convert", path, time.Hour)
+		if err != nil {
+			t.Fatalf("%q: Keep: %v", method, err)
+		}
+		if job.Compression != m.compression {
+			t.Errorf("%q: job stored with %q, want %q", method, job.Compression, m.compression)
+		}
+		r, _, err := m.OpenResult(job.ID)
+		if err != nil {
+			t.Fatalf("%q: OpenResult: %v", method, err)
+		}
+		got, _ := io.ReadAll(r)
+		r.Close()
+		if !bytes.Equal(got, content) {
+			t.Errorf("%q: result differs from what was kept", method)
+		}
+	}
+}
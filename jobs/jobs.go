@@ -0,0 +1,620 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/akila/document-converter/events"
+	"github.com/google/uuid"
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// Job is an asynchronous operation whose result is kept on disk until it
+// expires.
+type Job struct {
+	ID        string `json:"id"`
+	Operation string `json:"operation"`
+	Tenant    string `json:"tenant,omitempty"`
+	// Owner is the instance that runs the job (see NewManager).
+	Owner       string    `json:"owner,omitempty"`
+	Status      Status    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	ResultName  string    `json:"result_name,omitempty"`
+	ResultSize  int64     `json:"result_size,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at,omitempty"`
+
+	// Compression is how the result is stored at rest; StoredSize is its
+	// size on disk.
+	Compression string `json:"compression,omitempty"`
+	StoredSize  int64  `json:"stored_size,omitempty"`
+
+	// ExpiryNotified is set once the tenant was warned about expiry.
+	ExpiryNotified bool `json:"expiry_notified,omitempty"`
+
+	// SourceFormat is the input's format, when known.
+	SourceFormat string `json:"source_format,omitempty"`
+	// ReprocessedAt and ReprocessedWith record the last time the result
+	// was run through a pipeline again, and which (see Reprocess).
+	ReprocessedAt   time.Time `json:"reprocessed_at,omitempty"`
+	ReprocessedWith string    `json:"reprocessed_with,omitempty"`
+}
+
+func (j *Job) Done() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
+
+// Work produces a job's result inside workDir and returns its path.
+type Work func(jobID, workDir string) (string, error)
+
+// Manager runs jobs in the background and stores their results under
+// dir/<id>/, with metadata in dir/<id>/job.json so results survive restarts.
+// Instances sharing dir each run their own jobs; the janitor and expiry
+// notifier, which run on one of them, rescan dir to cover all of them.
+type Manager struct {
+	dir         string
+	instance    string
+	ttl         time.Duration
+	compression string
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+	// watchers follow jobs' events, see Watch
+	watchers map[string][]chan events.Event
+
+	// Events, when set, receives job.queued, job.running, job.succeeded
+	// and job.failed as jobs move along.
+	Events *events.Bus
+	// PostProcess, when set, runs on every result before it is kept; an
+	// error fails the job.
+	PostProcess func(job Job, resultPath string) error
+}
+
+// NewManager keeps results under dir for ttl, compressed at rest with
+// compression ("zstd", "gzip" or "" for none). instance names this process
+// among those sharing dir, as the owner of the jobs it runs.
+func NewManager(dir, instance string, ttl time.Duration, compression string) (*Manager, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	m := &Manager{dir: dir, instance: instance, ttl: ttl, compression: effectiveCompression(compression), jobs: map[string]*Job{}, watchers: map[string][]chan events.Event{}}
+	if compression != "" && m.compression != compression {
+		log.Printf("Result compression %q unavailable, using %q", compression, m.compression)
+	}
+	m.load()
+	return m, nil
+}
+
+// load restores jobs from disk. Unfinished jobs of this instance, or of
+// one that stopped (see orphaned), are marked failed; those of live
+// instances are left to them.
+func (m *Manager) load() {
+	m.heartbeat()
+	for _, job := range m.scan() {
+		if !job.Done() && (m.owns(job) || m.orphaned(job)) {
+			m.interrupt(job)
+		}
+		m.jobs[job.ID] = job
+	}
+}
+
+// interrupt fails a job whose instance stopped while it ran.
+func (m *Manager) interrupt(job *Job) {
+	log.Printf("[%s] Job %s interrupted by a restart of %s", job.ID, job.Operation, job.Owner)
+	job.Status = StatusFailed
+	job.Error = "interrupted by restart"
+	job.CompletedAt = time.Now()
+	job.ExpiresAt = job.CompletedAt.Add(m.ttl)
+	m.save(job)
+}
+
+// Instances sharing the directory touch dir/.instances/<instance> every
+// heartbeatInterval while they run; one that hasn't for heartbeatTimeout
+// has stopped, and its unfinished jobs never will finish.
+const (
+	heartbeatInterval = 30 * time.Second
+	heartbeatTimeout  = 3 * heartbeatInterval
+)
+
+func (m *Manager) heartbeatPath(instance string) string {
+	return filepath.Join(m.dir, ".instances", instance)
+}
+
+func (m *Manager) heartbeat() {
+	path := m.heartbeatPath(m.instance)
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		log.Printf("Job store heartbeat failed: %v", err)
+	}
+}
+
+// StartHeartbeat marks this instance as running until ctx is cancelled. It
+// runs on every instance, leader or not.
+func (m *Manager) StartHeartbeat(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.heartbeat()
+			}
+		}
+	}()
+}
+
+// orphaned reports whether job belongs to another instance that stopped.
+func (m *Manager) orphaned(job *Job) bool {
+	if m.owns(job) {
+		return false
+	}
+	info, err := os.Stat(m.heartbeatPath(job.Owner))
+	return err != nil || time.Since(info.ModTime()) > heartbeatTimeout
+}
+
+// scan reads every job's metadata from disk.
+func (m *Manager) scan() []*Job {
+	var found []*Job
+	entries, _ := os.ReadDir(m.dir)
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(m.dir, e.Name(), "job.json"))
+		if err != nil {
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil || job.ID != e.Name() {
+			continue
+		}
+		found = append(found, &job)
+	}
+	return found
+}
+
+// owns reports whether job is run by this instance. Jobs from before
+// owners were recorded belong to whoever finds them.
+func (m *Manager) owns(job *Job) bool {
+	return job.Owner == "" || job.Owner == m.instance
+}
+
+// rescan picks up the jobs other instances sharing the directory created,
+// finished or removed since load, and fails those left unfinished by an
+// instance that stopped. This instance's own jobs are kept as they are in
+// memory.
+func (m *Manager) rescan() {
+	onDisk := map[string]bool{}
+	for _, job := range m.scan() {
+		onDisk[job.ID] = true
+		m.mu.Lock()
+		if current, ok := m.jobs[job.ID]; !ok || !m.owns(current) {
+			if !job.Done() && m.orphaned(job) {
+				m.interrupt(job)
+			}
+			m.jobs[job.ID] = job
+		}
+		m.mu.Unlock()
+	}
+	m.mu.Lock()
+	for id, job := range m.jobs {
+		if !onDisk[id] && !m.owns(job) {
+			delete(m.jobs, id)
+		}
+	}
+	m.mu.Unlock()
+}
+
+func (m *Manager) jobDir(id string) string {
+	return filepath.Join(m.dir, id)
+}
+
+// save persists job metadata. Callers hold m.mu or own the job exclusively.
+func (m *Manager) save(job *Job) {
+	data, _ := json.MarshalIndent(job, "", "  ")
+	tmp := filepath.Join(m.jobDir(job.ID), "job.json.tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("[%s] Failed to save job: %v", job.ID, err)
+		return
+	}
+	os.Rename(tmp, filepath.Join(m.jobDir(job.ID), "job.json"))
+}
+
+// Submit starts work in the background. onDone, if set, is called with the
+// finished job.
+func (m *Manager) Submit(operation string, work Work, onDone func(Job)) (Job, error) {
+	return m.SubmitFor("", operation, work, onDone)
+}
+
+// SubmitFor is Submit for a job owned by tenant.
+func (m *Manager) SubmitFor(tenant, operation string, work Work, onDone func(Job)) (Job, error) {
+	return m.SubmitFrom(tenant, operation, "", work, onDone)
+}
+
+// SubmitFrom is SubmitFor for an input of a known format, which Find can
+// filter on.
+func (m *Manager) SubmitFrom(tenant, operation, sourceFormat string, work Work, onDone func(Job)) (Job, error) {
+	job := &Job{
+		ID:           uuid.New().String(),
+		Operation:    operation,
+		Tenant:       tenant,
+		Owner:        m.instance,
+		Status:       StatusQueued,
+		CreatedAt:    time.Now(),
+		SourceFormat: sourceFormat,
+	}
+	if err := os.MkdirAll(filepath.Join(m.jobDir(job.ID), "work"), 0755); err != nil {
+		return Job{}, err
+	}
+
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	m.save(job)
+	snapshot := *job
+	m.mu.Unlock()
+
+	m.emit("job.queued", snapshot)
+	go m.run(job, work, onDone)
+	return snapshot, nil
+}
+
+// Keep stores a file produced outside the manager as the result of a
+// succeeded job of operation, expiring after ttl, e.g. to hand it out as a
+// download link later. The file is moved, or copied from another file
+// system.
+func (m *Manager) Keep(tenant, operation, resultPath string, ttl time.Duration) (Job, error) {
+	now := time.Now()
+	job := &Job{
+		ID:          uuid.New().String(),
+		Operation:   operation,
+		Tenant:      tenant,
+		Owner:       m.instance,
+		Status:      StatusSucceeded,
+		CreatedAt:   now,
+		CompletedAt: now,
+		ExpiresAt:   now.Add(ttl),
+	}
+	workDir := filepath.Join(m.jobDir(job.ID), "work")
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return Job{}, err
+	}
+	staged := filepath.Join(workDir, filepath.Base(resultPath))
+	err := moveFile(resultPath, staged)
+	if err == nil {
+		job.ResultName, job.ResultSize, job.StoredSize, err = m.storeResult(job.ID, staged, "result")
+	}
+	os.RemoveAll(workDir)
+	if err != nil {
+		os.RemoveAll(m.jobDir(job.ID))
+		return Job{}, err
+	}
+	job.Compression = m.compression
+
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	m.save(job)
+	snapshot := *job
+	m.mu.Unlock()
+	return snapshot, nil
+}
+
+// moveFile renames src to dst, copying when they are on different file
+// systems.
+func moveFile(src, dst string) error {
+	if os.Rename(src, dst) == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// emit publishes a job's lifecycle event to Events and the job's watchers.
+// Events.Publish ignores a nil bus.
+func (m *Manager) emit(eventType string, job Job) {
+	e := events.New(eventType, eventData(job))
+	m.Events.Publish(e)
+	m.mu.Lock()
+	for _, ch := range m.watchers[job.ID] {
+		// Watchers get at most a few events a job, so this only drops for
+		// ones that stopped reading
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+	m.mu.Unlock()
+}
+
+// StatusEvent is the lifecycle event of a job's current status, as emitted
+// when it got there.
+func StatusEvent(job Job) events.Event {
+	return events.New("job."+string(job.Status), eventData(job))
+}
+
+// Watch follows a job's lifecycle events from now on, until stop is called.
+// It returns the job as it is when watching starts.
+func (m *Manager) Watch(id string) (Job, <-chan events.Event, func(), bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, nil, nil, false
+	}
+	ch := make(chan events.Event, 8)
+	m.watchers[id] = append(m.watchers[id], ch)
+	stop := func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		watchers := slices.DeleteFunc(m.watchers[id], func(c chan events.Event) bool { return c == ch })
+		if len(watchers) == 0 {
+			delete(m.watchers, id)
+		} else {
+			m.watchers[id] = watchers
+		}
+	}
+	return *job, ch, stop, true
+}
+
+func eventData(job Job) map[string]interface{} {
+	data := map[string]interface{}{
+		"job_id":    job.ID,
+		"operation": job.Operation,
+		"status":    string(job.Status),
+	}
+	if job.Tenant != "" {
+		data["tenant"] = job.Tenant
+	}
+	if job.Error != "" {
+		data["error"] = job.Error
+	}
+	if !job.CompletedAt.IsZero() {
+		data["duration_ms"] = job.CompletedAt.Sub(job.CreatedAt).Milliseconds()
+	}
+	return data
+}
+
+func (m *Manager) run(job *Job, work Work, onDone func(Job)) {
+	m.emit("job.running", m.update(job, func(j *Job) { j.Status = StatusRunning }))
+
+	workDir := filepath.Join(m.jobDir(job.ID), "work")
+	resultPath, err := work(job.ID, workDir)
+	if err == nil {
+		err = m.postProcess(job, resultPath)
+	}
+	if err == nil {
+		err = m.keepResult(job, resultPath)
+	}
+	os.RemoveAll(workDir)
+
+	final := m.update(job, func(j *Job) {
+		j.CompletedAt = time.Now()
+		j.ExpiresAt = j.CompletedAt.Add(m.ttl)
+		if err != nil {
+			j.Status = StatusFailed
+			j.Error = err.Error()
+			return
+		}
+		j.Status = StatusSucceeded
+	})
+	if err != nil {
+		log.Printf("[%s] Job %s failed: %v", job.ID, job.Operation, err)
+	} else {
+		log.Printf("[%s] Job %s finished: %s", job.ID, job.Operation, final.ResultName)
+	}
+	m.emit("job."+string(final.Status), final)
+	if onDone != nil {
+		onDone(final)
+	}
+}
+
+func (m *Manager) postProcess(job *Job, resultPath string) error {
+	if m.PostProcess == nil {
+		return nil
+	}
+	m.mu.Lock()
+	snapshot := *job
+	m.mu.Unlock()
+	return m.PostProcess(snapshot, resultPath)
+}
+
+// keepResult moves the produced file out of the work directory, compressing
+// it when configured.
+func (m *Manager) keepResult(job *Job, resultPath string) error {
+	name, size, storedSize, err := m.storeResult(job.ID, resultPath, "result")
+	if err != nil {
+		return err
+	}
+	m.update(job, func(j *Job) {
+		j.ResultName = name
+		j.ResultSize = size
+		j.Compression = m.compression
+		j.StoredSize = storedSize
+	})
+	return nil
+}
+
+// storeResult moves a result file into the job's directory dir, compressed
+// when configured, and returns its name, size and size on disk.
+func (m *Manager) storeResult(id, resultPath, dir string) (string, int64, int64, error) {
+	name := filepath.Base(resultPath)
+	dest := filepath.Join(m.jobDir(id), dir, name)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", 0, 0, err
+	}
+	if err := os.Rename(resultPath, dest); err != nil {
+		return "", 0, 0, fmt.Errorf("failed to store result: %v", err)
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	stored, err := compressFile(dest, m.compression)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("failed to compress result: %v", err)
+	}
+	storedInfo, err := os.Stat(stored)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return name, info.Size(), storedInfo.Size(), nil
+}
+
+func (m *Manager) update(job *Job, change func(*Job)) Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	change(job)
+	m.save(job)
+	return *job
+}
+
+// Get returns a snapshot of the job.
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns snapshots of all known jobs, oldest first.
+func (m *Manager) List() []Job {
+	m.mu.Lock()
+	out := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		out = append(out, *job)
+	}
+	m.mu.Unlock()
+	sort.Slice(out, func(i, k int) bool { return out[i].CreatedAt.Before(out[k].CreatedAt) })
+	return out
+}
+
+// ResultPath returns the stored result file of a succeeded job, which is
+// compressed when job.Compression is set.
+func (m *Manager) ResultPath(id string) (string, bool) {
+	job, ok := m.Get(id)
+	if !ok || job.Status != StatusSucceeded {
+		return "", false
+	}
+	return filepath.Join(m.jobDir(id), "result", job.ResultName+compressionExt[job.Compression]), true
+}
+
+// OpenResult streams the decompressed result of a succeeded job.
+func (m *Manager) OpenResult(id string) (io.ReadCloser, Job, error) {
+	job, _ := m.Get(id)
+	path, ok := m.ResultPath(id)
+	if !ok {
+		return nil, job, fmt.Errorf("no result for job %s", id)
+	}
+	r, err := openDecompressed(path, job.Compression)
+	return r, job, err
+}
+
+// Delete forgets a job and removes its files.
+func (m *Manager) Delete(id string) {
+	m.mu.Lock()
+	delete(m.jobs, id)
+	m.mu.Unlock()
+	os.RemoveAll(m.jobDir(id))
+}
+
+// StartJanitor removes expired jobs every interval until ctx is cancelled.
+func (m *Manager) StartJanitor(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.expire(time.Now())
+			}
+		}
+	}()
+}
+
+func (m *Manager) expire(now time.Time) {
+	m.rescan()
+	for _, job := range m.List() {
+		if job.Done() && !job.ExpiresAt.IsZero() && now.After(job.ExpiresAt) {
+			log.Printf("[%s] Job result expired", job.ID)
+			m.Delete(job.ID)
+		}
+	}
+}
+
+// StartExpiryNotifier calls notify every interval with each tenant's
+// succeeded jobs that expire within before. Jobs are reported once; a failed
+// notification is retried on the next tick.
+func (m *Manager) StartExpiryNotifier(ctx context.Context, interval, before time.Duration, notify func(tenant string, expiring []Job) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.notifyExpiring(time.Now().Add(before), notify)
+			}
+		}
+	}()
+}
+
+func (m *Manager) notifyExpiring(deadline time.Time, notify func(string, []Job) error) {
+	m.rescan()
+	byTenant := map[string][]Job{}
+	for _, job := range m.List() {
+		if job.Status == StatusSucceeded && !job.ExpiryNotified && job.ExpiresAt.Before(deadline) {
+			byTenant[job.Tenant] = append(byTenant[job.Tenant], job)
+		}
+	}
+	for tenant, expiring := range byTenant {
+		if err := notify(tenant, expiring); err != nil {
+			log.Printf("Expiry notification for tenant %q failed: %v", tenant, err)
+			continue
+		}
+		m.mu.Lock()
+		for _, job := range expiring {
+			if j, ok := m.jobs[job.ID]; ok {
+				j.ExpiryNotified = true
+				m.save(j)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
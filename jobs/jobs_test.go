@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeJob stores job's metadata in dir as its owner would.
+func writeJob(t *testing.T, dir string, job Job) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, job.ID), 0755); err != nil {
+		t.Fatal(err)
+	}
+	(&Manager{dir: dir}).save(&job)
+}
+
+func TestSharedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	active, err := NewManager(dir, "active", time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeJob(t, dir, Job{ID: "running", Owner: "active", Status: StatusRunning, CreatedAt: time.Now()})
+	writeJob(t, dir, Job{ID: "gone", Owner: "stopped", Status: StatusRunning, CreatedAt: time.Now()})
+
+	// A standby starting up leaves the active instance's job alone but
+	// fails the one whose instance stopped (it never sent a heartbeat)
+	standby, err := NewManager(dir, "standby", time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]Status{"running": StatusRunning, "gone": StatusFailed} {
+		if job, _ := standby.Get(id); job.Status != want {
+			t.Errorf("job %s after the standby's start: %s, want %s", id, job.Status, want)
+		}
+	}
+
+	// Jobs the active instance creates later expire on the standby's pass
+	kept := filepath.Join(t.TempDir(), "result.pdf")
+	os.WriteFile(kept, []byte("%PDF"), 0644)
+	job, err := active.Keep("", "convert", kept, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := standby.Get(job.ID); ok {
+		t.Fatal("standby knows the new job before rescanning")
+	}
+	standby.expire(time.Now().Add(2 * time.Minute))
+	if _, err := os.Stat(filepath.Join(dir, job.ID)); !os.IsNotExist(err) {
+		t.Errorf("expired job of the active instance was not removed: %v", err)
+	}
+
+	// Once the active instance stops heartbeating, its unfinished job is
+	// failed on the next pass
+	old := time.Now().Add(-2 * heartbeatTimeout)
+	os.Chtimes(active.heartbeatPath("active"), old, old)
+	standby.expire(time.Now())
+	if job, _ := standby.Get("running"); job.Status != StatusFailed {
+		t.Errorf("job of a stopped instance: %s, want failed", job.Status)
+	}
+}
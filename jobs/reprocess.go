@@ -0,0 +1,126 @@
+package jobs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Filter selects stored results. Zero fields match everything.
+type Filter struct {
+	Tenant string `json:"tenant,omitempty"`
+	// CreatedAfter and CreatedBefore bound the jobs' creation time.
+	CreatedAfter  time.Time `json:"created_after,omitempty"`
+	CreatedBefore time.Time `json:"created_before,omitempty"`
+	// SourceFormat matches the input's format; jobs whose input format was
+	// not recorded never match it.
+	SourceFormat string `json:"source_format,omitempty"`
+}
+
+func (f Filter) matches(job Job) bool {
+	switch {
+	case f.Tenant != "" && job.Tenant != f.Tenant:
+		return false
+	case !f.CreatedAfter.IsZero() && job.CreatedAt.Before(f.CreatedAfter):
+		return false
+	case !f.CreatedBefore.IsZero() && !job.CreatedAt.Before(f.CreatedBefore):
+		return false
+	case f.SourceFormat != "" && !strings.EqualFold(job.SourceFormat, f.SourceFormat):
+		return false
+	}
+	return true
+}
+
+// Find returns the succeeded jobs matching f, oldest first.
+func (m *Manager) Find(f Filter) []Job {
+	var out []Job
+	for _, job := range m.List() {
+		if job.Status == StatusSucceeded && f.matches(job) {
+			out = append(out, job)
+		}
+	}
+	return out
+}
+
+// Reprocess runs a succeeded job's result through work again, e.g. to re-OCR
+// it after an engine upgrade, and replaces the result with what work
+// produces, recording pipeline as ReprocessedWith. The job keeps its ID
+// and expiry; downloads under way finish with the old result.
+func (m *Manager) Reprocess(id, pipeline string, work func(inputPath, workDir string) (string, error)) (Job, error) {
+	job, ok := m.Get(id)
+	if !ok || job.Status != StatusSucceeded {
+		return Job{}, fmt.Errorf("job %s has no result", id)
+	}
+	workDir := filepath.Join(m.jobDir(id), "reprocess")
+	os.RemoveAll(workDir)
+	defer os.RemoveAll(workDir)
+	for _, dir := range []string{"input", "work"} {
+		if err := os.MkdirAll(filepath.Join(workDir, dir), 0755); err != nil {
+			return Job{}, err
+		}
+	}
+
+	inputPath := filepath.Join(workDir, "input", job.ResultName)
+	if err := m.copyResult(id, inputPath); err != nil {
+		return Job{}, err
+	}
+	resultPath, err := work(inputPath, filepath.Join(workDir, "work"))
+	if err != nil {
+		return Job{}, err
+	}
+	if m.PostProcess != nil {
+		if err := m.PostProcess(job, resultPath); err != nil {
+			return Job{}, err
+		}
+	}
+	staged := filepath.Join(workDir, "result")
+	name, size, storedSize, err := m.storeResult(id, resultPath, filepath.Join("reprocess", "result"))
+	if err != nil {
+		return Job{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("job %s was deleted", id)
+	}
+	current := filepath.Join(m.jobDir(id), "result")
+	old := filepath.Join(workDir, "old")
+	if err := os.Rename(current, old); err != nil {
+		return Job{}, err
+	}
+	if err := os.Rename(staged, current); err != nil {
+		os.Rename(old, current)
+		return Job{}, err
+	}
+	j.ResultName = name
+	j.ResultSize = size
+	j.Compression = m.compression
+	j.StoredSize = storedSize
+	j.ReprocessedAt = time.Now()
+	j.ReprocessedWith = pipeline
+	m.save(j)
+	return *j, nil
+}
+
+// copyResult writes a job's decompressed result to path.
+func (m *Manager) copyResult(id, path string) error {
+	rc, _, err := m.OpenResult(id)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, rc); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,176 @@
+// Package leader elects one instance among several sharing a data
+// directory, so background work such as the job janitor and ingest pollers
+// runs once in an active-passive deployment. Leadership is a lease file on
+// the shared storage, renewed well before it expires; a standby takes over
+// when the leader stops renewing. Hosts' clocks must roughly agree.
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Lease is one instance's claim on leadership.
+type Lease struct {
+	path   string
+	holder string
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	expires time.Time // of our own lease, while we hold it
+}
+
+type leaseFile struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// New campaigns as holder for the lease in dir. Leadership is lost ttl
+// after the last renewal.
+func New(dir, holder string, ttl time.Duration) *Lease {
+	return &Lease{path: filepath.Join(dir, "leader.lease"), holder: holder, ttl: ttl}
+}
+
+// IsLeader reports whether this instance currently holds the lease.
+func (l *Lease) IsLeader() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Now().Before(l.expires)
+}
+
+// Run campaigns until ctx is done. Each time this instance is elected, lead
+// runs with a context that is cancelled when leadership is lost, so what it
+// starts stops again. On shutdown the lease is released for a standby.
+func (l *Lease) Run(ctx context.Context, lead func(ctx context.Context)) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	var stop context.CancelFunc
+	for {
+		if err := l.campaign(); err != nil {
+			log.Printf("Leader election: %v", err)
+		}
+		switch leading := l.IsLeader(); {
+		case leading && stop == nil:
+			log.Printf("Leader election: %s is now the leader", l.holder)
+			var leaderCtx context.Context
+			leaderCtx, stop = context.WithCancel(ctx)
+			lead(leaderCtx)
+		case !leading && stop != nil:
+			log.Printf("Leader election: %s lost the lease, standing by", l.holder)
+			stop()
+			stop = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if stop != nil {
+				stop()
+				l.release()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// campaign takes or renews the lease when it is free, expired or ours.
+func (l *Lease) campaign() error {
+	unlock, err := l.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current, err := l.read()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if current.Holder != l.holder && now.Before(current.ExpiresAt) {
+		l.mu.Lock()
+		l.expires = time.Time{}
+		l.mu.Unlock()
+		return nil
+	}
+	expires := now.Add(l.ttl)
+	if err := l.write(leaseFile{Holder: l.holder, ExpiresAt: expires}); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.expires = expires
+	l.mu.Unlock()
+	return nil
+}
+
+// release gives the lease up so a standby need not wait for it to expire.
+func (l *Lease) release() {
+	unlock, err := l.lock()
+	if err != nil {
+		return
+	}
+	defer unlock()
+	if current, err := l.read(); err == nil && current.Holder == l.holder {
+		l.write(leaseFile{Holder: l.holder})
+	}
+	l.mu.Lock()
+	l.expires = time.Time{}
+	l.mu.Unlock()
+}
+
+// lock serializes lease updates between instances with an exclusively
+// created lock file, which works on network filesystems where flock may
+// not. A lock left behind by a crashed instance is broken after ttl.
+func (l *Lease) lock() (unlock func(), err error) {
+	lockPath := l.path + ".lock"
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintln(f, l.holder)
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		info, statErr := os.Stat(lockPath)
+		if statErr != nil || time.Since(info.ModTime()) < l.ttl {
+			break
+		}
+		os.Remove(lockPath)
+	}
+	return nil, fmt.Errorf("lease is locked by another instance")
+}
+
+func (l *Lease) read() (leaseFile, error) {
+	var current leaseFile
+	data, err := os.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return current, nil
+	}
+	if err != nil {
+		return current, err
+	}
+	if err := json.Unmarshal(data, &current); err != nil {
+		// A torn write; treat the lease as free
+		return leaseFile{}, nil
+	}
+	return current, nil
+}
+
+func (l *Lease) write(lease leaseFile) error {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
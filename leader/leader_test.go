@@ -0,0 +1,88 @@
+package leader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCampaign(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		lease  string // current lease file, "" for none
+		leader bool
+	}{
+		{"free", "", true},
+		{"held by another", `{"holder": "b", "expires_at": "2999-01-01T00:00:00Z"}`, false},
+		{"expired", `{"holder": "b", "expires_at": "2000-01-01T00:00:00Z"}`, true},
+		{"released", `{"holder": "b", "expires_at": "0001-01-01T00:00:00Z"}`, true},
+		{"ours", `{"holder": "a", "expires_at": "2999-01-01T00:00:00Z"}`, true},
+		{"torn", `{"holder": "b", "expi`, true},
+	} {
+		dir := t.TempDir()
+		if tc.lease != "" {
+			if err := os.WriteFile(filepath.Join(dir, "leader.lease"), []byte(tc.lease), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		l := New(dir, "a", time.Minute)
+		if err := l.campaign(); err != nil {
+			t.Errorf("%s: campaign: %v", tc.name, err)
+		}
+		if got := l.IsLeader(); got != tc.leader {
+			t.Errorf("%s: IsLeader = %v, want %v", tc.name, got, tc.leader)
+		}
+	}
+}
+
+func TestTakeover(t *testing.T) {
+	dir := t.TempDir()
+	const ttl = 100 * time.Millisecond
+	a, b := New(dir, "a", ttl), New(dir, "b", ttl)
+
+	steps := []struct {
+		name   string
+		act    func()
+		aLeads bool
+		bLeads bool
+	}{
+		{"a campaigns first", func() { a.campaign() }, true, false},
+		{"b stands by", func() { b.campaign() }, true, false},
+		{"a renews", func() { a.campaign() }, true, false},
+		// a stops renewing: its lease runs out and b takes over
+		{"b takes over an expired lease", func() { time.Sleep(ttl + 20*time.Millisecond); b.campaign() }, false, true},
+		{"a finds b leading", func() { a.campaign() }, false, true},
+		{"b releases on shutdown", func() { b.release() }, false, false},
+		{"a takes over without waiting", func() { a.campaign() }, true, false},
+	}
+	for _, s := range steps {
+		s.act()
+		if a.IsLeader() != s.aLeads || b.IsLeader() != s.bLeads {
+			t.Fatalf("%s: a leads %v, b leads %v; want %v, %v", s.name, a.IsLeader(), b.IsLeader(), s.aLeads, s.bLeads)
+		}
+	}
+}
+
+func TestStaleLock(t *testing.T) {
+	dir := t.TempDir()
+	const ttl = 50 * time.Millisecond
+	lockPath := filepath.Join(dir, "leader.lease.lock")
+	if err := os.WriteFile(lockPath, []byte("crashed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l := New(dir, "a", ttl)
+	if err := l.campaign(); err == nil || l.IsLeader() {
+		t.Fatal("campaign went through a fresh lock")
+	}
+	old := time.Now().Add(-2 * ttl)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.campaign(); err != nil || !l.IsLeader() {
+		t.Fatalf("campaign past a stale lock: %v, leader %v", err, l.IsLeader())
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Error("lock left behind after campaigning")
+	}
+}
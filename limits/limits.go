@@ -0,0 +1,74 @@
+package limits
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config overrides the largest upload, in bytes, that operations accept
+// (see GET /limits for their names and defaults), for every caller and per
+// tenant (see auth.Client.Tenant).
+type Config struct {
+	Operations map[string]int64  `json:"operations"`
+	Tenants    map[string]Tenant `json:"tenants"`
+}
+
+// Tenant limits win over the deployment's. Default applies to operations
+// not named in Operations.
+type Tenant struct {
+	Default    int64            `json:"default"`
+	Operations map[string]int64 `json:"operations"`
+}
+
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid limits config %s: %v", path, err)
+	}
+	check := func(where string, sizes map[string]int64) error {
+		for op, n := range sizes {
+			if n <= 0 {
+				return fmt.Errorf("limits config: %s%s must be a positive number of bytes", where, op)
+			}
+		}
+		return nil
+	}
+	if err := check("", cfg.Operations); err != nil {
+		return nil, err
+	}
+	for name, t := range cfg.Tenants {
+		if t.Default < 0 {
+			return nil, fmt.Errorf("limits config: tenant %s default must be a positive number of bytes", name)
+		}
+		if err := check("tenant "+name+" ", t.Operations); err != nil {
+			return nil, err
+		}
+	}
+	return &cfg, nil
+}
+
+// MaxUpload is the upload limit for operation and tenant: the tenant's own
+// for the operation, else the tenant's default, else the deployment's for
+// the operation, else def. A nil Config always gives def.
+func (c *Config) MaxUpload(tenant, operation string, def int64) int64 {
+	if c == nil {
+		return def
+	}
+	if t, ok := c.Tenants[tenant]; ok && tenant != "" {
+		if n, ok := t.Operations[operation]; ok {
+			return n
+		}
+		if t.Default > 0 {
+			return t.Default
+		}
+	}
+	if n, ok := c.Operations[operation]; ok {
+		return n
+	}
+	return def
+}
@@ -6,51 +6,214 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/akila/document-converter/auth"
+	"github.com/akila/document-converter/config"
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/events"
 	"github.com/akila/document-converter/handlers"
+	"github.com/akila/document-converter/hooks"
+	"github.com/akila/document-converter/ingest"
+	"github.com/akila/document-converter/jobs"
+	"github.com/akila/document-converter/leader"
+	"github.com/akila/document-converter/limits"
+	"github.com/akila/document-converter/metrics"
+	"github.com/akila/document-converter/migrate"
+	"github.com/akila/document-converter/notify"
+	"github.com/akila/document-converter/quota"
+	"github.com/akila/document-converter/rules"
+	"github.com/akila/document-converter/templates"
+	"github.com/akila/document-converter/web"
 	"github.com/akila/document-converter/workers"
 )
 
 func main() {
+	cfg := config.Load()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(cfg.DataDir, os.Args[2:])
+		return
+	}
+	if cfg.ManualMigrations {
+		if pending, err := migrate.Pending(cfg.DataDir); err != nil {
+			log.Fatalf("Migrations: %v", err)
+		} else if len(pending) > 0 {
+			log.Fatalf("Migrations: %d pending and MANUAL_MIGRATIONS is set; run \"%s migrate\" first", len(pending), os.Args[0])
+		}
+	} else if _, err := migrate.Up(cfg.DataDir); err != nil {
+		log.Fatalf("Migrations: %v", err)
+	}
 	numCPU := runtime.NumCPU()
 	log.Printf("Starting backend with %d workers per engine", numCPU)
 
 	// Initialize engines
-	mgr := workers.NewEngineManager(numCPU)
+	converters.DiscoverEngines()
+	mgr := workers.NewEngineManager(numCPU, cfg.Engines)
+	mgr.ParallelRenderPages = cfg.ParallelRenderPages
+	log.Printf("Engines compiled in: %v, running: %v", workers.CompiledEngines(), mgr.Engines())
+	for op, engine := range cfg.OperationEngines {
+		if mgr.Pool(engine) == nil {
+			log.Printf("OPERATION_ENGINES: engine %q for %s is not running; using the default", engine, op)
+		}
+	}
+	if cfg.RenderBackend == "gpu" && !converters.GPURenderAvailable() {
+		log.Printf("RENDER_BACKEND=gpu but the GPU renderer is not installed; rendering on the CPU")
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	mgr.Start(ctx)
 
+	jobsMgr, err := jobs.NewManager(filepath.Join(cfg.DataDir, "jobs"), cfg.InstanceID, cfg.ResultTTL, cfg.ResultCompression)
+	if err != nil {
+		log.Fatalf("Job store: %v", err)
+	}
+	jobsMgr.StartHeartbeat(ctx)
+	// Background work runs on one instance only when leader election is on
+	var background []func(ctx context.Context)
+	background = append(background, func(ctx context.Context) { jobsMgr.StartJanitor(ctx, time.Minute) })
+
+	if cfg.NotifyConfig != "" {
+		notifyCfg, err := notify.Load(cfg.NotifyConfig)
+		if err != nil {
+			log.Fatalf("Notifications: %v", err)
+		}
+		baseURL := cfg.PublicBaseURL
+		if baseURL == "" {
+			baseURL = "http://localhost:8080"
+		}
+		notifier := notify.New(notifyCfg, baseURL)
+		background = append(background, func(ctx context.Context) {
+			jobsMgr.StartExpiryNotifier(ctx, time.Minute, cfg.NotifyBefore, notifier.JobsExpiring)
+		})
+	}
+
+	sinks := []events.Sink{events.LogSink{}}
+	if cfg.EventsWebhookURL != "" {
+		sinks = append(sinks, events.NewWebhookSink(cfg.EventsWebhookURL, cfg.EventsWebhookSecret))
+	}
+	if cfg.EventsKafkaURL != "" {
+		sinks = append(sinks, events.NewKafkaRESTSink(cfg.EventsKafkaURL, cfg.EventsKafkaTopic))
+	}
+	bus := events.NewBus(ctx, sinks...)
+	jobsMgr.Events = bus
+
 	// Handlers
-	h := handlers.NewConversionHandler(mgr)
+	h := handlers.NewConversionHandler(mgr, cfg, jobsMgr)
+	h.Events = bus
+	if cfg.RulesConfig != "" {
+		if h.Rules, err = rules.Load(cfg.RulesConfig); err != nil {
+			log.Fatalf("Routing rules: %v", err)
+		}
+	}
+
+	if h.Templates, err = templates.Open(filepath.Join(cfg.DataDir, "templates")); err != nil {
+		log.Fatalf("Template catalog: %v", err)
+	}
+
+	if cfg.AuthConfig != "" || cfg.OIDC.Issuer != "" {
+		var oidc *auth.OIDCConfig
+		if cfg.OIDC.Issuer != "" {
+			oidc = &auth.OIDCConfig{
+				Issuer:       cfg.OIDC.Issuer,
+				Audience:     cfg.OIDC.Audience,
+				JWKSURL:      cfg.OIDC.JWKSURL,
+				TenantClaim:  cfg.OIDC.TenantClaim,
+				QuotaClaim:   cfg.OIDC.QuotaClaim,
+				JWKSCacheTTL: cfg.OIDC.JWKSCacheTTL.String(),
+			}
+		}
+		if h.Auth, err = auth.Load(cfg.AuthConfig, oidc); err != nil {
+			log.Fatalf("Auth: %v", err)
+		}
+	}
+
+	if cfg.QuotaConfig != "" {
+		if h.Quotas, err = quota.Load(cfg.QuotaConfig, cfg.QuotaRedisURL, bus); err != nil {
+			log.Fatalf("Quotas: %v", err)
+		}
+	}
+
+	if cfg.LimitsConfig != "" {
+		if h.Limits, err = limits.Load(cfg.LimitsConfig); err != nil {
+			log.Fatalf("Upload limits: %v", err)
+		}
+	}
+
+	if cfg.HooksConfig != "" {
+		if h.Hooks, err = hooks.Load(cfg.HooksConfig); err != nil {
+			log.Fatalf("Post-processing hooks: %v", err)
+		}
+		jobsMgr.PostProcess = func(job jobs.Job, resultPath string) error {
+			return h.Hooks.Run(job.ID, job.Operation, resultPath)
+		}
+	}
+
+	if cfg.Ingest.SFTPConfig != "" && h.OperationAllowed("ingest.sftp") {
+		sources, err := ingest.LoadSFTPSources(cfg.Ingest.SFTPConfig)
+		if err != nil {
+			log.Fatalf("SFTP ingest: %v", err)
+		}
+		background = append(background, func(ctx context.Context) {
+			for _, source := range sources {
+				go ingest.NewSFTPPoller(source, h).Run(ctx)
+			}
+		})
+	}
+	if cfg.Ingest.IMAPConfig != "" && h.OperationAllowed("ingest.imap") {
+		imapCfg, err := ingest.LoadIMAPConfig(cfg.Ingest.IMAPConfig)
+		if err != nil {
+			log.Fatalf("IMAP ingest: %v", err)
+		}
+		background = append(background, func(ctx context.Context) {
+			go ingest.NewIMAPPoller(imapCfg, h).Run(ctx)
+		})
+	}
+
+	startBackground := func(ctx context.Context) {
+		for _, start := range background {
+			start(ctx)
+		}
+	}
+	if cfg.LeaderElection {
+		log.Printf("Leader election on as %s; background work runs on the leader only", cfg.InstanceID)
+		go leader.New(cfg.DataDir, cfg.InstanceID, cfg.LeaseTTL).Run(ctx, startBackground)
+	} else {
+		startBackground(ctx)
+	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/convert", h.HandleConvert)
-	mux.HandleFunc("/merge", h.HandleMerge)
-	mux.HandleFunc("/split", h.HandleSplit)
-	mux.HandleFunc("/compress", h.HandleCompress)
-	mux.HandleFunc("/extract/text", h.HandleExtractText)
-	mux.HandleFunc("/extract/images", h.HandleExtractImages)
-	mux.HandleFunc("/rotate", h.HandleRotate)
-	mux.HandleFunc("/reorder", h.HandleReorder)
+	h.Register(mux)
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
 
-	// TODO: Add other endpoints (/merge, /split, /compress, etc.)
+	// Latency histograms for Prometheus, with trace exemplars for OpenMetrics
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	if cfg.ServeUI {
+		mux.Handle("/", web.Handler())
+	}
 
 	// CORS Middleware
 	corsHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE, PATCH, HEAD")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, X-Request-ID, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata")
+		w.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Expires, X-Upload-ID, X-Request-ID, X-Job-ID")
 
 		if r.Method == "OPTIONS" {
+			// Resumable upload clients discover the server's tus support
+			if strings.HasPrefix(r.URL.Path, handlers.TusPath) {
+				handlers.TusOptions(cfg, w.Header())
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
 			w.WriteHeader(http.StatusOK)
 			return
 		}
@@ -60,7 +223,7 @@ func main() {
 
 	server := &http.Server{
 		Addr:    ":8080",
-		Handler: corsHandler,
+		Handler: versionRouter(corsHandler),
 	}
 
 	// Graceful shutdown
@@ -84,3 +247,45 @@ func main() {
 		log.Fatalf("ListenAndServe error: %v", err)
 	}
 }
+
+// versionRouter serves the API under /v1, and still at its unversioned
+// paths as aliases for existing clients. A breaking /v2 gets its own
+// prefix here rather than changing what these paths answer.
+func versionRouter(v1 http.Handler) http.Handler {
+	stripped := http.StripPrefix("/v1", v1)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/") {
+			stripped.ServeHTTP(w, r.WithContext(handlers.WithBasePath(r.Context(), "/v1")))
+			return
+		}
+		v1.ServeHTTP(w, r)
+	})
+}
+
+// runMigrate is the migrate subcommand: "migrate" applies pending data
+// directory migrations, "migrate status" lists them.
+func runMigrate(dataDir string, args []string) {
+	pending, err := migrate.Pending(dataDir)
+	if err != nil {
+		log.Fatalf("Migrations: %v", err)
+	}
+	if len(args) > 0 && args[0] == "status" {
+		current, _ := migrate.Current(dataDir)
+		log.Printf("Data directory %s is at schema version %d of %d", dataDir, current, migrate.Latest())
+		for _, m := range pending {
+			log.Printf("Pending: %d (%s)", m.Version, m.Description)
+		}
+		return
+	}
+	if len(args) > 0 {
+		log.Fatalf("usage: %s migrate [status]", os.Args[0])
+	}
+	backup, err := migrate.Up(dataDir)
+	if err != nil {
+		log.Fatalf("Migrations: %v", err)
+	}
+	if backup != "" {
+		log.Printf("Applied %d migrations; the previous state is in %s", len(pending), backup)
+	}
+	log.Printf("Data directory %s is at schema version %d", dataDir, migrate.Latest())
+}
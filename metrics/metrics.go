@@ -0,0 +1,171 @@
+// Package metrics exposes latency histograms in the Prometheus text format.
+// Scrapers that ask for OpenMetrics also get exemplars: the trace ID of a
+// recent observation in each bucket, so a latency spike on a dashboard
+// links straight to the trace of a slow request.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets suit document conversions: tens of milliseconds for small
+// PDF operations up to minutes for large office documents.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Histogram is a histogram partitioned by a fixed set of labels.
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	labels  []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	counts []uint64 // per bucket, the last one is +Inf
+	sum    float64
+	count  uint64
+	// exemplars[i] is the latest traced observation in bucket i
+	exemplars []*exemplar
+}
+
+type exemplar struct {
+	traceID string
+	value   float64
+	at      time.Time
+}
+
+// NewHistogram creates a histogram and registers it for Handler.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		labels:  labels,
+		series:  map[string]*series{},
+	}
+	registry.Lock()
+	registry.histograms = append(registry.histograms, h)
+	registry.Unlock()
+	return h
+}
+
+// Observe records value for the given label values, in the order the labels
+// were declared. A non-empty traceID becomes the bucket's exemplar.
+func (h *Histogram) Observe(value float64, traceID string, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[key]
+	if s == nil {
+		s = &series{
+			values:    labelValues,
+			counts:    make([]uint64, len(h.buckets)+1),
+			exemplars: make([]*exemplar, len(h.buckets)+1),
+		}
+		h.series[key] = s
+	}
+	i := sort.SearchFloat64s(h.buckets, value)
+	s.counts[i]++
+	s.sum += value
+	s.count++
+	if traceID != "" {
+		s.exemplars[i] = &exemplar{traceID: traceID, value: value, at: time.Now()}
+	}
+}
+
+func (h *Histogram) write(w io.Writer, openMetrics bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		var labels []string
+		for i, name := range h.labels {
+			labels = append(labels, fmt.Sprintf("%s=%q", name, s.values[i]))
+		}
+		cumulative := uint64(0)
+		for i, count := range s.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(h.buckets) {
+				le = strconv.FormatFloat(h.buckets[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(w, "%s_bucket{%s} %d", h.name, strings.Join(append(labels, fmt.Sprintf("le=%q", le)), ","), cumulative)
+			if e := s.exemplars[i]; openMetrics && e != nil {
+				fmt.Fprintf(w, " # {trace_id=%q} %s %.3f", e.traceID, formatFloat(e.value), float64(e.at.UnixMilli())/1000)
+			}
+			fmt.Fprintln(w)
+		}
+		suffix := ""
+		if len(labels) > 0 {
+			suffix = "{" + strings.Join(labels, ",") + "}"
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, suffix, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, suffix, s.count)
+	}
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var registry struct {
+	sync.Mutex
+	histograms []*Histogram
+}
+
+// Handler serves every histogram. Exemplars are only part of OpenMetrics,
+// which Prometheus requests when exemplar storage is enabled; everyone else
+// gets the classic text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+		if openMetrics {
+			w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		}
+		registry.Lock()
+		histograms := append([]*Histogram(nil), registry.histograms...)
+		registry.Unlock()
+		for _, h := range histograms {
+			h.write(w, openMetrics)
+		}
+		if openMetrics {
+			fmt.Fprintln(w, "# EOF")
+		}
+	})
+}
+
+var traceparent = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+// TraceID returns the W3C trace context trace ID of a request (from the
+// traceparent header set by a tracing proxy or client), or "".
+func TraceID(r *http.Request) string {
+	m := traceparent.FindStringSubmatch(strings.TrimSpace(r.Header.Get("traceparent")))
+	if m == nil || strings.Trim(m[1], "0") == "" {
+		return ""
+	}
+	return m[1]
+}
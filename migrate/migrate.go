@@ -0,0 +1,236 @@
+// Package migrate upgrades the state persisted under the data directory
+// (the job store, the leader lease) from one layout to the next. The data
+// directory records its schema version in schema.json; at startup, or with
+// the migrate subcommand, pending migrations run in order after the state
+// is backed up, so a failed upgrade can be rolled back by restoring the
+// backup. A data directory written by a newer build is refused rather than
+// misread.
+package migrate
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Migration upgrades the data directory to Version.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(dataDir string) error
+}
+
+// Migrations are applied in order; append new ones with the next version
+// and never change or remove one that has shipped.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "baseline: jobs under jobs/<id>/ with metadata in job.json",
+		Up:          func(dataDir string) error { return nil },
+	},
+}
+
+// Latest is the schema version this build writes.
+func Latest() int {
+	return Migrations[len(Migrations)-1].Version
+}
+
+type schemaFile struct {
+	Version    int       `json:"version"`
+	MigratedAt time.Time `json:"migrated_at"`
+}
+
+// Current returns the data directory's schema version. Directories from
+// before versioning, and new ones, are at 0.
+func Current(dataDir string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(dataDir, "schema.json"))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var schema schemaFile
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return 0, fmt.Errorf("unreadable schema.json: %v", err)
+	}
+	return schema.Version, nil
+}
+
+// Pending lists the migrations the data directory still needs. It fails
+// for a directory written by a newer build.
+func Pending(dataDir string) ([]Migration, error) {
+	current, err := Current(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	if current > Latest() {
+		return nil, fmt.Errorf("data directory is at schema version %d but this build only knows up to %d; upgrade the service instead", current, Latest())
+	}
+	var pending []Migration
+	for _, m := range Migrations {
+		if m.Version > current {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies the pending migrations and returns the backup taken before
+// them ("" when there was nothing to back up or migrate). A new data
+// directory is simply stamped with the latest version.
+func Up(dataDir string) (backup string, err error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return "", err
+	}
+	pending, err := Pending(dataDir)
+	if err != nil || len(pending) == 0 {
+		return "", err
+	}
+	unlock, err := lock(dataDir)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	// Another instance may have migrated while we looked
+	if pending, err = Pending(dataDir); err != nil || len(pending) == 0 {
+		return "", err
+	}
+	current, _ := Current(dataDir)
+	if fresh, err := empty(dataDir); err != nil {
+		return "", err
+	} else if fresh {
+		return "", stamp(dataDir, Latest())
+	}
+
+	backup = filepath.Join(dataDir, "backups", fmt.Sprintf("schema-%d-%s.tar.gz", current, time.Now().UTC().Format("20060102T150405Z")))
+	if err := Backup(dataDir, backup); err != nil {
+		return "", fmt.Errorf("backup before migrating failed: %v", err)
+	}
+	log.Printf("Migrations: backed up the data directory to %s", backup)
+
+	for _, m := range pending {
+		log.Printf("Migrations: applying %d (%s)", m.Version, m.Description)
+		if err := m.Up(dataDir); err != nil {
+			return backup, fmt.Errorf("migration %d failed: %v; restore %s to roll back", m.Version, err, backup)
+		}
+		// Record progress after each step, so a retry resumes here
+		if err := stamp(dataDir, m.Version); err != nil {
+			return backup, err
+		}
+	}
+	return backup, nil
+}
+
+// Backup archives the data directory's metadata into a gzipped tarball at
+// dest. Job results and work directories are left out: migrations change
+// metadata, and results can be large. Earlier backups are skipped too.
+func Backup(dataDir, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	err = filepath.Walk(dataDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dataDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if info.IsDir() {
+			switch info.Name() {
+			case "backups", "result", "work":
+				return filepath.SkipDir
+			}
+		}
+		if !info.IsDir() && (!info.Mode().IsRegular() || rel == "schema.lock") {
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		os.Remove(dest)
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// empty reports whether the data directory holds no state yet.
+func empty(dataDir string) (bool, error) {
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return false, err
+	}
+	for _, e := range entries {
+		if e.Name() != "schema.lock" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func stamp(dataDir string, version int) error {
+	data, err := json.Marshal(schemaFile{Version: version, MigratedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dataDir, "schema.json.tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dataDir, "schema.json"))
+}
+
+// lock keeps instances sharing the data directory from migrating it at the
+// same time. A lock left by a crashed migration must be removed by hand,
+// after checking the data directory.
+func lock(dataDir string) (unlock func(), err error) {
+	lockPath := filepath.Join(dataDir, "schema.lock")
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("%s exists: another instance is migrating, or a migration was interrupted", lockPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(f, os.Getpid())
+	f.Close()
+	return func() { os.Remove(lockPath) }, nil
+}
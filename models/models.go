@@ -9,6 +9,8 @@ type ConversionRequest struct {
 
 type Job struct {
 	ID           string
+	// RequestID is the API request's X-Request-ID, for tracing
+	RequestID    string
 	InputPath    string
 	OutputPath   string
 	FromFormat   string
@@ -16,6 +18,7 @@ type Job struct {
 	Options      map[string]interface{}
 	ResultChan   chan JobResult
 	TempDir      string
+	LowPriority  bool
 }
 
 type JobResult struct {
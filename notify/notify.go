@@ -0,0 +1,192 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akila/document-converter/jobs"
+)
+
+// Config maps tenants to where their notifications go. Jobs without a tenant
+// use the "default" entry.
+type Config struct {
+	SMTP    *SMTPConfig        `json:"smtp"`
+	Tenants map[string]*Target `json:"tenants"`
+}
+
+type SMTPConfig struct {
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	User        string `json:"user"`
+	Password    string `json:"password"`
+	PasswordEnv string `json:"password_env"`
+	From        string `json:"from"`
+}
+
+// Target is a tenant's webhook and/or email recipients.
+type Target struct {
+	WebhookURL string `json:"webhook_url"`
+	// WebhookSecret signs the body as X-Signature: sha256=<hex HMAC>.
+	WebhookSecret    string   `json:"webhook_secret"`
+	WebhookSecretEnv string   `json:"webhook_secret_env"`
+	Email            []string `json:"email"`
+}
+
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid notify config %s: %v", path, err)
+	}
+	for tenant, t := range cfg.Tenants {
+		if t.WebhookSecretEnv != "" {
+			t.WebhookSecret = os.Getenv(t.WebhookSecretEnv)
+		}
+		if len(t.Email) > 0 && cfg.SMTP == nil {
+			return nil, fmt.Errorf("notify config: tenant %q has email recipients but no smtp settings", tenant)
+		}
+	}
+	if cfg.SMTP != nil && cfg.SMTP.PasswordEnv != "" {
+		cfg.SMTP.Password = os.Getenv(cfg.SMTP.PasswordEnv)
+	}
+	return &cfg, nil
+}
+
+// Notifier sends expiry reminders.
+type Notifier struct {
+	cfg     *Config
+	baseURL string
+	client  *http.Client
+}
+
+// New returns a notifier whose links point below baseURL.
+func New(cfg *Config, baseURL string) *Notifier {
+	return &Notifier{
+		cfg:     cfg,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type expiringJob struct {
+	ID         string    `json:"id"`
+	Operation  string    `json:"operation"`
+	ResultName string    `json:"result_name"`
+	ResultURL  string    `json:"result_url"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// JobsExpiring tells tenant which results are about to be deleted. Tenants
+// without a target (and no default) are skipped.
+func (n *Notifier) JobsExpiring(tenant string, expiring []jobs.Job) error {
+	target := n.cfg.Tenants[tenant]
+	if target == nil && tenant == "" {
+		target = n.cfg.Tenants["default"]
+	}
+	if target == nil {
+		return nil
+	}
+
+	list := make([]expiringJob, len(expiring))
+	for i, job := range expiring {
+		list[i] = expiringJob{
+			ID:         job.ID,
+			Operation:  job.Operation,
+			ResultName: job.ResultName,
+			ResultURL:  n.baseURL + "/jobs/" + job.ID + "/result",
+			ExpiresAt:  job.ExpiresAt,
+		}
+	}
+
+	var errs []string
+	if target.WebhookURL != "" {
+		if err := n.webhook(target, tenant, list); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(target.Email) > 0 {
+		if err := n.email(target.Email, list); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (n *Notifier) webhook(target *Target, tenant string, list []expiringJob) error {
+	body, _ := json.Marshal(map[string]interface{}{
+		"event":  "jobs.expiring",
+		"tenant": tenant,
+		"jobs":   list,
+	})
+	req, err := http.NewRequest(http.MethodPost, target.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if target.WebhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(target.WebhookSecret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (n *Notifier) email(recipients []string, list []expiringJob) error {
+	cfg := n.cfg.SMTP
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid smtp from address: %v", err)
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\nTo: %s\r\n", cfg.From, strings.Join(recipients, ", "))
+	fmt.Fprintf(&body, "Subject: %d converted file(s) expire soon\r\n", len(list))
+	fmt.Fprintf(&body, "Date: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("The following results will be deleted soon. Download anything you still need:\r\n\r\n")
+	for _, j := range list {
+		fmt.Fprintf(&body, "- %s (%s), expires %s\r\n  %s\r\n", j.ResultName, j.Operation, j.ExpiresAt.Format(time.RFC1123), j.ResultURL)
+	}
+
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if cfg.User != "" {
+		auth = smtp.PlainAuth("", cfg.User, cfg.Password, cfg.Host)
+	}
+	var to []string
+	for _, r := range recipients {
+		addr, err := mail.ParseAddress(r)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %v", r, err)
+		}
+		to = append(to, addr.Address)
+	}
+	return smtp.SendMail(cfg.Host+":"+strconv.Itoa(port), auth, from.Address, to, body.Bytes())
+}
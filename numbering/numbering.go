@@ -0,0 +1,220 @@
+// Package numbering issues sequential document numbers, such as invoice and
+// contract numbers, from named sequences kept per tenant, so clients don't
+// have to coordinate numbering among themselves. Sequences live in a JSON
+// file that every instance sharing the data directory updates under a lock
+// file, so a number is never issued twice. Numbers consumed by a request
+// that then fails are not reused: sequences can have gaps.
+package numbering
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sequence is one named counter and how its numbers are formatted.
+type Sequence struct {
+	// Format is the number's layout, with {seq} for the counter and {year}
+	// for the current year, e.g. "INV-{year}-{seq}". Default "{seq}".
+	Format string `json:"format"`
+	// Width zero-pads {seq}, e.g. 5 for 00042.
+	Width int `json:"width,omitempty"`
+	// Next is the counter value the next number gets.
+	Next int64 `json:"next"`
+	// ResetYearly restarts the counter at 1 in a new year; Year is the year
+	// of the last number issued.
+	ResetYearly bool `json:"reset_yearly,omitempty"`
+	Year        int  `json:"year,omitempty"`
+}
+
+// Issued is a number taken from a sequence.
+type Issued struct {
+	Sequence string `json:"sequence"`
+	Number   string `json:"number"`
+	Value    int64  `json:"value"`
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// ValidName reports whether name can name a sequence.
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// Registry holds the sequences of every tenant.
+type Registry struct {
+	path string
+}
+
+// Open uses the registry stored at path, which is created on first use.
+func Open(path string) *Registry {
+	return &Registry{path: path}
+}
+
+// state is the file's content: tenant -> sequence name -> sequence. The
+// tenant of unauthenticated deployments is "".
+type state map[string]map[string]*Sequence
+
+// Get returns a tenant's sequence.
+func (r *Registry) Get(tenant, name string) (Sequence, bool, error) {
+	var seq Sequence
+	found := false
+	err := r.update(func(s state) (bool, error) {
+		if current := s[tenant][name]; current != nil {
+			seq, found = *current, true
+		}
+		return false, nil
+	})
+	return seq, found, err
+}
+
+// Configure creates or changes a tenant's sequence. A zero Next keeps the
+// counter where it is (1 for a new sequence); lowering it below numbers
+// already issued would issue them again, so it is refused.
+func (r *Registry) Configure(tenant, name string, seq Sequence) error {
+	if seq.Format == "" {
+		seq.Format = "{seq}"
+	}
+	if !strings.Contains(seq.Format, "{seq}") {
+		return fmt.Errorf("format must contain {seq}")
+	}
+	if seq.Width < 0 || seq.Width > 20 {
+		return fmt.Errorf("width must be between 0 and 20")
+	}
+	if seq.Next < 0 {
+		return fmt.Errorf("next must be at least 1")
+	}
+	return r.update(func(s state) (bool, error) {
+		current := s[tenant][name]
+		switch {
+		case seq.Next == 0 && current != nil:
+			seq.Next = current.Next
+		case seq.Next == 0:
+			seq.Next = 1
+		}
+		if current != nil {
+			if seq.Next < current.Next {
+				return false, fmt.Errorf("next cannot go below %d, which would reissue numbers", current.Next)
+			}
+			seq.Year = current.Year
+		}
+		if s[tenant] == nil {
+			s[tenant] = map[string]*Sequence{}
+		}
+		s[tenant][name] = &seq
+		return true, nil
+	})
+}
+
+// Next issues the next number of a tenant's sequence, creating the sequence
+// with the default format if it doesn't exist yet.
+func (r *Registry) Next(tenant, name string) (Issued, error) {
+	issued := Issued{Sequence: name}
+	err := r.update(func(s state) (bool, error) {
+		if s[tenant] == nil {
+			s[tenant] = map[string]*Sequence{}
+		}
+		seq := s[tenant][name]
+		if seq == nil {
+			seq = &Sequence{Format: "{seq}", Next: 1}
+			s[tenant][name] = seq
+		}
+		year := time.Now().Year()
+		if seq.ResetYearly && seq.Year != 0 && seq.Year != year {
+			seq.Next = 1
+		}
+		seq.Year = year
+		issued.Value = seq.Next
+		issued.Number = seq.format(seq.Next, year)
+		seq.Next++
+		return true, nil
+	})
+	return issued, err
+}
+
+func (seq *Sequence) format(value int64, year int) string {
+	n := strconv.FormatInt(value, 10)
+	if pad := seq.Width - len(n); pad > 0 {
+		n = strings.Repeat("0", pad) + n
+	}
+	return strings.NewReplacer("{seq}", n, "{year}", strconv.Itoa(year)).Replace(seq.Format)
+}
+
+// Preview is the number Next would issue now.
+func (seq Sequence) Preview() string {
+	year := time.Now().Year()
+	next := seq.Next
+	if seq.ResetYearly && seq.Year != 0 && seq.Year != year {
+		next = 1
+	}
+	return seq.format(next, year)
+}
+
+// update runs change on the stored state under the lock, and saves the
+// state when change asks to.
+func (r *Registry) update(change func(s state) (save bool, err error)) error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s := state{}
+	data, err := os.ReadFile(r.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("unreadable numbering registry %s: %v", r.path, err)
+		}
+	}
+	save, err := change(s)
+	if err != nil || !save {
+		return err
+	}
+	data, err = json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// lock serializes updates between requests and instances with an
+// exclusively created lock file. Holders only keep it for a file read and
+// write, so a lock older than lockStale was left by a crashed process.
+func (r *Registry) lock() (unlock func(), err error) {
+	lockPath := r.path + ".lock"
+	deadline := time.Now().Add(lockWait)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > lockStale {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("numbering registry is busy")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+const (
+	lockWait  = 5 * time.Second
+	lockStale = 30 * time.Second
+)
@@ -0,0 +1,116 @@
+package numbering
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	for _, tc := range []struct {
+		seq   Sequence
+		value int64
+		want  string
+	}{
+		{Sequence{Format: "{seq}"}, 7, "7"},
+		{Sequence{Format: "{seq}", Width: 5}, 42, "00042"},
+		{Sequence{Format: "{seq}", Width: 2}, 12345, "12345"},
+		{Sequence{Format: "INV-{year}-{seq}", Width: 4}, 3, "INV-2026-0003"},
+		{Sequence{Format: "{year}/{seq}/{year}"}, 1, "2026/1/2026"},
+	} {
+		if got := tc.seq.format(tc.value, 2026); got != tc.want {
+			t.Errorf("%q width %d: format(%d) = %q, want %q", tc.seq.Format, tc.seq.Width, tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	year := time.Now().Year()
+	for _, tc := range []struct {
+		name   string
+		stored string // registry file, "" for none
+		want   []string
+	}{
+		{"new sequence", "", []string{"1", "2", "3"}},
+		{"configured", `{"acme": {"invoices": {"format": "INV-{seq}", "width": 3, "next": 41}}}`, []string{"INV-041", "INV-042"}},
+		{
+			"yearly reset in a new year",
+			`{"acme": {"invoices": {"format": "{seq}", "next": 500, "reset_yearly": true, "year": 2001}}}`,
+			[]string{"1", "2"},
+		},
+		{
+			"yearly reset within the year",
+			`{"acme": {"invoices": {"format": "{seq}", "next": 500, "reset_yearly": true, "year": ` + strconv.Itoa(year) + `}}}`,
+			[]string{"500", "501"},
+		},
+		{"another tenant's sequence", `{"globex": {"invoices": {"format": "{seq}", "next": 900}}}`, []string{"1", "2"}},
+	} {
+		path := filepath.Join(t.TempDir(), "numbering.json")
+		if tc.stored != "" {
+			if err := os.WriteFile(path, []byte(tc.stored), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r := Open(path)
+		var got []string
+		for range tc.want {
+			issued, err := r.Next("acme", "invoices")
+			if err != nil {
+				t.Fatalf("%s: Next: %v", tc.name, err)
+			}
+			got = append(got, issued.Number)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: issued %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	r := Open(filepath.Join(t.TempDir(), "numbering.json"))
+	for _, tc := range []struct {
+		seq     Sequence
+		wantErr bool
+		preview string
+	}{
+		{Sequence{Format: "C-{seq}", Width: 3}, false, "C-001"},
+		{Sequence{Format: "C-{seq}", Next: 10}, false, "C-10"},
+		// Next left at zero keeps the counter
+		{Sequence{Format: "K-{seq}"}, false, "K-10"},
+		{Sequence{Format: "C-{seq}", Next: 9}, true, ""},
+		{Sequence{Format: "no counter"}, true, ""},
+		{Sequence{Width: 21}, true, ""},
+		{Sequence{Next: -1}, true, ""},
+		{Sequence{}, false, "10"},
+	} {
+		err := r.Configure("acme", "contracts", tc.seq)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("Configure(%+v) error = %v, want error %v", tc.seq, err, tc.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		seq, found, err := r.Get("acme", "contracts")
+		if err != nil || !found || seq.Preview() != tc.preview {
+			t.Errorf("Configure(%+v): preview %q (found %v, %v), want %q", tc.seq, seq.Preview(), found, err, tc.preview)
+		}
+	}
+}
+
+func TestStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "numbering.json")
+	if err := os.WriteFile(path+".lock", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * lockStale)
+	if err := os.Chtimes(path+".lock", old, old); err != nil {
+		t.Fatal(err)
+	}
+	if issued, err := Open(path).Next("", "tickets"); err != nil || issued.Number != "1" {
+		t.Errorf("Next past a stale lock = %q, %v; want 1", issued.Number, err)
+	}
+}
@@ -0,0 +1,288 @@
+package quota
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/akila/document-converter/events"
+)
+
+// Config sets request limits per quota identity (see auth.Client.Quota;
+// unauthenticated callers are identified by IP address).
+type Config struct {
+	// Mode "hard" (default) refuses requests over a limit. "soft" lets them
+	// through up to SoftOverage beyond it, emitting events instead, so a
+	// burst doesn't take production traffic down.
+	Mode        string  `json:"mode"`
+	SoftOverage float64 `json:"soft_overage"` // fraction of the limit, default 0.2
+	// WarnAt is the fraction of a limit past which "quota.approaching" fires,
+	// default 0.8.
+	WarnAt float64 `json:"warn_at"`
+
+	Default    Limits            `json:"default"`
+	Identities map[string]Limits `json:"identities"`
+}
+
+// Limits of zero are unlimited. The daily quotas reset at midnight UTC.
+type Limits struct {
+	RequestsPerMinute int `json:"requests_per_minute"`
+	RequestsPerDay    int `json:"requests_per_day"`
+	// BytesPerDay bounds the request bodies (uploads) sent in a day.
+	BytesPerDay int64 `json:"bytes_per_day"`
+}
+
+// Load reads the quota config at path. Usage is counted in memory, or in
+// Redis at redisURL when set so replicas share one count.
+func Load(path, redisURL string, bus *events.Bus) (*Limiter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid quota config %s: %v", path, err)
+	}
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = "hard"
+	case "hard", "soft":
+	default:
+		return nil, fmt.Errorf("quota config: mode must be hard or soft")
+	}
+	if cfg.SoftOverage <= 0 {
+		cfg.SoftOverage = 0.2
+	}
+	if cfg.WarnAt <= 0 || cfg.WarnAt >= 1 {
+		cfg.WarnAt = 0.8
+	}
+	var store Store = newMemoryStore()
+	if redisURL != "" {
+		if store, err = newRedisStore(redisURL); err != nil {
+			return nil, fmt.Errorf("quota store: %v", err)
+		}
+	}
+	return &Limiter{cfg: cfg, events: bus, store: store, usage: map[string]*usage{}}, nil
+}
+
+// Limiter enforces the limits on counters in its Store. Should the store
+// fail, requests are let through rather than refused.
+type Limiter struct {
+	cfg    Config
+	events *events.Bus
+	store  Store
+
+	mu    sync.Mutex
+	usage map[string]*usage
+	day   time.Time
+}
+
+// usage tracks the events already sent for an identity's windows; the
+// counts themselves are in the store.
+type usage struct {
+	minute, day, bytes window
+}
+
+// window is a fixed counting window with the events already sent for it.
+type window struct {
+	start            time.Time
+	warned, exceeded bool
+	rejected         bool
+}
+
+// Decision is the outcome of counting one request.
+type Decision struct {
+	Allowed bool
+	// Headers describe the remaining allowance and belong on the response
+	// whether or not the request is allowed.
+	Headers map[string]string
+	// RetryAfter is set for refused requests.
+	RetryAfter time.Duration
+}
+
+func (l *Limiter) limits(identity string) Limits {
+	if lim, ok := l.cfg.Identities[identity]; ok {
+		return lim
+	}
+	return l.cfg.Default
+}
+
+// check is one limit applied to a request.
+type check struct {
+	name, header string
+	limit        int64
+	start        time.Time
+	length       time.Duration
+	window       func(*usage) *window
+	// add is what the request counts; need is what it must still fit
+	add, need        int64
+	used             int64
+	counted, refused bool
+}
+
+func (c *check) reset() time.Time {
+	return c.start.Add(c.length)
+}
+
+func (l *Limiter) allowance(limit int64) int64 {
+	if l.cfg.Mode == "soft" {
+		return limit + int64(math.Ceil(float64(limit)*l.cfg.SoftOverage))
+	}
+	return limit
+}
+
+func counterKey(identity, name string, start time.Time) string {
+	return "quota:" + identity + ":" + name + ":" + strconv.FormatInt(start.Unix(), 10)
+}
+
+// Count records a request by identity, with a body of size bytes (-1 when
+// unknown), and decides whether it may proceed. The body's bytes count
+// once read, see AddBytes.
+func (l *Limiter) Count(identity string, size int64) Decision {
+	now := time.Now().UTC()
+	lim := l.limits(identity)
+	today := now.Truncate(24 * time.Hour)
+	checks := []*check{
+		{name: "requests_per_minute", header: "X-RateLimit", limit: int64(lim.RequestsPerMinute), start: now.Truncate(time.Minute), length: time.Minute,
+			window: func(u *usage) *window { return &u.minute }, add: 1},
+		{name: "requests_per_day", header: "X-Quota", limit: int64(lim.RequestsPerDay), start: today, length: 24 * time.Hour,
+			window: func(u *usage) *window { return &u.day }, add: 1},
+		{name: "bytes_per_day", header: "X-Quota-Bytes", limit: lim.BytesPerDay, start: today, length: 24 * time.Hour,
+			window: func(u *usage) *window { return &u.bytes }, need: max(size, 0)},
+	}
+
+	d := Decision{Allowed: true, Headers: map[string]string{}}
+	for _, c := range checks {
+		if c.limit <= 0 {
+			continue
+		}
+		used, err := l.store.Add(counterKey(identity, c.name, c.start), c.add, c.reset())
+		if err != nil {
+			log.Printf("Quota: counting %s of %s failed, not enforcing it: %v", c.name, identity, err)
+			continue
+		}
+		c.used, c.counted = used, true
+		if used+c.need > l.allowance(c.limit) || (c.add == 0 && used >= l.allowance(c.limit)) {
+			c.refused, d.Allowed = true, false
+			if wait := c.reset().Sub(now); wait > d.RetryAfter {
+				d.RetryAfter = wait
+			}
+		}
+	}
+	if !d.Allowed {
+		// Only requests let through count against the limits
+		for _, c := range checks {
+			if c.counted && c.add != 0 {
+				l.store.Add(counterKey(identity, c.name, c.start), -c.add, c.reset())
+				c.used -= c.add
+			}
+		}
+	}
+
+	l.mu.Lock()
+	u := l.usageOf(identity, today)
+	overage := int64(0)
+	for _, c := range checks {
+		if !c.counted {
+			continue
+		}
+		w := c.window(u)
+		if !w.start.Equal(c.start) {
+			*w = window{start: c.start}
+		}
+		switch {
+		case !d.Allowed:
+			if c.refused && !w.rejected {
+				w.rejected = true
+				l.emit("quota.rejected", identity, c.name, c.limit, c.used)
+			}
+		case c.add != 0:
+			l.noteUsage(w, identity, c.name, c.limit, c.used)
+			if c.used > c.limit {
+				overage = max(overage, c.used-c.limit)
+			}
+		}
+	}
+	l.mu.Unlock()
+
+	for _, c := range checks {
+		if !c.counted {
+			continue
+		}
+		d.Headers[c.header+"-Limit"] = strconv.FormatInt(c.limit, 10)
+		d.Headers[c.header+"-Remaining"] = strconv.FormatInt(max(c.limit-c.used, 0), 10)
+		d.Headers[c.header+"-Reset"] = strconv.Itoa(int(math.Ceil(c.reset().Sub(now).Seconds())))
+	}
+	if overage > 0 {
+		d.Headers["X-Quota-Overage"] = strconv.FormatInt(overage, 10)
+	}
+	return d
+}
+
+// AddBytes counts n bytes of a request body Count let through against the
+// identity's daily byte quota.
+func (l *Limiter) AddBytes(identity string, n int64) {
+	limit := l.limits(identity).BytesPerDay
+	if limit <= 0 || n <= 0 {
+		return
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	used, err := l.store.Add(counterKey(identity, "bytes_per_day", today), n, today.Add(24*time.Hour))
+	if err != nil {
+		log.Printf("Quota: counting bytes_per_day of %s failed: %v", identity, err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w := &l.usageOf(identity, today).bytes
+	if !w.start.Equal(today) {
+		*w = window{start: today}
+	}
+	l.noteUsage(w, identity, "bytes_per_day", limit, used)
+}
+
+// usageOf returns identity's event state, forgetting identities idle since
+// before today. l.mu must be held.
+func (l *Limiter) usageOf(identity string, today time.Time) *usage {
+	if !today.Equal(l.day) {
+		for id, u := range l.usage {
+			if u.day.start.Before(today) && u.bytes.start.Before(today) {
+				delete(l.usage, id)
+			}
+		}
+		l.day = today
+	}
+	u := l.usage[identity]
+	if u == nil {
+		u = &usage{}
+		l.usage[identity] = u
+	}
+	return u
+}
+
+// noteUsage sends the approaching and exceeded events once per window.
+func (l *Limiter) noteUsage(w *window, identity, name string, limit, used int64) {
+	if !w.warned && float64(used) >= float64(limit)*l.cfg.WarnAt {
+		w.warned = true
+		l.emit("quota.approaching", identity, name, limit, used)
+	}
+	if used > limit && !w.exceeded {
+		w.exceeded = true
+		l.emit("quota.exceeded", identity, name, limit, used)
+	}
+}
+
+func (l *Limiter) emit(eventType, identity, limitName string, limit, used int64) {
+	l.events.Emit(eventType, map[string]interface{}{
+		"identity": identity,
+		"limit":    limitName,
+		"allowed":  limit,
+		"used":     used,
+		"mode":     l.cfg.Mode,
+	})
+}
@@ -0,0 +1,204 @@
+package quota
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/akila/document-converter/events"
+)
+
+// recordSink collects the events sent to it.
+type recordSink chan events.Event
+
+func (s recordSink) Send(e events.Event) error {
+	s <- e
+	return nil
+}
+
+func loadLimiter(t *testing.T, config string, bus *events.Bus) *Limiter {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "quota.json")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Load(path, "", bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestCountModes(t *testing.T) {
+	// Daily limits, so the window doesn't roll over mid-test
+	for _, tc := range []struct {
+		name      string
+		config    string
+		identity  string
+		allowed   []bool
+		remaining []string
+	}{
+		{
+			"hard",
+			`{"default": {"requests_per_day": 3}}`,
+			"203.0.113.7",
+			[]bool{true, true, true, false, false},
+			[]string{"2", "1", "0", "0", "0"},
+		},
+		{
+			"soft overage of a fifth, rounded up",
+			`{"mode": "soft", "default": {"requests_per_day": 3}}`,
+			"203.0.113.7",
+			[]bool{true, true, true, true, false},
+			[]string{"2", "1", "0", "0", "0"},
+		},
+		{
+			"soft with a set overage",
+			`{"mode": "soft", "soft_overage": 1, "default": {"requests_per_day": 2}}`,
+			"203.0.113.7",
+			[]bool{true, true, true, true, false},
+			[]string{"1", "0", "0", "0", "0"},
+		},
+		{
+			"identity limits",
+			`{"default": {"requests_per_day": 1}, "identities": {"acme": {"requests_per_day": 2}}}`,
+			"acme",
+			[]bool{true, true, false},
+			[]string{"1", "0", "0"},
+		},
+		{
+			"unlimited",
+			`{"identities": {"acme": {"requests_per_day": 1}}}`,
+			"203.0.113.7",
+			[]bool{true, true, true},
+			[]string{"", "", ""},
+		},
+	} {
+		l := loadLimiter(t, tc.config, nil)
+		var allowed []bool
+		var remaining []string
+		for range tc.allowed {
+			d := l.Count(tc.identity, -1)
+			allowed = append(allowed, d.Allowed)
+			remaining = append(remaining, d.Headers["X-Quota-Remaining"])
+			if !d.Allowed && (d.RetryAfter <= 0 || d.RetryAfter > 24*time.Hour) {
+				t.Errorf("%s: RetryAfter = %s, want until midnight", tc.name, d.RetryAfter)
+			}
+		}
+		if !slices.Equal(allowed, tc.allowed) || !slices.Equal(remaining, tc.remaining) {
+			t.Errorf("%s: allowed %v, remaining %q; want %v, %q", tc.name, allowed, remaining, tc.allowed, tc.remaining)
+		}
+	}
+}
+
+func TestCountBytes(t *testing.T) {
+	for _, tc := range []struct {
+		mode    string
+		uploads []int64
+		allowed []bool
+	}{
+		{"hard", []int64{600, 400, 1}, []bool{true, true, false}},
+		{"hard", []int64{1001}, []bool{false}},
+		{"soft", []int64{600, 600, 1}, []bool{true, true, false}},
+		{"soft", []int64{1200, 1}, []bool{true, false}},
+	} {
+		l := loadLimiter(t, `{"mode": "`+tc.mode+`", "default": {"bytes_per_day": 1000}}`, nil)
+		var allowed []bool
+		for _, size := range tc.uploads {
+			d := l.Count("acme", size)
+			allowed = append(allowed, d.Allowed)
+			if d.Allowed {
+				l.AddBytes("acme", size)
+			}
+		}
+		if !slices.Equal(allowed, tc.allowed) {
+			t.Errorf("%s mode, uploads %v: allowed %v, want %v", tc.mode, tc.uploads, allowed, tc.allowed)
+		}
+	}
+}
+
+func TestSoftModeEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sink := make(recordSink, 16)
+	l := loadLimiter(t, `{"mode": "soft", "soft_overage": 0.5, "default": {"requests_per_day": 4}}`, events.NewBus(ctx, sink))
+
+	// The 4th of 4 warns (past 80%); the 5th and 6th go over but within the
+	// overage; the 7th is refused
+	var overage []string
+	for i := 0; i < 7; i++ {
+		overage = append(overage, l.Count("acme", -1).Headers["X-Quota-Overage"])
+	}
+	if want := []string{"", "", "", "", "1", "2", ""}; !slices.Equal(overage, want) {
+		t.Errorf("X-Quota-Overage = %q, want %q", overage, want)
+	}
+
+	want := []struct {
+		kind string
+		used int64
+	}{
+		{"quota.approaching", 4},
+		{"quota.exceeded", 5},
+		{"quota.rejected", 6},
+	}
+	for _, w := range want {
+		select {
+		case e := <-sink:
+			used, _ := e.Data["used"].(int64)
+			if e.Type != w.kind || used != w.used || e.Data["mode"] != "soft" {
+				t.Errorf("event %s used %v (%v), want %s used %d", e.Type, e.Data["used"], e.Data["mode"], w.kind, w.used)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %s event", w.kind)
+		}
+	}
+	select {
+	case e := <-sink:
+		t.Errorf("unexpected event %s", e.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemoryStoreWindows(t *testing.T) {
+	s := newMemoryStore()
+	now := time.Now().UTC()
+	minute := now.Truncate(time.Minute)
+	// Expiries are far enough out not to pass mid-test
+	later := now.Add(time.Hour)
+	for _, tc := range []struct {
+		key     string
+		add     int64
+		expires time.Time
+		want    int64
+	}{
+		{counterKey("acme", "requests_per_minute", minute), 1, later, 1},
+		{counterKey("acme", "requests_per_minute", minute), 1, later, 2},
+		// Refunds of refused requests
+		{counterKey("acme", "requests_per_minute", minute), -1, later, 1},
+		// Each window and identity counts apart
+		{counterKey("acme", "requests_per_minute", minute.Add(time.Minute)), 1, later, 1},
+		{counterKey("globex", "requests_per_minute", minute), 1, later, 1},
+		// An expired counter starts over
+		{"expired", 5, now.Add(-time.Second), 5},
+		{"expired", 1, later, 1},
+	} {
+		if got, _ := s.Add(tc.key, tc.add, tc.expires); got != tc.want {
+			t.Errorf("Add(%s, %d) = %d, want %d", tc.key, tc.add, got, tc.want)
+		}
+	}
+	if key := counterKey("acme", "requests_per_day", time.Unix(86400, 0)); key != "quota:acme:requests_per_day:"+strconv.Itoa(86400) {
+		t.Errorf("counterKey = %s", key)
+	}
+}
+
+func TestLoadRejectsUnknownMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.json")
+	os.WriteFile(path, []byte(`{"mode": "lenient"}`), 0644)
+	if _, err := Load(path, "", nil); err == nil {
+		t.Error("Load accepted mode lenient")
+	}
+}
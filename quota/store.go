@@ -0,0 +1,228 @@
+package quota
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store holds the usage counters. The in-memory store counts per instance;
+// Redis shares the counts between replicas.
+type Store interface {
+	// Add adds n (which may be 0 or negative) to the counter key and
+	// returns its new value. The counter is dropped at expires.
+	Add(key string, n int64, expires time.Time) (int64, error)
+}
+
+// memoryStore counts in this process.
+type memoryStore struct {
+	mu        sync.Mutex
+	counters  map[string]counter
+	lastSweep time.Time
+}
+
+type counter struct {
+	value   int64
+	expires time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{counters: map[string]counter{}}
+}
+
+func (s *memoryStore) Add(key string, n int64, expires time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, c := range s.counters {
+			if now.After(c.expires) {
+				delete(s.counters, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	c := s.counters[key]
+	if now.After(c.expires) {
+		c = counter{}
+	}
+	c.value += n
+	c.expires = expires
+	s.counters[key] = c
+	return c.value, nil
+}
+
+// redisStore keeps the counters in Redis, speaking just enough of its
+// protocol (RESP) for INCRBY and PEXPIREAT.
+type redisStore struct {
+	addr     string
+	password string
+	db       int
+	tls      bool
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// At most this many idle connections are kept.
+const maxIdleRedisConns = 8
+
+const redisTimeout = 2 * time.Second
+
+// newRedisStore takes a redis:// (or rediss:// for TLS) URL, e.g.
+// redis://:password@host:6379/0.
+func newRedisStore(rawURL string) (*redisStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Redis URL %q", rawURL)
+	}
+	s := &redisStore{addr: u.Host, tls: u.Scheme == "rediss"}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		s.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+	}
+	return s, nil
+}
+
+func (s *redisStore) Add(key string, n int64, expires time.Time) (int64, error) {
+	conn, err := s.conn()
+	if err != nil {
+		return 0, err
+	}
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+	// Both commands go out at once; the expiry is absolute, so repeating it
+	// for every request of a window is harmless
+	err = conn.send(
+		[]string{"INCRBY", key, strconv.FormatInt(n, 10)},
+		[]string{"PEXPIREAT", key, strconv.FormatInt(expires.UnixMilli(), 10)},
+	)
+	var value int64
+	if err == nil {
+		value, err = conn.integer()
+	}
+	if err == nil {
+		_, err = conn.integer()
+	}
+	if err != nil {
+		conn.Close()
+		return 0, fmt.Errorf("redis: %v", err)
+	}
+	s.release(conn)
+	return value, nil
+}
+
+func (s *redisStore) conn() (*redisConn, error) {
+	s.mu.Lock()
+	if n := len(s.idle); n > 0 {
+		conn := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return conn, nil
+	}
+	s.mu.Unlock()
+
+	var raw net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	if s.tls {
+		raw, err = tls.DialWithDialer(dialer, "tcp", s.addr, nil)
+	} else {
+		raw, err = dialer.Dial("tcp", s.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis: %v", err)
+	}
+	conn := &redisConn{Conn: raw, r: bufio.NewReader(raw)}
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+	var setup [][]string
+	if s.password != "" {
+		setup = append(setup, []string{"AUTH", s.password})
+	}
+	if s.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.db)})
+	}
+	if len(setup) > 0 {
+		err = conn.send(setup...)
+		for range setup {
+			if err == nil {
+				_, err = conn.reply()
+			}
+		}
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+func (s *redisStore) release(conn *redisConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.idle) >= maxIdleRedisConns {
+		conn.Close()
+		return
+	}
+	s.idle = append(s.idle, conn)
+}
+
+// send writes commands as RESP arrays of bulk strings.
+func (c *redisConn) send(commands ...[]string) error {
+	var b strings.Builder
+	for _, args := range commands {
+		fmt.Fprintf(&b, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	_, err := io.WriteString(c.Conn, b.String())
+	return err
+}
+
+// reply reads one reply line: a status, an integer or an error. Bulk
+// strings and arrays, which these commands don't answer with, are refused.
+func (c *redisConn) reply() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return "", errors.New("empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", errors.New(line[1:])
+	}
+	return "", fmt.Errorf("unexpected reply %q", line)
+}
+
+func (c *redisConn) integer() (int64, error) {
+	v, err := c.reply()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
@@ -0,0 +1,174 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Config is the JSON routing rules file. Rules are tried in order and the
+// first match decides.
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+type Rule struct {
+	Name   string `json:"name"`
+	Match  Match  `json:"match"`
+	Action Action `json:"action"`
+}
+
+// Match lists conditions that must all hold; unset fields match anything.
+type Match struct {
+	Formats  []string `json:"formats"`   // detected input formats, e.g. ["pdf", "docx"]
+	MinPages int      `json:"min_pages"` // PDFs only
+	MaxPages int      `json:"max_pages"`
+	MinSize  int64    `json:"min_size"` // bytes
+	MaxSize  int64    `json:"max_size"`
+	Keywords []string `json:"keywords"` // any of these, case-insensitive, in the text
+}
+
+type Action struct {
+	// Reject refuses the input with this message.
+	Reject string `json:"reject"`
+	// Queue "low" runs the job only when its engine has no normal work.
+	Queue string `json:"queue"`
+	// Engine forces the engine used for conversions, e.g. "pandoc".
+	Engine string `json:"engine"`
+	// Preset is passed to the job as its "preset" option.
+	Preset string `json:"preset"`
+}
+
+// Facts describe an input. Pages and Text are only computed when a rule
+// needs them.
+type Facts struct {
+	Format string
+	Size   int64
+	Pages  func() (int, error)
+	Text   func() (string, error)
+}
+
+// Engine evaluates rules against inputs.
+type Engine struct {
+	rules []Rule
+}
+
+func Load(path string) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid rules file %s: %v", path, err)
+	}
+	for i, r := range cfg.Rules {
+		if r.Action.Queue != "" && r.Action.Queue != "low" {
+			return nil, fmt.Errorf("rule %d (%s): queue must be \"low\"", i+1, r.Name)
+		}
+		for j := range r.Match.Formats {
+			cfg.Rules[i].Match.Formats[j] = strings.ToLower(r.Match.Formats[j])
+		}
+	}
+	return &Engine{rules: cfg.Rules}, nil
+}
+
+// Evaluate returns the first matching rule, or nil.
+func (e *Engine) Evaluate(f Facts) *Rule {
+	if e == nil {
+		return nil
+	}
+	lazy := &lazyFacts{Facts: f}
+	for i := range e.rules {
+		if e.rules[i].Match.matches(lazy) {
+			return &e.rules[i]
+		}
+	}
+	return nil
+}
+
+// lazyFacts computes expensive facts at most once per evaluation.
+type lazyFacts struct {
+	Facts
+	pages     int
+	pagesDone bool
+	text      string
+	textDone  bool
+}
+
+func (l *lazyFacts) pageCount() (int, bool) {
+	if !l.pagesDone {
+		l.pagesDone = true
+		if l.Facts.Pages != nil {
+			n, err := l.Facts.Pages()
+			if err != nil {
+				log.Printf("Rules: page count unavailable: %v", err)
+				n = -1
+			}
+			l.pages = n
+		} else {
+			l.pages = -1
+		}
+	}
+	return l.pages, l.pages >= 0
+}
+
+func (l *lazyFacts) lowerText() (string, bool) {
+	if !l.textDone {
+		l.textDone = true
+		if l.Facts.Text != nil {
+			text, err := l.Facts.Text()
+			if err != nil {
+				log.Printf("Rules: text unavailable: %v", err)
+			}
+			l.text = strings.ToLower(text)
+		}
+	}
+	return l.text, l.text != ""
+}
+
+func (m Match) matches(f *lazyFacts) bool {
+	if len(m.Formats) > 0 && !contains(m.Formats, strings.ToLower(f.Format)) {
+		return false
+	}
+	if m.MinSize > 0 && f.Size < m.MinSize {
+		return false
+	}
+	if m.MaxSize > 0 && f.Size > m.MaxSize {
+		return false
+	}
+	if m.MinPages > 0 || m.MaxPages > 0 {
+		pages, ok := f.pageCount()
+		if !ok || (m.MinPages > 0 && pages < m.MinPages) || (m.MaxPages > 0 && pages > m.MaxPages) {
+			return false
+		}
+	}
+	if len(m.Keywords) > 0 {
+		text, ok := f.lowerText()
+		if !ok {
+			return false
+		}
+		found := false
+		for _, k := range m.Keywords {
+			if strings.Contains(text, strings.ToLower(k)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package rules
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testRules = `{"rules": [
+	{"name": "huge", "match": {"min_size": 1000000}, "action": {"reject": "too large"}},
+	{"name": "long-pdf", "match": {"formats": ["PDF"], "min_pages": 100}, "action": {"queue": "low"}},
+	{"name": "invoice", "match": {"formats": ["pdf", "docx"], "keywords": ["Invoice", "receipt"]}, "action": {"preset": "archive"}},
+	{"name": "small-sheet", "match": {"formats": ["xlsx"], "max_size": 1000}, "action": {"engine": "pandoc"}}
+]}`
+
+func loadRules(t *testing.T, rules string) (*Engine, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+func TestEvaluate(t *testing.T) {
+	engine, err := loadRules(t, testRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := func(n int) func() (int, error) { return func() (int, error) { return n, nil } }
+	text := func(s string) func() (string, error) { return func() (string, error) { return s, nil } }
+	unreadable := func() (int, error) { return 0, errors.New("broken") }
+
+	for _, tc := range []struct {
+		facts Facts
+		want  string // "" for no match
+	}{
+		{Facts{Format: "docx", Size: 2000000}, "huge"},
+		{Facts{Format: "pdf", Size: 500, Pages: pages(150)}, "long-pdf"},
+		{Facts{Format: "PDF", Size: 500, Pages: pages(150)}, "long-pdf"},
+		{Facts{Format: "pdf", Size: 500, Pages: pages(10), Text: text("Your INVOICE for May")}, "invoice"},
+		{Facts{Format: "docx", Size: 500, Text: text("a receipt")}, "invoice"},
+		{Facts{Format: "pdf", Size: 500, Pages: unreadable, Text: text("invoice")}, "invoice"},
+		{Facts{Format: "pdf", Size: 500, Pages: pages(10), Text: text("a letter")}, ""},
+		{Facts{Format: "pdf", Size: 500, Pages: pages(10)}, ""},
+		{Facts{Format: "xlsx", Size: 1000}, "small-sheet"},
+		{Facts{Format: "xlsx", Size: 1001}, ""},
+		{Facts{Format: "pptx", Size: 10}, ""},
+	} {
+		got := ""
+		if rule := engine.Evaluate(tc.facts); rule != nil {
+			got = rule.Name
+		}
+		if got != tc.want {
+			t.Errorf("Evaluate(%s, %d bytes) = %q, want %q", tc.facts.Format, tc.facts.Size, got, tc.want)
+		}
+	}
+}
+
+func TestEvaluateComputesFactsOnce(t *testing.T) {
+	engine, err := loadRules(t, `{"rules": [
+		{"name": "short", "match": {"max_pages": 2}},
+		{"name": "long", "match": {"min_pages": 50}},
+		{"name": "any", "match": {}}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	rule := engine.Evaluate(Facts{Format: "pdf", Pages: func() (int, error) { calls++; return 10, nil }})
+	if rule == nil || rule.Name != "any" {
+		t.Errorf("Evaluate = %v, want rule any", rule)
+	}
+	if calls != 1 {
+		t.Errorf("page count computed %d times, want once", calls)
+	}
+
+	// Rules that don't need them leave the facts alone
+	calls = 0
+	engine.Evaluate(Facts{Format: "pdf", Pages: func() (int, error) { calls++; return 10, nil }, Text: func() (string, error) {
+		t.Error("text computed without a keyword rule")
+		return "", nil
+	}})
+	if calls != 1 {
+		t.Errorf("page count computed %d times, want once", calls)
+	}
+
+	var none *Engine
+	if rule := none.Evaluate(Facts{Format: "pdf"}); rule != nil {
+		t.Errorf("nil engine matched %s", rule.Name)
+	}
+}
+
+func TestLoadRejectsUnknownQueue(t *testing.T) {
+	for _, tc := range []struct {
+		rules   string
+		wantErr bool
+	}{
+		{`{"rules": [{"name": "bulk", "action": {"queue": "low"}}]}`, false},
+		{`{"rules": [{"name": "bulk", "action": {"queue": "urgent"}}]}`, true},
+		{`{"rules": [`, true},
+	} {
+		if _, err := loadRules(t, tc.rules); (err != nil) != tc.wantErr {
+			t.Errorf("Load(%s) error = %v, want error %v", tc.rules, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/akila/document-converter/config"
+)
+
+const azureVersion = "2021-08-06"
+
+// AzureContainer is an Azure Blob Storage container as a Backend. Requests
+// are signed with the account's shared key; signed URLs are service SAS
+// tokens.
+type AzureContainer struct {
+	endpoint   *url.URL
+	account    string
+	key        []byte
+	container  string
+	httpClient *http.Client
+}
+
+func NewAzureContainer(cfg config.AzureStore, container string) (*AzureContainer, error) {
+	if !cfg.Configured() {
+		return nil, fmt.Errorf("no credentials configured for azure")
+	}
+	key, err := base64.StdEncoding.DecodeString(cfg.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid azure storage key: %v", err)
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid azure storage endpoint %q", cfg.Endpoint)
+	}
+	return &AzureContainer{
+		endpoint:   endpoint,
+		account:    cfg.Account,
+		key:        key,
+		container:  container,
+		httpClient: &http.Client{Timeout: 10 * time.Minute},
+	}, nil
+}
+
+func (c *AzureContainer) Put(key string, r io.Reader, size int64, contentType string) error {
+	req, err := c.newRequest(http.MethodPut, key, func(req *http.Request) {
+		req.Body = io.NopCloser(r)
+		req.ContentLength = size
+		req.Header.Set("x-ms-blob-type", "BlockBlob")
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return responseError("put", c.container, key, resp)
+	}
+	return nil
+}
+
+func (c *AzureContainer) Get(key string) (io.ReadCloser, int64, error) {
+	req, err := c.newRequest(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, 0, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, 0, responseError("get", c.container, key, resp)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (c *AzureContainer) Delete(key string) error {
+	req, err := c.newRequest(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNotFound {
+		return responseError("delete", c.container, key, resp)
+	}
+	return nil
+}
+
+// SignURL returns the blob's URL with a service SAS allowing reads (GET)
+// or creating and writing the blob (PUT). PUTs must send
+// x-ms-blob-type: BlockBlob.
+func (c *AzureContainer) SignURL(method, key string, expires time.Duration) (string, error) {
+	permissions := map[string]string{http.MethodGet: "r", http.MethodPut: "cw"}[method]
+	if permissions == "" {
+		return "", fmt.Errorf("can't sign %s URLs", method)
+	}
+	expiry := time.Now().Add(expires).UTC().Format("2006-01-02T15:04:05Z")
+	resource := "/blob/" + c.account + "/" + c.container + "/" + key
+	// Fields unused here (start, identifier, IP, protocol, snapshot,
+	// encryption scope, response headers) are signed as empty lines
+	stringToSign := strings.Join([]string{
+		permissions, "", expiry, resource, "", "", "", azureVersion, "b", "", "", "", "", "", "", "",
+	}, "\n")
+	query := url.Values{
+		"sv":  {azureVersion},
+		"sr":  {"b"},
+		"sp":  {permissions},
+		"se":  {expiry},
+		"sig": {c.sign(stringToSign)},
+	}
+	u := c.blobURL(key)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func (c *AzureContainer) blobURL(key string) *url.URL {
+	u := *c.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + c.container + "/" + key
+	u.RawPath = strings.TrimSuffix(c.endpoint.EscapedPath(), "/") + "/" + uriEncode(c.container, false) + "/" + uriEncode(key, false)
+	return &u
+}
+
+func (c *AzureContainer) newRequest(method, key string, prepare func(*http.Request)) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.blobURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if prepare != nil {
+		prepare(req)
+	}
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureVersion)
+	c.authorize(req)
+	return req, nil
+}
+
+// authorize adds a Shared Key Authorization header.
+func (c *AzureContainer) authorize(req *http.Request) {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = fmt.Sprint(req.ContentLength)
+	}
+
+	var names []string
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+
+	resource := "/" + c.account + req.URL.EscapedPath()
+	query := req.URL.Query()
+	params := make([]string, 0, len(query))
+	for name := range query {
+		params = append(params, name)
+	}
+	sort.Strings(params)
+	for _, name := range params {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		resource += "\n" + strings.ToLower(name) + ":" + strings.Join(values, ",")
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, sent as x-ms-date
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonicalHeaders.String() + resource,
+	}, "\n")
+	req.Header.Set("Authorization", "SharedKey "+c.account+":"+c.sign(stringToSign))
+}
+
+func (c *AzureContainer) sign(stringToSign string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
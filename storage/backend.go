@@ -0,0 +1,105 @@
+// Package storage keeps objects in a local directory, S3, GCS or Azure Blob
+// Storage behind one Backend interface. It backs the object storage
+// features: presigned uploads, storage delivery of outputs and the ingest
+// webhook. Async job results, and the download links handing them out,
+// are not objects: the jobs manager keeps them as files under
+// DataDir/jobs, which instances sharing the work must share.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/akila/document-converter/config"
+)
+
+// Backend stores objects by key in one bucket, container or directory.
+// Keys are slash-separated paths such as "outputs/<id>/part-1.pdf".
+type Backend interface {
+	// Put stores size bytes read from r as key, replacing any object
+	// already there.
+	Put(key string, r io.Reader, size int64, contentType string) error
+	// Get opens key and returns its size. Missing objects give ErrNotFound.
+	Get(key string) (io.ReadCloser, int64, error)
+	// Delete removes key. Missing objects are not an error.
+	Delete(key string) error
+	// SignURL returns a URL that allows method (GET or PUT) on key without
+	// further credentials until expires has passed.
+	SignURL(method, key string, expires time.Duration) (string, error)
+}
+
+// ErrNotFound is returned by Get for missing objects.
+var ErrNotFound = errors.New("object not found")
+
+// Open returns the backend for bucket on provider: "local" (a directory
+// under DataDir/storage), "s3", "gcs" or "azure" (bucket is the container).
+func Open(cfg *config.Config, provider, bucket string) (Backend, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("no bucket configured for %s", provider)
+	}
+	switch provider {
+	case "local":
+		return NewLocal(filepath.Join(cfg.DataDir, "storage"), bucket, cfg.PublicBaseURL, cfg.StorageURLSecret)
+	case "s3", "gcs":
+		store := cfg.S3
+		if provider == "gcs" {
+			store = cfg.GCS
+		}
+		if !store.Configured() {
+			return nil, fmt.Errorf("no credentials configured for %s", provider)
+		}
+		client, err := NewS3Client(store)
+		if err != nil {
+			return nil, err
+		}
+		return client.Bucket(bucket), nil
+	case "azure":
+		return NewAzureContainer(cfg.Azure, bucket)
+	}
+	return nil, fmt.Errorf("unknown storage provider %q", provider)
+}
+
+// PutFile stores the local file at path as key.
+func PutFile(b Backend, key, path, contentType string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return b.Put(key, f, info.Size(), contentType)
+}
+
+// GetFile writes key to the local file at path.
+func GetFile(b Backend, key, path string) error {
+	rc, _, err := b.Get(key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, rc); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// UploadHeaders are the headers clients must send with a PUT to a URL from
+// b.SignURL, e.g. the blob type Azure requires.
+func UploadHeaders(b Backend) map[string]string {
+	if _, ok := b.(*AzureContainer); ok {
+		return map[string]string{"x-ms-blob-type": "BlockBlob"}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalPathPrefix is where the API serves signed URLs of local buckets:
+// <prefix><bucket>/<key>.
+const LocalPathPrefix = "/storage/"
+
+// Local keeps objects as files under root/bucket, for single-node
+// deployments and development. Its signed URLs point at the API itself
+// (see LocalPathPrefix), so they need a secret to sign with.
+type Local struct {
+	dir     string
+	bucket  string
+	baseURL string
+	secret  []byte
+}
+
+func NewLocal(root, bucket, baseURL, secret string) (*Local, error) {
+	if !filepath.IsLocal(bucket) || strings.ContainsAny(bucket, `/\`) {
+		return nil, fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	dir := filepath.Join(root, bucket)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Local{dir: dir, bucket: bucket, baseURL: strings.TrimSuffix(baseURL, "/"), secret: []byte(secret)}, nil
+}
+
+// path maps key into the bucket's directory, refusing keys that would
+// leave it.
+func (l *Local) path(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) Put(key string, r io.Reader, size int64, contentType string) error {
+	dest, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	// Written aside and renamed so readers never see a partial object
+	f, err := os.CreateTemp(filepath.Dir(dest), ".put-*")
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, r)
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("got %d bytes, expected %d", n, size)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), dest)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (l *Local) Get(key string) (io.ReadCloser, int64, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, 0, ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, 0, ErrNotFound
+	}
+	return f, info.Size(), nil
+}
+
+func (l *Local) Delete(key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SignURL returns <base URL>/storage/<bucket>/<key> signed with the
+// secret, or a path relative to the API when no base URL is configured.
+func (l *Local) SignURL(method, key string, expires time.Duration) (string, error) {
+	if len(l.secret) == 0 {
+		return "", fmt.Errorf("local storage needs a URL signing secret")
+	}
+	if _, err := l.path(key); err != nil {
+		return "", err
+	}
+	objectPath := l.bucket + "/" + key
+	expiry := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	query := url.Values{
+		"method":    {method},
+		"expires":   {expiry},
+		"signature": {localSignature(l.secret, method, objectPath, expiry)},
+	}
+	u := url.URL{Path: LocalPathPrefix + objectPath, RawQuery: query.Encode()}
+	return l.baseURL + u.String(), nil
+}
+
+// VerifyLocalURL checks a request for a URL from Local.SignURL: objectPath
+// is "<bucket>/<key>" and query the URL's query. It returns the bucket
+// and key.
+func VerifyLocalURL(secret, method, objectPath string, query url.Values, now time.Time) (string, string, error) {
+	if secret == "" {
+		return "", "", fmt.Errorf("local storage URLs are not enabled")
+	}
+	expiry := query.Get("expires")
+	expires, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || query.Get("method") != method {
+		return "", "", fmt.Errorf("invalid signature")
+	}
+	want := localSignature([]byte(secret), method, objectPath, expiry)
+	if !hmac.Equal([]byte(want), []byte(query.Get("signature"))) {
+		return "", "", fmt.Errorf("invalid signature")
+	}
+	if now.Unix() > expires {
+		return "", "", fmt.Errorf("URL expired")
+	}
+	bucket, key, ok := strings.Cut(objectPath, "/")
+	if !ok || key == "" || path.Clean(key) != key {
+		return "", "", fmt.Errorf("invalid object path")
+	}
+	return bucket, key, nil
+}
+
+func localSignature(secret []byte, method, objectPath, expiry string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(method + "\n" + objectPath + "\n" + expiry))
+	return hex.EncodeToString(mac.Sum(nil))
+}
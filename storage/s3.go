@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/akila/document-converter/config"
+)
+
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Client talks to S3 or any S3-compatible object store (MinIO, GCS via
+// HMAC interoperability keys) using path-style requests signed with SigV4.
+type S3Client struct {
+	endpoint     *url.URL
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	httpClient   *http.Client
+}
+
+func NewS3Client(cfg config.ObjectStore) (*S3Client, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid object store endpoint %q", cfg.Endpoint)
+	}
+	return &S3Client{
+		endpoint:     endpoint,
+		region:       cfg.Region,
+		accessKey:    cfg.AccessKeyID,
+		secretKey:    cfg.SecretAccessKey,
+		sessionToken: cfg.SessionToken,
+		httpClient:   &http.Client{Timeout: 10 * time.Minute},
+	}, nil
+}
+
+// Get opens bucket/key and returns its size.
+func (c *S3Client) Get(bucket, key string) (io.ReadCloser, int64, error) {
+	req, err := c.newRequest(http.MethodGet, bucket, key, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, 0, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, 0, responseError("get", bucket, key, resp)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// Put stores size bytes read from r as bucket/key.
+func (c *S3Client) Put(bucket, key string, r io.Reader, size int64, contentType string) error {
+	req, err := c.newRequest(http.MethodPut, bucket, key, func(req *http.Request) {
+		req.Body = io.NopCloser(r)
+		req.ContentLength = size
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError("put", bucket, key, resp)
+	}
+	return nil
+}
+
+// Delete removes bucket/key. Missing objects are not an error.
+func (c *S3Client) Delete(bucket, key string) error {
+	req, err := c.newRequest(http.MethodDelete, bucket, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return responseError("delete", bucket, key, resp)
+	}
+	return nil
+}
+
+// Presign returns a URL that allows method on bucket/key without further
+// credentials until it expires. Only the host header is signed, so clients
+// may send any Content-Type.
+func (c *S3Client) Presign(method, bucket, key string, expires time.Duration) string {
+	return c.presign(method, c.objectURL(bucket, key), expires, time.Now().UTC())
+}
+
+func (c *S3Client) presign(method string, u *url.URL, expires time.Duration, now time.Time) string {
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + c.region + "/s3/aws4_request"
+
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {c.accessKey + "/" + scope},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {fmt.Sprint(int(expires.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if c.sessionToken != "" {
+		query.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		canonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	signature := c.signature(now, "AWS4-HMAC-SHA256\n"+amzDate+"\n"+scope+"\n"+hexSHA256(canonicalRequest))
+
+	u.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + signature
+	return u.String()
+}
+
+// S3Bucket is one bucket of an S3Client as a Backend.
+type S3Bucket struct {
+	client *S3Client
+	bucket string
+}
+
+// Bucket returns the Backend for bucket.
+func (c *S3Client) Bucket(bucket string) *S3Bucket {
+	return &S3Bucket{client: c, bucket: bucket}
+}
+
+func (b *S3Bucket) Put(key string, r io.Reader, size int64, contentType string) error {
+	return b.client.Put(b.bucket, key, r, size, contentType)
+}
+
+func (b *S3Bucket) Get(key string) (io.ReadCloser, int64, error) {
+	return b.client.Get(b.bucket, key)
+}
+
+func (b *S3Bucket) Delete(key string) error {
+	return b.client.Delete(b.bucket, key)
+}
+
+func (b *S3Bucket) SignURL(method, key string, expires time.Duration) (string, error) {
+	return b.client.Presign(method, b.bucket, key, expires), nil
+}
+
+func responseError(op, bucket, key string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("object store %s %s/%s failed: %s, body: %s", op, bucket, key, resp.Status, string(body))
+}
+
+func (c *S3Client) objectURL(bucket, key string) *url.URL {
+	u := *c.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + bucket + "/" + key
+	u.RawPath = strings.TrimSuffix(c.endpoint.EscapedPath(), "/") + "/" + uriEncode(bucket, false) + "/" + uriEncode(key, false)
+	return &u
+}
+
+func (c *S3Client) newRequest(method, bucket, key string, prepare func(*http.Request)) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.objectURL(bucket, key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if prepare != nil {
+		prepare(req)
+	}
+	c.sign(req, time.Now().UTC())
+	return req, nil
+}
+
+// sign adds a SigV4 Authorization header. Payloads are sent unsigned, which
+// S3 and compatible stores accept over HTTPS and lets uploads stream.
+func (c *S3Client) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := now.Format("20060102") + "/" + c.region + "/s3/aws4_request"
+	signature := c.signature(now, "AWS4-HMAC-SHA256\n"+amzDate+"\n"+scope+"\n"+hexSHA256(canonicalRequest))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func (c *S3Client) signature(now time.Time, stringToSign string) string {
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), values[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode applies SigV4 URI encoding: everything except unreserved
+// characters is percent-encoded, and '/' too unless it separates path
+// segments.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hexSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,368 @@
+// Package templates keeps a server-side catalog of document templates: an
+// HTML page (a Go html/template) with its CSS, images and fonts, stored in
+// numbered versions so templates can be updated, and rolled back, without
+// client deploys. Each template belongs to the tenant that created it and
+// is either private to that tenant or public to every tenant; names are
+// unique across the catalog.
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Visibilities of a template.
+const (
+	Private = "private"
+	Public  = "public"
+)
+
+var (
+	ErrNotFound = errors.New("template not found")
+	// ErrNotOwner is returned when a tenant changes a public template of
+	// another tenant, or takes its name.
+	ErrNotOwner = errors.New("template belongs to another tenant")
+)
+
+// Template is a catalog entry.
+type Template struct {
+	Name       string    `json:"name"`
+	Owner      string    `json:"owner,omitempty"`
+	Visibility string    `json:"visibility"`
+	Current    int       `json:"current"`
+	Versions   []Version `json:"versions"`
+}
+
+// Version is one upload of a template.
+type Version struct {
+	Version int `json:"version"`
+	// Entry is the template page, relative to the version's directory.
+	Entry     string    `json:"entry"`
+	CreatedAt time.Time `json:"created_at"`
+	// SampleData renders previews.
+	SampleData json.RawMessage `json:"sample_data,omitempty"`
+	// Reference is the layout documents generated from the version must
+	// match (a converters.LayoutReference), checked by /compare/template.
+	Reference json.RawMessage `json:"reference,omitempty"`
+}
+
+func (t *Template) version(v int) (Version, bool) {
+	if v == 0 {
+		v = t.Current
+	}
+	for _, version := range t.Versions {
+		if version.Version == v {
+			return version, true
+		}
+	}
+	return Version{}, false
+}
+
+func (t *Template) visibleTo(tenant string) bool {
+	return t.Owner == tenant || t.Visibility == Public
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// ValidName reports whether name can name a template.
+func ValidName(name string) bool {
+	return validName.MatchString(name) && name != "." && name != ".."
+}
+
+// Catalog stores templates under a directory: <name>/template.json and a
+// directory per version, <name>/v<N>/.
+type Catalog struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Open uses the catalog stored in dir.
+func Open(dir string) (*Catalog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Catalog{dir: dir}, nil
+}
+
+func (c *Catalog) load(name string) (*Template, error) {
+	if !ValidName(name) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(c.dir, name, "template.json"))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var t Template
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("template %s: %v", name, err)
+	}
+	return &t, nil
+}
+
+func (c *Catalog) save(t *Template) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(c.dir, t.Name, "template.json.tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(c.dir, t.Name, "template.json"))
+}
+
+// List returns the templates a tenant can use, by name.
+func (c *Catalog) List(tenant string) ([]Template, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	var list []Template
+	for _, e := range entries {
+		if t, err := c.load(e.Name()); err == nil && t.visibleTo(tenant) {
+			list = append(list, *t)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Get returns a template the tenant can use. Templates it can't see are
+// reported as not found.
+func (c *Catalog) Get(tenant, name string) (Template, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.load(name)
+	if err != nil {
+		return Template{}, err
+	}
+	if !t.visibleTo(tenant) {
+		return Template{}, ErrNotFound
+	}
+	return *t, nil
+}
+
+// AddVersion stores the site in srcDir, whose page entry must parse as a
+// template, as the template's next version and makes it current. The
+// template is created, with the given visibility (default private), if it
+// doesn't exist; otherwise a non-empty visibility changes it.
+func (c *Catalog) AddVersion(tenant, name, srcDir, entry string, sample json.RawMessage, visibility string) (Template, error) {
+	if err := checkVisibility(visibility); err != nil {
+		return Template{}, err
+	}
+	if _, err := template.ParseFiles(filepath.Join(srcDir, entry)); err != nil {
+		return Template{}, fmt.Errorf("invalid template: %v", err)
+	}
+	if len(sample) > 0 && !json.Valid(sample) {
+		return Template{}, fmt.Errorf("sample_data must be JSON")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.load(name)
+	switch {
+	case err == ErrNotFound:
+		t = &Template{Name: name, Owner: tenant, Visibility: Private}
+	case err != nil:
+		return Template{}, err
+	case t.Owner != tenant:
+		return Template{}, ErrNotOwner
+	}
+	if visibility != "" {
+		t.Visibility = visibility
+	}
+
+	next := 1
+	if n := len(t.Versions); n > 0 {
+		next = t.Versions[n-1].Version + 1
+	}
+	versionDir := filepath.Join(c.dir, name, "v"+strconv.Itoa(next))
+	if err := copyDir(srcDir, versionDir); err != nil {
+		os.RemoveAll(versionDir)
+		return Template{}, err
+	}
+	t.Versions = append(t.Versions, Version{
+		Version:    next,
+		Entry:      filepath.ToSlash(entry),
+		CreatedAt:  time.Now().UTC(),
+		SampleData: sample,
+	})
+	t.Current = next
+	if err := c.save(t); err != nil {
+		return Template{}, err
+	}
+	return *t, nil
+}
+
+// Update changes a template's visibility (unless empty) and current
+// version (unless 0), e.g. to roll back to an earlier version.
+func (c *Catalog) Update(tenant, name, visibility string, current int) (Template, error) {
+	if err := checkVisibility(visibility); err != nil {
+		return Template{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.owned(tenant, name)
+	if err != nil {
+		return Template{}, err
+	}
+	if visibility != "" {
+		t.Visibility = visibility
+	}
+	if current != 0 {
+		if _, ok := t.version(current); !ok {
+			return Template{}, fmt.Errorf("template %s has no version %d", name, current)
+		}
+		t.Current = current
+	}
+	if err := c.save(t); err != nil {
+		return Template{}, err
+	}
+	return *t, nil
+}
+
+// SetReference stores the layout reference of a version of a template (0
+// for the current one); an empty reference removes it.
+func (c *Catalog) SetReference(tenant, name string, version int, reference json.RawMessage) (Template, error) {
+	if len(reference) > 0 && !json.Valid(reference) {
+		return Template{}, fmt.Errorf("reference must be JSON")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, err := c.owned(tenant, name)
+	if err != nil {
+		return Template{}, err
+	}
+	v, ok := t.version(version)
+	if !ok {
+		return Template{}, fmt.Errorf("template %s has no version %d", name, version)
+	}
+	for i := range t.Versions {
+		if t.Versions[i].Version == v.Version {
+			t.Versions[i].Reference = reference
+		}
+	}
+	if err := c.save(t); err != nil {
+		return Template{}, err
+	}
+	return *t, nil
+}
+
+// Delete removes a template with all its versions.
+func (c *Catalog) Delete(tenant, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.owned(tenant, name); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(c.dir, name))
+}
+
+// owned loads a template the tenant may change.
+func (c *Catalog) owned(tenant, name string) (*Template, error) {
+	t, err := c.load(name)
+	if err != nil {
+		return nil, err
+	}
+	if t.Owner != tenant {
+		if t.visibleTo(tenant) {
+			return nil, ErrNotOwner
+		}
+		return nil, ErrNotFound
+	}
+	return t, nil
+}
+
+// Render writes a version of a template (0 for the current one), filled in
+// with data, as a site into outDir and returns its page, relative to
+// outDir. Nil data renders the version's sample data.
+func (c *Catalog) Render(tenant, name string, version int, data interface{}, outDir string) (string, error) {
+	t, err := c.Get(tenant, name)
+	if err != nil {
+		return "", err
+	}
+	v, ok := t.version(version)
+	if !ok {
+		return "", fmt.Errorf("template %s has no version %d", name, version)
+	}
+	if data == nil && len(v.SampleData) > 0 {
+		if err := json.Unmarshal(v.SampleData, &data); err != nil {
+			return "", err
+		}
+	}
+
+	if err := copyDir(filepath.Join(c.dir, name, "v"+strconv.Itoa(v.Version)), outDir); err != nil {
+		return "", err
+	}
+	entry := filepath.Join(outDir, filepath.FromSlash(v.Entry))
+	tmpl, err := template.ParseFiles(entry)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Create(entry)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := tmpl.Execute(f, data); err != nil {
+		return "", fmt.Errorf("rendering template %s: %v", name, err)
+	}
+	return v.Entry, nil
+}
+
+func checkVisibility(visibility string) error {
+	switch visibility {
+	case "", Private, Public:
+		return nil
+	}
+	return fmt.Errorf("visibility must be %s or %s", Private, Public)
+}
+
+// copyDir copies the regular files below src into dst.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
@@ -19,14 +19,38 @@ func ZipFiles(filename string, files []string) error {
 	defer zipWriter.Close()
 
 	for _, file := range files {
-		if err := addFileToZip(zipWriter, file); err != nil {
+		if err := addFileToZip(zipWriter, file, filepath.Base(file)); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func addFileToZip(zipWriter *zip.Writer, filename string) error {
+// ZipFilesUnder is ZipFiles keeping each file's path relative to root, so
+// files in different folders may share a name.
+func ZipFilesUnder(filename, root string, files []string) error {
+	newZipFile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer newZipFile.Close()
+
+	zipWriter := zip.NewWriter(newZipFile)
+	defer zipWriter.Close()
+
+	for _, file := range files {
+		name, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		if err := addFileToZip(zipWriter, file, filepath.ToSlash(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addFileToZip(zipWriter *zip.Writer, filename, name string) error {
 	fileToZip, err := os.Open(filename)
 	if err != nil {
 		return err
@@ -43,7 +67,7 @@ func addFileToZip(zipWriter *zip.Writer, filename string) error {
 		return err
 	}
 
-	header.Name = filepath.Base(filename)
+	header.Name = name
 	header.Method = zip.Deflate
 
 	writer, err := zipWriter.CreateHeader(header)
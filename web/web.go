@@ -0,0 +1,20 @@
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var assets embed.FS
+
+// Handler serves the bundled upload UI. It is mounted at / when SERVE_UI is
+// enabled so the backend can be deployed without a separate frontend.
+func Handler() http.Handler {
+	static, err := fs.Sub(assets, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServer(http.FS(static))
+}
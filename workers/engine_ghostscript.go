@@ -0,0 +1,43 @@
+//go:build !no_ghostscript
+
+package workers
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/models"
+)
+
+func init() {
+	registerEngine("ghostscript", func(mgr *EngineManager, numCPU int) *WorkerPool {
+		mgr.GhostscriptPool = NewWorkerPool(numCPU, func(job models.Job) {
+			var err error
+			outputPath := filepath.Join(job.TempDir, "output.pdf")
+			if job.ToFormat == "tiff" || job.ToFormat == "tif" {
+				outputPath = filepath.Join(job.TempDir, "output."+job.ToFormat)
+				mode, _ := job.Options["tiff_mode"].(string)
+				img := imageOptions(job)
+				err = converters.PDFToTIFF(job.InputPath, outputPath, mode, img.DPI, img.FirstPage, img.LastPage)
+			} else {
+				opts := converters.CompressOptions{}
+				opts.Level, _ = job.Options["preset"].(string)
+				opts.Quality, _ = job.Options["quality"].(int)
+				err = converters.CompressPDF(job.InputPath, outputPath, opts)
+			}
+			if err != nil {
+				log.Printf("[%s] Ghostscript worker failed: %v", job.ID, err)
+			} else {
+				log.Printf("[%s] Ghostscript worker finished: %s", job.ID, outputPath)
+			}
+
+			job.ResultChan <- models.JobResult{
+				Success: err == nil,
+				Error:   err,
+				Path:    outputPath,
+			}
+		})
+		return mgr.GhostscriptPool
+	})
+}
@@ -0,0 +1,52 @@
+//go:build !no_gpu
+
+package workers
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/models"
+)
+
+func init() {
+	registerEngine("gpu", func(mgr *EngineManager, numCPU int) *WorkerPool {
+		// Renders share one device; a few workers keep it busy
+		mgr.GPUPool = NewWorkerPool(max(1, numCPU/4), func(job models.Job) {
+			outputPath := filepath.Join(job.TempDir, "output")
+			opts := imageOptions(job)
+
+			var err error
+			gpu := !opts.AutoDPI && converters.GPURenderAvailable()
+			if gpu {
+				if err = converters.GPUPDFToImage(job.InputPath, outputPath, job.ToFormat, opts); err != nil {
+					log.Printf("[%s] GPU render failed, falling back to CPU: %v", job.ID, err)
+					partial, _ := filepath.Glob(outputPath + "*")
+					for _, p := range partial {
+						os.Remove(p)
+					}
+				}
+			}
+			if !gpu || err != nil {
+				err = converters.PDFToImage(job.InputPath, outputPath, job.ToFormat, opts)
+			}
+			if err == nil {
+				outputPath, err = imageResult(outputPath, job.ToFormat)
+			}
+			if err != nil {
+				log.Printf("[%s] GPU worker failed: %v", job.ID, err)
+			} else {
+				log.Printf("[%s] GPU worker finished: %s", job.ID, outputPath)
+			}
+
+			job.ResultChan <- models.JobResult{
+				Success: err == nil,
+				Error:   err,
+				Path:    outputPath,
+			}
+		})
+		return mgr.GPUPool
+	})
+}
@@ -0,0 +1,39 @@
+//go:build !no_imagemagick
+
+package workers
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/models"
+)
+
+func init() {
+	registerEngine("imagemagick", func(mgr *EngineManager, numCPU int) *WorkerPool {
+		mgr.ImageMagickPool = NewWorkerPool(numCPU, func(job models.Job) {
+			outputPath := filepath.Join(job.TempDir, "output.pdf")
+			var err error
+			if strings.EqualFold(job.FromFormat, "svg") {
+				// Rasterizing would lose the vectors
+				err = converters.SVGToPDF(job.InputPath, outputPath)
+			} else {
+				err = converters.ImageToPDF([]string{job.InputPath}, outputPath)
+			}
+			if err != nil {
+				log.Printf("[%s] ImageMagick worker failed: %v", job.ID, err)
+			} else {
+				log.Printf("[%s] ImageMagick worker finished: %s", job.ID, outputPath)
+			}
+
+			job.ResultChan <- models.JobResult{
+				Success: err == nil,
+				Error:   err,
+				Path:    outputPath,
+			}
+		})
+		return mgr.ImageMagickPool
+	})
+}
@@ -0,0 +1,56 @@
+//go:build !no_libreoffice
+
+package workers
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/models"
+)
+
+func init() {
+	registerEngine("libreoffice", func(mgr *EngineManager, numCPU int) *WorkerPool {
+		mgr.LibreOfficePool = NewWorkerPool(numCPU, func(job models.Job) {
+			log.Printf("[%s] LibreOffice worker starting: %s -> %s", job.ID, job.FromFormat, job.ToFormat)
+			outputPath := filepath.Join(job.TempDir, "output."+job.ToFormat)
+			var err error
+			switch strings.ToLower(job.FromFormat) {
+			case "eml", "msg":
+				// Emails are laid out in Go; LibreOffice converts attachments
+				appendAttachments, _ := job.Options["append_attachments"].(bool)
+				err = converters.EmailToPDF(job.InputPath, outputPath, appendAttachments)
+			default:
+				err = converters.LibreOfficeConvert(job.InputPath, job.TempDir, converters.LibreOfficeTarget(strings.ToLower(job.FromFormat), job.ToFormat))
+
+				if err == nil {
+					// Find the actual output file (LibreOffice might rename it)
+					matches, _ := filepath.Glob(filepath.Join(job.TempDir, "*."+job.ToFormat))
+					log.Printf("[%s] LibreOffice matches for %s: %v", job.ID, job.ToFormat, matches)
+					if len(matches) > 0 {
+						outputPath = matches[0]
+					} else {
+						// Try case-insensitive or common variations if needed, but for now just fail with info
+						err = fmt.Errorf("conversion succeeded but no output file found in %s for format %s", job.TempDir, job.ToFormat)
+					}
+				}
+			}
+
+			if err != nil {
+				log.Printf("[%s] LibreOffice worker failed: %v", job.ID, err)
+			} else {
+				log.Printf("[%s] LibreOffice worker finished: %s", job.ID, outputPath)
+			}
+
+			job.ResultChan <- models.JobResult{
+				Success: err == nil,
+				Error:   err,
+				Path:    outputPath,
+			}
+		})
+		return mgr.LibreOfficePool
+	})
+}
@@ -0,0 +1,42 @@
+//go:build !no_mupdf
+
+package workers
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/models"
+)
+
+func init() {
+	registerEngine("mupdf", func(mgr *EngineManager, numCPU int) *WorkerPool {
+		mgr.MuPDFPool = NewWorkerPool(numCPU, func(job models.Job) {
+			var err error
+			outputPath := filepath.Join(job.TempDir, "output")
+			if job.ToFormat == "txt" {
+				outputPath = outputPath + ".txt"
+				err = converters.MuPDFExtractText(job.InputPath, outputPath)
+			} else {
+				opts := imageOptions(job)
+				err = converters.MuPDFToImage(job.InputPath, outputPath, job.ToFormat, opts)
+				if err == nil {
+					outputPath, err = imageResult(outputPath, job.ToFormat)
+				}
+			}
+			if err != nil {
+				log.Printf("[%s] MuPDF worker failed: %v", job.ID, err)
+			} else {
+				log.Printf("[%s] MuPDF worker finished: %s", job.ID, outputPath)
+			}
+
+			job.ResultChan <- models.JobResult{
+				Success: err == nil,
+				Error:   err,
+				Path:    outputPath,
+			}
+		})
+		return mgr.MuPDFPool
+	})
+}
@@ -0,0 +1,46 @@
+//go:build !no_pandoc
+
+package workers
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/models"
+)
+
+func init() {
+	registerEngine("pandoc", func(mgr *EngineManager, numCPU int) *WorkerPool {
+		mgr.PandocPool = NewWorkerPool(numCPU, func(job models.Job) {
+			to := job.ToFormat
+			if to == "" {
+				to = "pdf"
+			}
+			outputPath := filepath.Join(job.TempDir, "output."+to)
+			var err error
+			switch strings.ToLower(job.FromFormat) {
+			case "pdf":
+				// Pandoc can't read PDFs
+				err = converters.EbookConvert(job.InputPath, outputPath)
+			case "tex", "latex":
+				err = converters.LaTeXToPDF(job.InputPath, outputPath)
+			default:
+				err = converters.PandocConvert(job.InputPath, outputPath)
+			}
+			if err != nil {
+				log.Printf("[%s] Pandoc worker failed: %v", job.ID, err)
+			} else {
+				log.Printf("[%s] Pandoc worker finished: %s", job.ID, outputPath)
+			}
+
+			job.ResultChan <- models.JobResult{
+				Success: err == nil,
+				Error:   err,
+				Path:    outputPath,
+			}
+		})
+		return mgr.PandocPool
+	})
+}
@@ -0,0 +1,47 @@
+//go:build !no_poppler
+
+package workers
+
+import (
+	"log"
+	"path/filepath"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/models"
+)
+
+func init() {
+	registerEngine("poppler", func(mgr *EngineManager, numCPU int) *WorkerPool {
+		mgr.PopplerPool = NewWorkerPool(numCPU, func(job models.Job) {
+			var err error
+			outputPath := filepath.Join(job.TempDir, "output")
+			if job.ToFormat == "txt" {
+				outputPath = outputPath + ".txt"
+				err = converters.ExtractText(job.InputPath, outputPath)
+			} else if job.ToFormat == "md" || job.ToFormat == "markdown" {
+				outputPath = outputPath + ".md"
+				err = converters.PDFToMarkdown(job.InputPath, outputPath)
+			} else {
+				// Image format
+				opts := imageOptions(job)
+				err = mgr.renderImages(job.InputPath, outputPath, job.ToFormat, opts)
+				// pdftoppm appends -1.jpg, -2.jpg, ... per page
+				if err == nil {
+					outputPath, err = imageResult(outputPath, job.ToFormat)
+				}
+			}
+			if err != nil {
+				log.Printf("[%s] Poppler worker failed: %v", job.ID, err)
+			} else {
+				log.Printf("[%s] Poppler worker finished: %s", job.ID, outputPath)
+			}
+
+			job.ResultChan <- models.JobResult{
+				Success: err == nil,
+				Error:   err,
+				Path:    outputPath,
+			}
+		})
+		return mgr.PopplerPool
+	})
+}
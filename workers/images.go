@@ -0,0 +1,78 @@
+package workers
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/akila/document-converter/converters"
+	"github.com/akila/document-converter/models"
+	"github.com/akila/document-converter/utils"
+)
+
+// imageOptions reads the rendering options a handler put on a job.
+func imageOptions(job models.Job) converters.ImageOptions {
+	opts := converters.ImageOptions{AutoDPI: job.Options["dpi"] == "auto"}
+	opts.DPI, _ = job.Options["dpi"].(int)
+	opts.Quality, _ = job.Options["quality"].(int)
+	opts.ScaleTo, _ = job.Options["scale_to"].(int)
+	opts.FirstPage, _ = job.Options["first_page"].(int)
+	opts.LastPage, _ = job.Options["last_page"].(int)
+	return opts
+}
+
+// renderImages renders a PDF to images with pdftoppm. Ranges of at least
+// ParallelRenderPages pages are split into smaller ranges rendered side by
+// side on idle Poppler workers (see WorkerPool.Spread). pdftoppm pads page
+// numbers to the document's page count, so the images of every range sort
+// in page order just like those of a single run.
+func (m *EngineManager) renderImages(inputPath, outputPrefix, format string, opts converters.ImageOptions) error {
+	if m.ParallelRenderPages <= 0 || m.PopplerPool == nil {
+		return converters.PDFToImage(inputPath, outputPrefix, format, opts)
+	}
+	pageCount, err := converters.PageCount(inputPath)
+	if err != nil {
+		// pdftoppm reports the problem
+		return converters.PDFToImage(inputPath, outputPrefix, format, opts)
+	}
+	first, last := max(opts.FirstPage, 1), opts.LastPage
+	if last == 0 || last > pageCount {
+		last = pageCount
+	}
+	pages := last - first + 1
+	if pages < m.ParallelRenderPages {
+		return converters.PDFToImage(inputPath, outputPrefix, format, opts)
+	}
+
+	// Two ranges per worker even out pages of uneven cost; a few pages each
+	// keep pdftoppm's start-up (parsing the document) a small share
+	workers := m.PopplerPool.Workers()
+	size := max(4, (pages+2*workers-1)/(2*workers))
+	var ranges [][2]int
+	for from := first; from <= last; from += size {
+		ranges = append(ranges, [2]int{from, min(from+size-1, last)})
+	}
+	return m.PopplerPool.Spread(len(ranges), func(i int) error {
+		rangeOpts := opts
+		rangeOpts.FirstPage, rangeOpts.LastPage = ranges[i][0], ranges[i][1]
+		return converters.PDFToImage(inputPath, outputPrefix, format, rangeOpts)
+	})
+}
+
+// imageResult picks the result of a render to outputPath: the image itself
+// for a single page, or a zip of every page image, in page order.
+func imageResult(outputPath, format string) (string, error) {
+	matches, _ := filepath.Glob(outputPath + "*." + format)
+	switch len(matches) {
+	case 0:
+		return outputPath, nil
+	case 1:
+		return matches[0], nil
+	}
+	// Page numbers are zero padded, so names sort in page order
+	sort.Strings(matches)
+	zipPath := outputPath + ".zip"
+	if err := utils.ZipFiles(zipPath, matches); err != nil {
+		return "", err
+	}
+	return zipPath, nil
+}
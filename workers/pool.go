@@ -2,10 +2,12 @@ package workers
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log"
-	"path/filepath"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/akila/document-converter/converters"
 	"github.com/akila/document-converter/models"
@@ -13,25 +15,94 @@ import (
 
 type WorkerPool struct {
 	JobQueue chan models.Job
-	workers  int
-	handler  func(models.Job)
-	wg       sync.WaitGroup
+	// LowQueue holds low-priority jobs, taken only when JobQueue is empty.
+	LowQueue chan models.Job
+	// helpers carry work a running job shares with idle workers (see
+	// Spread).
+	helpers chan func()
+	workers int
+	handler func(models.Job)
+	wg      sync.WaitGroup
 }
 
 func NewWorkerPool(workers int, handler func(models.Job)) *WorkerPool {
 	return &WorkerPool{
 		JobQueue: make(chan models.Job, 100),
+		LowQueue: make(chan models.Job, 100),
+		helpers:  make(chan func(), workers),
 		workers:  workers,
 		handler:  handler,
 	}
 }
 
+// Enqueue queues job according to its priority.
+func (p *WorkerPool) Enqueue(job models.Job) {
+	if job.LowPriority {
+		p.LowQueue <- job
+		return
+	}
+	p.JobQueue <- job
+}
+
+// ErrQueueFull is returned by TryEnqueue when the queue stays full.
+var ErrQueueFull = errors.New("job queue full")
+
+// TryEnqueue queues job like Enqueue, but waits at most wait for room in a
+// full queue and gives up with ErrQueueFull after that.
+func (p *WorkerPool) TryEnqueue(job models.Job, wait time.Duration) error {
+	queue := p.JobQueue
+	if job.LowPriority {
+		queue = p.LowQueue
+	}
+	select {
+	case queue <- job:
+		return nil
+	default:
+	}
+	if wait <= 0 {
+		return ErrQueueFull
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case queue <- job:
+		return nil
+	case <-timer.C:
+		return ErrQueueFull
+	}
+}
+
+// Capacity is the number of jobs the pool's queues hold.
+func (p *WorkerPool) Capacity() int {
+	return cap(p.JobQueue) + cap(p.LowQueue)
+}
+
+// Queued is the number of jobs waiting for a worker.
+func (p *WorkerPool) Queued() int {
+	return len(p.JobQueue) + len(p.LowQueue)
+}
+
+// Workers is the number of jobs the pool runs at once.
+func (p *WorkerPool) Workers() int {
+	return p.workers
+}
+
 func (p *WorkerPool) Start(ctx context.Context) {
 	for i := 0; i < p.workers; i++ {
 		p.wg.Add(1)
 		go func(workerID int) {
 			defer p.wg.Done()
 			for {
+				// Drain normal jobs first
+				select {
+				case job, ok := <-p.JobQueue:
+					if !ok {
+						return
+					}
+					p.handler(job)
+					continue
+				default:
+				}
 				select {
 				case <-ctx.Done():
 					return
@@ -40,14 +111,72 @@ func (p *WorkerPool) Start(ctx context.Context) {
 						return
 					}
 					p.handler(job)
+				case job, ok := <-p.LowQueue:
+					if !ok {
+						return
+					}
+					p.handler(job)
+				case help := <-p.helpers:
+					help()
 				}
 			}
 		}(i)
 	}
 }
 
+// Spread runs the n pieces of a job's work, such as the page ranges of one
+// render, on the calling worker and on whichever of the pool's workers are
+// idle. The caller works through the pieces too, so a job finishes even when
+// no worker is free; helpers that start after the last piece is taken do
+// nothing. Returns the first error.
+func (p *WorkerPool) Spread(n int, piece func(i int) error) error {
+	var next atomic.Int64
+	var mu sync.Mutex
+	var firstErr error
+	work := func() {
+		for i := int(next.Add(1) - 1); i < n; i = int(next.Add(1) - 1) {
+			if err := piece(i); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				// No point in the rest
+				next.Store(int64(n))
+			}
+		}
+	}
+
+	var running sync.WaitGroup
+	done := false
+	for i := 1; i < min(n, p.workers); i++ {
+		select {
+		case p.helpers <- func() {
+			mu.Lock()
+			if done {
+				mu.Unlock()
+				return
+			}
+			running.Add(1)
+			mu.Unlock()
+			defer running.Done()
+			work()
+		}:
+		default:
+			// Enough help is already on offer
+		}
+	}
+	work()
+	mu.Lock()
+	done = true
+	mu.Unlock()
+	running.Wait()
+	return firstErr
+}
+
 func (p *WorkerPool) Wait() {
 	close(p.JobQueue)
+	close(p.LowQueue)
 	p.wg.Wait()
 }
 
@@ -58,96 +187,76 @@ type EngineManager struct {
 	ImageMagickPool *WorkerPool
 	PandocPool      *WorkerPool
 	GhostscriptPool *WorkerPool
+	GPUPool         *WorkerPool
+	MuPDFPool       *WorkerPool
+
+	// ParallelRenderPages is the page count from which Poppler splits a
+	// PDF -> image render into page ranges rendered side by side (see
+	// WorkerPool.Spread). Zero renders in one pdftoppm run.
+	ParallelRenderPages int
+
+	pools map[string]*WorkerPool
 }
 
-func NewEngineManager(numCPU int) *EngineManager {
-	mgr := &EngineManager{}
+// engineFactory builds the worker pool for one engine and wires it into the
+// manager. Each engine registers itself from a file guarded by a no_<engine>
+// build tag, so minimal binaries can leave whole engines out.
+type engineFactory func(mgr *EngineManager, workers int) *WorkerPool
 
-	mgr.LibreOfficePool = NewWorkerPool(numCPU, func(job models.Job) {
-		log.Printf("[%s] LibreOffice worker starting: %s -> %s", job.ID, job.FromFormat, job.ToFormat)
-		outputPath := filepath.Join(job.TempDir, "output."+job.ToFormat)
-		err := converters.LibreOfficeConvert(job.InputPath, job.TempDir, job.ToFormat)
+var engineFactories = map[string]engineFactory{}
 
-		if err == nil {
-			// Find the actual output file (LibreOffice might rename it)
-			matches, _ := filepath.Glob(filepath.Join(job.TempDir, "*."+job.ToFormat))
-			log.Printf("[%s] LibreOffice matches for %s: %v", job.ID, job.ToFormat, matches)
-			if len(matches) > 0 {
-				outputPath = matches[0]
-			} else {
-				// Try case-insensitive or common variations if needed, but for now just fail with info
-				err = fmt.Errorf("conversion succeeded but no output file found in %s for format %s", job.TempDir, job.ToFormat)
-			}
-		}
+func registerEngine(name string, factory engineFactory) {
+	engineFactories[name] = factory
+}
 
-		if err != nil {
-			log.Printf("[%s] LibreOffice worker failed: %v", job.ID, err)
-		} else {
-			log.Printf("[%s] LibreOffice worker finished: %s", job.ID, outputPath)
-		}
+// CompiledEngines lists the engines built into this binary.
+func CompiledEngines() []string {
+	names := make([]string, 0, len(engineFactories))
+	for name := range engineFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
 
-		job.ResultChan <- models.JobResult{
-			Success: err == nil,
-			Error:   err,
-			Path:    outputPath,
-		}
-	})
-
-	mgr.PopplerPool = NewWorkerPool(numCPU, func(job models.Job) {
-		var err error
-		outputPath := filepath.Join(job.TempDir, "output")
-		if job.ToFormat == "txt" {
-			outputPath = outputPath + ".txt"
-			err = converters.ExtractText(job.InputPath, outputPath)
-		} else {
-			// Image format
-			err = converters.PDFToImage(job.InputPath, outputPath, job.ToFormat)
-			// pdftoppm appends -1.jpg, so we need to find it
-			matches, _ := filepath.Glob(outputPath + "*." + job.ToFormat)
-			if len(matches) > 0 {
-				outputPath = matches[0]
-			}
-		}
-		job.ResultChan <- models.JobResult{
-			Success: err == nil,
-			Error:   err,
-			Path:    outputPath,
-		}
-	})
-
-	mgr.ImageMagickPool = NewWorkerPool(numCPU, func(job models.Job) {
-		outputPath := filepath.Join(job.TempDir, "output.pdf")
-		err := converters.ImageToPDF([]string{job.InputPath}, outputPath)
-		job.ResultChan <- models.JobResult{
-			Success: err == nil,
-			Error:   err,
-			Path:    outputPath,
-		}
-	})
-
-	mgr.PandocPool = NewWorkerPool(numCPU, func(job models.Job) {
-		outputPath := filepath.Join(job.TempDir, "output.pdf")
-		err := converters.PandocConvert(job.InputPath, outputPath)
-		job.ResultChan <- models.JobResult{
-			Success: err == nil,
-			Error:   err,
-			Path:    outputPath,
-		}
-	})
-
-	mgr.GhostscriptPool = NewWorkerPool(numCPU, func(job models.Job) {
-		outputPath := filepath.Join(job.TempDir, "output.pdf")
-		err := converters.CompressPDF(job.InputPath, outputPath)
-		job.ResultChan <- models.JobResult{
-			Success: err == nil,
-			Error:   err,
-			Path:    outputPath,
+// NewEngineManager starts a pool for every compiled engine, or only for the
+// ones named in enabled when it is non-empty. Pools for engines that are not
+// running stay nil; callers treat a nil pool as an unsupported operation.
+func NewEngineManager(numCPU int, enabled []string) *EngineManager {
+	mgr := &EngineManager{pools: map[string]*WorkerPool{}}
+
+	want := map[string]bool{}
+	for _, name := range enabled {
+		if _, ok := engineFactories[name]; !ok {
+			log.Printf("Engine %q requested but not compiled into this binary", name)
 		}
-	})
+		want[name] = true
+	}
 
+	for _, name := range CompiledEngines() {
+		if len(want) > 0 && !want[name] {
+			continue
+		}
+		mgr.pools[name] = engineFactories[name](mgr, numCPU)
+	}
 	return mgr
 }
 
+// Engines lists the engines running in this manager.
+func (m *EngineManager) Engines() []string {
+	names := make([]string, 0, len(m.pools))
+	for name := range m.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Pool returns the running pool of the named engine, or nil.
+func (m *EngineManager) Pool(name string) *WorkerPool {
+	return m.pools[name]
+}
+
 func (m *EngineManager) MergePDFsSync(inputs []string, output string) error {
 	return converters.MergePDFs(inputs, output)
 }
@@ -157,9 +266,7 @@ func (m *EngineManager) ImageToPDFSync(inputs []string, output string) error {
 }
 
 func (m *EngineManager) Start(ctx context.Context) {
-	m.LibreOfficePool.Start(ctx)
-	m.PopplerPool.Start(ctx)
-	m.ImageMagickPool.Start(ctx)
-	m.PandocPool.Start(ctx)
-	m.GhostscriptPool.Start(ctx)
+	for _, pool := range m.pools {
+		pool.Start(ctx)
+	}
 }